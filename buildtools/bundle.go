@@ -68,6 +68,29 @@ func (b AppBundle) WriteInfoPlist() Step {
 	return writeInfoPlist(filepath.Join(b.Path, "Contents", "Info.plist"), b.Info)
 }
 
+// ValidateInfoPlist returns a Step that validates the bundle's Info.plist,
+// any warnings are included in the step's output.
+func (b AppBundle) ValidateInfoPlist() Step {
+	return StepFunc(func(_ context.Context, _ *CommandRunner) (StepResult, error) {
+		var out strings.Builder
+		for _, w := range b.Info.Warnings() {
+			fmt.Fprintf(&out, "warning: %v\n", w)
+		}
+		err := b.Info.Validate()
+		return NewStepResult("validate Info.plist", nil, []byte(out.String()), err), err
+	})
+}
+
+// WritePrivacyManifest returns the step required to validate the privacy
+// manifest and to write it to the app bundle's Resources directory.
+func (b AppBundle) WritePrivacyManifest(pm PrivacyManifest) Step {
+	path := b.Resources(PrivacyManifestFile)
+	if err := pm.Validate(); err != nil {
+		return ErrorStep(fmt.Errorf("invalid privacy manifest: %w", err), "write "+PrivacyManifestFile, path)
+	}
+	return writeInfoPlist(path, pm)
+}
+
 // CopyContents returns the step required to copy a file into the app bundle
 // dst is relative to the bundle Contents root.
 func (b AppBundle) CopyContents(src string, dst ...string) Step {
@@ -100,7 +123,8 @@ func (b AppBundle) ExecutablePath() string {
 }
 
 // InstallProvisioningProfile returns a Step that copies the provisioning profile
-// into the app bundle.
+// into the app bundle. The profile is first validated against the bundle's
+// CFBundleIdentifier, see ValidateProvisioningProfile.
 // See https://developer.apple.com/documentation/technotes/tn3125-inside-code-signing-provisioning-profiles for an explanation of
 // provisioning profiles.
 func (b AppBundle) InstallProvisioningProfile(profile string) Step {
@@ -108,7 +132,13 @@ func (b AppBundle) InstallProvisioningProfile(profile string) Step {
 		return ErrorStep(fmt.Errorf("provisioning profile path not specified"), "cp", profile, "")
 	}
 	dst := filepath.Join(b.Path, "Contents", "embedded.provisionprofile")
-	return Copy(profile, dst)
+	validate := ValidateProvisioningProfile(profile, b.Info.CFBundleIdentifier)
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		if res, err := validate.Run(ctx, cmdRunner); err != nil {
+			return res, err
+		}
+		return Copy(profile, dst).Run(ctx, cmdRunner)
+	})
 }
 
 // Clean returns a Step that removes the app bundle directory and all its contents.
@@ -177,6 +207,12 @@ func (b AppBundle) Sign(signer Signer) Step {
 	return signer.SignPath(b.Path, "")
 }
 
+// SignInsideOut returns the step required to sign all of the code within
+// the app bundle and then the bundle itself, see Signer.SignInsideOut.
+func (b AppBundle) SignInsideOut(signer Signer) Step {
+	return signer.SignInsideOut(b.Path)
+}
+
 func (b AppBundle) VerifySignatures(signer Signer) []Step {
 	steps := []Step{
 		signer.VerifyPath(b.Path, ""),
@@ -184,6 +220,14 @@ func (b AppBundle) VerifySignatures(signer Signer) []Step {
 	return steps
 }
 
+// VerifySignaturesOffline returns the steps required to verify the bundle's
+// signatures without using codesign, see VerifyPathOffline.
+func (b AppBundle) VerifySignaturesOffline() []Step {
+	return []Step{
+		VerifyPathOffline(b.Path, ""),
+	}
+}
+
 func (b AppBundle) SPCtlAsses() Step {
 	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
 		return cmdRunner.Run(ctx, "spctl", "--assess", "--type", "execute", b.Path)
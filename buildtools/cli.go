@@ -70,16 +70,65 @@ type Config struct {
 
 // SigningConfig represents signing related configuration
 // that can be read from a yaml config file.
+// The Backend field selects the signing backend, one of codesign (the
+// default), rcodesign, adhoc, noop or remote, the latter requires that
+// Remote also be set. CodesignArguments are passed to whichever backend
+// is selected and replace its default arguments. HardenedRuntime defaults
+// to true unless CodesignArguments are specified. Options and
+// PerFileOptions are typed alternatives to CodesignArguments that are
+// translated for the selected backend.
 type SigningConfig struct {
-	Identity            string               `yaml:"identity"`
-	CodesignArguments   []string             `yaml:"codesign-args"`
-	Entitlements        *Entitlements        `yaml:"entitlements"`
-	PerFileEntitlements *PerFileEntitlements `yaml:"perfile_entitlements"`
+	Backend             string                 `yaml:"backend,omitempty"`
+	Identity            string                 `yaml:"identity"`
+	CodesignArguments   []string               `yaml:"codesign-args"`
+	HardenedRuntime     *bool                  `yaml:"hardened-runtime,omitempty"`
+	Options             *SigningOptions        `yaml:"options,omitempty"`
+	PerFileOptions      *PerFileSigningOptions `yaml:"perfile_options,omitempty"`
+	Entitlements        *Entitlements          `yaml:"entitlements"`
+	PerFileEntitlements *PerFileEntitlements   `yaml:"perfile_entitlements"`
+	Remote              *RemoteSigningConfig   `yaml:"remote,omitempty"`
 }
 
-// Signer returns a Signer based on the configuration.
+// Signer returns a Signer based on the configuration. If the configured
+// backend is not supported, or the signing options are invalid, the
+// Signer's steps will all return an error.
 func (s SigningConfig) Signer() Signer {
-	return NewSigner(s.Identity, s.Entitlements, s.PerFileEntitlements, s.CodesignArguments)
+	opts := []SignerOption{WithSigningOptions(s.Options, s.PerFileOptions)}
+	if s.HardenedRuntime != nil {
+		opts = append(opts, WithHardenedRuntime(*s.HardenedRuntime))
+	}
+	backend, err := s.backend()
+	if err == nil {
+		opts = append(opts, WithSigningBackend(backend))
+		err = s.validateOptions()
+	}
+	signer := NewSigner(s.Identity, s.Entitlements, s.PerFileEntitlements, s.CodesignArguments, opts...)
+	signer.err = err
+	return signer
+}
+
+func (s SigningConfig) validateOptions() error {
+	if s.Options != nil {
+		if err := s.Options.Validate(); err != nil {
+			return fmt.Errorf("invalid signing options: %w", err)
+		}
+	}
+	if s.PerFileOptions != nil {
+		if err := s.PerFileOptions.Validate(); err != nil {
+			return fmt.Errorf("invalid per-file signing options: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s SigningConfig) backend() (SigningBackend, error) {
+	if s.Backend != SigningBackendRemote {
+		return NewSigningBackend(s.Backend)
+	}
+	if s.Remote == nil {
+		return nil, fmt.Errorf("the %v signing backend requires a remote configuration", s.Backend)
+	}
+	return NewRemoteBackend(*s.Remote)
 }
 
 // PrintResultAndExitOnErrorf prints the results of running steps and exits with a non-zero
@@ -0,0 +1,49 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign
+
+import (
+	"fmt"
+	"os"
+
+	"howett.net/plist"
+)
+
+// bundleInfo contains the Info.plist keys used by this package.
+type bundleInfo struct {
+	identifier  string
+	executable  string
+	packageType string
+	extension   bool // set for app extensions, ie. NSExtension is present.
+}
+
+func readBundleInfo(path string) (bundleInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return bundleInfo{}, err
+	}
+	info, err := parseBundleInfo(data)
+	if err != nil {
+		return bundleInfo{}, fmt.Errorf("%v: %w", path, err)
+	}
+	return info, nil
+}
+
+// parseBundleInfo parses the contents of an Info.plist file.
+func parseBundleInfo(data []byte) (bundleInfo, error) {
+	var raw map[string]any
+	if _, err := plist.Unmarshal(data, &raw); err != nil {
+		return bundleInfo{}, err
+	}
+	var info bundleInfo
+	info.identifier, _ = raw["CFBundleIdentifier"].(string)
+	info.executable, _ = raw["CFBundleExecutable"].(string)
+	info.packageType, _ = raw["CFBundlePackageType"].(string)
+	_, info.extension = raw["NSExtension"]
+	if _, ok := raw["EXAppExtensionAttributes"]; ok {
+		info.extension = true
+	}
+	return info, nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// CodeDirectory represents a parsed CodeDirectory blob.
+type CodeDirectory struct {
+	Version       uint32
+	Flags         CodeDirectoryFlags
+	HashType      HashType
+	HashSize      int
+	PageSize      int // in bytes, 0 means a single page covers the entire file.
+	Platform      uint8
+	Identifier    string
+	TeamID        string
+	CodeLimit     uint64
+	ExecSegBase   uint64
+	ExecSegLimit  uint64
+	ExecSegFlags  ExecSegFlags
+	Runtime       uint32 // the SDK version used to build the binary, if known.
+	NSpecialSlots int
+	NCodeSlots    int
+
+	// SpecialSlots contains the special slot hashes indexed by Slot,
+	// ie. SpecialSlots[SlotEntitlements] is the hash of the entitlements
+	// blob. Index 0 is always nil.
+	SpecialSlots [][]byte
+	// CodeSlots contains the hashes of each page of the code.
+	CodeSlots [][]byte
+	// CDHash is the hash of the CodeDirectory blob truncated
+	// to 20 bytes.
+	CDHash []byte
+	// Raw is the entire CodeDirectory blob.
+	Raw []byte
+}
+
+// HardenedRuntime returns true if the hardened runtime is enabled.
+func (cd *CodeDirectory) HardenedRuntime() bool {
+	return cd.Flags&FlagRuntime != 0
+}
+
+// AdHoc returns true if the CodeDirectory is for an ad-hoc signature.
+func (cd *CodeDirectory) AdHoc() bool {
+	return cd.Flags&FlagAdhoc != 0
+}
+
+// CDHashString returns the hex encoded cdhash.
+func (cd *CodeDirectory) CDHashString() string {
+	return hex.EncodeToString(cd.CDHash)
+}
+
+// SpecialSlot returns the hash stored in the specified special slot
+// and true if that slot is present and is not all zeros.
+func (cd *CodeDirectory) SpecialSlot(slot Slot) ([]byte, bool) {
+	if int(slot) >= len(cd.SpecialSlots) || slot == 0 {
+		return nil, false
+	}
+	h := cd.SpecialSlots[slot]
+	for _, b := range h {
+		if b != 0 {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+func cstring(data []byte, offset uint32) (string, error) {
+	if offset == 0 {
+		return "", nil
+	}
+	if int(offset) >= len(data) {
+		return "", fmt.Errorf("string offset %d out of range (%d)", offset, len(data))
+	}
+	for i := int(offset); i < len(data); i++ {
+		if data[i] == 0 {
+			return string(data[offset:i]), nil
+		}
+	}
+	return "", fmt.Errorf("unterminated string at offset %d", offset)
+}
+
+// cdHeader is the fixed size portion of the CodeDirectory that is
+// present in all versions.
+type cdHeader struct {
+	Magic         uint32
+	Length        uint32
+	Version       uint32
+	Flags         uint32
+	HashOffset    uint32
+	IdentOffset   uint32
+	NSpecialSlots uint32
+	NCodeSlots    uint32
+	CodeLimit     uint32
+	HashSize      uint8
+	HashType      uint8
+	Platform      uint8
+	PageSize      uint8
+	Spare2        uint32
+}
+
+const cdHeaderSize = 44
+
+// ParseCodeDirectory parses a CodeDirectory blob.
+func ParseCodeDirectory(data []byte) (*CodeDirectory, error) {
+	if len(data) < cdHeaderSize {
+		return nil, fmt.Errorf("code directory too short: %d bytes", len(data))
+	}
+	be := binary.BigEndian
+	hdr := cdHeader{
+		Magic:         be.Uint32(data[0:]),
+		Length:        be.Uint32(data[4:]),
+		Version:       be.Uint32(data[8:]),
+		Flags:         be.Uint32(data[12:]),
+		HashOffset:    be.Uint32(data[16:]),
+		IdentOffset:   be.Uint32(data[20:]),
+		NSpecialSlots: be.Uint32(data[24:]),
+		NCodeSlots:    be.Uint32(data[28:]),
+		CodeLimit:     be.Uint32(data[32:]),
+		HashSize:      data[36],
+		HashType:      data[37],
+		Platform:      data[38],
+		PageSize:      data[39],
+	}
+	if hdr.Magic != MagicCodeDirectory {
+		return nil, fmt.Errorf("bad code directory magic: %#x", hdr.Magic)
+	}
+	if int(hdr.Length) > len(data) {
+		return nil, fmt.Errorf("code directory length %d exceeds available data %d", hdr.Length, len(data))
+	}
+	data = data[:hdr.Length]
+	cd := &CodeDirectory{
+		Version:       hdr.Version,
+		Flags:         CodeDirectoryFlags(hdr.Flags),
+		HashType:      HashType(hdr.HashType),
+		HashSize:      int(hdr.HashSize),
+		Platform:      hdr.Platform,
+		NSpecialSlots: int(hdr.NSpecialSlots),
+		NCodeSlots:    int(hdr.NCodeSlots),
+		CodeLimit:     uint64(hdr.CodeLimit),
+		Raw:           data,
+	}
+	if hdr.PageSize != 0 {
+		cd.PageSize = 1 << hdr.PageSize
+	}
+	if err := cd.parseVersionedFields(data); err != nil {
+		return nil, err
+	}
+	var err error
+	if cd.Identifier, err = cstring(data, hdr.IdentOffset); err != nil {
+		return nil, fmt.Errorf("identifier: %w", err)
+	}
+	if err := cd.parseHashes(data, hdr.HashOffset); err != nil {
+		return nil, err
+	}
+	if cd.HashType.New() != nil {
+		cd.CDHash = cd.HashType.Sum(data)[:cdHashSize]
+	}
+	return cd, nil
+}
+
+func (cd *CodeDirectory) parseVersionedFields(data []byte) error {
+	be := binary.BigEndian
+	field32 := func(off int) uint32 {
+		if off+4 > len(data) {
+			return 0
+		}
+		return be.Uint32(data[off:])
+	}
+	field64 := func(off int) uint64 {
+		if off+8 > len(data) {
+			return 0
+		}
+		return be.Uint64(data[off:])
+	}
+	// scatterOffset is at 44 and is ignored.
+	if cd.Version >= versionTeamID {
+		team, err := cstring(data, field32(48))
+		if err != nil {
+			return fmt.Errorf("team id: %w", err)
+		}
+		cd.TeamID = team
+	}
+	if cd.Version >= versionCodeLimit64 {
+		if cl := field64(56); cl != 0 {
+			cd.CodeLimit = cl
+		}
+	}
+	if cd.Version >= versionExecSeg {
+		cd.ExecSegBase = field64(64)
+		cd.ExecSegLimit = field64(72)
+		cd.ExecSegFlags = ExecSegFlags(field64(80))
+	}
+	if cd.Version >= versionRuntime {
+		cd.Runtime = field32(88)
+	}
+	return nil
+}
+
+func (cd *CodeDirectory) parseHashes(data []byte, hashOffset uint32) error {
+	hs := cd.HashSize
+	start := int(hashOffset) - cd.NSpecialSlots*hs
+	end := int(hashOffset) + cd.NCodeSlots*hs
+	if hs == 0 || start < 0 || end > len(data) {
+		return fmt.Errorf("hash slots [%d:%d] out of range (%d)", start, end, len(data))
+	}
+	cd.SpecialSlots = make([][]byte, cd.NSpecialSlots+1)
+	for i := 1; i <= cd.NSpecialSlots; i++ {
+		off := int(hashOffset) - i*hs
+		cd.SpecialSlots[i] = data[off : off+hs]
+	}
+	cd.CodeSlots = make([][]byte, cd.NCodeSlots)
+	for i := range cd.NCodeSlots {
+		off := int(hashOffset) + i*hs
+		cd.CodeSlots[i] = data[off : off+hs]
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Package codesign provides pure Go support for reading the embedded
+// code signatures found in Mach-O files, that is, the data referenced by
+// the LC_CODE_SIGNATURE load command, and for verifying those signatures and
+// the resources sealed by them, as well as for creating ad-hoc signatures
+// for Mach-O files and application bundles and for determining the order
+// in which the code nested within a bundle must be signed. It does not
+// depend on the macOS codesign command and hence can be used on any
+// platform.
+//
+// The constants and structure layouts are derived from xnu's
+// osfmk/kern/cs_blobs.h.
+package codesign
+
+import (
+	"crypto/sha1" //nolint:gosec // G505, SHA1 is part of the code signing format.
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Magic numbers used to identify the blobs within a code signature.
+const (
+	MagicRequirement             uint32 = 0xfade0c00 // single Requirement blob
+	MagicRequirements            uint32 = 0xfade0c01 // Requirements vector (internal requirements)
+	MagicCodeDirectory           uint32 = 0xfade0c02 // CodeDirectory blob
+	MagicEmbeddedSignature       uint32 = 0xfade0cc0 // embedded form of signature data
+	MagicDetachedSignature       uint32 = 0xfade0cc1 // multi-arch collection of embedded signatures
+	MagicBlobWrapper             uint32 = 0xfade0b01 // CMS signature, among other things
+	MagicEmbeddedEntitlements    uint32 = 0xfade7171 // embedded entitlements (XML plist)
+	MagicEmbeddedDEREntitlements uint32 = 0xfade7172 // embedded entitlements (DER)
+)
+
+// Slot is the type of a blob within a SuperBlob and is also used
+// to index the special slots of a CodeDirectory.
+type Slot uint32
+
+// Slot types, see cs_blobs.h.
+const (
+	SlotCodeDirectory            Slot = 0
+	SlotInfo                     Slot = 1
+	SlotRequirements             Slot = 2
+	SlotResourceDir              Slot = 3
+	SlotApplication              Slot = 4
+	SlotEntitlements             Slot = 5
+	SlotRepSpecific              Slot = 6
+	SlotEntitlementsDER          Slot = 7
+	SlotAlternateCodeDirectories Slot = 0x1000
+	SlotSignature                Slot = 0x10000
+)
+
+// String implements fmt.Stringer.
+func (s Slot) String() string {
+	switch s {
+	case SlotCodeDirectory:
+		return "CodeDirectory"
+	case SlotInfo:
+		return "Info.plist"
+	case SlotRequirements:
+		return "Requirements"
+	case SlotResourceDir:
+		return "CodeResources"
+	case SlotApplication:
+		return "Application"
+	case SlotEntitlements:
+		return "Entitlements"
+	case SlotRepSpecific:
+		return "RepSpecific"
+	case SlotEntitlementsDER:
+		return "EntitlementsDER"
+	case SlotSignature:
+		return "Signature"
+	}
+	if s >= SlotAlternateCodeDirectories && s < SlotAlternateCodeDirectories+5 {
+		return fmt.Sprintf("AlternateCodeDirectory(%d)", s-SlotAlternateCodeDirectories)
+	}
+	return fmt.Sprintf("Slot(%#x)", uint32(s))
+}
+
+// HashType is the type of hash used by a CodeDirectory.
+type HashType uint8
+
+// Hash types, see cs_blobs.h.
+const (
+	HashNone            HashType = 0
+	HashSHA1            HashType = 1
+	HashSHA256          HashType = 2
+	HashSHA256Truncated HashType = 3
+	HashSHA384          HashType = 4
+)
+
+// String implements fmt.Stringer.
+func (h HashType) String() string {
+	switch h {
+	case HashSHA1:
+		return "sha1"
+	case HashSHA256:
+		return "sha256"
+	case HashSHA256Truncated:
+		return "sha256-truncated"
+	case HashSHA384:
+		return "sha384"
+	}
+	return fmt.Sprintf("HashType(%d)", uint8(h))
+}
+
+// New returns a new hash.Hash for the hash type or nil if the
+// hash type is not supported.
+func (h HashType) New() hash.Hash {
+	switch h {
+	case HashSHA1:
+		return sha1.New() //nolint:gosec // G401
+	case HashSHA256, HashSHA256Truncated:
+		return sha256.New()
+	case HashSHA384:
+		return sha512.New384()
+	}
+	return nil
+}
+
+// Size returns the size, in bytes, of hashes of this type as stored
+// in a CodeDirectory.
+func (h HashType) Size() int {
+	switch h {
+	case HashSHA1, HashSHA256Truncated:
+		return 20
+	case HashSHA256:
+		return 32
+	case HashSHA384:
+		return 48
+	}
+	return 0
+}
+
+// Sum returns the hash of data truncated to the size used within
+// a CodeDirectory.
+func (h HashType) Sum(data []byte) []byte {
+	hf := h.New()
+	if hf == nil {
+		return nil
+	}
+	hf.Write(data)
+	return hf.Sum(nil)[:h.Size()]
+}
+
+// CodeDirectoryFlags represents the flags field of a CodeDirectory.
+type CodeDirectoryFlags uint32
+
+// CodeDirectory flags, see cs_blobs.h.
+const (
+	FlagValid                    CodeDirectoryFlags = 0x00000001
+	FlagAdhoc                    CodeDirectoryFlags = 0x00000002
+	FlagGetTaskAllow             CodeDirectoryFlags = 0x00000004
+	FlagInstaller                CodeDirectoryFlags = 0x00000008
+	FlagForcedLibraryValidation  CodeDirectoryFlags = 0x00000010
+	FlagInvalidAllowed           CodeDirectoryFlags = 0x00000020
+	FlagHard                     CodeDirectoryFlags = 0x00000100
+	FlagKill                     CodeDirectoryFlags = 0x00000200
+	FlagCheckExpiration          CodeDirectoryFlags = 0x00000400
+	FlagRestrict                 CodeDirectoryFlags = 0x00000800
+	FlagEnforcement              CodeDirectoryFlags = 0x00001000
+	FlagRequireLibraryValidation CodeDirectoryFlags = 0x00002000
+	FlagRuntime                  CodeDirectoryFlags = 0x00010000
+	FlagLinkerSigned             CodeDirectoryFlags = 0x00020000
+)
+
+var flagNames = []struct {
+	flag CodeDirectoryFlags
+	name string
+}{
+	{FlagValid, "valid"},
+	{FlagAdhoc, "adhoc"},
+	{FlagGetTaskAllow, "get-task-allow"},
+	{FlagInstaller, "installer"},
+	{FlagForcedLibraryValidation, "forced-lv"},
+	{FlagInvalidAllowed, "invalid-allowed"},
+	{FlagHard, "hard"},
+	{FlagKill, "kill"},
+	{FlagCheckExpiration, "check-expiration"},
+	{FlagRestrict, "restrict"},
+	{FlagEnforcement, "enforcement"},
+	{FlagRequireLibraryValidation, "library"},
+	{FlagRuntime, "runtime"},
+	{FlagLinkerSigned, "linker-signed"},
+}
+
+// String implements fmt.Stringer. The names used are those
+// used by codesign --display where possible.
+func (f CodeDirectoryFlags) String() string {
+	var names []string
+	for _, fn := range flagNames {
+		if f&fn.flag != 0 {
+			names = append(names, fn.name)
+			f &^= fn.flag
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(f)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// ExecSegFlags represents the execSegFlags field of a CodeDirectory.
+type ExecSegFlags uint64
+
+// Executable segment flags, see cs_blobs.h.
+const (
+	ExecSegMainBinary    ExecSegFlags = 0x1
+	ExecSegAllowUnsigned ExecSegFlags = 0x10
+	ExecSegDebugger      ExecSegFlags = 0x20
+	ExecSegJIT           ExecSegFlags = 0x40
+	ExecSegSkipLV        ExecSegFlags = 0x80
+	ExecSegCanLoadCDHash ExecSegFlags = 0x100
+	ExecSegCanExecCDHash ExecSegFlags = 0x200
+)
+
+// CodeDirectory versions that introduced new fields.
+const (
+	versionScatter     uint32 = 0x20100
+	versionTeamID      uint32 = 0x20200
+	versionCodeLimit64 uint32 = 0x20300
+	versionExecSeg     uint32 = 0x20400
+	versionRuntime     uint32 = 0x20500
+	versionLinkage     uint32 = 0x20600
+)
+
+// lcCodeSignature is the Mach-O LC_CODE_SIGNATURE load command.
+const lcCodeSignature = 0x1d
+
+// cdHashSize is the size of a cdhash, hashes are truncated to this size.
+const cdHashSize = 20
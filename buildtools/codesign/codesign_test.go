@@ -0,0 +1,268 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/macho"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloudeng.io/macos/buildtools/codesign"
+)
+
+var (
+	// signedBinary is a darwin/arm64 binary that is ad-hoc signed by
+	// the go linker.
+	signedBinary string
+	// unsignedBinary is a darwin/amd64 binary that the go linker
+	// does not sign.
+	unsignedBinary string
+)
+
+func buildDarwinBinary(dir, arch string) string {
+	bin := filepath.Join(dir, "hello-"+arch)
+	cmd := exec.Command("go", "build", "-ldflags=-s -w", "-o", bin, filepath.Join("testdata", "hello.go"))
+	cmd.Env = append(os.Environ(), "GOOS=darwin", "GOARCH="+arch, "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		panic(string(out) + ": " + err.Error())
+	}
+	return bin
+}
+
+func TestMain(m *testing.M) {
+	tmpDir, err := os.MkdirTemp("", "codesign-test")
+	if err != nil {
+		panic(err)
+	}
+	signedBinary = buildDarwinBinary(tmpDir, "arm64")
+	unsignedBinary = buildDarwinBinary(tmpDir, "amd64")
+	code := m.Run()
+	os.RemoveAll(tmpDir)
+	os.Exit(code)
+}
+
+func TestParseLinkerSigned(t *testing.T) {
+	slices, err := codesign.ParseFile(signedBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(slices), 1; got != want {
+		t.Fatalf("got %d slices, want %d", got, want)
+	}
+	s := slices[0]
+	if got, want := s.CPU, macho.CpuArm64; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !s.Signed() {
+		t.Fatal("expected a signature")
+	}
+	cd := s.Signature.CodeDirectory
+	if got, want := cd.Identifier, "a.out"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := cd.Flags, codesign.FlagAdhoc|codesign.FlagLinkerSigned; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := cd.Flags.String(), "adhoc,linker-signed"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if cd.HardenedRuntime() || !cd.AdHoc() {
+		t.Errorf("unexpected flags: %v", cd.Flags)
+	}
+	if got, want := cd.HashType, codesign.HashSHA256; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := cd.CodeLimit, uint64(s.SignatureOffset); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := cd.ExecSegFlags, codesign.ExecSegMainBinary; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(cd.CDHash), 20; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if s.Signature.Entitlements != nil || s.Signature.Requirements != nil {
+		t.Errorf("unexpected entitlements or requirements")
+	}
+
+	// The page hashes must match the contents of the file.
+	data, err := os.ReadFile(signedBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cd.NCodeSlots, (int(cd.CodeLimit)+cd.PageSize-1)/cd.PageSize; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, h := range cd.CodeSlots {
+		end := min((i+1)*cd.PageSize, int(cd.CodeLimit))
+		sum := sha256.Sum256(data[i*cd.PageSize : end])
+		if !bytes.Equal(h, sum[:]) {
+			t.Fatalf("page %d: hash mismatch", i)
+		}
+	}
+}
+
+func TestParseUnsigned(t *testing.T) {
+	slices, err := codesign.ParseFile(unsignedBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(slices), 1; got != want {
+		t.Fatalf("got %d slices, want %d", got, want)
+	}
+	if slices[0].Signed() {
+		t.Errorf("expected no signature")
+	}
+	if got, want := slices[0].CPU, macho.CpuAmd64; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestIsMachO(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		want bool
+	}{
+		{signedBinary, true},
+		{unsignedBinary, true},
+		{filepath.Join("testdata", "hello.go"), false},
+	} {
+		got, err := codesign.IsMachOFile(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%v: got %v, want %v", tc.path, got, tc.want)
+		}
+	}
+	if _, err := codesign.ParseFile(filepath.Join("testdata", "hello.go")); err == nil {
+		t.Errorf("expected an error")
+	}
+	// A java class file.
+	if codesign.IsMachO([]byte{0xca, 0xfe, 0xba, 0xbe, 0x00, 0x00, 0x00, 0x34}) {
+		t.Errorf("java class file detected as Mach-O")
+	}
+}
+
+func TestDEREntitlements(t *testing.T) {
+	der, err := hex.DecodeString("7050020101b04b30230c1e636f6d2e6170706c652e73656375726974792e6170702d73616e64626f780101ff30240c166b6579636861696e2d6163636573732d67726f757073300a0c03412e620c03412e2a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ent, err := codesign.DecodeDEREntitlements(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"com.apple.security.app-sandbox": true,
+		"keychain-access-groups":         []any{"A.b", "A.*"},
+	}
+	if !reflect.DeepEqual(ent, want) {
+		t.Errorf("got %v, want %v", ent, want)
+	}
+	if _, err := codesign.DecodeDEREntitlements(der[:10]); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func blob(magic uint32, data []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, magic)
+	out = binary.BigEndian.AppendUint32(out, uint32(8+len(data)))
+	return append(out, data...)
+}
+
+func superBlob(blobs map[codesign.Slot][]byte, order ...codesign.Slot) []byte {
+	hdr := 12 + 8*len(order)
+	out := binary.BigEndian.AppendUint32(nil, codesign.MagicEmbeddedSignature)
+	out = binary.BigEndian.AppendUint32(out, 0)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(order)))
+	var body []byte
+	for _, slot := range order {
+		out = binary.BigEndian.AppendUint32(out, uint32(slot))
+		out = binary.BigEndian.AppendUint32(out, uint32(hdr+len(body)))
+		body = append(body, blobs[slot]...)
+	}
+	out = append(out, body...)
+	binary.BigEndian.PutUint32(out[4:], uint32(len(out)))
+	return out
+}
+
+func TestParseSignature(t *testing.T) {
+	slices, err := codesign.ParseFile(signedBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := slices[0].Signature.CodeDirectory.Raw
+	xml := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict><key>com.apple.security.app-sandbox</key><true/></dict></plist>`)
+	der, _ := hex.DecodeString("7050020101b04b30230c1e636f6d2e6170706c652e73656375726974792e6170702d73616e64626f780101ff30240c166b6579636861696e2d6163636573732d67726f757073300a0c03412e620c03412e2a")
+	// A requirements set containing a single designated requirement
+	// whose contents are not interpreted.
+	req := blob(codesign.MagicRequirement, []byte{0, 0, 0, 1, 0, 0, 0, 0})
+	reqs := binary.BigEndian.AppendUint32(nil, uint32(codesign.DesignatedRequirementType))
+	reqs = binary.BigEndian.AppendUint32(reqs, 20)
+	reqs = blob(codesign.MagicRequirements, append(binary.BigEndian.AppendUint32(nil, 1), append(reqs, req...)...))
+
+	raw := superBlob(map[codesign.Slot][]byte{
+		codesign.SlotCodeDirectory:   cd,
+		codesign.SlotRequirements:    reqs,
+		codesign.SlotEntitlements:    blob(codesign.MagicEmbeddedEntitlements, xml),
+		codesign.SlotEntitlementsDER: blob(codesign.MagicEmbeddedDEREntitlements, der),
+		codesign.SlotSignature:       blob(codesign.MagicBlobWrapper, nil),
+	}, codesign.SlotCodeDirectory, codesign.SlotRequirements, codesign.SlotEntitlements,
+		codesign.SlotEntitlementsDER, codesign.SlotSignature)
+
+	sig, err := codesign.ParseSignature(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(sig.Index), 5; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	ent, err := sig.EntitlementsMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ent, map[string]any{"com.apple.security.app-sandbox": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	dent, err := sig.EntitlementsDERMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(dent), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(sig.Requirements.Entries), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := sig.Requirements.Entries[0].Type, codesign.DesignatedRequirementType; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if sig.CMS == nil || len(sig.CMS) != 0 {
+		t.Errorf("expected an empty CMS blob")
+	}
+	if b, ok := sig.Blob(codesign.SlotRequirements); !ok || !bytes.Equal(b, reqs) {
+		t.Errorf("requirements blob mismatch")
+	}
+
+	// Truncated signatures must be rejected.
+	if _, err := codesign.ParseSignature(raw[:len(raw)-4]); err == nil {
+		t.Errorf("expected an error")
+	}
+	// As must SuperBlobs whose length does not cover their header.
+	short := []byte{0xfa, 0xde, 0x0c, 0xc0, 0, 0, 0, 4, 0, 0, 0, 0}
+	if _, err := codesign.ParseSignature(short); err == nil || !strings.Contains(err.Error(), "invalid length 4") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// The DER encoding of entitlements used by Apple is:
+//
+//	[APPLICATION 16] {
+//	   INTEGER 1 -- version
+//	   [CONTEXT 16] { -- dictionary
+//	       SEQUENCE { UTF8String key, value }...
+//	   }
+//	}
+//
+// where value is one of BOOLEAN, INTEGER, UTF8String, SEQUENCE (an array)
+// or a nested dictionary.
+const derDictTag = 16
+
+// EntitlementsDERMap returns the DER entitlements as a map.
+func (s *Signature) EntitlementsDERMap() (map[string]any, error) {
+	if len(s.EntitlementsDER) == 0 {
+		return nil, nil
+	}
+	return DecodeDEREntitlements(s.EntitlementsDER)
+}
+
+// DecodeDEREntitlements decodes DER encoded entitlements.
+func DecodeDEREntitlements(data []byte) (map[string]any, error) {
+	var outer asn1.RawValue
+	if _, err := asn1.Unmarshal(data, &outer); err != nil {
+		return nil, fmt.Errorf("der entitlements: %w", err)
+	}
+	if outer.Class != asn1.ClassApplication || outer.Tag != derDictTag {
+		return nil, fmt.Errorf("der entitlements: unexpected outer tag: class %d, tag %d", outer.Class, outer.Tag)
+	}
+	var version int
+	rest, err := asn1.Unmarshal(outer.Bytes, &version)
+	if err != nil {
+		return nil, fmt.Errorf("der entitlements: version: %w", err)
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("der entitlements: unsupported version: %d", version)
+	}
+	var dict asn1.RawValue
+	if _, err := asn1.Unmarshal(rest, &dict); err != nil {
+		return nil, fmt.Errorf("der entitlements: %w", err)
+	}
+	v, err := decodeDERValue(dict)
+	if err != nil {
+		return nil, fmt.Errorf("der entitlements: %w", err)
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("der entitlements: top level value is not a dictionary")
+	}
+	return m, nil
+}
+
+func decodeDERValue(rv asn1.RawValue) (any, error) {
+	switch {
+	case rv.Class == asn1.ClassContextSpecific && rv.Tag == derDictTag:
+		return decodeDERDict(rv.Bytes)
+	case rv.Class != asn1.ClassUniversal:
+		return nil, fmt.Errorf("unexpected tag: class %d, tag %d", rv.Class, rv.Tag)
+	}
+	switch rv.Tag {
+	case asn1.TagBoolean:
+		var b bool
+		_, err := asn1.Unmarshal(rv.FullBytes, &b)
+		return b, err
+	case asn1.TagInteger:
+		var i *big.Int
+		if _, err := asn1.Unmarshal(rv.FullBytes, &i); err != nil {
+			return nil, err
+		}
+		if !i.IsInt64() {
+			return nil, fmt.Errorf("integer out of range: %v", i)
+		}
+		return i.Int64(), nil
+	case asn1.TagUTF8String:
+		return string(rv.Bytes), nil
+	case asn1.TagSequence:
+		return decodeDERArray(rv.Bytes)
+	}
+	return nil, fmt.Errorf("unsupported tag: %d", rv.Tag)
+}
+
+func decodeDERArray(data []byte) ([]any, error) {
+	arr := []any{}
+	for len(data) > 0 {
+		var rv asn1.RawValue
+		rest, err := asn1.Unmarshal(data, &rv)
+		if err != nil {
+			return nil, err
+		}
+		v, err := decodeDERValue(rv)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+		data = rest
+	}
+	return arr, nil
+}
+
+func decodeDERDict(data []byte) (map[string]any, error) {
+	dict := map[string]any{}
+	for len(data) > 0 {
+		var entry asn1.RawValue
+		rest, err := asn1.Unmarshal(data, &entry)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Class != asn1.ClassUniversal || entry.Tag != asn1.TagSequence {
+			return nil, fmt.Errorf("dictionary entry is not a sequence")
+		}
+		var key asn1.RawValue
+		vrest, err := asn1.Unmarshal(entry.Bytes, &key)
+		if err != nil {
+			return nil, err
+		}
+		if key.Tag != asn1.TagUTF8String {
+			return nil, fmt.Errorf("dictionary key is not a string")
+		}
+		var val asn1.RawValue
+		if _, err := asn1.Unmarshal(vrest, &val); err != nil {
+			return nil, fmt.Errorf("%s: %w", key.Bytes, err)
+		}
+		v, err := decodeDERValue(val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key.Bytes, err)
+		}
+		dict[string(key.Bytes)] = v
+		data = rest
+	}
+	return dict, nil
+}
+
+// EncodeDEREntitlements encodes entitlements using the DER format
+// described above. Dictionary keys are sorted as required by DER.
+func EncodeDEREntitlements(ent map[string]any) ([]byte, error) {
+	dict, err := encodeDERDict(ent)
+	if err != nil {
+		return nil, fmt.Errorf("der entitlements: %w", err)
+	}
+	version, err := asn1.Marshal(1)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassApplication,
+		Tag:        derDictTag,
+		IsCompound: true,
+		Bytes:      append(version, dict...),
+	})
+}
+
+func encodeDERValue(v any) ([]byte, error) {
+	switch val := v.(type) {
+	case bool:
+		return asn1.Marshal(val)
+	case string:
+		return asn1.MarshalWithParams(val, "utf8")
+	case int:
+		return asn1.Marshal(int64(val))
+	case int64:
+		return asn1.Marshal(val)
+	case uint64:
+		return asn1.Marshal(new(big.Int).SetUint64(val))
+	case []any:
+		return encodeDERArray(val)
+	case map[string]any:
+		return encodeDERDict(val)
+	}
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+func encodeDERArray(arr []any) ([]byte, error) {
+	var content []byte
+	for _, v := range arr {
+		enc, err := encodeDERValue(v)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, enc...)
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: content})
+}
+
+func encodeDERDict(dict map[string]any) ([]byte, error) {
+	keys := make([]string, 0, len(dict))
+	for k := range dict {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var content []byte
+	for _, k := range keys {
+		key, err := asn1.MarshalWithParams(k, "utf8")
+		if err != nil {
+			return nil, err
+		}
+		val, err := encodeDERValue(dict[k])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", k, err)
+		}
+		entry, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: append(key, val...)})
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, entry...)
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: derDictTag, IsCompound: true, Bytes: content})
+}
@@ -0,0 +1,224 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+)
+
+// Sign creates an ad-hoc signature for every slice in the supplied thin
+// or universal Mach-O file and returns the signed file. Any existing
+// signature is replaced. If there is no existing signature an
+// LC_CODE_SIGNATURE load command is added, which requires that there
+// is sufficient space following the existing load commands.
+func Sign(data []byte, opts SignOptions) ([]byte, error) {
+	if !IsMachO(data) {
+		return nil, ErrNotMachO
+	}
+	sb, err := newSignatureBuilder(opts)
+	if err != nil {
+		return nil, err
+	}
+	switch binary.BigEndian.Uint32(data) {
+	case magicFat:
+		return signFat(data, sb)
+	case magicFat64:
+		return nil, fmt.Errorf("64 bit universal files are not supported")
+	}
+	return signSlice(data, sb)
+}
+
+const (
+	fatHeaderSize = 8
+	fatArchSize   = 20
+)
+
+type fatArch struct {
+	cpu, subCPU, offset, size, align uint32
+}
+
+func signFat(data []byte, sb *signatureBuilder) ([]byte, error) {
+	be := binary.BigEndian
+	n := be.Uint32(data[4:])
+	if fatHeaderSize+int(n)*fatArchSize > len(data) {
+		return nil, fmt.Errorf("truncated universal header")
+	}
+	arches := make([]fatArch, n)
+	slices := make([][]byte, n)
+	for i := range arches {
+		off := fatHeaderSize + i*fatArchSize
+		a := fatArch{
+			cpu:    be.Uint32(data[off:]),
+			subCPU: be.Uint32(data[off+4:]),
+			offset: be.Uint32(data[off+8:]),
+			size:   be.Uint32(data[off+12:]),
+			align:  be.Uint32(data[off+16:]),
+		}
+		if uint64(a.offset)+uint64(a.size) > uint64(len(data)) || a.align > 31 {
+			return nil, fmt.Errorf("slice %d: invalid offset, size or alignment", i)
+		}
+		signed, err := signSlice(data[a.offset:a.offset+a.size], sb)
+		if err != nil {
+			return nil, fmt.Errorf("slice %d: %w", i, err)
+		}
+		arches[i], slices[i] = a, signed
+	}
+	out := be.AppendUint32(nil, magicFat)
+	out = be.AppendUint32(out, n)
+	offset := uint64(fatHeaderSize + int(n)*fatArchSize)
+	for i := range arches {
+		a := &arches[i]
+		offset = alignUp(offset, 1<<a.align)
+		a.offset, a.size = uint32(offset), uint32(len(slices[i]))
+		for _, v := range []uint32{a.cpu, a.subCPU, a.offset, a.size, a.align} {
+			out = be.AppendUint32(out, v)
+		}
+		offset += uint64(len(slices[i]))
+	}
+	for i, a := range arches {
+		out = append(out, make([]byte, int(a.offset)-len(out))...)
+		out = append(out, slices[i]...)
+	}
+	return out, nil
+}
+
+func alignUp(v, align uint64) uint64 {
+	return (v + align - 1) &^ (align - 1)
+}
+
+// machoLayout records the locations within a thin Mach-O file that
+// need to be updated when adding or replacing a code signature.
+type machoLayout struct {
+	file        *macho.File
+	bo          binary.ByteOrder
+	headerSize  int
+	sizeofcmds  int
+	codeSigCmd  int // offset of LC_CODE_SIGNATURE, or 0 if there is none.
+	sigOffset   uint64
+	linkeditCmd int // offset of the __LINKEDIT segment command.
+	firstData   uint64
+	text        *macho.Segment
+	linkedit    *macho.Segment
+}
+
+const (
+	lcSegment   = 0x1
+	lcSegment64 = 0x19
+)
+
+func newMachoLayout(data []byte) (*machoLayout, error) {
+	f, err := macho.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	l := &machoLayout{file: f, bo: f.ByteOrder, headerSize: 28, firstData: uint64(len(data))}
+	if f.Magic == macho.Magic64 {
+		l.headerSize = 32
+	}
+	l.sizeofcmds = int(f.Cmdsz)
+	off := l.headerSize
+	for _, load := range f.Loads {
+		raw := load.Raw()
+		cmd := l.bo.Uint32(raw)
+		switch cmd {
+		case lcCodeSignature:
+			l.codeSigCmd = off
+			l.sigOffset = uint64(l.bo.Uint32(raw[8:]))
+		case lcSegment, lcSegment64:
+			seg := load.(*macho.Segment)
+			l.segment(seg, off)
+		}
+		off += len(raw)
+	}
+	for _, s := range f.Sections {
+		if s.Offset != 0 && uint64(s.Offset) < l.firstData {
+			l.firstData = uint64(s.Offset)
+		}
+	}
+	if l.linkedit == nil || l.text == nil {
+		return nil, fmt.Errorf("missing __TEXT or __LINKEDIT segment")
+	}
+	return l, nil
+}
+
+func (l *machoLayout) segment(seg *macho.Segment, off int) {
+	switch seg.Name {
+	case "__TEXT":
+		l.text = seg
+	case "__LINKEDIT":
+		l.linkedit = seg
+		l.linkeditCmd = off
+	}
+}
+
+// codeLimit returns the offset at which the signature will be placed.
+func (l *machoLayout) codeLimit(size int) (uint64, error) {
+	if l.codeSigCmd != 0 {
+		if l.sigOffset > uint64(size) {
+			return 0, fmt.Errorf("existing code signature is beyond the end of the file")
+		}
+		return l.sigOffset, nil
+	}
+	end := l.linkedit.Offset + l.linkedit.Filesz
+	if end != uint64(size) {
+		return 0, fmt.Errorf("__LINKEDIT segment does not extend to the end of the file")
+	}
+	if l.headerSize+l.sizeofcmds+16 > int(l.firstData) {
+		return 0, fmt.Errorf("insufficient space to add an LC_CODE_SIGNATURE load command")
+	}
+	return alignUp(end, 16), nil
+}
+
+// update rewrites the header and load commands in data for a signature
+// of sigSize bytes located at codeLimit.
+func (l *machoLayout) update(data []byte, codeLimit uint64, sigSize int) {
+	bo := l.bo
+	if l.codeSigCmd == 0 {
+		l.codeSigCmd = l.headerSize + l.sizeofcmds
+		bo.PutUint32(data[l.codeSigCmd:], lcCodeSignature)
+		bo.PutUint32(data[l.codeSigCmd+4:], 16)
+		bo.PutUint32(data[16:], l.file.Ncmd+1)
+		bo.PutUint32(data[20:], uint32(l.sizeofcmds+16))
+	}
+	bo.PutUint32(data[l.codeSigCmd+8:], uint32(codeLimit))
+	bo.PutUint32(data[l.codeSigCmd+12:], uint32(sigSize))
+
+	filesz := codeLimit + uint64(sigSize) - l.linkedit.Offset
+	vmsz := max(l.linkedit.Memsz, alignUp(filesz, 0x4000))
+	off := l.linkeditCmd
+	if l.file.Magic == macho.Magic64 {
+		bo.PutUint64(data[off+32:], vmsz)
+		bo.PutUint64(data[off+48:], filesz)
+		return
+	}
+	bo.PutUint32(data[off+28:], uint32(vmsz))
+	bo.PutUint32(data[off+36:], uint32(filesz))
+}
+
+func signSlice(data []byte, sb *signatureBuilder) ([]byte, error) {
+	l, err := newMachoLayout(data)
+	if err != nil {
+		return nil, err
+	}
+	codeLimit, err := l.codeLimit(len(data))
+	if err != nil {
+		return nil, err
+	}
+	sigSize := sb.size(int(codeLimit))
+	out := make([]byte, int(codeLimit)+sigSize)
+	copy(out, data[:min(uint64(len(data)), codeLimit)])
+	l.update(out, codeLimit, sigSize)
+	var flags ExecSegFlags
+	if l.file.Type == macho.TypeExec {
+		flags = ExecSegMainBinary
+	}
+	code := out[:codeLimit]
+	sig := sb.build(code, sigSize, l.text.Offset, l.text.Filesz, flags)
+	copy(out[codeLimit:], sig)
+	return out, nil
+}
@@ -0,0 +1,266 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Slice represents a single architecture within a, possibly universal,
+// Mach-O file.
+type Slice struct {
+	CPU    macho.Cpu
+	SubCPU uint32
+	Type   macho.Type
+	// Offset and Size are the location of the slice within the file.
+	Offset int64
+	Size   int64
+	// SignatureOffset and SignatureSize are the location of the code
+	// signature relative to the start of the slice, as recorded in the
+	// LC_CODE_SIGNATURE load command.
+	SignatureOffset uint32
+	SignatureSize   uint32
+	// Signature is nil for unsigned slices.
+	Signature *Signature
+}
+
+// Signed returns true if the slice has an embedded signature.
+func (s Slice) Signed() bool {
+	return s.Signature != nil
+}
+
+// Arch returns the architecture name of the slice as used by the
+// macOS command line tools, eg. arm64, arm64e or x86_64.
+func (s Slice) Arch() string {
+	switch s.CPU {
+	case macho.CpuArm64:
+		if s.SubCPU&^cpuSubtypeMask == cpuSubtypeArm64E {
+			return "arm64e"
+		}
+		return "arm64"
+	case macho.CpuAmd64:
+		return "x86_64"
+	case macho.Cpu386:
+		return "i386"
+	case macho.CpuArm:
+		return "arm"
+	}
+	return s.CPU.String()
+}
+
+const (
+	cpuSubtypeMask   = 0xff000000
+	cpuSubtypeArm64E = 2
+)
+
+// ErrNotMachO is returned when a file is not a Mach-O file.
+var ErrNotMachO = errors.New("not a Mach-O file")
+
+const (
+	magicFat   = 0xcafebabe
+	magicFat64 = 0xcafebabf
+	// Java class files share the fat magic number, but Java class
+	// version numbers are always much larger than the number of
+	// architectures in a universal binary.
+	maxFatArches = 32
+)
+
+// IsMachO returns true if header, which should be at least 8 bytes long,
+// is the start of a thin or universal Mach-O file.
+func IsMachO(header []byte) bool {
+	if len(header) < 8 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(header) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	}
+	switch binary.BigEndian.Uint32(header) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	case magicFat, magicFat64:
+		n := binary.BigEndian.Uint32(header[4:])
+		return n > 0 && n < maxFatArches
+	}
+	return false
+}
+
+// IsMachOFile returns true if the named file is a Mach-O file.
+func IsMachOFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	var hdr [8]byte
+	if _, err := io.ReadFull(f, hdr[:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return IsMachO(hdr[:]), nil
+}
+
+const (
+	infoPlistSegment = "__TEXT"
+	infoPlistSection = "__info_plist"
+)
+
+// EmbeddedInfoPlist returns the contents of the __TEXT,__info_plist
+// section of the first slice in the Mach-O file read from ra. This
+// section is used to provide an Info.plist, and hence a bundle identity,
+// for command line executables that are not packaged in a bundle and is
+// typically created using the linker's -sectcreate option. A nil slice
+// is returned if there is no such section.
+func EmbeddedInfoPlist(ra io.ReaderAt) ([]byte, error) {
+	var hdr [8]byte
+	if _, err := ra.ReadAt(hdr[:], 0); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if !IsMachO(hdr[:]) {
+		return nil, ErrNotMachO
+	}
+	var f *macho.File
+	switch binary.BigEndian.Uint32(hdr[:]) {
+	case magicFat, magicFat64:
+		ff, err := macho.NewFatFile(ra)
+		if err != nil {
+			return nil, err
+		}
+		f = ff.Arches[0].File
+	default:
+		var err error
+		if f, err = macho.NewFile(ra); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range f.Sections {
+		if s.Seg == infoPlistSegment && s.Name == infoPlistSection {
+			return s.Data()
+		}
+	}
+	return nil, nil
+}
+
+// ReadEmbeddedInfoPlist is like EmbeddedInfoPlist but reads the named file.
+func ReadEmbeddedInfoPlist(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := EmbeddedInfoPlist(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return data, nil
+}
+
+// ParseFile parses the code signatures of all of the slices in the
+// named Mach-O file.
+func ParseFile(path string) ([]Slice, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	slices, err := Parse(f, fi.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return slices, nil
+}
+
+// Parse parses the code signatures of all of the slices in the Mach-O
+// file read from ra.
+func Parse(ra io.ReaderAt, size int64) ([]Slice, error) {
+	var hdr [8]byte
+	if _, err := ra.ReadAt(hdr[:], 0); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if !IsMachO(hdr[:]) {
+		return nil, ErrNotMachO
+	}
+	switch binary.BigEndian.Uint32(hdr[:]) {
+	case magicFat, magicFat64:
+		return parseFat(ra)
+	}
+	f, err := macho.NewFile(ra)
+	if err != nil {
+		return nil, err
+	}
+	s, err := parseSlice(ra, f, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	return []Slice{s}, nil
+}
+
+func parseFat(ra io.ReaderAt) ([]Slice, error) {
+	ff, err := macho.NewFatFile(ra)
+	if err != nil {
+		return nil, err
+	}
+	slices := make([]Slice, 0, len(ff.Arches))
+	for _, arch := range ff.Arches {
+		s, err := parseSlice(ra, arch.File, int64(arch.Offset), int64(arch.Size))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", arch.Cpu, err)
+		}
+		slices = append(slices, s)
+	}
+	return slices, nil
+}
+
+// codeSignatureCommand returns the dataoff and datasize fields of
+// the LC_CODE_SIGNATURE load command, if any.
+func codeSignatureCommand(f *macho.File) (uint32, uint32, bool) {
+	for _, l := range f.Loads {
+		raw := l.Raw()
+		if len(raw) < 16 || f.ByteOrder.Uint32(raw) != lcCodeSignature {
+			continue
+		}
+		return f.ByteOrder.Uint32(raw[8:]), f.ByteOrder.Uint32(raw[12:]), true
+	}
+	return 0, 0, false
+}
+
+func parseSlice(ra io.ReaderAt, f *macho.File, offset, size int64) (Slice, error) {
+	s := Slice{
+		CPU:    f.Cpu,
+		SubCPU: f.SubCpu,
+		Type:   f.Type,
+		Offset: offset,
+		Size:   size,
+	}
+	dataoff, datasize, ok := codeSignatureCommand(f)
+	if !ok {
+		return s, nil
+	}
+	if int64(dataoff)+int64(datasize) > size {
+		return s, fmt.Errorf("code signature [%d:%d] extends beyond the end of the slice (%d)", dataoff, dataoff+datasize, size)
+	}
+	s.SignatureOffset, s.SignatureSize = dataoff, datasize
+	buf := make([]byte, datasize)
+	if _, err := ra.ReadAt(buf, offset+int64(dataoff)); err != nil {
+		return s, fmt.Errorf("failed to read code signature: %w", err)
+	}
+	sig, err := ParseSignature(buf)
+	if err != nil {
+		return s, err
+	}
+	s.Signature = sig
+	return s, nil
+}
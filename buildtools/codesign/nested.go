@@ -0,0 +1,305 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign
+
+import (
+	"debug/macho"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// CodeKind identifies the kind of code found within a bundle.
+type CodeKind int
+
+const (
+	CodeMachO      CodeKind = iota // A standalone executable, dylib or loadable bundle.
+	CodeApp                        // An application, eg. Contents/Helpers/*.app.
+	CodeFramework                  // A framework, eg. Contents/Frameworks/*.framework.
+	CodeXPCService                 // An XPC service, eg. Contents/XPCServices/*.xpc.
+	CodePlugIn                     // An app extension or plug-in, eg. Contents/PlugIns/*.appex.
+	CodeBundle                     // Any other bundle, eg. a loadable .bundle.
+)
+
+func (k CodeKind) String() string {
+	switch k {
+	case CodeMachO:
+		return "mach-o"
+	case CodeApp:
+		return "app"
+	case CodeFramework:
+		return "framework"
+	case CodeXPCService:
+		return "xpc-service"
+	case CodePlugIn:
+		return "plug-in"
+	case CodeBundle:
+		return "bundle"
+	}
+	return fmt.Sprintf("CodeKind(%d)", int(k))
+}
+
+// Code represents an item of code within a bundle that must be signed.
+type Code struct {
+	// Path is the slash separated path of the code relative to the
+	// bundle, it is empty for the bundle itself.
+	Path string
+	Kind CodeKind
+	// Executable is the path of a bundle's main executable relative to
+	// the bundle, it is empty for Mach-O files and for bundles that
+	// have no executable.
+	Executable string
+}
+
+// Unsignable represents a file that appears to be code but that
+// cannot be signed in its current form or location.
+type Unsignable struct {
+	Path   string
+	Reason string
+}
+
+func (u Unsignable) String() string {
+	return u.Path + ": " + u.Reason
+}
+
+// SigningPlan lists the code within a bundle in the order in which
+// it must be signed.
+type SigningPlan struct {
+	// Code is ordered inside-out, that is, all of the code contained
+	// within a bundle precedes that bundle. The last item is always
+	// the bundle itself.
+	Code       []Code
+	Unsignable []Unsignable
+}
+
+// codeDirs are the directories within which executable files
+// are expected to be Mach-O files. Other directories within Library,
+// such as LaunchAgents, commonly contain executable files that are
+// not code, eg. scripts.
+var codeDirs = []string{"MacOS", "Helpers", "Frameworks", "PlugIns", "XPCServices",
+	"Library/LoginItems", "Library/LaunchServices", "Library/SystemExtensions"}
+
+// inCodeDir returns true if the slash separated directory dir is, or is
+// within, one of the codeDirs.
+func inCodeDir(dir string) bool {
+	dir = "/" + dir + "/"
+	return slices.ContainsFunc(codeDirs, func(d string) bool { return strings.Contains(dir, "/"+d+"/") })
+}
+
+// PlanSigning examines the contents of the bundle at root and returns
+// the order in which the code within it must be signed. Nested bundles
+// are detected by the presence of an Info.plist, rather than their
+// extension, and classified using their CFBundlePackageType. Mach-O files
+// are detected by their contents; the main executables of bundles are
+// not listed separately since they are signed along with their bundle.
+// Files that cannot be signed, such as Mach-O object files, Mach-O
+// files stored as resources or executable files in code directories that
+// are not Mach-O files are listed in the plan's Unsignable field.
+func PlanSigning(root string) (*SigningPlan, error) {
+	top, err := bundleCode(root, "")
+	if err != nil {
+		return nil, err
+	}
+	bundles := []Code{}
+	mainExecutables := map[string]bool{}
+	if top.Executable != "" {
+		mainExecutables[top.Executable] = true
+	}
+	var files []string
+	frameworks := map[string]bool{}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.Name() == "_CodeSignature" {
+			return filepath.SkipDir
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		if !d.IsDir() {
+			files = append(files, rel)
+			return nil
+		}
+		if d.Name() == "Contents" || d.Name() == "Resources" {
+			// The Info.plist within these belongs to the enclosing bundle.
+			return nil
+		}
+		if dir, parent := path.Split(path.Dir(rel)); parent == "Versions" && frameworks[path.Clean(dir)] {
+			// The versions of a framework are part of the framework.
+			return nil
+		}
+		if !hasInfoPlist(p) {
+			return nil
+		}
+		code, err := bundleCode(p, rel)
+		if err != nil {
+			return err
+		}
+		if code.Kind == CodeFramework {
+			frameworks[rel] = true
+		}
+		if code.Executable != "" {
+			mainExecutables[code.Executable] = true
+		}
+		bundles = append(bundles, code)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan := &SigningPlan{Code: bundles}
+	for _, rel := range files {
+		if mainExecutables[rel] {
+			continue
+		}
+		code, unsignable, err := fileCode(filepath.Join(root, filepath.FromSlash(rel)), rel)
+		if err != nil {
+			return nil, err
+		}
+		if unsignable != nil {
+			plan.Unsignable = append(plan.Unsignable, *unsignable)
+			continue
+		}
+		if code != nil {
+			plan.Code = append(plan.Code, *code)
+		}
+	}
+	sort.SliceStable(plan.Code, func(i, j int) bool {
+		di, dj := strings.Count(plan.Code[i].Path, "/"), strings.Count(plan.Code[j].Path, "/")
+		if di != dj {
+			return di > dj
+		}
+		return plan.Code[i].Path < plan.Code[j].Path
+	})
+	plan.Code = append(plan.Code, top)
+	return plan, nil
+}
+
+func hasInfoPlist(dir string) bool {
+	for _, p := range []string{
+		filepath.Join("Contents", "Info.plist"),
+		"Info.plist",
+		filepath.Join("Resources", "Info.plist"),
+	} {
+		if fi, err := os.Stat(filepath.Join(dir, p)); err == nil && fi.Mode().IsRegular() {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleCode returns the Code for the bundle at dir whose path relative
+// to the top-level bundle is rel.
+func bundleCode(dir, rel string) (Code, error) {
+	layout, err := newBundleLayout(dir)
+	if err != nil {
+		return Code{}, err
+	}
+	info, err := readBundleInfo(filepath.Join(layout.contents, layout.infoPlist))
+	if err != nil {
+		return Code{}, err
+	}
+	code := Code{Path: rel, Kind: bundleKind(info, dir)}
+	if layout.executable != "" {
+		exe, err := resolveWithin(dir, filepath.Join(layout.contents, layout.executable))
+		if err != nil {
+			return Code{}, err
+		}
+		code.Executable = path.Join(rel, exe)
+	}
+	return code, nil
+}
+
+// resolveWithin returns the slash separated path, relative to dir, of
+// filename after any symlinks within dir have been resolved.
+func resolveWithin(dir, filename string) (string, error) {
+	base, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filename)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(base, resolved)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%v: refers to %v which is outside of %v", filename, resolved, dir)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func bundleKind(info bundleInfo, dir string) CodeKind {
+	switch info.packageType {
+	case "APPL":
+		return CodeApp
+	case "FMWK":
+		return CodeFramework
+	case "XPC!":
+		return CodeXPCService
+	}
+	if info.extension {
+		return CodePlugIn
+	}
+	switch filepath.Ext(dir) {
+	case ".app":
+		return CodeApp
+	case ".framework":
+		return CodeFramework
+	case ".xpc":
+		return CodeXPCService
+	case ".appex", ".plugin":
+		return CodePlugIn
+	}
+	return CodeBundle
+}
+
+// fileCode determines whether the file at filename, whose path relative
+// to the top-level bundle is rel, is code that should be signed.
+func fileCode(filename, rel string) (*Code, *Unsignable, error) {
+	isMachO, err := IsMachOFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	elems := strings.Split(path.Dir(rel), "/")
+	if !isMachO {
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		if fi.Mode()&0111 != 0 && inCodeDir(path.Dir(rel)) {
+			return nil, &Unsignable{Path: rel, Reason: "executable file in a code directory is not a Mach-O file"}, nil
+		}
+		return nil, nil, nil
+	}
+	if slices.Contains(elems, "Resources") {
+		return nil, &Unsignable{Path: rel, Reason: "Mach-O files must not be stored in a Resources directory"}, nil
+	}
+	ms, err := ParseFile(filename)
+	if err != nil {
+		return nil, &Unsignable{Path: rel, Reason: err.Error()}, nil
+	}
+	for _, s := range ms {
+		switch s.Type {
+		case macho.TypeExec, macho.TypeDylib, macho.TypeBundle:
+		default:
+			return nil, &Unsignable{Path: rel, Reason: fmt.Sprintf("Mach-O files of type %v cannot be signed", s.Type)}, nil
+		}
+	}
+	return &Code{Path: rel, Kind: CodeMachO}, nil, nil
+}
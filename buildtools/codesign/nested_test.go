@@ -0,0 +1,143 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"cloudeng.io/macos/buildtools/codesign"
+)
+
+func infoPlist(exe, id, pkgType string, extra string) []byte {
+	return fmt.Appendf(nil, `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict>
+<key>CFBundleExecutable</key><string>%s</string>
+<key>CFBundleIdentifier</key><string>%s</string>
+<key>CFBundlePackageType</key><string>%s</string>%s
+</dict></plist>`, exe, id, pkgType, extra)
+}
+
+func symlink(t *testing.T, target string, elems ...string) {
+	t.Helper()
+	if err := os.Symlink(target, filepath.Join(elems...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createNestedBundle creates a bundle that contains every kind of
+// nested code as well as several files that cannot be signed.
+func createNestedBundle(t *testing.T) string {
+	t.Helper()
+	bundle := filepath.Join(t.TempDir(), "Test.app")
+	contents := filepath.Join(bundle, "Contents")
+	writeFile(t, infoPlist("hello", "io.cloudeng.test", "APPL", ""), contents, "Info.plist")
+	copyFile(t, unsignedBinary, filepath.Join(contents, "MacOS", "hello"), 0700)
+	copyFile(t, unsignedBinary, filepath.Join(contents, "MacOS", "helper"), 0700)
+	writeFile(t, []byte("#!/bin/sh\n"), contents, "MacOS", "script.sh")
+	if err := os.Chmod(filepath.Join(contents, "MacOS", "script.sh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"LaunchAgents", "LoginItems"} {
+		writeFile(t, []byte("#!/bin/sh\n"), contents, "Library", dir, "script.sh")
+		if err := os.Chmod(filepath.Join(contents, "Library", dir, "script.sh"), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	obj := copyFile(t, unsignedBinary, filepath.Join(contents, "MacOS", "hello.o"), 0600)
+	binary.LittleEndian.PutUint32(obj[12:], 1) // MH_OBJECT
+	writeFile(t, obj, contents, "MacOS", "hello.o")
+	copyFile(t, unsignedBinary, filepath.Join(contents, "Resources", "tool"), 0700)
+	writeFile(t, []byte("resource"), contents, "Resources", "resource.txt")
+
+	fw := filepath.Join(contents, "Frameworks", "Foo.framework")
+	writeFile(t, infoPlist("Foo", "io.cloudeng.test.Foo", "FMWK", ""), fw, "Versions", "A", "Resources", "Info.plist")
+	copyFile(t, unsignedBinary, filepath.Join(fw, "Versions", "A", "Foo"), 0700)
+	copyFile(t, unsignedBinary, filepath.Join(fw, "Versions", "A", "Libraries", "libbar.dylib"), 0700)
+	symlink(t, "A", fw, "Versions", "Current")
+	symlink(t, filepath.Join("Versions", "Current", "Foo"), fw, "Foo")
+	symlink(t, filepath.Join("Versions", "Current", "Resources"), fw, "Resources")
+
+	for _, b := range []struct{ dir, exe, pkgType, extra string }{
+		{filepath.Join("XPCServices", "Service.xpc"), "Service", "XPC!", ""},
+		{filepath.Join("PlugIns", "Ext.appex"), "Ext", "BNDL", "<key>NSExtension</key><dict></dict>"},
+		{filepath.Join("Helpers", "Helper.app"), "Helper", "APPL", ""},
+	} {
+		dir := filepath.Join(contents, b.dir, "Contents")
+		writeFile(t, infoPlist(b.exe, "io.cloudeng.test."+b.exe, b.pkgType, b.extra), dir, "Info.plist")
+		copyFile(t, unsignedBinary, filepath.Join(dir, "MacOS", b.exe), 0700)
+	}
+	return bundle
+}
+
+func TestPlanSigning(t *testing.T) {
+	bundle := createNestedBundle(t)
+	plan, err := codesign.PlanSigning(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, c := range plan.Code {
+		order = append(order, fmt.Sprintf("%v %v %v", c.Path, c.Kind, c.Executable))
+	}
+	if got, want := order, []string{
+		"Contents/Frameworks/Foo.framework/Versions/A/Libraries/libbar.dylib mach-o ",
+		"Contents/Frameworks/Foo.framework framework Contents/Frameworks/Foo.framework/Versions/A/Foo",
+		"Contents/Helpers/Helper.app app Contents/Helpers/Helper.app/Contents/MacOS/Helper",
+		"Contents/MacOS/helper mach-o ",
+		"Contents/PlugIns/Ext.appex plug-in Contents/PlugIns/Ext.appex/Contents/MacOS/Ext",
+		"Contents/XPCServices/Service.xpc xpc-service Contents/XPCServices/Service.xpc/Contents/MacOS/Service",
+		" app Contents/MacOS/hello",
+	}; !slices.Equal(got, want) {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+	var unsignable []string
+	for _, u := range plan.Unsignable {
+		unsignable = append(unsignable, u.String())
+	}
+	if got, want := unsignable, []string{
+		"Contents/Library/LoginItems/script.sh: executable file in a code directory is not a Mach-O file",
+		"Contents/MacOS/hello.o: Mach-O files of type Obj cannot be signed",
+		"Contents/MacOS/script.sh: executable file in a code directory is not a Mach-O file",
+		"Contents/Resources/tool: Mach-O files must not be stored in a Resources directory",
+	}; !slices.Equal(got, want) {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+
+	// Sign everything in the computed order after removing the files
+	// that cannot be signed, the result must verify.
+	for _, u := range plan.Unsignable {
+		if err := os.Remove(filepath.Join(bundle, filepath.FromSlash(u.Path))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range plan.Code {
+		p := filepath.Join(bundle, filepath.FromSlash(c.Path))
+		var err error
+		if c.Kind == codesign.CodeMachO {
+			err = codesign.SignFile(p, codesign.SignOptions{})
+		} else {
+			err = codesign.SignBundle(p, codesign.SignOptions{})
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", c.Path, err)
+		}
+	}
+	issues, err := codesign.VerifyBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := issues.Err(); err != nil {
+		t.Fatal(err)
+	}
+	fwSig := filepath.Join(bundle, "Contents", "Frameworks", "Foo.framework", "Versions", "A", "_CodeSignature", "CodeResources")
+	if _, err := os.Stat(fwSig); err != nil {
+		t.Errorf("framework not sealed: %v", err)
+	}
+}
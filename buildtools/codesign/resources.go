@@ -0,0 +1,292 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"howett.net/plist"
+)
+
+// ResourceEntry represents a single entry in the files or files2
+// dictionaries of a _CodeSignature/CodeResources file.
+type ResourceEntry struct {
+	Hash        []byte // SHA1 of the file contents.
+	Hash2       []byte // SHA256 of the file contents.
+	Optional    bool
+	Symlink     string // target of a symbolic link.
+	CDHash      []byte // cdhash of nested code.
+	Requirement string // designated requirement of nested code.
+}
+
+// ResourceRule represents a rule in the rules or rules2 dictionaries
+// of a _CodeSignature/CodeResources file. Rules determine how files
+// within a bundle are treated when the bundle is sealed.
+type ResourceRule struct {
+	Pattern  string
+	Omit     bool
+	Optional bool
+	Nested   bool
+	Weight   int
+
+	re *regexp.Regexp
+}
+
+// CodeResources represents a parsed _CodeSignature/CodeResources file.
+// File names are relative to the bundle's Contents directory (or the
+// bundle root for shallow bundles).
+type CodeResources struct {
+	Files  map[string]ResourceEntry
+	Files2 map[string]ResourceEntry
+	Rules  []ResourceRule
+	Rules2 []ResourceRule
+}
+
+// ParseCodeResources parses the contents of a _CodeSignature/CodeResources file.
+func ParseCodeResources(data []byte) (*CodeResources, error) {
+	var raw map[string]any
+	if _, err := plist.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse CodeResources: %w", err)
+	}
+	cr := &CodeResources{}
+	var err error
+	if cr.Files, err = parseResourceFiles(raw["files"]); err != nil {
+		return nil, fmt.Errorf("files: %w", err)
+	}
+	if cr.Files2, err = parseResourceFiles(raw["files2"]); err != nil {
+		return nil, fmt.Errorf("files2: %w", err)
+	}
+	if cr.Rules, err = parseResourceRules(raw["rules"]); err != nil {
+		return nil, fmt.Errorf("rules: %w", err)
+	}
+	if cr.Rules2, err = parseResourceRules(raw["rules2"]); err != nil {
+		return nil, fmt.Errorf("rules2: %w", err)
+	}
+	return cr, nil
+}
+
+func parseResourceFiles(v any) (map[string]ResourceEntry, error) {
+	files := map[string]ResourceEntry{}
+	if v == nil {
+		return files, nil
+	}
+	dict, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("not a dictionary")
+	}
+	for name, val := range dict {
+		entry, err := parseResourceEntry(val)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", name, err)
+		}
+		files[name] = entry
+	}
+	return files, nil
+}
+
+func parseResourceEntry(v any) (ResourceEntry, error) {
+	var entry ResourceEntry
+	switch val := v.(type) {
+	case []byte:
+		entry.Hash = val
+		return entry, nil
+	case map[string]any:
+		entry.Hash, _ = val["hash"].([]byte)
+		entry.Hash2, _ = val["hash2"].([]byte)
+		entry.Optional, _ = val["optional"].(bool)
+		entry.Symlink, _ = val["symlink"].(string)
+		entry.CDHash, _ = val["cdhash"].([]byte)
+		entry.Requirement, _ = val["requirement"].(string)
+		return entry, nil
+	}
+	return entry, fmt.Errorf("unexpected type %T", v)
+}
+
+func parseResourceRules(v any) ([]ResourceRule, error) {
+	if v == nil {
+		return nil, nil
+	}
+	dict, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("not a dictionary")
+	}
+	rules := make([]ResourceRule, 0, len(dict))
+	for pattern, val := range dict {
+		rule := ResourceRule{Pattern: pattern, Weight: 1}
+		switch r := val.(type) {
+		case bool:
+			rule.Omit = !r
+		case map[string]any:
+			rule.Omit, _ = r["omit"].(bool)
+			rule.Optional, _ = r["optional"].(bool)
+			rule.Nested, _ = r["nested"].(bool)
+			if w, ok := asInt(r["weight"]); ok {
+				rule.Weight = w
+			}
+		default:
+			return nil, fmt.Errorf("%v: unexpected type %T", pattern, val)
+		}
+		rules = append(rules, rule)
+	}
+	if err := compileRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func asInt(v any) (int, bool) {
+	switch i := v.(type) {
+	case int:
+		return i, true
+	case int64:
+		return int(i), true
+	case uint64:
+		return int(i), true
+	case float64:
+		return int(i), true
+	}
+	return 0, false
+}
+
+// compileRules compiles the rules' patterns and sorts them by
+// decreasing weight, and then by pattern for determinism.
+func compileRules(rules []ResourceRule) error {
+	for i := range rules {
+		re, err := regexp.Compile(rules[i].Pattern)
+		if err != nil {
+			return fmt.Errorf("%v: %w", rules[i].Pattern, err)
+		}
+		rules[i].re = re
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Weight != rules[j].Weight {
+			return rules[i].Weight > rules[j].Weight
+		}
+		return rules[i].Pattern < rules[j].Pattern
+	})
+	return nil
+}
+
+// MatchRule returns the highest weighted rule that matches path, which
+// must be relative to the bundle's Contents directory.
+func MatchRule(rules []ResourceRule, path string) (ResourceRule, bool) {
+	var best ResourceRule
+	found := false
+	for _, r := range rules {
+		re := r.re
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(r.Pattern); err != nil {
+				continue
+			}
+		}
+		if re.MatchString(path) && (!found || r.Weight > best.Weight) {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
+
+// DefaultRules returns the version 1 resource rules used by codesign.
+func DefaultRules() []ResourceRule {
+	rules := []ResourceRule{
+		{Pattern: `^Resources/`, Weight: 1},
+		{Pattern: `^Resources/.*\.lproj/`, Optional: true, Weight: 1000},
+		{Pattern: `^Resources/.*\.lproj/locversion.plist$`, Omit: true, Weight: 1100},
+		{Pattern: `^Resources/Base\.lproj/`, Weight: 1010},
+		{Pattern: `^version.plist$`, Weight: 1},
+	}
+	_ = compileRules(rules)
+	return rules
+}
+
+// DefaultRules2 returns the version 2 resource rules used by codesign.
+func DefaultRules2() []ResourceRule {
+	rules := []ResourceRule{
+		{Pattern: `.*\.dSYM($|/)`, Weight: 11},
+		{Pattern: `^(.*/)?\.DS_Store$`, Omit: true, Weight: 2000},
+		{Pattern: `^(Frameworks|SharedFrameworks|PlugIns|Plug-ins|XPCServices|Helpers|MacOS|Library/(Automator|Spotlight|LoginItems))/`, Nested: true, Weight: 10},
+		{Pattern: `^.*`, Weight: 1},
+		{Pattern: `^Info\.plist$`, Omit: true, Weight: 20},
+		{Pattern: `^PkgInfo$`, Omit: true, Weight: 20},
+		{Pattern: `^Resources/`, Weight: 20},
+		{Pattern: `^Resources/.*\.lproj/`, Optional: true, Weight: 1000},
+		{Pattern: `^Resources/.*\.lproj/locversion.plist$`, Omit: true, Weight: 1100},
+		{Pattern: `^Resources/Base\.lproj/`, Weight: 1010},
+		{Pattern: `^[^/]+$`, Nested: true, Weight: 10},
+		{Pattern: `^embedded\.provisionprofile$`, Weight: 20},
+		{Pattern: `^version\.plist$`, Weight: 20},
+	}
+	_ = compileRules(rules)
+	return rules
+}
+
+func marshalRules(rules []ResourceRule) map[string]any {
+	out := make(map[string]any, len(rules))
+	for _, r := range rules {
+		if !r.Omit && !r.Optional && !r.Nested && r.Weight == 1 {
+			out[r.Pattern] = true
+			continue
+		}
+		d := map[string]any{}
+		if r.Omit {
+			d["omit"] = true
+		}
+		if r.Optional {
+			d["optional"] = true
+		}
+		if r.Nested {
+			d["nested"] = true
+		}
+		if r.Weight != 1 {
+			d["weight"] = float64(r.Weight)
+		}
+		out[r.Pattern] = d
+	}
+	return out
+}
+
+func marshalEntry(e ResourceEntry, v1 bool) any {
+	if v1 && !e.Optional {
+		return e.Hash
+	}
+	d := map[string]any{}
+	switch {
+	case e.Symlink != "":
+		d["symlink"] = e.Symlink
+	case e.CDHash != nil:
+		d["cdhash"] = e.CDHash
+		d["requirement"] = e.Requirement
+	case v1:
+		d["hash"] = e.Hash
+	default:
+		d["hash"] = e.Hash
+		d["hash2"] = e.Hash2
+	}
+	if e.Optional {
+		d["optional"] = true
+	}
+	return d
+}
+
+// Marshal returns the XML plist representation of the CodeResources.
+func (cr *CodeResources) Marshal() ([]byte, error) {
+	files := make(map[string]any, len(cr.Files))
+	for name, e := range cr.Files {
+		files[name] = marshalEntry(e, true)
+	}
+	files2 := make(map[string]any, len(cr.Files2))
+	for name, e := range cr.Files2 {
+		files2[name] = marshalEntry(e, false)
+	}
+	return plist.MarshalIndent(map[string]any{
+		"files":  files,
+		"files2": files2,
+		"rules":  marshalRules(cr.Rules),
+		"rules2": marshalRules(cr.Rules2),
+	}, plist.XMLFormat, "\t")
+}
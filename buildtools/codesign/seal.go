@@ -0,0 +1,141 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign
+
+import (
+	"crypto/sha1" //nolint:gosec // G505, SHA1 is part of the code signing format.
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SealBundle computes the CodeResources for the bundle at path using the
+// default resource rules. Nested code, ie. Mach-O files and bundles
+// in locations covered by nested rules, must already be signed since
+// their cdhashes are recorded rather than the hashes of their contents.
+func SealBundle(path string) (*CodeResources, error) {
+	layout, err := newBundleLayout(path)
+	if err != nil {
+		return nil, err
+	}
+	return sealBundle(layout)
+}
+
+func sealBundle(layout bundleLayout) (*CodeResources, error) {
+	cr := &CodeResources{
+		Files:  map[string]ResourceEntry{},
+		Files2: map[string]ResourceEntry{},
+		Rules:  DefaultRules(),
+		Rules2: DefaultRules2(),
+	}
+	files, err := walkResources(layout, cr.Rules2)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		rule, _ := MatchRule(cr.Rules2, f.path)
+		entry, err := sealResource(layout, f, rule)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", f.path, err)
+		}
+		entry.Optional = rule.Optional
+		cr.Files2[f.path] = entry
+		if entry.Hash == nil {
+			continue
+		}
+		if r1, ok := MatchRule(cr.Rules, f.path); ok && !r1.Omit {
+			cr.Files[f.path] = ResourceEntry{Hash: entry.Hash, Optional: r1.Optional}
+		}
+	}
+	return cr, nil
+}
+
+func sealResource(layout bundleLayout, f resourceFile, rule ResourceRule) (ResourceEntry, error) {
+	path := filepath.Join(layout.contents, filepath.FromSlash(f.path))
+	switch {
+	case f.symlink:
+		target, err := os.Readlink(path)
+		return ResourceEntry{Symlink: target}, err
+	case f.bundle:
+		nested, err := newBundleLayout(path)
+		if err != nil {
+			return ResourceEntry{}, err
+		}
+		if nested.executable == "" {
+			return ResourceEntry{}, fmt.Errorf("nested bundle has no executable")
+		}
+		return nestedEntry(filepath.Join(nested.contents, nested.executable))
+	}
+	if rule.Nested {
+		isMachO, err := IsMachOFile(path)
+		if err != nil {
+			return ResourceEntry{}, err
+		}
+		if isMachO {
+			return nestedEntry(path)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ResourceEntry{}, err
+	}
+	h1 := sha1.Sum(data) //nolint:gosec // G401
+	h2 := sha256.Sum256(data)
+	return ResourceEntry{Hash: h1[:], Hash2: h2[:]}, nil
+}
+
+func nestedEntry(exe string) (ResourceEntry, error) {
+	cdhash, err := cdHashOf(exe)
+	if err != nil {
+		return ResourceEntry{}, fmt.Errorf("nested code: %w", err)
+	}
+	return ResourceEntry{
+		CDHash:      cdhash,
+		Requirement: fmt.Sprintf("cdhash H\"%s\"", hex.EncodeToString(cdhash)),
+	}, nil
+}
+
+// SignBundle creates an ad-hoc signature for the bundle at path. It seals
+// the bundle's resources, writes _CodeSignature/CodeResources and signs
+// the main executable binding it to the Info.plist and CodeResources.
+// Nested code must be signed before the bundle is signed. If
+// opts.Identifier is empty the bundle's CFBundleIdentifier is used.
+func SignBundle(path string, opts SignOptions) error {
+	layout, err := newBundleLayout(path)
+	if err != nil {
+		return err
+	}
+	if layout.executable == "" {
+		return fmt.Errorf("%v: bundles without a main executable are not supported", path)
+	}
+	infoPath := filepath.Join(layout.contents, layout.infoPlist)
+	if opts.Identifier == "" {
+		info, err := readBundleInfo(infoPath)
+		if err != nil {
+			return err
+		}
+		opts.Identifier = info.identifier
+	}
+	if opts.InfoPlist, err = os.ReadFile(infoPath); err != nil {
+		return err
+	}
+	cr, err := sealBundle(layout)
+	if err != nil {
+		return err
+	}
+	if opts.CodeResources, err = cr.Marshal(); err != nil {
+		return err
+	}
+	crPath := filepath.Join(layout.contents, codeResourcesPath)
+	if err := os.MkdirAll(filepath.Dir(crPath), 0755); err != nil { //nolint:gosec // G301
+		return err
+	}
+	if err := os.WriteFile(crPath, opts.CodeResources, 0644); err != nil { //nolint:gosec // G306
+		return err
+	}
+	return SignFile(filepath.Join(layout.contents, layout.executable), opts)
+}
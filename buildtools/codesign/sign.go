@@ -0,0 +1,255 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"howett.net/plist"
+)
+
+// SignOptions represents the options used to create an ad-hoc signature.
+type SignOptions struct {
+	// Identifier is the signing identifier, it defaults to the
+	// base name of the file being signed or to the CFBundleIdentifier
+	// when signing a bundle.
+	Identifier string
+	// Entitlements is an XML plist containing the entitlements to embed.
+	// Both the XML and DER forms of the entitlements are embedded.
+	Entitlements []byte
+	// Flags are additional CodeDirectory flags, eg. FlagRuntime for the
+	// hardened runtime. FlagAdhoc is always set.
+	Flags CodeDirectoryFlags
+	// InfoPlist and CodeResources are the contents of the bundle's
+	// Info.plist and CodeResources files to be bound to the signature.
+	InfoPlist     []byte
+	CodeResources []byte
+}
+
+// pageSizeBits is the log2 of the page size used for code page hashes,
+// as used by codesign and the go linker.
+const pageSizeBits = 12
+
+// emptyRequirements is an empty internal requirements set, as generated
+// by codesign for ad-hoc signatures.
+var emptyRequirements = []byte{0xfa, 0xde, 0x0c, 0x01, 0, 0, 0, 0x0c, 0, 0, 0, 0}
+
+// signatureBuilder builds an ad-hoc signature for a single slice.
+type signatureBuilder struct {
+	opts         SignOptions
+	entitlements []byte // entitlements blob, including the header.
+	der          []byte // DER entitlements blob, including the header.
+	execSegFlags ExecSegFlags
+}
+
+func appendBlob(out []byte, magic uint32, data []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, magic)
+	out = binary.BigEndian.AppendUint32(out, uint32(8+len(data)))
+	return append(out, data...)
+}
+
+func newSignatureBuilder(opts SignOptions) (*signatureBuilder, error) {
+	sb := &signatureBuilder{opts: opts}
+	if len(opts.Entitlements) == 0 {
+		return sb, nil
+	}
+	var ent map[string]any
+	if _, err := plist.Unmarshal(opts.Entitlements, &ent); err != nil {
+		return nil, fmt.Errorf("failed to parse entitlements: %w", err)
+	}
+	der, err := EncodeDEREntitlements(ent)
+	if err != nil {
+		return nil, err
+	}
+	sb.entitlements = appendBlob(nil, MagicEmbeddedEntitlements, opts.Entitlements)
+	sb.der = appendBlob(nil, MagicEmbeddedDEREntitlements, der)
+	for _, key := range []string{"get-task-allow", "com.apple.security.get-task-allow"} {
+		if v, _ := ent[key].(bool); v {
+			sb.execSegFlags |= ExecSegAllowUnsigned
+		}
+	}
+	return sb, nil
+}
+
+// specialSlots returns the data to be hashed for each special slot.
+func (sb *signatureBuilder) specialSlots() [][]byte {
+	slots := make([][]byte, SlotEntitlementsDER+1)
+	slots[SlotInfo] = sb.opts.InfoPlist
+	slots[SlotRequirements] = emptyRequirements
+	slots[SlotResourceDir] = sb.opts.CodeResources
+	slots[SlotEntitlements] = sb.entitlements
+	slots[SlotEntitlementsDER] = sb.der
+	n := len(slots) - 1
+	for n > 0 && slots[n] == nil {
+		n--
+	}
+	return slots[:n+1]
+}
+
+const (
+	superBlobHeaderSize = 12
+	blobIndexSize       = 8
+	cdVersion           = versionExecSeg
+	cdSize              = 88 // size of the header for versionExecSeg.
+	hashType            = HashSHA256
+)
+
+func (sb *signatureBuilder) cdLength(nCodeSlots int) int {
+	hs := hashType.Size()
+	return cdSize + len(sb.opts.Identifier) + 1 + (len(sb.specialSlots())-1)*hs + nCodeSlots*hs
+}
+
+func (sb *signatureBuilder) blobs() []Slot {
+	slots := []Slot{SlotCodeDirectory, SlotRequirements}
+	if sb.entitlements != nil {
+		slots = append(slots, SlotEntitlements, SlotEntitlementsDER)
+	}
+	return append(slots, SlotSignature)
+}
+
+// size returns the size of the signature for code of the specified size.
+func (sb *signatureBuilder) size(codeLimit int) int {
+	npages := (codeLimit + 1<<pageSizeBits - 1) >> pageSizeBits
+	n := superBlobHeaderSize + len(sb.blobs())*blobIndexSize
+	n += sb.cdLength(npages) + len(emptyRequirements) + len(sb.entitlements) + len(sb.der) + 8
+	// Allow for the padding added by codesign_allocate.
+	return (n + 15) &^ 15
+}
+
+// codeDirectory builds a CodeDirectory for the supplied code.
+func (sb *signatureBuilder) codeDirectory(code []byte, execSegBase, execSegLimit uint64, execSegFlags ExecSegFlags) []byte {
+	hs := hashType.Size()
+	pageSize := 1 << pageSizeBits
+	npages := (len(code) + pageSize - 1) / pageSize
+	special := sb.specialSlots()
+	identOffset := cdSize
+	hashOffset := identOffset + len(sb.opts.Identifier) + 1 + (len(special)-1)*hs
+
+	be := binary.BigEndian
+	out := be.AppendUint32(nil, MagicCodeDirectory)
+	out = be.AppendUint32(out, uint32(sb.cdLength(npages)))
+	out = be.AppendUint32(out, cdVersion)
+	out = be.AppendUint32(out, uint32(sb.opts.Flags|FlagAdhoc))
+	out = be.AppendUint32(out, uint32(hashOffset))
+	out = be.AppendUint32(out, uint32(identOffset))
+	out = be.AppendUint32(out, uint32(len(special)-1))
+	out = be.AppendUint32(out, uint32(npages))
+	out = be.AppendUint32(out, uint32(len(code))) //nolint:gosec // G115
+	out = append(out, byte(hs), byte(hashType), 0, pageSizeBits)
+	out = be.AppendUint32(out, 0) // spare2
+	out = be.AppendUint32(out, 0) // scatterOffset
+	out = be.AppendUint32(out, 0) // teamOffset
+	out = be.AppendUint32(out, 0) // spare3
+	out = be.AppendUint64(out, 0) // codeLimit64
+	out = be.AppendUint64(out, execSegBase)
+	out = be.AppendUint64(out, execSegLimit)
+	out = be.AppendUint64(out, uint64(execSegFlags|sb.execSegFlags))
+	out = append(out, sb.opts.Identifier...)
+	out = append(out, 0)
+	for i := len(special) - 1; i > 0; i-- {
+		if special[i] == nil {
+			out = append(out, make([]byte, hs)...)
+			continue
+		}
+		out = append(out, hashType.Sum(special[i])...)
+	}
+	for i := range npages {
+		out = append(out, hashType.Sum(code[i*pageSize:min((i+1)*pageSize, len(code))])...)
+	}
+	return out
+}
+
+// build returns the SuperBlob for the supplied code padded to size bytes.
+func (sb *signatureBuilder) build(code []byte, size int, execSegBase, execSegLimit uint64, execSegFlags ExecSegFlags) []byte {
+	blobs := map[Slot][]byte{
+		SlotCodeDirectory:   sb.codeDirectory(code, execSegBase, execSegLimit, execSegFlags),
+		SlotRequirements:    emptyRequirements,
+		SlotEntitlements:    sb.entitlements,
+		SlotEntitlementsDER: sb.der,
+		SlotSignature:       appendBlob(nil, MagicBlobWrapper, nil),
+	}
+	order := sb.blobs()
+	be := binary.BigEndian
+	offset := superBlobHeaderSize + len(order)*blobIndexSize
+	length := offset
+	for _, slot := range order {
+		length += len(blobs[slot])
+	}
+	out := be.AppendUint32(make([]byte, 0, size), MagicEmbeddedSignature)
+	out = be.AppendUint32(out, uint32(length))
+	out = be.AppendUint32(out, uint32(len(order)))
+	for _, slot := range order {
+		out = be.AppendUint32(out, uint32(slot))
+		out = be.AppendUint32(out, uint32(offset))
+		offset += len(blobs[slot])
+	}
+	for _, slot := range order {
+		out = append(out, blobs[slot]...)
+	}
+	return append(out, make([]byte, size-len(out))...)
+}
+
+// SignFile creates an ad-hoc signature for every slice in the named
+// Mach-O file, replacing any existing signature. The file is
+// rewritten in place. If opts.InfoPlist is not set and the file has an
+// embedded Info.plist, see EmbeddedInfoPlist, the signature is bound to
+// it and its CFBundleIdentifier is used as the default identifier, as
+// is done by codesign for standalone executables.
+func SignFile(path string, opts SignOptions) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if opts.InfoPlist == nil {
+		if opts.InfoPlist, err = EmbeddedInfoPlist(bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("%v: %w", path, err)
+		}
+		if opts.InfoPlist != nil && opts.Identifier == "" {
+			info, err := parseBundleInfo(opts.InfoPlist)
+			if err != nil {
+				return fmt.Errorf("%v: embedded Info.plist: %w", path, err)
+			}
+			opts.Identifier = info.identifier
+		}
+	}
+	if opts.Identifier == "" {
+		opts.Identifier = filepath.Base(path)
+	}
+	signed, err := Sign(data, opts)
+	if err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+	return replaceFile(path, signed)
+}
+
+// replaceFile atomically replaces the contents of path, retaining
+// its permissions.
+func replaceFile(path string, data []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".codesign-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
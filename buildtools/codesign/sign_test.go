@@ -0,0 +1,410 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign_test
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"cloudeng.io/macos/buildtools/codesign"
+)
+
+const entitlementsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>com.apple.security.app-sandbox</key>
+	<true/>
+	<key>keychain-access-groups</key>
+	<array>
+		<string>ABCDE12345.*</string>
+	</array>
+</dict>
+</plist>
+`
+
+var wantEntitlements = map[string]any{
+	"com.apple.security.app-sandbox": true,
+	"keychain-access-groups":         []any{"ABCDE12345.*"},
+}
+
+func TestDERRoundTrip(t *testing.T) {
+	ent := map[string]any{
+		"a": true,
+		"b": "string",
+		"c": int64(42),
+		"d": []any{"x", false},
+		"e": map[string]any{"nested": int64(-1)},
+	}
+	der, err := codesign.EncodeDEREntitlements(ent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := codesign.DecodeDEREntitlements(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, ent) {
+		t.Errorf("got %v, want %v", got, ent)
+	}
+}
+
+func signAndCheck(t *testing.T, data []byte, opts codesign.SignOptions) []codesign.Slice {
+	t.Helper()
+	signed, err := codesign.Sign(data, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "signed")
+	writeFile(t, signed, path)
+	slices, err := codesign.ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues, err := codesign.VerifyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := issues.Err(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range slices {
+		checkSignature(t, s, opts)
+	}
+	return slices
+}
+
+func checkSignature(t *testing.T, s codesign.Slice, opts codesign.SignOptions) {
+	t.Helper()
+	if !s.Signed() {
+		t.Fatalf("%v: not signed", s.Arch())
+	}
+	sig := s.Signature
+	cd := sig.CodeDirectory
+	if got, want := cd.Identifier, opts.Identifier; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := cd.Flags, opts.Flags|codesign.FlagAdhoc; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := cd.ExecSegFlags, codesign.ExecSegMainBinary; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if sig.Requirements == nil || len(sig.Requirements.Entries) != 0 {
+		t.Errorf("expected an empty requirements set")
+	}
+	if len(opts.Entitlements) == 0 {
+		return
+	}
+	ent, err := sig.EntitlementsMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ent, wantEntitlements) {
+		t.Errorf("got %v, want %v", ent, wantEntitlements)
+	}
+	der, err := sig.EntitlementsDERMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(der, wantEntitlements) {
+		t.Errorf("got %v, want %v", der, wantEntitlements)
+	}
+	if !bytes.Equal(sig.Entitlements, []byte(entitlementsXML)) {
+		t.Errorf("entitlements were not embedded verbatim")
+	}
+}
+
+func TestSignFile(t *testing.T) {
+	opts := codesign.SignOptions{
+		Identifier:   "io.cloudeng.hello",
+		Entitlements: []byte(entitlementsXML),
+		Flags:        codesign.FlagRuntime,
+	}
+	for _, bin := range []string{signedBinary, unsignedBinary} {
+		data, err := os.ReadFile(bin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices := signAndCheck(t, data, opts)
+		if got, want := len(slices), 1; got != want {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		if !slices[0].Signature.CodeDirectory.HardenedRuntime() {
+			t.Errorf("expected hardened runtime")
+		}
+		// Re-signing must replace the signature.
+		slices = signAndCheck(t, data, codesign.SignOptions{Identifier: "other"})
+		if slices[0].Signature.Entitlements != nil {
+			t.Errorf("unexpected entitlements")
+		}
+	}
+
+	// SignFile rewrites the file in place and defaults the identifier.
+	path := filepath.Join(t.TempDir(), "hello")
+	copyFile(t, unsignedBinary, path, 0700)
+	if err := codesign.SignFile(path, codesign.SignOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	slices, err := codesign.ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := slices[0].Signature.CodeDirectory.Identifier, "hello"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("unexpected permissions: %v, %v", fi.Mode(), err)
+	}
+	if _, err := macho.Open(path); err != nil {
+		t.Errorf("signed file is not a valid Mach-O file: %v", err)
+	}
+}
+
+func universal(t *testing.T, files ...string) []byte {
+	t.Helper()
+	be := binary.BigEndian
+	out := be.AppendUint32(nil, 0xcafebabe)
+	out = be.AppendUint32(out, uint32(len(files)))
+	var body []byte
+	offset := uint32(0x4000)
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mf, err := macho.NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []uint32{uint32(mf.Cpu), mf.SubCpu, offset, uint32(len(data)), 14} {
+			out = be.AppendUint32(out, v)
+		}
+		body = append(body, make([]byte, int(offset)-0x4000-len(body))...)
+		body = append(body, data...)
+		offset = (offset + uint32(len(data)) + 0x3fff) &^ 0x3fff
+	}
+	out = append(out, make([]byte, 0x4000-len(out))...)
+	return append(out, body...)
+}
+
+func TestSignUniversal(t *testing.T) {
+	data := universal(t, unsignedBinary, signedBinary)
+	slices := signAndCheck(t, data, codesign.SignOptions{
+		Identifier:   "io.cloudeng.universal",
+		Entitlements: []byte(entitlementsXML),
+	})
+	if got, want := len(slices), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := slices[0].Arch()+","+slices[1].Arch(), "x86_64,arm64"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, s := range slices {
+		if s.Offset%0x4000 != 0 {
+			t.Errorf("%v: slice is not aligned: %#x", s.Arch(), s.Offset)
+		}
+	}
+}
+
+func createBundle(t *testing.T) string {
+	t.Helper()
+	bundle := filepath.Join(t.TempDir(), "Test.app")
+	contents := filepath.Join(bundle, "Contents")
+	copyFile(t, unsignedBinary, filepath.Join(contents, "MacOS", "hello"), 0700)
+	copyFile(t, unsignedBinary, filepath.Join(contents, "MacOS", "helper"), 0700)
+	writeFile(t, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict>
+<key>CFBundleExecutable</key><string>hello</string>
+<key>CFBundleIdentifier</key><string>io.cloudeng.test</string>
+</dict></plist>`), contents, "Info.plist")
+	writeFile(t, []byte("resource"), contents, "Resources", "resource.txt")
+	writeFile(t, []byte("localized"), contents, "Resources", "en.lproj", "Localizable.strings")
+	writeFile(t, []byte("ignored"), contents, "Resources", ".DS_Store")
+	if err := os.Symlink("resource.txt", filepath.Join(contents, "Resources", "link")); err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func TestSignBundle(t *testing.T) {
+	bundle := createBundle(t)
+	contents := filepath.Join(bundle, "Contents")
+	helper := filepath.Join(contents, "MacOS", "helper")
+	if err := codesign.SignFile(helper, codesign.SignOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	opts := codesign.SignOptions{Entitlements: []byte(entitlementsXML)}
+	if err := codesign.SignBundle(bundle, opts); err != nil {
+		t.Fatal(err)
+	}
+	issues, err := codesign.VerifyBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := issues.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(contents, "_CodeSignature", "CodeResources"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr, err := codesign.ParseCodeResources(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range cr.Files2 {
+		names = append(names, name)
+	}
+	if got, want := len(names), 4; got != want {
+		t.Errorf("got %v, want %v: %v", got, want, names)
+	}
+	if e := cr.Files2["MacOS/helper"]; e.CDHash == nil || e.Requirement == "" {
+		t.Errorf("helper not sealed as nested code: %+v", e)
+	}
+	if e := cr.Files2["Resources/en.lproj/Localizable.strings"]; !e.Optional {
+		t.Errorf("localized resource is not optional: %+v", e)
+	}
+	if _, ok := cr.Files["Resources/resource.txt"]; !ok {
+		t.Errorf("resource missing from version 1 files")
+	}
+
+	slices, err := codesign.ParseFile(filepath.Join(contents, "MacOS", "hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := slices[0].Signature.CodeDirectory
+	if got, want := cd.Identifier, "io.cloudeng.test"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, slot := range []codesign.Slot{codesign.SlotInfo, codesign.SlotResourceDir} {
+		if _, ok := cd.SpecialSlot(slot); !ok {
+			t.Errorf("missing special slot: %v", slot)
+		}
+	}
+
+	// Modify a resource and the nested helper.
+	writeFile(t, []byte("modified"), contents, "Resources", "resource.txt")
+	if err := codesign.SignFile(helper, codesign.SignOptions{Identifier: "changed"}); err != nil {
+		t.Fatal(err)
+	}
+	issues, err = codesign.VerifyBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKind := kinds(issues)
+	if got := byKind[codesign.IssueResourceModified]; len(got) != 1 || got[0].Path != "Test.app/Contents/Resources/resource.txt" {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+	if got := byKind[codesign.IssueNestedCode]; len(got) != 1 || got[0].Path != "Test.app/Contents/MacOS/helper" {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+
+	// Remove the main executable, which is not sealed in CodeResources.
+	if err := os.Remove(filepath.Join(contents, "MacOS", "hello")); err != nil {
+		t.Fatal(err)
+	}
+	issues, err = codesign.VerifyBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := kinds(issues)[codesign.IssueResourceMissing]; len(got) != 1 || got[0].Path != "Test.app/Contents/MacOS/hello" {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+}
+
+const embeddedInfoPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleIdentifier</key>
+	<string>io.cloudeng.tool</string>
+</dict>
+</plist>
+`
+
+// withEmbeddedInfoPlist returns a copy of the Mach-O file at src in which
+// the __TEXT,__rodata section is renamed to __info_plist and its contents
+// replaced with info. The result cannot be run, but is sufficient for
+// testing signing and verification.
+func withEmbeddedInfoPlist(t *testing.T, src string, info []byte) []byte {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := macho.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sect := f.Section("__rodata")
+	if sect == nil || sect.Seg != "__TEXT" || sect.Size < uint64(len(info)) {
+		t.Fatalf("%v: no suitable __TEXT,__rodata section", src)
+	}
+	copy(data[sect.Offset:], info)
+	hdr := make([]byte, 32)
+	copy(hdr, "__rodata")
+	copy(hdr[16:], "__TEXT")
+	i := bytes.Index(data, hdr)
+	copy(data[i:i+16], append([]byte("__info_plist"), 0, 0, 0, 0))
+	binary.LittleEndian.PutUint64(data[i+40:], uint64(len(info)))
+	return data
+}
+
+func TestEmbeddedInfoPlist(t *testing.T) {
+	if info, err := codesign.ReadEmbeddedInfoPlist(unsignedBinary); err != nil || info != nil {
+		t.Errorf("unexpected embedded Info.plist: %s: %v", info, err)
+	}
+
+	data := withEmbeddedInfoPlist(t, unsignedBinary, []byte(embeddedInfoPlist))
+	info, err := codesign.EmbeddedInfoPlist(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(info), embeddedInfoPlist; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// SignFile binds the signature to the embedded Info.plist and uses
+	// its identifier.
+	path := filepath.Join(t.TempDir(), "tool")
+	writeFile(t, data, path)
+	if err := codesign.SignFile(path, codesign.SignOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	slices, err := codesign.ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := slices[0].Signature.CodeDirectory
+	if got, want := cd.Identifier, "io.cloudeng.tool"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if hash, ok := cd.SpecialSlot(codesign.SlotInfo); !ok || !bytes.Equal(hash, cd.HashType.Sum([]byte(embeddedInfoPlist))) {
+		t.Errorf("Info.plist hash is missing or incorrect: %x, %v", hash, ok)
+	}
+
+	issues, err := codesign.VerifyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := issues.Err(); err != nil {
+		t.Fatal(err)
+	}
+	issues, err = codesign.VerifyFile(path, codesign.WithInfoPlist([]byte("other")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(issues), 1; got != want || issues[0].Slot != codesign.SlotInfo {
+		t.Errorf("got %v, want %v: %v", got, want, issues)
+	}
+}
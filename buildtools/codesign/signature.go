@@ -0,0 +1,275 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"howett.net/plist"
+)
+
+// BlobIndex represents an entry in the index of a SuperBlob.
+type BlobIndex struct {
+	Type   Slot
+	Offset uint32
+	Magic  uint32
+	Length uint32
+}
+
+// Signature represents a parsed embedded signature, ie. the SuperBlob
+// referenced by LC_CODE_SIGNATURE.
+type Signature struct {
+	// Index lists all of the blobs found in the SuperBlob.
+	Index []BlobIndex
+	// CodeDirectory is the primary CodeDirectory.
+	CodeDirectory *CodeDirectory
+	// AlternateCodeDirectories contains any alternate CodeDirectories,
+	// typically using SHA256 when the primary uses SHA1.
+	AlternateCodeDirectories []*CodeDirectory
+	// Entitlements is the XML plist for the embedded entitlements,
+	// without the blob header.
+	Entitlements []byte
+	// EntitlementsDER is the DER encoded entitlements, without the
+	// blob header.
+	EntitlementsDER []byte
+	// Requirements contains the internal requirements.
+	Requirements *Requirements
+	// CMS is the CMS signature, if any, without the blob header.
+	// Ad-hoc signatures have an empty CMS blob or none at all.
+	CMS []byte
+	// Raw is the entire SuperBlob.
+	Raw []byte
+}
+
+// Requirements represents the internal requirements blob.
+type Requirements struct {
+	Entries []Requirement
+	// Raw is the entire requirements blob, including its header.
+	Raw []byte
+}
+
+// RequirementType is the type of an internal requirement.
+type RequirementType uint32
+
+// Requirement types, see cs_blobs.h.
+const (
+	HostRequirementType       RequirementType = 1
+	GuestRequirementType      RequirementType = 2
+	DesignatedRequirementType RequirementType = 3
+	LibraryRequirementType    RequirementType = 4
+	PluginRequirementType     RequirementType = 5
+)
+
+// String implements fmt.Stringer.
+func (r RequirementType) String() string {
+	switch r {
+	case HostRequirementType:
+		return "host"
+	case GuestRequirementType:
+		return "guest"
+	case DesignatedRequirementType:
+		return "designated"
+	case LibraryRequirementType:
+		return "library"
+	case PluginRequirementType:
+		return "plugin"
+	}
+	return fmt.Sprintf("RequirementType(%d)", uint32(r))
+}
+
+// Requirement represents a single compiled requirement.
+type Requirement struct {
+	Type RequirementType
+	// Raw is the compiled requirement blob, including its header.
+	Raw []byte
+}
+
+// EntitlementsMap returns the XML entitlements as a map.
+func (s *Signature) EntitlementsMap() (map[string]any, error) {
+	if len(s.Entitlements) == 0 {
+		return nil, nil
+	}
+	var ent map[string]any
+	if _, err := plist.Unmarshal(s.Entitlements, &ent); err != nil {
+		return nil, fmt.Errorf("failed to parse entitlements: %w", err)
+	}
+	return ent, nil
+}
+
+// CodeDirectories returns the primary and alternate CodeDirectories.
+func (s *Signature) CodeDirectories() []*CodeDirectory {
+	cds := make([]*CodeDirectory, 0, 1+len(s.AlternateCodeDirectories))
+	if s.CodeDirectory != nil {
+		cds = append(cds, s.CodeDirectory)
+	}
+	return append(cds, s.AlternateCodeDirectories...)
+}
+
+// BestCodeDirectory returns the CodeDirectory that uses the strongest
+// hash, this is the one used by the kernel for the cdhash of the code.
+func (s *Signature) BestCodeDirectory() *CodeDirectory {
+	var best *CodeDirectory
+	for _, cd := range s.CodeDirectories() {
+		if best == nil || rankHash(cd.HashType) > rankHash(best.HashType) {
+			best = cd
+		}
+	}
+	return best
+}
+
+func rankHash(h HashType) int {
+	switch h {
+	case HashSHA1:
+		return 1
+	case HashSHA256Truncated:
+		return 2
+	case HashSHA256:
+		return 3
+	case HashSHA384:
+		return 4
+	}
+	return 0
+}
+
+// Blob returns the raw contents of the blob, including its header,
+// stored in the specified slot.
+func (s *Signature) Blob(slot Slot) ([]byte, bool) {
+	for _, idx := range s.Index {
+		if idx.Type == slot {
+			return s.Raw[idx.Offset : idx.Offset+idx.Length], true
+		}
+	}
+	return nil, false
+}
+
+// blobAt returns the magic number and contents of the blob at offset.
+func blobAt(data []byte, offset uint32) (uint32, []byte, error) {
+	if int(offset)+8 > len(data) {
+		return 0, nil, fmt.Errorf("blob offset %d out of range (%d)", offset, len(data))
+	}
+	magic := binary.BigEndian.Uint32(data[offset:])
+	length := binary.BigEndian.Uint32(data[offset+4:])
+	if length < 8 || uint64(offset)+uint64(length) > uint64(len(data)) {
+		return 0, nil, fmt.Errorf("blob at offset %d has invalid length %d", offset, length)
+	}
+	return magic, data[offset : offset+length], nil
+}
+
+// ParseSignature parses an embedded signature SuperBlob.
+func ParseSignature(data []byte) (*Signature, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("signature too short: %d bytes", len(data))
+	}
+	be := binary.BigEndian
+	if magic := be.Uint32(data); magic != MagicEmbeddedSignature {
+		return nil, fmt.Errorf("bad embedded signature magic: %#x", magic)
+	}
+	length := be.Uint32(data[4:])
+	if length < 12 {
+		return nil, fmt.Errorf("signature has invalid length %d", length)
+	}
+	if int(length) > len(data) {
+		return nil, fmt.Errorf("signature length %d exceeds available data %d", length, len(data))
+	}
+	data = data[:length]
+	count := be.Uint32(data[8:])
+	if uint64(12)+uint64(count)*8 > uint64(len(data)) {
+		return nil, fmt.Errorf("signature index with %d entries exceeds available data", count)
+	}
+	sig := &Signature{Raw: data}
+	for i := range count {
+		off := 12 + i*8
+		idx := BlobIndex{
+			Type:   Slot(be.Uint32(data[off:])),
+			Offset: be.Uint32(data[off+4:]),
+		}
+		magic, blob, err := blobAt(data, idx.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", idx.Type, err)
+		}
+		idx.Magic, idx.Length = magic, uint32(len(blob))
+		sig.Index = append(sig.Index, idx)
+		if err := sig.addBlob(idx.Type, magic, blob); err != nil {
+			return nil, fmt.Errorf("%v: %w", idx.Type, err)
+		}
+	}
+	if sig.CodeDirectory == nil {
+		return nil, fmt.Errorf("signature does not contain a code directory")
+	}
+	return sig, nil
+}
+
+func (s *Signature) addBlob(slot Slot, magic uint32, blob []byte) error {
+	switch {
+	case slot == SlotCodeDirectory:
+		cd, err := ParseCodeDirectory(blob)
+		if err != nil {
+			return err
+		}
+		s.CodeDirectory = cd
+	case slot >= SlotAlternateCodeDirectories && slot < SlotAlternateCodeDirectories+5:
+		cd, err := ParseCodeDirectory(blob)
+		if err != nil {
+			return err
+		}
+		s.AlternateCodeDirectories = append(s.AlternateCodeDirectories, cd)
+	case slot == SlotEntitlements:
+		if magic != MagicEmbeddedEntitlements {
+			return fmt.Errorf("bad entitlements magic: %#x", magic)
+		}
+		s.Entitlements = blob[8:]
+	case slot == SlotEntitlementsDER:
+		if magic != MagicEmbeddedDEREntitlements {
+			return fmt.Errorf("bad DER entitlements magic: %#x", magic)
+		}
+		s.EntitlementsDER = blob[8:]
+	case slot == SlotRequirements:
+		req, err := ParseRequirements(blob)
+		if err != nil {
+			return err
+		}
+		s.Requirements = req
+	case slot == SlotSignature:
+		if magic != MagicBlobWrapper {
+			return fmt.Errorf("bad signature magic: %#x", magic)
+		}
+		s.CMS = blob[8:]
+	}
+	return nil
+}
+
+// ParseRequirements parses an internal requirements blob.
+func ParseRequirements(data []byte) (*Requirements, error) {
+	magic, blob, err := blobAt(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if magic != MagicRequirements {
+		return nil, fmt.Errorf("bad requirements magic: %#x", magic)
+	}
+	if len(blob) < 12 {
+		return nil, fmt.Errorf("requirements blob too short: %d bytes", len(blob))
+	}
+	be := binary.BigEndian
+	count := be.Uint32(blob[8:])
+	if uint64(12)+uint64(count)*8 > uint64(len(blob)) {
+		return nil, fmt.Errorf("requirements index with %d entries exceeds available data", count)
+	}
+	reqs := &Requirements{Raw: blob}
+	for i := range count {
+		off := 12 + i*8
+		typ := RequirementType(be.Uint32(blob[off:]))
+		magic, req, err := blobAt(blob, be.Uint32(blob[off+4:]))
+		if err != nil {
+			return nil, fmt.Errorf("requirement %v: %w", typ, err)
+		}
+		if magic != MagicRequirement {
+			return nil, fmt.Errorf("requirement %v: bad magic: %#x", typ, magic)
+		}
+		reqs.Entries = append(reqs.Entries, Requirement{Type: typ, Raw: req})
+	}
+	return reqs, nil
+}
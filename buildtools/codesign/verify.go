@@ -0,0 +1,572 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // G505, SHA1 is part of the code signing format.
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IssueKind identifies the type of a verification Issue.
+type IssueKind int
+
+// Issue kinds.
+const (
+	IssueUnsigned         IssueKind = iota // a Mach-O slice has no signature.
+	IssueMalformed                         // a signature or CodeResources file could not be parsed.
+	IssuePageHash                          // a code page hash does not match.
+	IssueSpecialSlot                       // a special slot hash does not match.
+	IssueResourceMissing                   // a sealed resource is missing.
+	IssueResourceModified                  // a sealed resource has been modified.
+	IssueResourceAdded                     // a resource is present that is not sealed.
+	IssueNestedCode                        // the cdhash of nested code does not match.
+)
+
+// String implements fmt.Stringer.
+func (k IssueKind) String() string {
+	switch k {
+	case IssueUnsigned:
+		return "unsigned"
+	case IssueMalformed:
+		return "malformed"
+	case IssuePageHash:
+		return "page hash mismatch"
+	case IssueSpecialSlot:
+		return "special slot mismatch"
+	case IssueResourceMissing:
+		return "resource missing"
+	case IssueResourceModified:
+		return "resource modified"
+	case IssueResourceAdded:
+		return "resource added"
+	case IssueNestedCode:
+		return "nested code modified"
+	}
+	return fmt.Sprintf("IssueKind(%d)", int(k))
+}
+
+// Issue describes a single divergence between a signature and the
+// file or files that it covers.
+type Issue struct {
+	Kind IssueKind
+	// Path is the file that the issue refers to, relative to the
+	// bundle root when verifying a bundle.
+	Path string
+	// Arch is the architecture of the slice, if any, that the
+	// issue refers to.
+	Arch string
+	// HashType is the hash type of the CodeDirectory, if any, that the
+	// issue refers to.
+	HashType HashType
+	// Page is the index of the code page for IssuePageHash.
+	Page int
+	// Slot is the special slot for IssueSpecialSlot.
+	Slot   Slot
+	Detail string
+}
+
+// String implements fmt.Stringer.
+func (i Issue) String() string {
+	var out strings.Builder
+	out.WriteString(i.Path)
+	if i.Arch != "" {
+		fmt.Fprintf(&out, " (%s)", i.Arch)
+	}
+	fmt.Fprintf(&out, ": %v", i.Kind)
+	switch i.Kind {
+	case IssuePageHash:
+		fmt.Fprintf(&out, ": %v page %d", i.HashType, i.Page)
+	case IssueSpecialSlot:
+		fmt.Fprintf(&out, ": %v slot %v", i.HashType, i.Slot)
+	}
+	if i.Detail != "" {
+		fmt.Fprintf(&out, ": %s", i.Detail)
+	}
+	return out.String()
+}
+
+// Issues represents the set of issues found when verifying a file
+// or bundle.
+type Issues []Issue
+
+// Err returns an error that lists all of the issues, or nil
+// if there are none.
+func (is Issues) Err() error {
+	if len(is) == 0 {
+		return nil
+	}
+	errs := make([]error, len(is))
+	for i, issue := range is {
+		errs[i] = errors.New(issue.String())
+	}
+	return errors.Join(errs...)
+}
+
+// VerifyOption represents an option to VerifyFile.
+type VerifyOption func(o *verifyOptions)
+
+type verifyOptions struct {
+	displayPath   string
+	infoPlist     []byte
+	codeResources []byte
+}
+
+// WithInfoPlist specifies the contents of the Info.plist file whose
+// hash is expected in the SlotInfo special slot.
+func WithInfoPlist(data []byte) VerifyOption {
+	return func(o *verifyOptions) {
+		o.infoPlist = data
+	}
+}
+
+// WithCodeResources specifies the contents of the CodeResources file whose
+// hash is expected in the SlotResourceDir special slot.
+func WithCodeResources(data []byte) VerifyOption {
+	return func(o *verifyOptions) {
+		o.codeResources = data
+	}
+}
+
+// WithDisplayPath specifies the path to use in any reported Issues.
+func WithDisplayPath(path string) VerifyOption {
+	return func(o *verifyOptions) {
+		o.displayPath = path
+	}
+}
+
+// VerifyFile verifies the embedded signature of every slice within the
+// named Mach-O file. It recomputes the page hashes for every
+// CodeDirectory and compares the special slot hashes with the
+// requirements and entitlements blobs, and, if specified via options,
+// with the Info.plist and CodeResources files. An Info.plist embedded
+// in the file, see EmbeddedInfoPlist, is used if none is specified.
+// The returned error is only non-nil if the file could not be read; all
+// divergences are reported as Issues.
+func VerifyFile(path string, opts ...VerifyOption) (Issues, error) {
+	o := verifyOptions{displayPath: path}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	slices, err := Parse(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		if errors.Is(err, ErrNotMachO) {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+		return Issues{{Kind: IssueMalformed, Path: o.displayPath, Detail: err.Error()}}, nil
+	}
+	if o.infoPlist == nil {
+		if o.infoPlist, err = EmbeddedInfoPlist(bytes.NewReader(data)); err != nil {
+			return Issues{{Kind: IssueMalformed, Path: o.displayPath, Detail: err.Error()}}, nil
+		}
+	}
+	var issues Issues
+	for _, s := range slices {
+		issues = append(issues, verifySlice(o, data[s.Offset:s.Offset+s.Size], s)...)
+	}
+	return issues, nil
+}
+
+func verifySlice(o verifyOptions, data []byte, s Slice) Issues {
+	arch := s.Arch()
+	if !s.Signed() {
+		return Issues{{Kind: IssueUnsigned, Path: o.displayPath, Arch: arch}}
+	}
+	var issues Issues
+	for _, cd := range s.Signature.CodeDirectories() {
+		for _, issue := range verifyCodeDirectory(o, data, s, cd) {
+			issue.Path, issue.Arch, issue.HashType = o.displayPath, arch, cd.HashType
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+func verifyCodeDirectory(o verifyOptions, data []byte, s Slice, cd *CodeDirectory) Issues {
+	sig := s.Signature
+	if cd.HashType.New() == nil {
+		return Issues{{Kind: IssueMalformed, Detail: fmt.Sprintf("unsupported hash type: %v", cd.HashType)}}
+	}
+	if cd.CodeLimit > uint64(len(data)) {
+		return Issues{{Kind: IssueMalformed, Detail: fmt.Sprintf("code limit %d exceeds slice size %d", cd.CodeLimit, len(data))}}
+	}
+	issues := verifyPages(data[:cd.CodeLimit], s.Offset, cd)
+	reqs, _ := sig.Blob(SlotRequirements)
+	ent, _ := sig.Blob(SlotEntitlements)
+	der, _ := sig.Blob(SlotEntitlementsDER)
+	for _, sl := range []struct {
+		slot Slot
+		data []byte
+	}{
+		{SlotInfo, o.infoPlist},
+		{SlotRequirements, reqs},
+		{SlotResourceDir, o.codeResources},
+		{SlotEntitlements, ent},
+		{SlotEntitlementsDER, der},
+	} {
+		if issue, ok := verifySpecialSlot(cd, sl.slot, sl.data); !ok {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// verifyPages verifies the page hashes of code, which starts at the
+// specified offset within the file.
+func verifyPages(code []byte, offset int64, cd *CodeDirectory) Issues {
+	pageSize := cd.PageSize
+	if pageSize == 0 {
+		pageSize = max(len(code), 1)
+	}
+	npages := (len(code) + pageSize - 1) / pageSize
+	if npages != cd.NCodeSlots {
+		return Issues{{Kind: IssueMalformed, Detail: fmt.Sprintf("code directory has %d code slots, the code requires %d", cd.NCodeSlots, npages)}}
+	}
+	var issues Issues
+	for i := range npages {
+		page := code[i*pageSize : min((i+1)*pageSize, len(code))]
+		if !bytes.Equal(cd.HashType.Sum(page), cd.CodeSlots[i]) {
+			issues = append(issues, Issue{Kind: IssuePageHash, Page: i,
+				Detail: fmt.Sprintf("file offset %#x", offset+int64(i*pageSize))})
+		}
+	}
+	return issues
+}
+
+// verifySpecialSlot checks the hash in the specified special slot.
+// A nil data value indicates that the corresponding data is not
+// available and the slot is only checked if the data is expected
+// to be absent, ie. for blobs within the signature.
+func verifySpecialSlot(cd *CodeDirectory, slot Slot, data []byte) (Issue, bool) {
+	recorded, present := cd.SpecialSlot(slot)
+	external := slot == SlotInfo || slot == SlotResourceDir
+	switch {
+	case data == nil && !present:
+		return Issue{}, true
+	case data == nil && external:
+		// Not provided by the caller, so cannot be checked.
+		return Issue{}, true
+	case data == nil:
+		return Issue{Kind: IssueSpecialSlot, Slot: slot, Detail: "hash recorded but blob is missing"}, false
+	case !present:
+		return Issue{Kind: IssueSpecialSlot, Slot: slot, Detail: "data present but no hash recorded"}, false
+	}
+	if computed := cd.HashType.Sum(data); !bytes.Equal(computed, recorded) {
+		return Issue{Kind: IssueSpecialSlot, Slot: slot,
+			Detail: fmt.Sprintf("recorded %x, computed %x", recorded, computed)}, false
+	}
+	return Issue{}, true
+}
+
+// bundleLayout describes the location of the key files within a bundle.
+type bundleLayout struct {
+	root       string // the bundle directory.
+	contents   string // the directory that resources are relative to, eg. Contents or Versions/A.
+	executable string // path of the main executable relative to contents, if any.
+	infoPlist  string // path of the Info.plist relative to contents, if any.
+	// missing is the path, relative to contents, at which the main
+	// executable named by the Info.plist was expected if it does not exist.
+	missing string
+}
+
+// codeResourcesPath is the location of the CodeResources file
+// relative to the bundle's contents directory.
+var codeResourcesPath = filepath.Join("_CodeSignature", "CodeResources")
+
+func newBundleLayout(root string) (bundleLayout, error) {
+	l := bundleLayout{root: root, contents: root}
+	if fi, err := os.Stat(filepath.Join(root, "Contents")); err == nil && fi.IsDir() {
+		l.contents = filepath.Join(root, "Contents")
+	} else if current, err := os.Readlink(filepath.Join(root, "Versions", "Current")); err == nil && filepath.IsLocal(current) {
+		// A versioned framework, its current version is signed.
+		l.contents = filepath.Join(root, "Versions", current)
+	}
+	for _, p := range []string{"Info.plist", filepath.Join("Resources", "Info.plist")} {
+		if _, err := os.Stat(filepath.Join(l.contents, p)); err == nil {
+			l.infoPlist = p
+			break
+		}
+	}
+	if l.infoPlist == "" {
+		return l, fmt.Errorf("%v: no Info.plist found", root)
+	}
+	info, err := readBundleInfo(filepath.Join(l.contents, l.infoPlist))
+	if err != nil {
+		return l, err
+	}
+	if exe := info.executable; exe != "" {
+		for _, p := range []string{filepath.Join("MacOS", exe), exe} {
+			if _, err := os.Stat(filepath.Join(l.contents, p)); err == nil {
+				l.executable = p
+				break
+			}
+		}
+		if l.executable == "" {
+			l.missing = exe
+			if l.contents == filepath.Join(root, "Contents") {
+				l.missing = filepath.Join("MacOS", exe)
+			}
+		}
+	}
+	return l, nil
+}
+
+// VerifyBundle verifies the signature of the bundle at path. It verifies
+// the main executable and all nested code via VerifyFile and checks
+// every resource sealed in _CodeSignature/CodeResources against the
+// files on disk, reporting any that are missing, modified or have
+// been added. A main executable named by the Info.plist that does
+// not exist is reported as missing. The returned error is only
+// non-nil if the bundle could not be read; all divergences are
+// reported as Issues.
+func VerifyBundle(path string) (Issues, error) {
+	return verifyBundle(path, filepath.Base(path))
+}
+
+func verifyBundle(path, display string) (Issues, error) {
+	layout, err := newBundleLayout(path)
+	if err != nil {
+		return nil, err
+	}
+	rel := func(p string) string {
+		r, _ := filepath.Rel(layout.root, filepath.Join(layout.contents, p))
+		return filepath.Join(display, r)
+	}
+	info, err := os.ReadFile(filepath.Join(layout.contents, layout.infoPlist))
+	if err != nil {
+		return nil, err
+	}
+	crData, err := os.ReadFile(filepath.Join(layout.contents, codeResourcesPath))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var issues Issues
+	if layout.executable != "" {
+		opts := []VerifyOption{WithDisplayPath(rel(layout.executable)), WithInfoPlist(info)}
+		if crData != nil {
+			opts = append(opts, WithCodeResources(crData))
+		}
+		exeIssues, err := VerifyFile(filepath.Join(layout.contents, layout.executable), opts...)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, exeIssues...)
+	}
+	if layout.missing != "" {
+		issues = append(issues, Issue{Kind: IssueResourceMissing, Path: rel(layout.missing),
+			Detail: "main executable named by CFBundleExecutable does not exist"})
+	}
+	if crData == nil {
+		return append(issues, Issue{Kind: IssueResourceMissing, Path: rel(codeResourcesPath),
+			Detail: "bundle resources are not sealed"}), nil
+	}
+	cr, err := ParseCodeResources(crData)
+	if err != nil {
+		return append(issues, Issue{Kind: IssueMalformed, Path: rel(codeResourcesPath), Detail: err.Error()}), nil
+	}
+	resIssues, err := verifyResources(layout, cr, rel)
+	if err != nil {
+		return nil, err
+	}
+	return append(issues, resIssues...), nil
+}
+
+// resourceFile represents a file, symlink or nested bundle found
+// within a bundle.
+type resourceFile struct {
+	path    string // relative to the bundle's contents directory.
+	symlink bool
+	bundle  bool
+}
+
+// walkResources returns all of the files within the bundle that are
+// subject to sealing, nested bundles are returned as a single entry.
+func walkResources(layout bundleLayout, rules []ResourceRule) ([]resourceFile, error) {
+	var files []resourceFile
+	err := filepath.WalkDir(layout.contents, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(layout.contents, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "_CodeSignature" || rel == layout.executable {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rule, _ := MatchRule(rules, rel)
+		if rule.Omit {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if rule.Nested && isBundleDir(p) {
+				files = append(files, resourceFile{path: rel, bundle: true})
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files = append(files, resourceFile{path: rel, symlink: d.Type()&fs.ModeSymlink != 0})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, err
+}
+
+// bundleExtensions are the directory extensions that are treated as
+// nested bundles.
+var bundleExtensions = map[string]bool{
+	".app":             true,
+	".appex":           true,
+	".bundle":          true,
+	".framework":       true,
+	".kext":            true,
+	".plugin":          true,
+	".xpc":             true,
+	".systemextension": true,
+}
+
+func isBundleDir(p string) bool {
+	return bundleExtensions[filepath.Ext(p)]
+}
+
+func verifyResources(layout bundleLayout, cr *CodeResources, rel func(string) string) (Issues, error) {
+	rules := cr.Rules2
+	files, err := walkResources(layout, rules)
+	if err != nil {
+		return nil, err
+	}
+	var issues Issues
+	seen := map[string]bool{}
+	for _, f := range files {
+		seen[f.path] = true
+		entry, ok := cr.Files2[f.path]
+		if !ok {
+			issues = append(issues, Issue{Kind: IssueResourceAdded, Path: rel(f.path)})
+			continue
+		}
+		fileIssues, err := verifyResource(layout, f, entry, rel)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, fileIssues...)
+	}
+	names := make([]string, 0, len(cr.Files2))
+	for name := range cr.Files2 {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !seen[name] && !cr.Files2[name].Optional {
+			issues = append(issues, Issue{Kind: IssueResourceMissing, Path: rel(name)})
+		}
+	}
+	return issues, nil
+}
+
+func verifyResource(layout bundleLayout, f resourceFile, entry ResourceEntry, rel func(string) string) (Issues, error) {
+	path := filepath.Join(layout.contents, filepath.FromSlash(f.path))
+	switch {
+	case f.symlink:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		if target != entry.Symlink {
+			return Issues{{Kind: IssueResourceModified, Path: rel(f.path),
+				Detail: fmt.Sprintf("symlink target %q, sealed %q", target, entry.Symlink)}}, nil
+		}
+		return nil, nil
+	case entry.CDHash != nil:
+		return verifyNested(path, f, entry, rel(f.path))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if ok, detail := compareResourceHashes(data, entry); !ok {
+		return Issues{{Kind: IssueResourceModified, Path: rel(f.path), Detail: detail}}, nil
+	}
+	return nil, nil
+}
+
+func compareResourceHashes(data []byte, entry ResourceEntry) (bool, string) {
+	if entry.Hash2 != nil {
+		sum := sha256.Sum256(data)
+		return bytes.Equal(sum[:], entry.Hash2), fmt.Sprintf("sha256 %x, sealed %x", sum, entry.Hash2)
+	}
+	if entry.Hash != nil {
+		sum := sha1.Sum(data) //nolint:gosec // G401
+		return bytes.Equal(sum[:], entry.Hash), fmt.Sprintf("sha1 %x, sealed %x", sum, entry.Hash)
+	}
+	return false, "no hash sealed"
+}
+
+// verifyNested verifies nested code, either a Mach-O file or a
+// nested bundle, and compares its cdhash with the sealed one.
+func verifyNested(path string, f resourceFile, entry ResourceEntry, display string) (Issues, error) {
+	var issues Issues
+	exe := path
+	if f.bundle {
+		nested, err := verifyBundle(path, display)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, nested...)
+		layout, err := newBundleLayout(path)
+		if err != nil {
+			return nil, err
+		}
+		if layout.executable == "" {
+			return issues, nil
+		}
+		exe = filepath.Join(layout.contents, layout.executable)
+	} else {
+		fileIssues, err := VerifyFile(path, WithDisplayPath(display))
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, fileIssues...)
+	}
+	cdhash, err := cdHashOf(exe)
+	if err != nil {
+		return append(issues, Issue{Kind: IssueNestedCode, Path: display, Detail: err.Error()}), nil
+	}
+	if !bytes.Equal(cdhash, entry.CDHash) {
+		issues = append(issues, Issue{Kind: IssueNestedCode, Path: display,
+			Detail: fmt.Sprintf("cdhash %s, sealed %s", hex.EncodeToString(cdhash), hex.EncodeToString(entry.CDHash))})
+	}
+	return issues, nil
+}
+
+// cdHashOf returns the cdhash of the first slice of the named Mach-O file.
+func cdHashOf(path string) ([]byte, error) {
+	slices, err := ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(slices) == 0 || !slices[0].Signed() {
+		return nil, fmt.Errorf("not signed")
+	}
+	return slices[0].Signature.BestCodeDirectory().CDHash, nil
+}
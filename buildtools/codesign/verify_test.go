@@ -0,0 +1,184 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package codesign_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloudeng.io/macos/buildtools/codesign"
+	"howett.net/plist"
+)
+
+func copyFile(t *testing.T, src, dst string, perm os.FileMode) []byte {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, perm); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func writeFile(t *testing.T, data []byte, elems ...string) {
+	t.Helper()
+	p := filepath.Join(elems...)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func kinds(issues codesign.Issues) map[codesign.IssueKind][]codesign.Issue {
+	m := map[codesign.IssueKind][]codesign.Issue{}
+	for _, i := range issues {
+		m[i.Kind] = append(m[i.Kind], i)
+	}
+	return m
+}
+
+func TestVerifyFile(t *testing.T) {
+	issues, err := codesign.VerifyFile(signedBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := issues.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err = codesign.VerifyFile(unsignedBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(issues), 1; got != want {
+		t.Fatalf("got %v, want %v: %v", got, want, issues)
+	}
+	if got, want := issues[0].Kind, codesign.IssueUnsigned; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	modified := filepath.Join(t.TempDir(), "modified")
+	data := copyFile(t, signedBinary, modified, 0600)
+	data[4096*3+10] ^= 0xff
+	writeFile(t, data, modified)
+	issues, err = codesign.VerifyFile(modified, codesign.WithDisplayPath("modified"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(issues), 1; got != want {
+		t.Fatalf("got %v, want %v: %v", got, want, issues)
+	}
+	if got, want := issues[0].Page, 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := issues[0].String(), "modified (arm64): page hash mismatch: sha256 page 3: file offset 0x3000"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The offset reported for a universal file is relative to the start
+	// of the file rather than the slice.
+	data = universal(t, unsignedBinary, signedBinary)
+	slices, err := codesign.Parse(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[slices[1].Offset+4096*3+10] ^= 0xff
+	writeFile(t, data, modified)
+	issues, err = codesign.VerifyFile(modified, codesign.WithDisplayPath("modified"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(issues), 2; got != want {
+		t.Fatalf("got %v, want %v: %v", got, want, issues)
+	}
+	if got, want := issues[1].String(), fmt.Sprintf("modified (arm64): page hash mismatch: sha256 page 3: file offset %#x", slices[1].Offset+0x3000); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func sealedEntry(data []byte) map[string]any {
+	sum := sha256.Sum256(data)
+	return map[string]any{"hash2": sum[:]}
+}
+
+func TestVerifyBundle(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "Test.app")
+	contents := filepath.Join(bundle, "Contents")
+	copyFile(t, signedBinary, filepath.Join(contents, "MacOS", "hello"), 0700)
+	writeFile(t, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict><key>CFBundleExecutable</key><string>hello</string></dict></plist>`),
+		contents, "Info.plist")
+	writeFile(t, []byte("a"), contents, "Resources", "a.txt")
+	writeFile(t, []byte("b"), contents, "Resources", "b.txt")
+	writeFile(t, []byte("d"), contents, "Resources", "d.txt")
+	if err := os.Symlink("a.txt", filepath.Join(contents, "Resources", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	cr := map[string]any{
+		"files2": map[string]any{
+			"Resources/a.txt": sealedEntry([]byte("a")),
+			"Resources/b.txt": sealedEntry([]byte("not b")),
+			"Resources/c.txt": sealedEntry([]byte("c")),
+			"Resources/e.txt": map[string]any{"hash2": []byte{1}, "optional": true},
+			"Resources/link":  map[string]any{"symlink": "b.txt"},
+		},
+		"rules2": map[string]any{
+			"^.*":                    true,
+			"^Info\\.plist$":         map[string]any{"omit": true, "weight": 20},
+			"^MacOS/":                map[string]any{"nested": true, "weight": 10},
+			"^Resources/.*\\.lproj/": map[string]any{"optional": true, "weight": 1000},
+		},
+	}
+	crData, err := plist.Marshal(cr, plist.XMLFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, crData, contents, "_CodeSignature", "CodeResources")
+
+	issues, err := codesign.VerifyBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKind := kinds(issues)
+
+	// The linker signed executable is not bound to the Info.plist
+	// or CodeResources.
+	if got, want := len(byKind[codesign.IssueSpecialSlot]), 2; got != want {
+		t.Errorf("got %v, want %v: %v", got, want, issues)
+	}
+	for kind, path := range map[codesign.IssueKind]string{
+		codesign.IssueResourceAdded:   "Test.app/Contents/Resources/d.txt",
+		codesign.IssueResourceMissing: "Test.app/Contents/Resources/c.txt",
+	} {
+		if got := byKind[kind]; len(got) != 1 || got[0].Path != path {
+			t.Errorf("%v: got %v, want %v", kind, got, path)
+		}
+	}
+	modified := byKind[codesign.IssueResourceModified]
+	if got, want := len(modified), 2; got != want {
+		t.Fatalf("got %v, want %v: %v", got, want, modified)
+	}
+	if got, want := modified[0].Path, "Test.app/Contents/Resources/b.txt"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := modified[1].Path, "Test.app/Contents/Resources/link"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(issues), 6; got != want {
+		t.Errorf("got %v, want %v: %v", got, want, issues)
+	}
+}
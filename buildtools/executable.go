@@ -0,0 +1,87 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"cloudeng.io/macos/buildtools/codesign"
+	"howett.net/plist"
+)
+
+// EmbeddedInfoPlistLDFlags returns the value for go build's -ldflags
+// option that embeds the Info.plist file at path in the __TEXT,__info_plist
+// section of the executable being built. External linking is used since
+// the go linker cannot create arbitrary sections, and hence cgo must be
+// enabled.
+func EmbeddedInfoPlistLDFlags(path string) string {
+	return fmt.Sprintf(`-linkmode=external "-extldflags=-sectcreate __TEXT __info_plist '%v'"`, path)
+}
+
+// Executable represents a command line executable that is not packaged
+// in an app bundle but instead has its Info.plist embedded in its
+// __TEXT,__info_plist section. The embedded Info.plist provides the
+// executable with a bundle identity, eg. for keychain access, and the
+// executable's signature is bound to it.
+type Executable struct {
+	Path string
+	Info InfoPlist
+}
+
+// ValidateInfoPlist returns a Step that validates the executable's
+// Info.plist, see InfoPlist.Validate.
+func (e Executable) ValidateInfoPlist() Step {
+	return AppBundle{Info: e.Info}.ValidateInfoPlist()
+}
+
+// WriteInfoPlist returns a Step that writes the executable's Info.plist
+// to the specified file so that it can be embedded in the executable when
+// it is linked, see EmbeddedInfoPlistLDFlags.
+func (e Executable) WriteInfoPlist(path string) Step {
+	return writeInfoPlist(path, e.Info)
+}
+
+// VerifyInfoPlist returns a Step that verifies that the executable has
+// an embedded Info.plist whose CFBundleIdentifier is that of the
+// executable's Info.plist.
+func (e Executable) VerifyInfoPlist() Step {
+	return StepFunc(func(_ context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		if cmdRunner.DryRun() {
+			return NewStepResult("verify embedded Info.plist", []string{e.Path}, nil, nil), nil
+		}
+		err := e.verifyInfoPlist()
+		return NewStepResult("verify embedded Info.plist", []string{e.Path}, nil, err), err
+	})
+}
+
+func (e Executable) verifyInfoPlist() error {
+	data, err := codesign.ReadEmbeddedInfoPlist(e.Path)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("%v: does not contain an embedded Info.plist", e.Path)
+	}
+	var embedded map[string]any
+	if _, err := plist.Unmarshal(data, &embedded); err != nil {
+		return fmt.Errorf("%v: embedded Info.plist: %w", e.Path, err)
+	}
+	got, _ := asString(embedded, "CFBundleIdentifier")
+	want, _ := asString(e.Info.Raw, "CFBundleIdentifier")
+	if got != want {
+		return fmt.Errorf("%v: embedded Info.plist: CFBundleIdentifier: got %q, want %q", e.Path, got, want)
+	}
+	return nil
+}
+
+// Sign returns a Step that signs the executable, using the signer's
+// entitlements for its base name or its default entitlements. The
+// signature is bound to the embedded Info.plist and its identifier is
+// the executable's CFBundleIdentifier.
+func (e Executable) Sign(signer Signer) Step {
+	return signer.SignPath(filepath.Dir(e.Path), filepath.Base(e.Path))
+}
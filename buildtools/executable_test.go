@@ -0,0 +1,119 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"bytes"
+	"context"
+	"debug/macho"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloudeng.io/macos/buildtools"
+	"cloudeng.io/macos/buildtools/codesign"
+	"gopkg.in/yaml.v3"
+)
+
+// embedInfoPlist rewrites the Mach-O file at path so that its
+// __TEXT,__rodata section is renamed to __info_plist and contains the
+// Info.plist at infoPath, as if it had been linked using
+// EmbeddedInfoPlistLDFlags. The result cannot be run, but can be
+// signed and verified.
+func embedInfoPlist(t *testing.T, path, infoPath string) {
+	t.Helper()
+	info, err := os.ReadFile(infoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := macho.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sect := f.Section("__rodata")
+	if sect == nil || sect.Seg != "__TEXT" || sect.Size < uint64(len(info)) {
+		t.Fatalf("%v: no suitable __TEXT,__rodata section", path)
+	}
+	copy(data[sect.Offset:], info)
+	hdr := make([]byte, 32)
+	copy(hdr, "__rodata")
+	copy(hdr[16:], "__TEXT")
+	i := bytes.Index(data, hdr)
+	copy(data[i:i+16], append([]byte("__info_plist"), 0, 0, 0, 0))
+	binary.LittleEndian.PutUint64(data[i+40:], uint64(len(info)))
+	if err := os.WriteFile(path, data, 0755); err != nil { //nolint:gosec // G306
+		t.Fatal(err)
+	}
+}
+
+func TestEmbeddedInfoPlistLDFlags(t *testing.T) {
+	if got, want := buildtools.EmbeddedInfoPlistLDFlags("/tmp/x/Info.plist"), `-linkmode=external "-extldflags=-sectcreate __TEXT __info_plist '/tmp/x/Info.plist'"`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestExecutable(t *testing.T) {
+	ctx := context.Background()
+	binary := buildDarwinBinary(t)
+	infoPath := filepath.Join(t.TempDir(), "Info.plist")
+	exe := buildtools.Executable{
+		Path: binary,
+		Info: unmarshalInfoPlist(t, plistYAML),
+	}
+
+	_, err := exe.VerifyInfoPlist().Run(ctx, buildtools.NewCommandRunner())
+	if err == nil || !strings.Contains(err.Error(), "does not contain an embedded Info.plist") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+
+	var ents buildtools.Entitlements
+	if err := yaml.Unmarshal([]byte("com.apple.security.network.client: true\n"), &ents); err != nil {
+		t.Fatal(err)
+	}
+	signer := buildtools.NewSigner("-", &ents, nil, nil,
+		buildtools.WithSigningBackend(buildtools.AdHocBackend{}))
+
+	runner := buildtools.NewRunner()
+	runner.AddSteps(exe.ValidateInfoPlist(), exe.WriteInfoPlist(infoPath))
+	if err := runner.Run(ctx, buildtools.NewCommandRunner()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	embedInfoPlist(t, binary, infoPath)
+
+	dir, base := filepath.Split(binary)
+	runner = buildtools.NewRunner()
+	runner.AddSteps(
+		exe.VerifyInfoPlist(),
+		exe.Sign(signer),
+		signer.VerifyEntitlements(dir, base),
+		buildtools.VerifyPathOffline(dir, base),
+	)
+	results := runner.Run(ctx, buildtools.NewCommandRunner())
+	if err := results.Error(); err != nil {
+		for _, r := range results {
+			t.Log(r.String())
+		}
+		t.Fatal(err)
+	}
+	slices, err := codesign.ParseFile(binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := slices[0].Signature.CodeDirectory.Identifier, "io.cloudeng.TestApp"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	exe.Info.Raw["CFBundleIdentifier"] = "io.cloudeng.Other"
+	_, err = exe.VerifyInfoPlist().Run(ctx, buildtools.NewCommandRunner())
+	if err == nil || !strings.Contains(err.Error(), `CFBundleIdentifier: got "io.cloudeng.TestApp", want "io.cloudeng.Other"`) {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+}
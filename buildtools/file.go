@@ -74,6 +74,14 @@ func Rename(oldname, newname string) Step {
 	})
 }
 
+// Symlink returns a Step that creates, or replaces, a symbolic link at
+// link that refers to target using ln -sfn.
+func Symlink(target, link string) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		return cmdRunner.Run(ctx, "ln", "-sfn", target, link)
+	})
+}
+
 // Copy returns a Step that copies a file using cp.
 func Copy(oldname, newname string) Step {
 	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
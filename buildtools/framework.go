@@ -0,0 +1,219 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"strings"
+)
+
+// Framework represents a macOS framework bundle that packages a shared
+// library, typically a Go package built with -buildmode=c-shared, so that
+// it can be linked against by Swift and Objective-C code. It uses the
+// versioned layout:
+//
+//	<Name>.framework/
+//	  <Name> -> Versions/Current/<Name>
+//	  Headers -> Versions/Current/Headers
+//	  Modules -> Versions/Current/Modules
+//	  Resources -> Versions/Current/Resources
+//	  Versions/
+//	    Current -> A
+//	    A/
+//	      <Name>
+//	      Headers/<Name>.h
+//	      Modules/module.modulemap
+//	      Resources/Info.plist
+type Framework struct {
+	Path    string // eg. build/GoLib.framework
+	Version string // the version directory, defaults to A.
+	// Info is the framework's Info.plist, CFBundleExecutable, CFBundleName
+	// and CFBundlePackageType (FMWK) are set if not already specified.
+	Info InfoPlist
+}
+
+// Name returns the name of the framework, ie. the base name of its path
+// without the .framework extension, which is also the name of the library
+// within it.
+func (f Framework) Name() string {
+	return strings.TrimSuffix(filepath.Base(f.Path), ".framework")
+}
+
+func (f Framework) version() string {
+	if f.Version == "" {
+		return "A"
+	}
+	return f.Version
+}
+
+// Versioned returns the path to the specified element within the
+// framework's version directory, eg. Versions/A.
+func (f Framework) Versioned(elem ...string) string {
+	return filepath.Join(f.Path, "Versions", f.version(), filepath.Join(elem...))
+}
+
+// LibraryPath returns the path to the framework's library.
+func (f Framework) LibraryPath() string {
+	return f.Versioned(f.Name())
+}
+
+// HeaderPath returns the path to the framework's umbrella header.
+func (f Framework) HeaderPath() string {
+	return f.Versioned("Headers", f.Name()+".h")
+}
+
+// InstallName returns the install name for the framework's library,
+// ie. @rpath/<Name>.framework/Versions/A/<Name>, so that executables
+// that link against it find it via their run path search list, eg.
+// @executable_path/../Frameworks for an app bundle.
+func (f Framework) InstallName() string {
+	return fmt.Sprintf("@rpath/%[1]v.framework/Versions/%[2]v/%[1]v", f.Name(), f.version())
+}
+
+// Create returns the steps required to create the framework's directory
+// structure and symbolic links. The top-level symbolic link to the
+// library will be dangling until the library is built or copied.
+func (f Framework) Create() []Step {
+	if filepath.Ext(f.Path) != ".framework" {
+		return []Step{ErrorStep(fmt.Errorf("%q is not a framework", f.Path), "mkdir", "-p")}
+	}
+	steps := []Step{
+		MkdirAll(f.Versioned("Headers")),
+		MkdirAll(f.Versioned("Modules")),
+		MkdirAll(f.Versioned("Resources")),
+		Symlink(f.version(), filepath.Join(f.Path, "Versions", "Current")),
+	}
+	for _, name := range []string{f.Name(), "Headers", "Modules", "Resources"} {
+		steps = append(steps, Symlink(filepath.Join("Versions", "Current", name), filepath.Join(f.Path, name)))
+	}
+	return steps
+}
+
+// BuildGoLibrary returns the steps required to build the specified Go
+// package with -buildmode=c-shared as the framework's library, to move
+// the cgo generated header into the Headers directory and to set the
+// library's install name. The args are passed to go build, eg. -tags.
+// The steps are run in the current directory, or that specified via
+// ContextWithCWD.
+func (f Framework) BuildGoLibrary(pkg string, args ...string) []Step {
+	buildArgs := append([]string{"build", "-buildmode=c-shared", "-o", f.LibraryPath()}, args...)
+	buildArgs = append(buildArgs, pkg)
+	return []Step{
+		StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+			return cmdRunner.Run(ctx, "go", buildArgs...)
+		}),
+		Rename(f.Versioned(f.Name()+".h"), f.HeaderPath()),
+		f.SetInstallName(),
+	}
+}
+
+// CopyLibrary returns the steps required to copy a previously built
+// shared library and its header into the framework and to set the
+// library's install name.
+func (f Framework) CopyLibrary(library, header string) []Step {
+	return []Step{
+		Copy(library, f.LibraryPath()),
+		Copy(header, f.HeaderPath()),
+		f.SetInstallName(),
+	}
+}
+
+// SetInstallName returns a Step that sets the install name of the
+// framework's library to InstallName using install_name_tool.
+func (f Framework) SetInstallName() Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		return cmdRunner.Run(ctx, "install_name_tool", "-id", f.InstallName(), f.LibraryPath())
+	})
+}
+
+// ModuleMap returns the contents of the framework's module map which
+// makes the umbrella header available to Swift as a module with the
+// framework's name, ie. import <Name>.
+func (f Framework) ModuleMap() string {
+	return fmt.Sprintf(`framework module %[1]v {
+    umbrella header "%[1]v.h"
+
+    export *
+    module * { export * }
+}
+`, f.Name())
+}
+
+// WriteModuleMap returns a Step that writes the framework's module map
+// to Modules/module.modulemap.
+func (f Framework) WriteModuleMap() Step {
+	return WriteFile([]byte(f.ModuleMap()), 0644, f.Versioned("Modules", "module.modulemap"))
+}
+
+// info returns the framework's Info.plist with the required keys set.
+func (f Framework) info() (InfoPlist, error) {
+	info := f.Info
+	info.Raw = maps.Clone(f.Info.Raw)
+	if info.Raw == nil {
+		info.Raw = map[string]any{}
+	}
+	var errs []error
+	for key, val := range map[string]string{
+		"CFBundleExecutable":  f.Name(),
+		"CFBundlePackageType": "FMWK",
+	} {
+		if v, ok := info.Raw[key]; ok && v != val {
+			errs = append(errs, fmt.Errorf("%v: %q must be %q for a framework", key, v, val))
+		}
+		info.Raw[key] = val
+	}
+	if _, ok := info.Raw["CFBundleName"]; !ok {
+		info.Raw["CFBundleName"] = f.Name()
+	}
+	if _, ok := info.Raw["CFBundleInfoDictionaryVersion"]; !ok {
+		info.Raw["CFBundleInfoDictionaryVersion"] = "6.0"
+	}
+	if id, _ := asString(info.Raw, "CFBundleIdentifier"); id == "" {
+		errs = append(errs, fmt.Errorf("CFBundleIdentifier is not set"))
+	}
+	info.CFBundleExecutable = f.Name()
+	info.CFBundlePackageType = "FMWK"
+	return info, errors.Join(errs...)
+}
+
+// WriteInfoPlist returns a Step that writes the framework's Info.plist to
+// Resources/Info.plist. CFBundleExecutable, CFBundlePackageType, CFBundleName
+// and CFBundleInfoDictionaryVersion are set if not specified and an error
+// is returned if CFBundleIdentifier is not set or if CFBundleExecutable or
+// CFBundlePackageType have incorrect values.
+func (f Framework) WriteInfoPlist() Step {
+	path := f.Versioned("Resources", "Info.plist")
+	info, err := f.info()
+	if err != nil {
+		return ErrorStep(fmt.Errorf("invalid framework Info.plist: %w", err), "write Info.plist", path)
+	}
+	return writeInfoPlist(path, info)
+}
+
+// WithFrameworks returns a copy of the SwiftApp that, when built, links
+// against the specified frameworks, which are imported as modules with
+// the same names as the frameworks. The run path search list includes
+// @executable_path/../Frameworks so that the frameworks are found once
+// embedded in an app bundle's Contents/Frameworks directory, see
+// AppBundle.EmbedFramework.
+func (s SwiftApp) WithFrameworks(frameworks ...Framework) SwiftApp {
+	args := append([]string{}, s.buildArgs...)
+	dirs := map[string]bool{}
+	for _, fw := range frameworks {
+		dir := filepath.Dir(fw.Path)
+		if !dirs[dir] {
+			dirs[dir] = true
+			args = append(args, "-Xswiftc", "-F"+dir, "-Xlinker", "-F"+dir)
+		}
+		args = append(args, "-Xlinker", "-framework", "-Xlinker", fw.Name())
+	}
+	args = append(args, "-Xlinker", "-rpath", "-Xlinker", "@executable_path/../Frameworks")
+	s.buildArgs = args
+	return s
+}
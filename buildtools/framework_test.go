@@ -0,0 +1,214 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloudeng.io/macos/buildtools"
+)
+
+const goLibrarySource = `package main
+
+import "C"
+
+//export GoLibAdd
+func GoLibAdd(a, b C.int) C.int { return a + b }
+
+func main() {}
+`
+
+func TestFramework(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	// Use a fake install_name_tool that records its arguments.
+	bin := t.TempDir()
+	log := filepath.Join(tmpDir, "install_name_tool.log")
+	if err := os.WriteFile(filepath.Join(bin, "install_name_tool"), []byte("#!/bin/sh\necho \"$@\" > "+log+"\n"), 0755); err != nil { //nolint:gosec // G306
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	fw := buildtools.Framework{
+		Path: filepath.Join(tmpDir, "GoLib.framework"),
+		Info: buildtools.InfoPlist{Raw: map[string]any{
+			"CFBundleIdentifier": "io.cloudeng.GoLib",
+			"CFBundleVersion":    "1.0.0",
+		}},
+	}
+	if got, want := fw.Name(), "GoLib"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := fw.InstallName(), "@rpath/GoLib.framework/Versions/A/GoLib"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	lib := filepath.Join(tmpDir, "libgolib.dylib")
+	hdr := filepath.Join(tmpDir, "libgolib.h")
+	for _, f := range []string{lib, hdr} {
+		if err := os.WriteFile(f, []byte(filepath.Base(f)), 0644); err != nil { //nolint:gosec // G306
+			t.Fatal(err)
+		}
+	}
+
+	runner := buildtools.NewRunner()
+	runner.AddSteps(fw.Create()...)
+	runner.AddSteps(fw.CopyLibrary(lib, hdr)...)
+	runner.AddSteps(fw.WriteModuleMap(), fw.WriteInfoPlist())
+	if err := runner.Run(ctx, buildtools.NewCommandRunner()).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, link := range [][2]string{
+		{"Versions/Current", "A"},
+		{"GoLib", "Versions/Current/GoLib"},
+		{"Headers", "Versions/Current/Headers"},
+		{"Modules", "Versions/Current/Modules"},
+		{"Resources", "Versions/Current/Resources"},
+	} {
+		target, err := os.Readlink(filepath.Join(fw.Path, filepath.FromSlash(link[0])))
+		if err != nil || target != filepath.FromSlash(link[1]) {
+			t.Errorf("%v: unexpected symlink: %v: %v", link[0], target, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		path     string
+		contains []string
+	}{
+		{"GoLib", []string{"libgolib.dylib"}},
+		{"Headers/GoLib.h", []string{"libgolib.h"}},
+		{"Modules/module.modulemap", []string{
+			"framework module GoLib {",
+			`umbrella header "GoLib.h"`,
+		}},
+		{"Resources/Info.plist", []string{
+			"<key>CFBundleExecutable</key>\n\t\t<string>GoLib</string>",
+			"<key>CFBundlePackageType</key>\n\t\t<string>FMWK</string>",
+			"<key>CFBundleName</key>\n\t\t<string>GoLib</string>",
+			"<key>CFBundleIdentifier</key>\n\t\t<string>io.cloudeng.GoLib</string>",
+		}},
+	} {
+		// Read via the top-level symlinks.
+		data, err := os.ReadFile(filepath.Join(fw.Path, filepath.FromSlash(tc.path)))
+		if err != nil {
+			t.Errorf("%v: %v", tc.path, err)
+			continue
+		}
+		for _, want := range tc.contains {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%v: %s does not contain %q", tc.path, data, want)
+			}
+		}
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(data)), "-id @rpath/GoLib.framework/Versions/A/GoLib "+fw.LibraryPath(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFrameworkGoLibrary(t *testing.T) {
+	if out, err := exec.Command("go", "env", "CGO_ENABLED").Output(); err != nil || strings.TrimSpace(string(out)) != "1" {
+		t.Skip("cgo is not available")
+	}
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "install_name_tool"), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil { //nolint:gosec // G306
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	src := filepath.Join(tmpDir, "golib")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range map[string]string{
+		"go.mod":  "module example.com/golib\n\ngo 1.21\n",
+		"main.go": goLibrarySource,
+	} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(contents), 0644); err != nil { //nolint:gosec // G306
+			t.Fatal(err)
+		}
+	}
+
+	fw := buildtools.Framework{Path: filepath.Join(tmpDir, "GoLib.framework")}
+	runner := buildtools.NewRunner()
+	runner.AddSteps(fw.Create()...)
+	runner.AddSteps(fw.BuildGoLibrary(".")...)
+	results := runner.Run(buildtools.ContextWithCWD(ctx, src), buildtools.NewCommandRunner())
+	if err := results.Error(); err != nil {
+		for _, r := range results {
+			t.Log(r.String())
+		}
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fw.LibraryPath()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(fw.Path, "Headers", "GoLib.h"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "GoLibAdd") {
+		t.Errorf("header does not declare GoLibAdd: %s", data)
+	}
+	if _, err := os.Stat(fw.Versioned("GoLib.h")); !os.IsNotExist(err) {
+		t.Errorf("header was not moved: %v", err)
+	}
+}
+
+func TestFrameworkErrors(t *testing.T) {
+	ctx := context.Background()
+	cmdRunner := buildtools.NewCommandRunner()
+	fw := buildtools.Framework{Path: filepath.Join(t.TempDir(), "GoLib")}
+	if _, err := fw.Create()[0].Run(ctx, cmdRunner); err == nil || !strings.Contains(err.Error(), "is not a framework") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+
+	fw.Path += ".framework"
+	fw.Info = buildtools.InfoPlist{Raw: map[string]any{
+		"CFBundleExecutable":  "Other",
+		"CFBundlePackageType": "APPL",
+	}}
+	_, err := fw.WriteInfoPlist().Run(ctx, cmdRunner)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		`CFBundleExecutable: "Other" must be "GoLib" for a framework`,
+		`CFBundlePackageType: "APPL" must be "FMWK" for a framework`,
+		"CFBundleIdentifier is not set",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%v does not contain %v", err, want)
+		}
+	}
+}
+
+func TestSwiftAppWithFrameworks(t *testing.T) {
+	ctx := context.Background()
+	app := buildtools.SwiftApp{}.WithFrameworks(
+		buildtools.Framework{Path: "build/GoLib.framework"},
+		buildtools.Framework{Path: "build/Other.framework"},
+	)
+	res, err := app.Build().Run(ctx, buildtools.NewCommandRunner(buildtools.WithDryRun(true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.CommandLine(), "swift build -Xswiftc -Fbuild -Xlinker -Fbuild -Xlinker -framework -Xlinker GoLib -Xlinker -framework -Xlinker Other -Xlinker -rpath -Xlinker @executable_path/../Frameworks "; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -7,7 +7,11 @@ package buildtools
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Git struct {
@@ -51,3 +55,191 @@ func (g Git) ReplaceBranch(version, buildID string) string {
 	}
 	return version[:index] + "+" + buildID
 }
+
+// GitMetadata describes the state of a git repository at the time that
+// a bundle was built so that the bundle can be traced to its source.
+type GitMetadata struct {
+	Commit      string    `yaml:"commit"`
+	ShortCommit string    `yaml:"short-commit"`
+	Branch      string    `yaml:"branch,omitempty"` // empty for a detached HEAD.
+	Tag         string    `yaml:"tag,omitempty"`    // the nearest tag, if any.
+	TagDistance int       `yaml:"tag-distance"`     // the number of commits since Tag.
+	Dirty       bool      `yaml:"dirty"`
+	CommitTime  time.Time `yaml:"commit-time"`
+	Remote      string    `yaml:"remote,omitempty"` // the origin URL without credentials.
+}
+
+// Metadata returns the metadata for the repository's HEAD commit. A
+// repository without tags or without an origin remote is not an error.
+// In dry-run mode the commands are displayed and an empty GitMetadata
+// is returned.
+func (g Git) Metadata(ctx context.Context, cmdRunner *CommandRunner) (GitMetadata, error) {
+	var md GitMetadata
+	var err error
+	if md.Commit, err = g.run(ctx, cmdRunner, "rev-parse", "HEAD"); err != nil {
+		return md, err
+	}
+	res, err := g.Hash(ctx, cmdRunner, "HEAD", 8)
+	if err != nil {
+		return md, err
+	}
+	md.ShortCommit = strings.TrimSpace(res.Output())
+	if md.Branch, err = g.run(ctx, cmdRunner, "rev-parse", "--abbrev-ref", "HEAD"); err != nil {
+		return md, err
+	}
+	if md.Branch == "HEAD" {
+		md.Branch = ""
+	}
+	if describe, err := g.run(ctx, cmdRunner, "describe", "--tags", "--long"); err == nil {
+		md.Tag, md.TagDistance = parseDescribe(describe)
+	}
+	if md.Dirty, err = g.IsDirty(ctx, cmdRunner); err != nil {
+		return md, err
+	}
+	when, err := g.run(ctx, cmdRunner, "show", "-s", "--format=%cI", "HEAD")
+	if err != nil {
+		return md, err
+	}
+	if remote, err := g.run(ctx, cmdRunner, "remote", "get-url", "origin"); err == nil {
+		md.Remote = StripURLCredentials(remote)
+	}
+	if cmdRunner.DryRun() {
+		return GitMetadata{}, nil
+	}
+	if md.CommitTime, err = time.Parse(time.RFC3339, when); err != nil {
+		return md, fmt.Errorf("failed to parse commit time %q: %w", when, err)
+	}
+	return md, nil
+}
+
+// parseDescribe parses the output of git describe --long, ie.
+// <tag>-<distance>-g<hash>, noting that the tag may contain dashes.
+func parseDescribe(describe string) (string, int) {
+	parts := strings.Split(describe, "-")
+	if len(parts) < 3 {
+		return "", 0
+	}
+	distance, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		return "", 0
+	}
+	return strings.Join(parts[:len(parts)-2], "-"), distance
+}
+
+// StripURLCredentials removes any credentials from a git remote URL.
+// All user information is removed from http(s) URLs, since it is
+// typically an access token, whereas only passwords are removed from
+// other URLs so that ssh user names, eg. git@, are retained. For
+// scp-like syntax, eg. git@github.com:org/repo.git, and other URLs that
+// cannot be parsed, any user information that includes a password, eg.
+// oauth2:token@gitlab.com:org/repo.git, is removed.
+func StripURLCredentials(remote string) string {
+	if !strings.Contains(remote, "://") {
+		if userinfo, rest, ok := cutUserinfo(remote); ok && strings.Contains(userinfo, ":") {
+			return rest
+		}
+		return remote
+	}
+	u, err := url.Parse(remote)
+	if err != nil {
+		scheme, hier, _ := strings.Cut(remote, "://")
+		if _, rest, ok := cutUserinfo(hier); ok {
+			return scheme + "://" + rest
+		}
+		return remote
+	}
+	if u.User == nil {
+		return remote
+	}
+	switch u.Scheme {
+	case "http", "https":
+		u.User = nil
+	default:
+		u.User = url.User(u.User.Username())
+	}
+	return u.String()
+}
+
+// cutUserinfo splits s at the last @ that precedes the first /, if any.
+func cutUserinfo(s string) (userinfo, rest string, found bool) {
+	authority, _, _ := strings.Cut(s, "/")
+	i := strings.LastIndex(authority, "@")
+	if i < 0 {
+		return "", s, false
+	}
+	return s[:i], s[i+1:], true
+}
+
+// InfoPlistKeys returns the metadata as custom Info.plist keys, ie.
+// GitCommit, GitShortCommit, GitBranch, GitTag, GitTagDistance, GitDirty,
+// GitCommitTime (in RFC 3339 format) and GitRemote. Empty values are
+// omitted.
+func (md GitMetadata) InfoPlistKeys() map[string]any {
+	keys := map[string]any{
+		"GitCommit":      md.Commit,
+		"GitShortCommit": md.ShortCommit,
+		"GitDirty":       md.Dirty,
+		"GitCommitTime":  md.CommitTime.UTC().Format(time.RFC3339),
+	}
+	if md.Branch != "" {
+		keys["GitBranch"] = md.Branch
+	}
+	if md.Tag != "" {
+		keys["GitTag"] = md.Tag
+		keys["GitTagDistance"] = md.TagDistance
+	}
+	if md.Remote != "" {
+		keys["GitRemote"] = md.Remote
+	}
+	return keys
+}
+
+// MetadataStep returns a Step that obtains the repository's metadata and
+// stores it in md for use by subsequent steps, see
+// AppBundle.WriteInfoPlistGitMetadata.
+func (g Git) MetadataStep(md *GitMetadata) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		m, err := g.Metadata(ctx, cmdRunner)
+		if err != nil {
+			return NewStepResult("git metadata", []string{g.dir}, nil, err), err
+		}
+		*md = m
+		out := fmt.Sprintf("commit: %v, branch: %v, tag: %v+%v, dirty: %v\n", m.Commit, m.Branch, m.Tag, m.TagDistance, m.Dirty)
+		return NewStepResult("git metadata", []string{g.dir}, []byte(out), nil), nil
+	})
+}
+
+// WriteInfoPlistGitMetadata returns a Step that writes the bundle's
+// Info.plist with the git metadata, obtained by a preceding
+// Git.MetadataStep, added as custom keys, see GitMetadata.InfoPlistKeys.
+func (b AppBundle) WriteInfoPlistGitMetadata(md *GitMetadata) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		info := withGitMetadata(b.Info, md)
+		return writeInfoPlist(filepath.Join(b.Path, "Contents", "Info.plist"), info).Run(ctx, cmdRunner)
+	})
+}
+
+// WriteInfoPlistGitMetadata is like AppBundle.WriteInfoPlistGitMetadata
+// but writes the executable's Info.plist to the specified file, see
+// Executable.WriteInfoPlist.
+func (e Executable) WriteInfoPlistGitMetadata(path string, md *GitMetadata) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		return writeInfoPlist(path, withGitMetadata(e.Info, md)).Run(ctx, cmdRunner)
+	})
+}
+
+// withGitMetadata returns a copy of info with the git metadata, if any,
+// added to it.
+func withGitMetadata(info InfoPlist, md *GitMetadata) InfoPlist {
+	raw := info.Raw
+	info.Raw = make(map[string]any, len(raw))
+	for k, v := range raw {
+		info.Raw[k] = v
+	}
+	if md.Commit != "" {
+		for k, v := range md.InfoPlistKeys() {
+			info.Raw[k] = v
+		}
+	}
+	return info
+}
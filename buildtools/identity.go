@@ -0,0 +1,292 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1" //nolint:gosec // G505, identities are named by the SHA-1 hash of their certificate.
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// IdentityKind represents the kind of a code signing identity, ie. the
+// prefix of its certificate's common name.
+type IdentityKind string
+
+const (
+	AppleDevelopment         IdentityKind = "Apple Development"
+	AppleDistribution        IdentityKind = "Apple Distribution"
+	DeveloperIDApplication   IdentityKind = "Developer ID Application"
+	DeveloperIDInstaller     IdentityKind = "Developer ID Installer"
+	MacDeveloper             IdentityKind = "Mac Developer"
+	MacAppDistribution       IdentityKind = "3rd Party Mac Developer Application"
+	MacInstallerDistribution IdentityKind = "3rd Party Mac Developer Installer"
+)
+
+// SigningIdentity represents a code signing identity as reported by
+// security find-identity.
+type SigningIdentity struct {
+	SHA1       string       // Upper case, hex encoded, SHA-1 hash of the certificate.
+	CommonName string       // eg. Developer ID Application: Example Inc (ABCDE12345)
+	Kind       IdentityKind // eg. Developer ID Application
+	Name       string       // eg. Example Inc
+	// TeamID is the team identifier. ParseIdentities obtains it from
+	// the parenthesized suffix of the common name for Developer ID and
+	// 3rd Party Mac Developer certificates only, since for Apple
+	// Development, Apple Distribution and Mac Developer certificates
+	// the suffix is not the team identifier and TeamID is left empty.
+	// FindSigningIdentities obtains it from the organizational unit of
+	// each identity's certificate, which is the team identifier for
+	// all kinds of certificate.
+	TeamID string
+	// Status is empty for valid identities and otherwise contains the
+	// reason that the identity is not valid, eg. CSSMERR_TP_CERT_EXPIRED.
+	Status string
+}
+
+// Valid returns true if the identity is valid.
+func (id SigningIdentity) Valid() bool {
+	return id.Status == ""
+}
+
+// Expired returns true if the identity's certificate has expired.
+func (id SigningIdentity) Expired() bool {
+	return id.Status == "CSSMERR_TP_CERT_EXPIRED"
+}
+
+func (id SigningIdentity) String() string {
+	if id.Valid() {
+		return fmt.Sprintf("%v %q", id.SHA1, id.CommonName)
+	}
+	return fmt.Sprintf("%v %q (%v)", id.SHA1, id.CommonName, id.Status)
+}
+
+var (
+	identityPrefixRE = regexp.MustCompile(`^\s*\d+\)\s`)
+	identityLineRE   = regexp.MustCompile(`^\s*\d+\)\s+([0-9A-Fa-f]{40})\s+"(.*)"(?:\s+\((.*)\))?\s*$`)
+	commonNameRE     = regexp.MustCompile(`^([^:]+):\s*(.*?)(?:\s+\(([^()]+)\))?$`)
+)
+
+func parseCommonName(cn string) (kind IdentityKind, name, team string) {
+	m := commonNameRE.FindStringSubmatch(cn)
+	if m == nil {
+		return "", cn, ""
+	}
+	kind = IdentityKind(m[1])
+	switch kind {
+	case DeveloperIDApplication, DeveloperIDInstaller, MacAppDistribution, MacInstallerDistribution:
+		return kind, m[2], m[3]
+	}
+	return kind, m[2], ""
+}
+
+// ParseIdentities parses the output of security find-identity, with or
+// without the -v flag, and returns the identities it lists. Without -v
+// invalid identities are listed along with the reason they are invalid.
+// Identities that are listed more than once are returned only once.
+func ParseIdentities(output []byte) ([]SigningIdentity, error) {
+	var ids []SigningIdentity
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for sc.Scan() {
+		line := sc.Text()
+		if !identityPrefixRE.MatchString(line) {
+			continue
+		}
+		m := identityLineRE.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("failed to parse identity: %q", line)
+		}
+		sha := strings.ToUpper(m[1])
+		if seen[sha] {
+			continue
+		}
+		seen[sha] = true
+		kind, name, team := parseCommonName(m[2])
+		ids = append(ids, SigningIdentity{
+			SHA1:       sha,
+			CommonName: m[2],
+			Kind:       kind,
+			Name:       name,
+			TeamID:     team,
+			Status:     m[3],
+		})
+	}
+	return ids, sc.Err()
+}
+
+// FindSigningIdentities runs security find-identity -p codesigning and
+// returns the identities it lists, including those that are not valid.
+// The TeamID of each identity is set from its certificate, obtained
+// using security find-certificate, see SetCertificateTeamIDs.
+// In dry-run mode no identities are returned.
+func FindSigningIdentities(ctx context.Context, cmdRunner *CommandRunner) ([]SigningIdentity, StepResult, error) {
+	result, err := cmdRunner.Run(ctx, "security", "find-identity", "-p", "codesigning")
+	if err != nil {
+		return nil, result, err
+	}
+	ids, err := ParseIdentities(result.output)
+	if err != nil {
+		return nil, result, err
+	}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id.CommonName] {
+			continue
+		}
+		seen[id.CommonName] = true
+		certs, err := cmdRunner.Run(ctx, "security", "find-certificate", "-a", "-p", "-c", id.CommonName)
+		if err != nil {
+			return nil, certs, err
+		}
+		if err := SetCertificateTeamIDs(ids, certs.output); err != nil {
+			return nil, certs, err
+		}
+	}
+	return ids, result, nil
+}
+
+// SetCertificateTeamIDs sets the TeamID of each of the identities whose
+// SHA-1 hash matches one of the PEM encoded certificates in pemData, as
+// output by security find-certificate -p, to the first organizational
+// unit of that certificate's subject, which Apple sets to the team
+// identifier.
+func SetCertificateTeamIDs(ids []SigningIdentity, pemData []byte) error {
+	for {
+		var block *pem.Block
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			return nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		if len(cert.Subject.OrganizationalUnit) == 0 {
+			continue
+		}
+		sum := sha1.Sum(cert.Raw) //nolint:gosec // G401
+		sha := strings.ToUpper(hex.EncodeToString(sum[:]))
+		for i := range ids {
+			if ids[i].SHA1 == sha {
+				ids[i].TeamID = cert.Subject.OrganizationalUnit[0]
+			}
+		}
+	}
+}
+
+func identityList(ids []SigningIdentity) string {
+	var out strings.Builder
+	for _, id := range ids {
+		out.WriteString("\n  ")
+		out.WriteString(id.String())
+	}
+	return out.String()
+}
+
+// selectValid returns the single valid identity in matched, or an error
+// that describes why there is no such identity.
+func selectValid(matched []SigningIdentity, description string) (SigningIdentity, error) {
+	if len(matched) == 0 {
+		return SigningIdentity{}, fmt.Errorf("no signing identity found for %v", description)
+	}
+	var valid, invalid []SigningIdentity
+	for _, id := range matched {
+		if id.Valid() {
+			valid = append(valid, id)
+		} else {
+			invalid = append(invalid, id)
+		}
+	}
+	switch len(valid) {
+	case 0:
+		return SigningIdentity{}, fmt.Errorf("no valid signing identity found for %v, the following are not valid:%v", description, identityList(invalid))
+	case 1:
+		return valid[0], nil
+	}
+	sort.Slice(valid, func(i, j int) bool { return valid[i].SHA1 < valid[j].SHA1 })
+	return SigningIdentity{}, fmt.Errorf("ambiguous signing identity for %v, use the SHA-1 hash of one of:%v", description, identityList(valid))
+}
+
+// SelectIdentity returns the single valid identity of the specified kind
+// and team. An empty kind or teamID matches any kind or team. Note that
+// Apple Development, Apple Distribution and Mac Developer identities
+// can only be matched by team if their TeamID has been set from their
+// certificates, as FindSigningIdentities does. An error is
+// returned if there are no matching identities, if none of them are valid
+// (eg. because they have expired), or if more than one is valid.
+func SelectIdentity(ids []SigningIdentity, kind IdentityKind, teamID string) (SigningIdentity, error) {
+	var matched []SigningIdentity
+	for _, id := range ids {
+		if (kind == "" || id.Kind == kind) && (teamID == "" || id.TeamID == teamID) {
+			matched = append(matched, id)
+		}
+	}
+	var description []string
+	if kind != "" {
+		description = append(description, fmt.Sprintf("kind %q", kind))
+	}
+	if teamID != "" {
+		description = append(description, fmt.Sprintf("team %q", teamID))
+	}
+	if len(description) == 0 {
+		description = append(description, "any kind or team")
+	}
+	return selectValid(matched, strings.Join(description, " and "))
+}
+
+// LookupIdentity returns the single valid identity that codesign would
+// use for the specified identity string, which may be a SHA-1 hash, a
+// complete common name or a substring of a common name.
+func LookupIdentity(ids []SigningIdentity, identity string) (SigningIdentity, error) {
+	var exact, partial []SigningIdentity
+	for _, id := range ids {
+		switch {
+		case strings.EqualFold(id.SHA1, identity):
+			return selectValid([]SigningIdentity{id}, fmt.Sprintf("%q", identity))
+		case id.CommonName == identity:
+			exact = append(exact, id)
+		case strings.Contains(id.CommonName, identity):
+			partial = append(partial, id)
+		}
+	}
+	if len(exact) > 0 {
+		return selectValid(exact, fmt.Sprintf("%q", identity))
+	}
+	return selectValid(partial, fmt.Sprintf("%q", identity))
+}
+
+// CheckIdentity returns a Step that verifies that the signer's identity
+// refers to exactly one valid identity in the user's keychains so that
+// problems are reported before any signing takes place. The check is
+// only performed for the codesign backend and for identities other than
+// the ad-hoc identity, -. In dry-run mode the command that would be
+// used is reported without checking anything.
+func (s Signer) CheckIdentity() Step {
+	if _, ok := s.backend.(CodesignBackend); !ok || s.identity == "-" || s.identity == "" {
+		return NoopStep(fmt.Sprintf("check identity: not required for %q with the %v backend", s.identity, s.backend.Name()))
+	}
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		ids, result, err := FindSigningIdentities(ctx, cmdRunner)
+		if err != nil || cmdRunner.DryRun() {
+			return result, err
+		}
+		id, err := LookupIdentity(ids, s.identity)
+		if err != nil {
+			return NewStepResult(result.executable, result.args, result.output, err), err
+		}
+		return NewStepResult(result.executable, result.args, []byte(id.String()+"\n"), nil), nil
+	})
+}
@@ -0,0 +1,214 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1" //nolint:gosec // G505
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudeng.io/macos/buildtools"
+	"cloudeng.io/macos/buildtools/internal/profiletest"
+)
+
+func parseIdentities(t *testing.T, name string) []buildtools.SigningIdentity {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := buildtools.ParseIdentities(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestParseIdentities(t *testing.T) {
+	ids := parseIdentities(t, "find-identity.txt")
+	if got, want := len(ids), 7; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	id := ids[2]
+	if got, want := id.SHA1, "0123456789ABCDEF0123456789ABCDEF01234567"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := id.Kind, buildtools.DeveloperIDApplication; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := id.Name, "Example Inc"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := id.TeamID, "ABCDE12345"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if id.Valid() || !id.Expired() {
+		t.Errorf("expected an expired identity: %v", id)
+	}
+	if got, want := ids[4].Status, "CSSMERR_TP_CERT_REVOKED"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !ids[0].Valid() || ids[0].Kind != buildtools.AppleDevelopment {
+		t.Errorf("unexpected identity: %v", ids[0])
+	}
+	// The common name suffix is not the team for development and
+	// Apple Distribution certificates.
+	for _, i := range []int{0, 6} {
+		if got := ids[i].TeamID; got != "" {
+			t.Errorf("%v: unexpected team: %v", ids[i], got)
+		}
+	}
+
+	valid := parseIdentities(t, "find-identity-v.txt")
+	if got, want := len(valid), 4; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for _, id := range valid {
+		if !id.Valid() {
+			t.Errorf("unexpected invalid identity: %v", id)
+		}
+	}
+
+	if _, err := buildtools.ParseIdentities([]byte(`  1) 0123 "truncated"`)); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestSelectIdentity(t *testing.T) {
+	ids := parseIdentities(t, "find-identity.txt")
+
+	for _, tc := range []struct {
+		kind   buildtools.IdentityKind
+		team   string
+		sha1   string
+		errors []string
+	}{
+		{buildtools.DeveloperIDApplication, "ABCDE12345", "8A7B6C5D4E3F2A1B0C9D8E7F6A5B4C3D2E1F0A9B", nil},
+		{buildtools.DeveloperIDInstaller, "", "1111111111111111111111111111111111111111", nil},
+		{buildtools.DeveloperIDApplication, "ZZZZZ99999", "", []string{
+			`no valid signing identity found for kind "Developer ID Application" and team "ZZZZZ99999", the following are not valid:`,
+			`2222222222222222222222222222222222222222 "Developer ID Application: Other Corp (ZZZZZ99999)" (CSSMERR_TP_CERT_REVOKED)`}},
+		{buildtools.AppleDistribution, "", "", []string{"(CSSMERR_TP_NOT_TRUSTED)"}},
+		{buildtools.AppleDevelopment, "", "", []string{
+			`ambiguous signing identity for kind "Apple Development", use the SHA-1 hash of one of:`,
+			"\n  3333333333333333333333333333333333333333 \"Apple Development: Jane Appleseed (Q7R8S9T0U1)\"\n  3F2A9C1B7D4E5F60718293A4B5C6D7E8F9012345"}},
+		{buildtools.MacInstallerDistribution, "", "", []string{`no signing identity found for kind "3rd Party Mac Developer Installer"`}},
+	} {
+		id, err := buildtools.SelectIdentity(ids, tc.kind, tc.team)
+		if len(tc.errors) == 0 {
+			if err != nil {
+				t.Errorf("%v %v: %v", tc.kind, tc.team, err)
+			}
+			if got, want := id.SHA1, tc.sha1; got != want {
+				t.Errorf("%v %v: got %v, want %v", tc.kind, tc.team, got, want)
+			}
+			continue
+		}
+		for _, e := range tc.errors {
+			if err == nil || !strings.Contains(err.Error(), e) {
+				t.Errorf("%v %v: error %v does not contain %q", tc.kind, tc.team, err, e)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		identity, sha1, err string
+	}{
+		{"8a7b6c5d4e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b", "8A7B6C5D4E3F2A1B0C9D8E7F6A5B4C3D2E1F0A9B", ""},
+		{"Developer ID Application: Example Inc (ABCDE12345)", "8A7B6C5D4E3F2A1B0C9D8E7F6A5B4C3D2E1F0A9B", ""},
+		{"Developer ID Installer", "1111111111111111111111111111111111111111", ""},
+		{"0123456789ABCDEF0123456789ABCDEF01234567", "", "CSSMERR_TP_CERT_EXPIRED"},
+		{"Example Inc", "", "ambiguous signing identity"},
+		{"Nobody", "", `no signing identity found for "Nobody"`},
+	} {
+		id, err := buildtools.LookupIdentity(ids, tc.identity)
+		if tc.err == "" {
+			if err != nil || id.SHA1 != tc.sha1 {
+				t.Errorf("%v: unexpected result: %v, %v", tc.identity, id, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%v: error %v does not contain %q", tc.identity, err, tc.err)
+		}
+	}
+
+	ctx := context.Background()
+	dryRun := buildtools.NewCommandRunner(buildtools.WithDryRun(true))
+	signer := buildtools.NewSigner("Developer ID Application", nil, nil, nil)
+	result, err := signer.CheckIdentity().Run(ctx, dryRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := result.CommandLine(), "security find-identity -p codesigning "; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	result, err = buildtools.NewAdHocSigner(nil, nil).CheckIdentity().Run(ctx, dryRun)
+	if err != nil || !strings.HasPrefix(result.CommandLine(), "noop: check identity") {
+		t.Errorf("unexpected result: %v, %v", result.CommandLine(), err)
+	}
+}
+
+func TestFindSigningIdentities(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	var identities, certs bytes.Buffer
+	for i, cn := range []string{
+		"Apple Development: Jane Appleseed (Q7R8S9T0U1)",
+		"Developer ID Application: Example Inc (ABCDE12345)",
+	} {
+		der := profiletest.Certificate(t, cn, "ABCDE12345", time.Now().Add(time.Hour))
+		fmt.Fprintf(&identities, "  %v) %X \"%v\"\n", i+1, sha1.Sum(der), cn) //nolint:gosec // G401
+		if err := pem.Encode(&certs, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile := func(name string, data []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0700); err != nil { //nolint:gosec // G306
+			t.Fatal(err)
+		}
+	}
+	writeFile("identities", identities.Bytes())
+	writeFile("certs", certs.Bytes())
+	writeFile("security", []byte(fmt.Sprintf(`#!/bin/sh
+echo "$@" >> %[1]q/log
+case "$1" in
+find-identity) cat %[1]q/identities;;
+find-certificate) cat %[1]q/certs;;
+esac
+`, dir)))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ids, _, err := buildtools.FindSigningIdentities(ctx, buildtools.NewCommandRunner())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if got, want := id.TeamID, "ABCDE12345"; got != want {
+			t.Errorf("%v: got %v, want %v", id, got, want)
+		}
+	}
+	id, err := buildtools.SelectIdentity(ids, buildtools.AppleDevelopment, "ABCDE12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := id.CommonName, "Apple Development: Jane Appleseed (Q7R8S9T0U1)"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	log, err := os.ReadFile(filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Count(string(log), "find-certificate -a -p -c "), 2; got != want {
+		t.Errorf("got %v, want %v: %s", got, want, log)
+	}
+}
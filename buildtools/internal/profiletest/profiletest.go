@@ -0,0 +1,161 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Package profiletest provides support for creating provisioning profiles
+// for use in tests.
+package profiletest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"howett.net/plist"
+)
+
+// Spec specifies the contents of a provisioning profile.
+type Spec struct {
+	Name         string
+	UUID         string
+	TeamID       string
+	BundleID     string // eg. com.example.app or *.
+	Expiration   time.Time
+	Devices      []string
+	Entitlements map[string]any // merged with the default entitlements.
+}
+
+// Certificate creates a self-signed code signing certificate
+// for the specified common name and team.
+func Certificate(t testing.TB, commonName, teamID string, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject: pkix.Name{
+			CommonName:         commonName,
+			OrganizationalUnit: []string{teamID},
+			Organization:       []string{"Test"},
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// Create returns a CMS wrapped provisioning profile for the specified
+// Spec. The CMS structure uses BER indefinite lengths and a constructed
+// octet string, as produced by Apple's tools, and is not signed.
+func Create(t testing.TB, spec Spec) []byte {
+	t.Helper()
+	ent := map[string]any{
+		"com.apple.application-identifier":    spec.TeamID + "." + spec.BundleID,
+		"com.apple.developer.team-identifier": spec.TeamID,
+		"keychain-access-groups":              []any{spec.TeamID + ".*"},
+	}
+	for k, v := range spec.Entitlements {
+		ent[k] = v
+	}
+	cert := Certificate(t, "Apple Development: Test ("+spec.TeamID+")", spec.TeamID, spec.Expiration)
+	pl := map[string]any{
+		"Name":                        spec.Name,
+		"UUID":                        spec.UUID,
+		"AppIDName":                   spec.Name + " App",
+		"TeamName":                    "Test Team",
+		"TeamIdentifier":              []any{spec.TeamID},
+		"ApplicationIdentifierPrefix": []any{spec.TeamID},
+		"Platform":                    []any{"OSX"},
+		"CreationDate":                spec.Expiration.Add(-365 * 24 * time.Hour),
+		"ExpirationDate":              spec.Expiration,
+		"Entitlements":                ent,
+		"DeveloperCertificates":       []any{cert},
+		"Version":                     1,
+	}
+	if len(spec.Devices) > 0 {
+		pl["ProvisionedDevices"] = spec.Devices
+	} else {
+		pl["ProvisionsAllDevices"] = true
+	}
+	content, err := plist.MarshalIndent(pl, plist.XMLFormat, "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wrap(t, content, cert)
+}
+
+func oid(t testing.TB, id asn1.ObjectIdentifier) []byte {
+	der, err := asn1.Marshal(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func indefinite(tag byte, children ...[]byte) []byte {
+	buf := []byte{tag, 0x80}
+	for _, c := range children {
+		buf = append(buf, c...)
+	}
+	return append(buf, 0, 0)
+}
+
+func definite(tag byte, content []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(tag)
+	switch l := len(content); {
+	case l < 0x80:
+		buf.WriteByte(byte(l))
+	case l < 0x100:
+		buf.Write([]byte{0x81, byte(l)})
+	case l < 0x10000:
+		buf.Write([]byte{0x82, byte(l >> 8), byte(l)})
+	default:
+		buf.Write([]byte{0x83, byte(l >> 16), byte(l >> 8), byte(l)})
+	}
+	buf.Write(content)
+	return buf.Bytes()
+}
+
+func wrap(t testing.TB, content, cert []byte) []byte {
+	half := len(content) / 2
+	octets := indefinite(0x24, definite(0x04, content[:half]), definite(0x04, content[half:]))
+	signedData := indefinite(0x30,
+		[]byte{0x02, 0x01, 0x01}, // version
+		[]byte{0x31, 0x00},       // digestAlgorithms
+		indefinite(0x30, oid(t, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}), indefinite(0xa0, octets)),
+		definite(0xa0, cert), // certificates
+		[]byte{0x31, 0x00},   // signerInfos
+	)
+	return indefinite(0x30, oid(t, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}), indefinite(0xa0, signedData))
+}
+
+// Write creates a profile for spec and writes it to the named file.
+func Write(t testing.TB, spec Spec, elems ...string) string {
+	t.Helper()
+	filename := filepath.Join(elems...)
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, Create(t, spec), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
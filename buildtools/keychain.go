@@ -0,0 +1,190 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"cloudeng.io/file"
+)
+
+// EphemeralKeychain represents a temporary keychain, with a random
+// password, that is intended for use on CI machines. Create the keychain,
+// import a signing certificate into it using ImportP12 and arrange for
+// Delete to be run once signing is complete, typically using
+// StepRunner.AddCleanupSteps so that the keychain is removed even if
+// the build fails. For example:
+//
+//	kc, err := NewEphemeralKeychain("")
+//	runner.AddSteps(kc.Create()...)
+//	runner.AddSteps(kc.ImportP12(fs, "signing.p12", "signing.p12.password")...)
+//	runner.AddSteps(bundle.Sign(signer))
+//	runner.AddCleanupSteps(kc.Delete()...)
+//
+// Note that security only accepts passwords as command line arguments
+// when run non-interactively, so the keychain's password, and that of
+// any imported certificate, are visible to other users of the machine,
+// eg. via ps, whilst the security commands are running. EphemeralKeychain
+// should therefore only be used on machines that are not shared with
+// untrusted users, as is typically the case for CI machines.
+type EphemeralKeychain struct {
+	// Path is the path of the keychain file.
+	Path     string
+	password string
+}
+
+// KeychainPartitionList is the partition list used by ImportP12 to allow
+// codesign, and other Apple tools, to use imported keys without prompting.
+const KeychainPartitionList = "apple-tool:,apple:,codesign:"
+
+// NewEphemeralKeychain returns an EphemeralKeychain with a random name and
+// password in the specified directory, or in os.TempDir() if dir is empty.
+// The keychain is not created until the steps returned by Create are run.
+func NewEphemeralKeychain(dir string) (*EphemeralKeychain, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	name := make([]byte, 8)
+	password := make([]byte, 32)
+	if _, err := rand.Read(name); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(password); err != nil {
+		return nil, err
+	}
+	return &EphemeralKeychain{
+		Path:     filepath.Join(dir, "buildtools-"+hex.EncodeToString(name)+".keychain-db"),
+		password: hex.EncodeToString(password),
+	}, nil
+}
+
+const redacted = "<redacted>"
+
+// runRedacted runs the specified command and replaces any of the secrets
+// that appear in its arguments with a placeholder in the returned result.
+func runRedacted(ctx context.Context, cmdRunner *CommandRunner, secrets []string, name string, args ...string) (StepResult, error) {
+	result, err := cmdRunner.Run(ctx, name, args...)
+	result.args = slices.Clone(args)
+	for i, arg := range result.args {
+		if slices.Contains(secrets, arg) {
+			result.args[i] = redacted
+		}
+	}
+	return result, err
+}
+
+func (k *EphemeralKeychain) security(args ...string) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		return runRedacted(ctx, cmdRunner, []string{k.password}, "security", args...)
+	})
+}
+
+// Create returns the steps required to create and unlock the keychain
+// and to add it to the user's keychain search list so that codesign
+// can find the identities it contains. The keychain is configured to
+// lock itself after 6 hours.
+func (k *EphemeralKeychain) Create() []Step {
+	return []Step{
+		k.security("create-keychain", "-p", k.password, k.Path),
+		k.security("set-keychain-settings", "-lut", "21600", k.Path),
+		k.security("unlock-keychain", "-p", k.password, k.Path),
+		k.updateSearchList(true),
+	}
+}
+
+// parseKeychainList parses the output of security list-keychains.
+func parseKeychainList(output []byte) []string {
+	var keychains []string
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for sc.Scan() {
+		if kc := strings.Trim(strings.TrimSpace(sc.Text()), `"`); kc != "" {
+			keychains = append(keychains, kc)
+		}
+	}
+	return keychains
+}
+
+// updateSearchList adds or removes the keychain from the user's keychain
+// search list, leaving the other keychains in place.
+func (k *EphemeralKeychain) updateSearchList(add bool) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		result, err := cmdRunner.Run(ctx, "security", "list-keychains", "-d", "user")
+		if err != nil {
+			return result, err
+		}
+		keychains := slices.DeleteFunc(parseKeychainList(result.output), func(kc string) bool {
+			return kc == k.Path
+		})
+		if add {
+			keychains = append([]string{k.Path}, keychains...)
+		}
+		return cmdRunner.Run(ctx, "security", append([]string{"list-keychains", "-d", "user", "-s"}, keychains...)...)
+	})
+}
+
+// ImportP12 returns the steps required to import a PKCS#12 (.p12) signing
+// certificate and key into the keychain and to set the key's partition
+// list so that codesign can use it without prompting. The certificate and
+// its password are read from fs using the specified names, so that they
+// may be obtained from a keychain plugin, AWS secrets manager or any other
+// file.ReadFileFS; trailing newlines are removed from the password. The
+// certificate is written to a temporary file, readable only by the
+// current user, for the duration of the import. Passwords are never
+// included in the step results, but are passed to security as arguments,
+// see EphemeralKeychain.
+func (k *EphemeralKeychain) ImportP12(fs file.ReadFileFS, certName, passwordName string) []Step {
+	importStep := StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		args := []string{"import", certName, "-k", k.Path, "-f", "pkcs12", "-P", redacted,
+			"-T", "/usr/bin/codesign", "-T", "/usr/bin/security", "-T", "/usr/bin/productbuild", "-T", "/usr/bin/pkgbuild"}
+		cert, err := fs.ReadFileCtx(ctx, certName)
+		if err != nil {
+			err = fmt.Errorf("failed to read certificate %q: %w", certName, err)
+			return NewStepResult("security", args, nil, err), err
+		}
+		password, err := fs.ReadFileCtx(ctx, passwordName)
+		if err != nil {
+			err = fmt.Errorf("failed to read certificate password %q: %w", passwordName, err)
+			return NewStepResult("security", args, nil, err), err
+		}
+		pw := strings.TrimRight(string(password), "\r\n")
+		if cmdRunner.DryRun() {
+			return NewStepResult("security", args, nil, nil), nil
+		}
+		tmpDir, err := os.MkdirTemp("", "buildtools-p12-")
+		if err != nil {
+			return NewStepResult("security", args, nil, err), err
+		}
+		defer os.RemoveAll(tmpDir) //nolint:errcheck
+		tmpFile := filepath.Join(tmpDir, "certificate.p12")
+		if err := os.WriteFile(tmpFile, cert, 0600); err != nil {
+			return NewStepResult("security", args, nil, err), err
+		}
+		args[1], args[7] = tmpFile, pw
+		return runRedacted(ctx, cmdRunner, []string{pw, k.password}, "security", args...)
+	})
+	return []Step{
+		importStep,
+		k.security("set-key-partition-list", "-S", KeychainPartitionList, "-s", "-k", k.password, k.Path),
+	}
+}
+
+// Delete returns the steps required to remove the keychain from the
+// user's keychain search list and to delete it. These steps are
+// generally added using StepRunner.AddCleanupSteps.
+func (k *EphemeralKeychain) Delete() []Step {
+	return []Step{
+		k.updateSearchList(false),
+		k.security("delete-keychain", k.Path),
+	}
+}
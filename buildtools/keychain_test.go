@@ -0,0 +1,183 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudeng.io/macos/buildtools"
+)
+
+type secretsFS map[string][]byte
+
+func (fs secretsFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFileCtx(context.Background(), name)
+}
+
+func (fs secretsFS) ReadFileCtx(_ context.Context, name string) ([]byte, error) {
+	if data, ok := fs[name]; ok {
+		return data, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// fakeSecurity installs a security command that logs its arguments, lists
+// a login keychain and fails when asked to import a certificate if
+// failImport is set.
+func fakeSecurity(t *testing.T, failImport bool) string {
+	t.Helper()
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$@" >> %[1]q
+case "$1" in
+list-keychains)
+	if [ "$#" -eq 3 ]; then
+		cat %[1]q.list 2>/dev/null || echo '    "/Users/ci/Library/Keychains/login.keychain-db"'
+	else
+		shift 4
+		: > %[1]q.list
+		for kc in "$@"; do echo "    \"$kc\"" >> %[1]q.list; done
+	fi;;
+import)
+	if [ %[2]q = "true" ]; then echo "import failed" >&2; exit 1; fi
+	test -f "$2" || exit 2;;
+esac
+`, log, fmt.Sprint(failImport))
+	if err := os.WriteFile(filepath.Join(dir, "security"), []byte(script), 0700); err != nil { //nolint:gosec // G306
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+func TestEphemeralKeychain(t *testing.T) {
+	ctx := context.Background()
+	fs := secretsFS{
+		"signing.p12":          []byte("p12 data"),
+		"signing.p12.password": []byte("p12-secret\n"),
+	}
+	for _, failImport := range []bool{false, true} {
+		log := fakeSecurity(t, failImport)
+		kc, err := buildtools.NewEphemeralKeychain(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		runner := buildtools.NewRunner()
+		runner.AddSteps(kc.Create()...)
+		runner.AddSteps(kc.ImportP12(fs, "signing.p12", "signing.p12.password")...)
+		runner.AddCleanupSteps(kc.Delete()...)
+		results := runner.Run(ctx, buildtools.NewCommandRunner())
+		if err := results.Error(); (err != nil) != failImport {
+			t.Errorf("failImport: %v: unexpected error: %v", failImport, err)
+		}
+
+		data, err := os.ReadFile(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		first := func(prefix string) string {
+			for _, l := range lines {
+				if strings.HasPrefix(l, prefix) {
+					return l
+				}
+			}
+			return ""
+		}
+		login := "/Users/ci/Library/Keychains/login.keychain-db"
+		if got, want := first("list-keychains -d user -s"), "list-keychains -d user -s "+kc.Path+" "+login; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := lines[len(lines)-2], "list-keychains -d user -s "+login; got != want {
+			t.Errorf("failImport: %v: got %v, want %v", failImport, got, want)
+		}
+		if got, want := lines[len(lines)-1], "delete-keychain "+kc.Path; got != want {
+			t.Errorf("failImport: %v: got %v, want %v", failImport, got, want)
+		}
+		if got := first("import "); !strings.Contains(got, "-P p12-secret ") {
+			t.Errorf("failImport: %v: unexpected import command: %v", failImport, got)
+		}
+		if got := first("set-key-partition-list"); failImport != (got == "") {
+			t.Errorf("failImport: %v: unexpected partition list command: %v", failImport, got)
+		}
+
+		if got, want := results[0].CommandLine(), "security create-keychain -p <redacted> "+kc.Path+" "; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		for _, r := range results {
+			if strings.Contains(r.CommandLine(), "p12-secret") {
+				t.Errorf("secret not redacted: %v", r.CommandLine())
+			}
+		}
+		if data, _ := os.ReadFile(log); strings.Count(string(data), "create-keychain -p ") != 1 || strings.Contains(string(data), "<redacted>") {
+			t.Errorf("unexpected password: %s", data)
+		}
+	}
+
+	// A missing secret is reported without running the import.
+	dryRun := buildtools.NewCommandRunner(buildtools.WithDryRun(true))
+	kc, err := buildtools.NewEphemeralKeychain("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = kc.ImportP12(fs, "signing.p12", "missing")[0].Run(ctx, dryRun)
+	if err == nil || !strings.Contains(err.Error(), `failed to read certificate password "missing"`) {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+}
+
+func TestCleanupSteps(t *testing.T) {
+	ctx := context.Background()
+	var ran []string
+	step := func(name string, err error) buildtools.Step {
+		return buildtools.StepFunc(func(context.Context, *buildtools.CommandRunner) (buildtools.StepResult, error) {
+			ran = append(ran, name)
+			return buildtools.NewStepResult(name, nil, nil, err), err
+		})
+	}
+	runner := buildtools.NewRunner()
+	runner.AddSteps(step("a", nil), step("b", fmt.Errorf("b failed")), step("c", nil))
+	runner.AddCleanupSteps(step("cleanup-1", fmt.Errorf("cleanup failed")), step("cleanup-2", nil))
+	results := runner.Run(ctx, buildtools.NewCommandRunner())
+	if got, want := strings.Join(ran, ","), "a,b,cleanup-1,cleanup-2"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := results.Error(); err == nil || err.Error() != "b failed\ncleanup failed" {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+
+	// Cleanup steps run even when the context has been canceled.
+	ran = nil
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	runner = buildtools.NewRunner(buildtools.WithCleanupTimeout(time.Hour))
+	runner.AddSteps(buildtools.StepFunc(func(ctx context.Context, _ *buildtools.CommandRunner) (buildtools.StepResult, error) {
+		return buildtools.NewStepResult("a", nil, nil, ctx.Err()), ctx.Err()
+	}))
+	runner.AddCleanupSteps(buildtools.StepFunc(func(ctx context.Context, cmdRunner *buildtools.CommandRunner) (buildtools.StepResult, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("cleanup context has no deadline")
+		}
+		return cmdRunner.Run(ctx, "true")
+	}))
+	results = runner.Run(cctx, buildtools.NewCommandRunner())
+	if got, want := len(results), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if err := results.Error(); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	if err := results[1].Error(); err != nil {
+		t.Errorf("cleanup step failed: %v", err)
+	}
+}
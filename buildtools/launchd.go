@@ -0,0 +1,429 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"howett.net/plist"
+)
+
+// LaunchdPlist represents a launchd job property list for a launch agent
+// or launch daemon, either one that is installed in one of the system's
+// Library directories, or one that is bundled within an app. The YAML keys
+// are the same as the plist keys.
+// See https://developer.apple.com/library/archive/documentation/MacOSX/Conceptual/BPSystemStartup/Chapters/CreatingLaunchdJobs.html
+type LaunchdPlist struct {
+	Label string `yaml:"Label" plist:"Label"`
+	// Program is the absolute path of the executable to run.
+	Program string `yaml:"Program,omitempty" plist:"Program,omitempty"`
+	// BundleProgram is the path of the executable to run relative to
+	// the app bundle that contains the plist, for use by agents and
+	// daemons that are registered using SMAppService.
+	BundleProgram    string   `yaml:"BundleProgram,omitempty" plist:"BundleProgram,omitempty"`
+	ProgramArguments []string `yaml:"ProgramArguments,omitempty" plist:"ProgramArguments,omitempty"`
+	// KeepAlive specifies whether the job is to be kept running
+	// unconditionally or subject to the conditions it specifies.
+	KeepAlive *KeepAlive `yaml:"KeepAlive,omitempty" plist:"KeepAlive,omitempty"`
+	RunAtLoad bool       `yaml:"RunAtLoad,omitempty" plist:"RunAtLoad,omitempty"`
+	// StartInterval runs the job every StartInterval seconds.
+	StartInterval int `yaml:"StartInterval,omitempty" plist:"StartInterval,omitempty"`
+	// StartCalendarInterval runs the job at the specified times, in the
+	// manner of cron.
+	StartCalendarInterval CalendarIntervals `yaml:"StartCalendarInterval,omitempty" plist:"StartCalendarInterval,omitempty"`
+	// Sockets are the sockets that launchd creates on behalf of the job,
+	// keyed by the name that the job uses to retrieve them.
+	Sockets map[string]LaunchdSocket `yaml:"Sockets,omitempty" plist:"Sockets,omitempty"`
+	// MachServices are the names of the mach services to be registered
+	// with the bootstrap namespace.
+	MachServices         map[string]bool   `yaml:"MachServices,omitempty" plist:"MachServices,omitempty"`
+	EnvironmentVariables map[string]string `yaml:"EnvironmentVariables,omitempty" plist:"EnvironmentVariables,omitempty"`
+	StandardOutPath      string            `yaml:"StandardOutPath,omitempty" plist:"StandardOutPath,omitempty"`
+	StandardErrorPath    string            `yaml:"StandardErrorPath,omitempty" plist:"StandardErrorPath,omitempty"`
+	// UserName is the user that a daemon is run as, it is ignored for
+	// agents.
+	UserName string `yaml:"UserName,omitempty" plist:"UserName,omitempty"`
+	// AssociatedBundleIdentifiers are the identifiers of the apps that
+	// are displayed as the owner of the job in System Settings.
+	AssociatedBundleIdentifiers []string `yaml:"AssociatedBundleIdentifiers,omitempty" plist:"AssociatedBundleIdentifiers,omitempty"`
+}
+
+// KeepAlive represents the KeepAlive key of a launchd plist, which is
+// either a boolean, represented by Always, or a dictionary of conditions
+// under which the job is kept running.
+type KeepAlive struct {
+	Always bool `yaml:"-" plist:"-"`
+	// SuccessfulExit, if set, keeps the job running until it exits
+	// successfully if false, or restarts it when it does if true.
+	SuccessfulExit *bool `yaml:"SuccessfulExit,omitempty" plist:"SuccessfulExit,omitempty"`
+	// Crashed, if set, restarts the job when it crashes if true, or
+	// when it exits without crashing if false.
+	Crashed *bool `yaml:"Crashed,omitempty" plist:"Crashed,omitempty"`
+	// PathState keeps the job running while each path exists, if true,
+	// or does not exist, if false.
+	PathState map[string]bool `yaml:"PathState,omitempty" plist:"PathState,omitempty"`
+	// OtherJobEnabled keeps the job running while each of the labelled
+	// jobs is loaded, if true, or is not loaded, if false.
+	OtherJobEnabled map[string]bool `yaml:"OtherJobEnabled,omitempty" plist:"OtherJobEnabled,omitempty"`
+}
+
+type keepAliveConditions KeepAlive
+
+func (k *KeepAlive) conditional() bool {
+	return k.SuccessfulExit != nil || k.Crashed != nil || len(k.PathState) > 0 || len(k.OtherJobEnabled) > 0
+}
+
+func (k KeepAlive) MarshalPlist() (any, error) {
+	if !k.conditional() {
+		return k.Always, nil
+	}
+	return keepAliveConditions(k), nil
+}
+
+func (k *KeepAlive) UnmarshalPlist(unmarshal func(any) error) error {
+	if err := unmarshal(&k.Always); err == nil {
+		return nil
+	}
+	return unmarshal((*keepAliveConditions)(k))
+}
+
+func (k KeepAlive) MarshalYAML() (any, error) {
+	if !k.conditional() {
+		return k.Always, nil
+	}
+	return keepAliveConditions(k), nil
+}
+
+func (k *KeepAlive) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&k.Always)
+	}
+	return node.Decode((*keepAliveConditions)(k))
+}
+
+// CalendarInterval represents an entry in a launchd plist's
+// StartCalendarInterval, unset fields are wildcards.
+type CalendarInterval struct {
+	Minute  *int `yaml:"Minute,omitempty" plist:"Minute,omitempty"`   // 0-59
+	Hour    *int `yaml:"Hour,omitempty" plist:"Hour,omitempty"`       // 0-23
+	Day     *int `yaml:"Day,omitempty" plist:"Day,omitempty"`         // 1-31
+	Weekday *int `yaml:"Weekday,omitempty" plist:"Weekday,omitempty"` // 0-7, 0 and 7 are Sunday
+	Month   *int `yaml:"Month,omitempty" plist:"Month,omitempty"`     // 1-12
+}
+
+// CalendarIntervals represents a launchd plist's StartCalendarInterval,
+// which may be specified as either a single dictionary or an array of
+// them. It is always written as an array.
+type CalendarIntervals []CalendarInterval
+
+func (c *CalendarIntervals) UnmarshalPlist(unmarshal func(any) error) error {
+	var ci CalendarInterval
+	if err := unmarshal(&ci); err == nil {
+		*c = CalendarIntervals{ci}
+		return nil
+	}
+	return unmarshal((*[]CalendarInterval)(c))
+}
+
+func (c *CalendarIntervals) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		var ci CalendarInterval
+		if err := node.Decode(&ci); err != nil {
+			return err
+		}
+		*c = CalendarIntervals{ci}
+		return nil
+	}
+	return node.Decode((*[]CalendarInterval)(c))
+}
+
+// LaunchdSocket represents a socket that launchd creates on behalf of
+// a job, either a unix domain socket, specified by SockPathName, or a
+// network socket, specified by SockServiceName.
+type LaunchdSocket struct {
+	SockType        string `yaml:"SockType,omitempty" plist:"SockType,omitempty"`               // stream (the default), dgram or seqpacket.
+	SockPassive     *bool  `yaml:"SockPassive,omitempty" plist:"SockPassive,omitempty"`         // listen (the default) or connect.
+	SockNodeName    string `yaml:"SockNodeName,omitempty" plist:"SockNodeName,omitempty"`       // the node to listen on or connect to.
+	SockServiceName string `yaml:"SockServiceName,omitempty" plist:"SockServiceName,omitempty"` // the port number or service name.
+	SockFamily      string `yaml:"SockFamily,omitempty" plist:"SockFamily,omitempty"`           // IPv4, IPv6, IPv4v6 or Unix.
+	SockPathName    string `yaml:"SockPathName,omitempty" plist:"SockPathName,omitempty"`       // the path of a unix domain socket.
+	SockPathMode    int    `yaml:"SockPathMode,omitempty" plist:"SockPathMode,omitempty"`       // the mode of a unix domain socket, eg. 0600.
+}
+
+// ParseLaunchdPlist parses a launchd property list.
+func ParseLaunchdPlist(data []byte) (LaunchdPlist, error) {
+	var lp LaunchdPlist
+	if _, err := plist.Unmarshal(data, &lp); err != nil {
+		return LaunchdPlist{}, err
+	}
+	return lp, nil
+}
+
+// Validate returns an error if the plist has no label, does not specify
+// exactly one of Program, BundleProgram or ProgramArguments as the
+// executable to run, if Program or any of the log or PathState paths
+// are not absolute, if BundleProgram is not a path within the bundle, or
+// if any of the intervals, sockets, mach services or environment
+// variables are invalid. All such errors are returned, joined together.
+func (lp LaunchdPlist) Validate() error {
+	var errs []error
+	if lp.Label == "" {
+		errs = append(errs, fmt.Errorf("Label is not set"))
+	}
+	switch {
+	case lp.Program != "" && lp.BundleProgram != "":
+		errs = append(errs, fmt.Errorf("only one of Program and BundleProgram may be set"))
+	case lp.Program == "" && lp.BundleProgram == "" && len(lp.ProgramArguments) == 0:
+		errs = append(errs, fmt.Errorf("one of Program, BundleProgram or ProgramArguments must be set"))
+	}
+	if lp.Program != "" && !filepath.IsAbs(lp.Program) {
+		errs = append(errs, fmt.Errorf("Program: %q is not an absolute path", lp.Program))
+	}
+	if p := lp.BundleProgram; p != "" && (filepath.IsAbs(p) || !filepath.IsLocal(p)) {
+		errs = append(errs, fmt.Errorf("BundleProgram: %q is not a path within the bundle", p))
+	}
+	if lp.KeepAlive != nil {
+		for _, p := range sortedKeys(lp.KeepAlive.PathState) {
+			if !filepath.IsAbs(p) {
+				errs = append(errs, fmt.Errorf("KeepAlive: PathState: %q is not an absolute path", p))
+			}
+		}
+	}
+	if lp.StartInterval < 0 {
+		errs = append(errs, fmt.Errorf("StartInterval: %v is negative", lp.StartInterval))
+	}
+	for i, ci := range lp.StartCalendarInterval {
+		errs = append(errs, ci.validate(fmt.Sprintf("StartCalendarInterval[%v]", i))...)
+	}
+	for _, name := range sortedKeys(lp.Sockets) {
+		errs = append(errs, lp.Sockets[name].validate(fmt.Sprintf("Sockets: %v", name))...)
+	}
+	for _, name := range sortedKeys(lp.MachServices) {
+		if name == "" || strings.ContainsAny(name, " /") {
+			errs = append(errs, fmt.Errorf("MachServices: invalid service name %q", name))
+		}
+	}
+	for _, name := range sortedKeys(lp.EnvironmentVariables) {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			errs = append(errs, fmt.Errorf("EnvironmentVariables: invalid variable name %q", name))
+		}
+	}
+	for _, lf := range [][2]string{{"StandardOutPath", lp.StandardOutPath}, {"StandardErrorPath", lp.StandardErrorPath}} {
+		if lf[1] != "" && !filepath.IsAbs(lf[1]) {
+			errs = append(errs, fmt.Errorf("%v: %q is not an absolute path", lf[0], lf[1]))
+		}
+	}
+	if strings.ContainsAny(lp.UserName, " :/") {
+		errs = append(errs, fmt.Errorf("UserName: invalid user name %q", lp.UserName))
+	}
+	if err := errors.Join(errs...); err != nil {
+		if lp.Label != "" {
+			return fmt.Errorf("%v: %w", lp.Label, err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (ci CalendarInterval) validate(prefix string) []error {
+	var errs []error
+	for _, f := range []struct {
+		name     string
+		val      *int
+		min, max int
+	}{
+		{"Minute", ci.Minute, 0, 59},
+		{"Hour", ci.Hour, 0, 23},
+		{"Day", ci.Day, 1, 31},
+		{"Weekday", ci.Weekday, 0, 7},
+		{"Month", ci.Month, 1, 12},
+	} {
+		if f.val != nil && (*f.val < f.min || *f.val > f.max) {
+			errs = append(errs, fmt.Errorf("%v: %v: %v is not in the range %v-%v", prefix, f.name, *f.val, f.min, f.max))
+		}
+	}
+	return errs
+}
+
+func (s LaunchdSocket) validate(prefix string) []error {
+	var errs []error
+	if s.SockType != "" && !slices.Contains([]string{"stream", "dgram", "seqpacket"}, s.SockType) {
+		errs = append(errs, fmt.Errorf("%v: invalid SockType %q", prefix, s.SockType))
+	}
+	if s.SockFamily != "" && !slices.Contains([]string{"IPv4", "IPv6", "IPv4v6", "Unix"}, s.SockFamily) {
+		errs = append(errs, fmt.Errorf("%v: invalid SockFamily %q", prefix, s.SockFamily))
+	}
+	switch {
+	case s.SockPathName != "" && s.SockServiceName != "":
+		errs = append(errs, fmt.Errorf("%v: only one of SockPathName and SockServiceName may be set", prefix))
+	case s.SockPathName == "" && s.SockServiceName == "":
+		errs = append(errs, fmt.Errorf("%v: one of SockPathName or SockServiceName must be set", prefix))
+	case s.SockPathName != "" && !filepath.IsAbs(s.SockPathName):
+		errs = append(errs, fmt.Errorf("%v: SockPathName: %q is not an absolute path", prefix, s.SockPathName))
+	case s.SockFamily == "Unix" && s.SockPathName == "":
+		errs = append(errs, fmt.Errorf("%v: SockPathName must be set for a Unix socket", prefix))
+	}
+	return errs
+}
+
+// Write returns a Step that validates the plist and writes it to the
+// specified path using WritePlistFile, eg. to
+// /Library/LaunchDaemons/<Label>.plist within a package's root.
+func (lp LaunchdPlist) Write(elems ...string) Step {
+	path := filepath.Join(elems...)
+	if err := lp.Validate(); err != nil {
+		return ErrorStep(fmt.Errorf("invalid launchd plist: %w", err), "write "+filepath.Base(path), path)
+	}
+	return WritePlistFile(lp, path)
+}
+
+// LaunchAgents returns the path to the specified element within the app
+// bundle's Contents/Library/LaunchAgents directory.
+func (b AppBundle) LaunchAgents(elem ...string) string {
+	return b.Contents("Library", "LaunchAgents", filepath.Join(elem...))
+}
+
+// LaunchDaemons returns the path to the specified element within the app
+// bundle's Contents/Library/LaunchDaemons directory.
+func (b AppBundle) LaunchDaemons(elem ...string) string {
+	return b.Contents("Library", "LaunchDaemons", filepath.Join(elem...))
+}
+
+// WriteLaunchAgent returns the step required to validate the plist and
+// to write it to the app bundle's Contents/Library/LaunchAgents directory
+// as <Label>.plist, from where it can be registered using SMAppService.
+// If no AssociatedBundleIdentifiers are specified the bundle's own
+// identifier is used.
+func (b AppBundle) WriteLaunchAgent(lp LaunchdPlist) Step {
+	return b.writeLaunchdPlist(b.LaunchAgents(), lp)
+}
+
+// WriteLaunchDaemon is like WriteLaunchAgent except that the plist is
+// written to the Contents/Library/LaunchDaemons directory.
+func (b AppBundle) WriteLaunchDaemon(lp LaunchdPlist) Step {
+	return b.writeLaunchdPlist(b.LaunchDaemons(), lp)
+}
+
+func (b AppBundle) writeLaunchdPlist(dir string, lp LaunchdPlist) Step {
+	path := filepath.Join(dir, lp.Label+".plist")
+	if err := lp.Validate(); err != nil {
+		return ErrorStep(fmt.Errorf("invalid launchd plist: %w", err), "write "+filepath.Base(path), path)
+	}
+	if len(lp.AssociatedBundleIdentifiers) == 0 && b.Info.CFBundleIdentifier != "" {
+		lp.AssociatedBundleIdentifiers = []string{b.Info.CFBundleIdentifier}
+	}
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		if res, err := MkdirAll(dir).Run(ctx, cmdRunner); err != nil {
+			return res, err
+		}
+		return WritePlistFile(lp, path).Run(ctx, cmdRunner)
+	})
+}
+
+// LoginItem returns a NestedBundle for a login item helper app with the
+// specified name, ie. Contents/Library/LoginItems/<name>.app, which can
+// be registered using SMAppService.
+func (b AppBundle) LoginItem(name string, info InfoPlist, entitlements *Entitlements) NestedBundle {
+	return b.Nested(LoginItemBundle, name, info, entitlements)
+}
+
+// ValidateBackgroundItems returns a Step that verifies that the program
+// referred to by every launchd plist in the app bundle's LaunchAgents and
+// LaunchDaemons directories, and the main executable of every login item,
+// exists within the bundle and is executable. It should be run once the
+// bundle has been populated; in dry-run mode nothing is checked.
+func (b AppBundle) ValidateBackgroundItems() Step {
+	return StepFunc(func(_ context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		if cmdRunner.DryRun() {
+			return NewStepResult("validate background items", []string{b.Path}, nil, nil), nil
+		}
+		var out strings.Builder
+		errs := b.validateLaunchdPrograms(&out, b.LaunchAgents())
+		errs = append(errs, b.validateLaunchdPrograms(&out, b.LaunchDaemons())...)
+		errs = append(errs, b.validateLoginItems(&out)...)
+		err := errors.Join(errs...)
+		return NewStepResult("validate background items", []string{b.Path}, []byte(out.String()), err), err
+	})
+}
+
+func (b AppBundle) validateLaunchdPrograms(out *strings.Builder, dir string) []error {
+	plists, _ := filepath.Glob(filepath.Join(dir, "*.plist"))
+	var errs []error
+	for _, file := range plists {
+		rel, _ := filepath.Rel(b.Path, file)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		lp, err := ParseLaunchdPlist(data)
+		if err == nil {
+			err = lp.Validate()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", rel, err))
+			continue
+		}
+		program := lp.BundleProgram
+		if program == "" {
+			fmt.Fprintf(out, "%v: no BundleProgram, not checked\n", rel)
+			continue
+		}
+		if err := checkExecutable(b.Path, program); err != nil {
+			errs = append(errs, fmt.Errorf("%v: BundleProgram: %w", rel, err))
+			continue
+		}
+		fmt.Fprintf(out, "%v: %v\n", rel, program)
+	}
+	return errs
+}
+
+func (b AppBundle) validateLoginItems(out *strings.Builder) []error {
+	apps, _ := filepath.Glob(b.Contents("Library", "LoginItems", "*.app"))
+	var errs []error
+	for _, app := range apps {
+		rel, _ := filepath.Rel(b.Path, app)
+		data, err := os.ReadFile(filepath.Join(app, "Contents", "Info.plist"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", rel, err))
+			continue
+		}
+		var info map[string]any
+		if _, err := plist.Unmarshal(data, &info); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", rel, err))
+			continue
+		}
+		exe, err := asString(info, "CFBundleExecutable")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", rel, err))
+			continue
+		}
+		program := filepath.Join("Contents", "MacOS", exe)
+		if err := checkExecutable(app, program); err != nil {
+			errs = append(errs, fmt.Errorf("%v: CFBundleExecutable: %w", rel, err))
+			continue
+		}
+		fmt.Fprintf(out, "%v: %v\n", rel, program)
+	}
+	return errs
+}
+
+func checkExecutable(dir, program string) error {
+	fi, err := os.Stat(filepath.Join(dir, program))
+	switch {
+	case err != nil:
+		return fmt.Errorf("%v does not exist in %v", program, dir)
+	case fi.IsDir() || fi.Mode()&0111 == 0:
+		return fmt.Errorf("%v is not an executable file", program)
+	}
+	return nil
+}
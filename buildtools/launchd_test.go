@@ -0,0 +1,335 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloudeng.io/macos/buildtools"
+	"gopkg.in/yaml.v3"
+)
+
+const launchAgentYAML = `
+Label: io.cloudeng.TestApp.agent
+BundleProgram: Contents/MacOS/agent
+ProgramArguments: [agent, --verbose]
+RunAtLoad: true
+MachServices:
+  io.cloudeng.TestApp.agent.xpc: true
+`
+
+func TestBundledBackgroundItems(t *testing.T) {
+	ctx := context.Background()
+	runner := buildtools.NewCommandRunner()
+	bundle := buildtools.AppBundle{
+		Path: filepath.Join(t.TempDir(), "TestApp.app"),
+		Info: unmarshalInfoPlist(t, plistYAML),
+	}
+	var agent buildtools.LaunchdPlist
+	if err := yaml.Unmarshal([]byte(launchAgentYAML), &agent); err != nil {
+		t.Fatal(err)
+	}
+	daemon := buildtools.LaunchdPlist{
+		Label:                       "io.cloudeng.TestApp.daemon",
+		BundleProgram:               "Contents/MacOS/daemon",
+		AssociatedBundleIdentifiers: []string{"io.cloudeng.Other"},
+	}
+	helperInfo := unmarshalInfoPlist(t, strings.ReplaceAll(helperAppYAML, "Helper", "Login"))
+	login := bundle.LoginItem("Login", helperInfo, nil)
+	if got, want := login.RelPath(), filepath.Join("Contents", "Library", "LoginItems", "Login.app"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	steps := buildtools.NewRunner()
+	steps.AddSteps(bundle.Create()...)
+	steps.AddSteps(login.Create()...)
+	steps.AddSteps(
+		bundle.ValidateNested(login),
+		bundle.WriteLaunchAgent(agent),
+		bundle.WriteLaunchDaemon(daemon),
+		login.WriteInfoPlist(),
+	)
+	if err := steps.Run(ctx, runner).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(bundle.LaunchAgents("io.cloudeng.TestApp.agent.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := buildtools.ParseLaunchdPlist(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.AssociatedBundleIdentifiers = []string{"io.cloudeng.TestApp"}
+	if !reflect.DeepEqual(parsed, agent) {
+		t.Errorf("got %+v, want %+v", parsed, agent)
+	}
+	data, err = os.ReadFile(bundle.LaunchDaemons("io.cloudeng.TestApp.daemon.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed, err = buildtools.ParseLaunchdPlist(data); err != nil || !reflect.DeepEqual(parsed, daemon) {
+		t.Errorf("got %+v, want %+v: %v", parsed, daemon, err)
+	}
+
+	// None of the programs exist yet.
+	_, err = bundle.ValidateBackgroundItems().Run(ctx, runner)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		filepath.FromSlash("Contents/Library/LaunchAgents/io.cloudeng.TestApp.agent.plist: BundleProgram: Contents/MacOS/agent does not exist in " + bundle.Path),
+		filepath.FromSlash("Contents/Library/LaunchDaemons/io.cloudeng.TestApp.daemon.plist: BundleProgram: Contents/MacOS/daemon does not exist in " + bundle.Path),
+		filepath.FromSlash("Contents/Library/LoginItems/Login.app: CFBundleExecutable: Contents/MacOS/Login does not exist in " + login.Path),
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%v does not contain %v", err, want)
+		}
+	}
+
+	for _, exe := range []string{bundle.Contents("MacOS", "agent"), bundle.Contents("MacOS", "daemon"), login.ExecutablePath()} {
+		if err := os.WriteFile(exe, []byte("#!/bin/sh\n"), 0755); err != nil { //nolint:gosec // G306
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(bundle.Contents("MacOS", "daemon"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = bundle.ValidateBackgroundItems().Run(ctx, runner)
+	if err == nil || err.Error() != filepath.FromSlash("Contents/Library/LaunchDaemons/io.cloudeng.TestApp.daemon.plist: BundleProgram: Contents/MacOS/daemon is not an executable file") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	if err := os.Chmod(bundle.Contents("MacOS", "daemon"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	res, err := bundle.ValidateBackgroundItems().Run(ctx, runner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.Output(), filepath.FromSlash(`Contents/Library/LaunchAgents/io.cloudeng.TestApp.agent.plist: Contents/MacOS/agent
+Contents/Library/LaunchDaemons/io.cloudeng.TestApp.daemon.plist: Contents/MacOS/daemon
+Contents/Library/LoginItems/Login.app: Contents/MacOS/Login
+`); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLaunchdPlistValidation(t *testing.T) {
+	for _, tc := range []struct {
+		plist buildtools.LaunchdPlist
+		err   string
+	}{
+		{buildtools.LaunchdPlist{BundleProgram: "Contents/MacOS/agent"}, "Label is not set"},
+		{buildtools.LaunchdPlist{Label: "a"}, "a: one of Program, BundleProgram or ProgramArguments must be set"},
+		{buildtools.LaunchdPlist{Label: "a", Program: "/bin/a", BundleProgram: "Contents/MacOS/a"}, "a: only one of Program and BundleProgram may be set"},
+		{buildtools.LaunchdPlist{Label: "a", Program: "bin/a"}, `a: Program: "bin/a" is not an absolute path`},
+		{buildtools.LaunchdPlist{Label: "a", BundleProgram: "../a"}, `a: BundleProgram: "../a" is not a path within the bundle`},
+		{buildtools.LaunchdPlist{Label: "a", ProgramArguments: []string{"/bin/a"}, MachServices: map[string]bool{"a b": true}}, `a: MachServices: invalid service name "a b"`},
+	} {
+		if err := tc.plist.Validate(); err == nil || err.Error() != tc.err {
+			t.Errorf("%+v: unexpected or missing error: %v", tc.plist, err)
+		}
+	}
+	bundle := buildtools.AppBundle{Path: filepath.Join(t.TempDir(), "TestApp.app")}
+	_, err := bundle.WriteLaunchAgent(buildtools.LaunchdPlist{Label: "a"}).Run(context.Background(), buildtools.NewCommandRunner())
+	if err == nil || !strings.Contains(err.Error(), "invalid launchd plist: a: one of") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+}
+
+const launchDaemonYAML = `
+Label: io.cloudeng.daemon
+ProgramArguments: [/usr/local/bin/daemon, --serve]
+KeepAlive:
+  SuccessfulExit: false
+  PathState:
+    /var/run/daemon.enabled: true
+RunAtLoad: true
+StartCalendarInterval:
+  Hour: 3
+  Minute: 30
+Sockets:
+  Listener:
+    SockServiceName: "8080"
+    SockFamily: IPv4
+  Control:
+    SockPathName: /var/run/daemon.sock
+    SockPathMode: 384
+MachServices:
+  io.cloudeng.daemon.xpc: true
+EnvironmentVariables:
+  LOG_LEVEL: debug
+StandardOutPath: /var/log/daemon.log
+StandardErrorPath: /var/log/daemon.err
+UserName: _daemon
+`
+
+func TestLaunchdPlist(t *testing.T) {
+	ctx := context.Background()
+	var lp buildtools.LaunchdPlist
+	if err := yaml.Unmarshal([]byte(launchDaemonYAML), &lp); err != nil {
+		t.Fatal(err)
+	}
+	if err := lp.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(lp.StartCalendarInterval), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	path := filepath.Join(t.TempDir(), "io.cloudeng.daemon.plist")
+	if _, err := lp.Write(path).Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<key>KeepAlive</key>\n\t\t<dict>\n\t\t\t<key>PathState</key>",
+		"<key>SuccessfulExit</key>\n\t\t\t<false/>",
+		"<key>StartCalendarInterval</key>\n\t\t<array>\n\t\t\t<dict>\n\t\t\t\t<key>Hour</key>\n\t\t\t\t<integer>3</integer>",
+		"<key>SockServiceName</key>\n\t\t\t\t<string>8080</string>",
+		"<key>UserName</key>\n\t\t<string>_daemon</string>",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s does not contain %v", data, want)
+		}
+	}
+	parsed, err := buildtools.ParseLaunchdPlist(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, lp) {
+		t.Errorf("got %+v, want %+v", parsed, lp)
+	}
+
+	// KeepAlive may be a boolean and StartCalendarInterval an array.
+	lp = buildtools.LaunchdPlist{}
+	if err := yaml.Unmarshal([]byte(`
+Label: io.cloudeng.agent
+Program: /usr/local/bin/agent
+KeepAlive: true
+StartCalendarInterval: [{Weekday: 1}, {Weekday: 5, Hour: 9}]
+`), &lp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lp.Write(path).Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "<key>KeepAlive</key>\n\t\t<true/>") {
+		t.Errorf("%s does not contain a boolean KeepAlive", data)
+	}
+	if parsed, err = buildtools.ParseLaunchdPlist(data); err != nil || !parsed.KeepAlive.Always || len(parsed.StartCalendarInterval) != 2 {
+		t.Errorf("unexpected plist: %+v: %v", parsed, err)
+	}
+
+	// A single StartCalendarInterval dictionary is also accepted.
+	parsed, err = buildtools.ParseLaunchdPlist([]byte(`<plist version="1.0"><dict>
+<key>Label</key><string>a</string>
+<key>StartCalendarInterval</key><dict><key>Minute</key><integer>5</integer></dict>
+</dict></plist>`))
+	if err != nil || len(parsed.StartCalendarInterval) != 1 || *parsed.StartCalendarInterval[0].Minute != 5 {
+		t.Errorf("unexpected plist: %+v: %v", parsed, err)
+	}
+
+	hour := 24
+	for _, tc := range []struct {
+		plist buildtools.LaunchdPlist
+		err   string
+	}{
+		{buildtools.LaunchdPlist{Label: "a", Program: "/a", StartInterval: -1}, "a: StartInterval: -1 is negative"},
+		{buildtools.LaunchdPlist{Label: "a", Program: "/a", StartCalendarInterval: buildtools.CalendarIntervals{{Hour: &hour}}}, "a: StartCalendarInterval[0]: Hour: 24 is not in the range 0-23"},
+		{buildtools.LaunchdPlist{Label: "a", Program: "/a", KeepAlive: &buildtools.KeepAlive{PathState: map[string]bool{"tmp/x": true}}}, `a: KeepAlive: PathState: "tmp/x" is not an absolute path`},
+		{buildtools.LaunchdPlist{Label: "a", Program: "/a", Sockets: map[string]buildtools.LaunchdSocket{"s": {SockType: "raw", SockServiceName: "80"}}}, `a: Sockets: s: invalid SockType "raw"`},
+		{buildtools.LaunchdPlist{Label: "a", Program: "/a", Sockets: map[string]buildtools.LaunchdSocket{"s": {SockFamily: "Unix"}}}, "a: Sockets: s: one of SockPathName or SockServiceName must be set"},
+		{buildtools.LaunchdPlist{Label: "a", Program: "/a", Sockets: map[string]buildtools.LaunchdSocket{"s": {SockFamily: "Unix", SockServiceName: "80"}}}, "a: Sockets: s: SockPathName must be set for a Unix socket"},
+		{buildtools.LaunchdPlist{Label: "a", Program: "/a", EnvironmentVariables: map[string]string{"A=B": "c"}}, `a: EnvironmentVariables: invalid variable name "A=B"`},
+		{buildtools.LaunchdPlist{Label: "a", Program: "/a", StandardErrorPath: "log/a.err"}, `a: StandardErrorPath: "log/a.err" is not an absolute path`},
+		{buildtools.LaunchdPlist{Label: "a", Program: "/a", UserName: "a b"}, `a: UserName: invalid user name "a b"`},
+	} {
+		if err := tc.plist.Validate(); err == nil || err.Error() != tc.err {
+			t.Errorf("%+v: unexpected or missing error: %v", tc.plist, err)
+		}
+		if _, err := tc.plist.Write(path).Run(ctx, buildtools.NewCommandRunner()); err == nil || err.Error() != "invalid launchd plist: "+tc.err {
+			t.Errorf("%+v: unexpected or missing error: %v", tc.plist, err)
+		}
+	}
+}
+
+func TestLaunchctlScript(t *testing.T) {
+	bin := t.TempDir()
+	log := filepath.Join(t.TempDir(), "launchctl.log")
+	for name, script := range map[string]string{
+		// Only the system domain job is not loaded.
+		"launchctl": `#!/bin/sh
+echo "$@" >> ` + log + `
+if [ "$1" = "print" ] && [ "$2" = "system/io.cloudeng.daemon" ]; then
+  exit 1
+fi
+`,
+		"id": "#!/bin/sh\necho 501\n",
+	} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil { //nolint:gosec // G306
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// BashInstallPreamble relies on the macOS stat command.
+	preamble := "#!/usr/bin/env bash\nset -euo pipefail\nTARGET_USER=${CONSOLE_USER}\n"
+	scr := buildtools.NewBashScript(preamble)
+	scr.LaunchctlBootout(false, "io.cloudeng.agent")
+	scr.LaunchctlBootout(true, "io.cloudeng.daemon")
+	scr.LaunchctlBootstrap(false, "${TARGET_USER}/Library/LaunchAgents/io.cloudeng.agent.plist")
+	scr.LaunchctlBootstrap(true, "/Library/LaunchDaemons/io.cloudeng.daemon.plist")
+	if got, want := strings.Count(string(scr.Bytes()), "function launchctl_bootout"), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	script := filepath.Join(t.TempDir(), "postinstall")
+	if err := os.WriteFile(script, scr.Bytes(), 0755); err != nil { //nolint:gosec // G306
+		t.Fatal(err)
+	}
+
+	runner := buildtools.NewCommandRunner()
+	t.Setenv("CONSOLE_USER", "tester")
+	res, err := runner.Run(context.Background(), script)
+	if err != nil {
+		t.Fatalf("%v: %s", err, res.Output())
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `print gui/501/io.cloudeng.agent
+bootout gui/501/io.cloudeng.agent
+print system/io.cloudeng.daemon
+bootstrap gui/501 tester/Library/LaunchAgents/io.cloudeng.agent.plist
+bootstrap system /Library/LaunchDaemons/io.cloudeng.daemon.plist
+`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Agents are skipped when there is no console user.
+	if err := os.Remove(log); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONSOLE_USER", "root")
+	if res, err := runner.Run(context.Background(), script); err != nil || !strings.Contains(res.Output(), "No console user, not stopping io.cloudeng.agent") {
+		t.Fatalf("%v: %s", err, res.Output())
+	}
+	if data, err = os.ReadFile(log); err != nil || strings.Contains(string(data), "gui/") {
+		t.Errorf("unexpected launchctl commands: %s: %v", data, err)
+	}
+}
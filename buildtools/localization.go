@@ -0,0 +1,263 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	"howett.net/plist"
+)
+
+const (
+	// InfoPlistStringsFile is the name of the file, within a .lproj
+	// directory, that contains localized Info.plist values.
+	InfoPlistStringsFile = "InfoPlist.strings"
+	// LocalizableStringsFile is the name of the file, within a .lproj
+	// directory, that contains an app's localized strings.
+	LocalizableStringsFile = "Localizable.strings"
+)
+
+// StringsFormat specifies the format used to write .strings files.
+type StringsFormat string
+
+const (
+	// StringsUTF16 is the text format, ie. "key" = "value";, encoded as
+	// UTF-16 with a byte order mark. It is the default.
+	StringsUTF16 StringsFormat = "utf16"
+	// StringsBinary is the binary property list format.
+	StringsBinary StringsFormat = "binary"
+)
+
+// Localization represents the localized strings for a single language.
+type Localization struct {
+	// InfoPlist contains localized values for Info.plist keys, such as
+	// CFBundleDisplayName and usage descriptions, which are written
+	// to InfoPlist.strings.
+	InfoPlist map[string]string `yaml:"info.plist,omitempty"`
+	// Strings contains the app's localized strings, which are written
+	// to Localizable.strings.
+	Strings map[string]string `yaml:"strings,omitempty"`
+}
+
+// Localizations represents a localization table, keyed by language,
+// eg. en or pt-BR, for which .lproj directories are created in an app
+// bundle's Resources directory. For example:
+//
+//	development-region: en
+//	format: utf16
+//	languages:
+//	  en:
+//	    info.plist:
+//	      CFBundleDisplayName: Example
+//	      NSCameraUsageDescription: Used to scan QR codes.
+//	    strings:
+//	      greeting: Hello
+//	  fr:
+//	    info.plist:
+//	      CFBundleDisplayName: Exemple
+//	      NSCameraUsageDescription: Utilisé pour scanner les codes QR.
+//	    strings:
+//	      greeting: Bonjour
+type Localizations struct {
+	// DevelopmentRegion is the language used when no localization matches
+	// the user's preferences, it is written to the Info.plist as
+	// CFBundleDevelopmentRegion.
+	DevelopmentRegion string                  `yaml:"development-region"`
+	Format            StringsFormat           `yaml:"format,omitempty"`
+	Languages         map[string]Localization `yaml:"languages"`
+}
+
+// LocalizableInfoPlistKeys lists the Info.plist keys, in addition to the
+// NS*UsageDescription keys, that may be localized via InfoPlist.strings.
+var LocalizableInfoPlistKeys = []string{
+	"CFBundleDisplayName",
+	"CFBundleName",
+	"CFBundleSpokenName",
+	"NSHumanReadableCopyright",
+}
+
+func isLocalizableInfoPlistKey(key string) bool {
+	return isUsageDescriptionKey(key) || slices.Contains(LocalizableInfoPlistKeys, key)
+}
+
+// Codes returns the sorted language codes of the localizations.
+func (l Localizations) Codes() []string {
+	return sortedKeys(l.Languages)
+}
+
+// Validate returns an error if the development region is not one of the
+// localized languages, if the format is unsupported, if any Info.plist key
+// cannot be localized or if any key, or value, is missing for any language
+// but present in another. All such errors are returned, joined together.
+func (l Localizations) Validate() error {
+	var errs []error
+	switch {
+	case l.DevelopmentRegion == "":
+		errs = append(errs, fmt.Errorf("development-region is not set"))
+	case len(l.Languages) > 0:
+		if _, ok := l.Languages[l.DevelopmentRegion]; !ok {
+			errs = append(errs, fmt.Errorf("development-region: %q is not one of the localized languages", l.DevelopmentRegion))
+		}
+	}
+	switch l.Format {
+	case "", StringsUTF16, StringsBinary:
+	default:
+		errs = append(errs, fmt.Errorf("format: %q is not one of %q or %q", l.Format, StringsUTF16, StringsBinary))
+	}
+	infoKeys, stringKeys := map[string]bool{}, map[string]bool{}
+	for _, loc := range l.Languages {
+		for k := range loc.InfoPlist {
+			infoKeys[k] = true
+		}
+		for k := range loc.Strings {
+			stringKeys[k] = true
+		}
+	}
+	for _, k := range sortedKeys(infoKeys) {
+		if !isLocalizableInfoPlistKey(k) {
+			errs = append(errs, fmt.Errorf("%v: %v is not a localizable Info.plist key", InfoPlistStringsFile, k))
+		}
+	}
+	for _, code := range l.Codes() {
+		loc := l.Languages[code]
+		errs = append(errs, missingKeys(code, InfoPlistStringsFile, infoKeys, loc.InfoPlist)...)
+		errs = append(errs, missingKeys(code, LocalizableStringsFile, stringKeys, loc.Strings)...)
+	}
+	return errors.Join(errs...)
+}
+
+func missingKeys(code, file string, want map[string]bool, got map[string]string) []error {
+	var errs []error
+	for _, k := range sortedKeys(want) {
+		if v, ok := got[k]; !ok {
+			errs = append(errs, fmt.Errorf("%v: %v: %v is missing", code, file, k))
+		} else if v == "" {
+			errs = append(errs, fmt.Errorf("%v: %v: %v is empty", code, file, k))
+		}
+	}
+	return errs
+}
+
+// ValidateLocalizations returns a Step that validates the localizations,
+// see Localizations.Validate, and that every localized Info.plist key is
+// present in the bundle's Info.plist, since only keys that are present
+// are localized.
+func (b AppBundle) ValidateLocalizations(l Localizations) Step {
+	return StepFunc(func(_ context.Context, _ *CommandRunner) (StepResult, error) {
+		errs := []error{l.Validate()}
+		keys := map[string]bool{}
+		for _, loc := range l.Languages {
+			for k := range loc.InfoPlist {
+				keys[k] = true
+			}
+		}
+		for _, k := range sortedKeys(keys) {
+			if _, ok := b.Info.Raw[k]; !ok {
+				errs = append(errs, fmt.Errorf("%v: %v is not set in Info.plist", InfoPlistStringsFile, k))
+			}
+		}
+		err := errors.Join(errs...)
+		return NewStepResult("validate localizations", l.Codes(), nil, err), err
+	})
+}
+
+// WithLocalizations returns a copy of the app bundle whose Info.plist
+// has CFBundleDevelopmentRegion and CFBundleLocalizations set from the
+// localizations.
+func (b AppBundle) WithLocalizations(l Localizations) AppBundle {
+	b.Info.Raw = maps.Clone(b.Info.Raw)
+	if b.Info.Raw == nil {
+		b.Info.Raw = map[string]any{}
+	}
+	if l.DevelopmentRegion != "" {
+		b.Info.Raw["CFBundleDevelopmentRegion"] = l.DevelopmentRegion
+	}
+	codes := make([]any, 0, len(l.Languages))
+	for _, code := range l.Codes() {
+		codes = append(codes, code)
+	}
+	b.Info.Raw["CFBundleLocalizations"] = codes
+	return b
+}
+
+// WriteLocalizations returns the steps required to create a <language>.lproj
+// directory in the app bundle's Resources directory for each of the
+// localizations and to write their InfoPlist.strings and Localizable.strings
+// files, if they have any entries, in the configured format.
+func (b AppBundle) WriteLocalizations(l Localizations) []Step {
+	if err := l.Validate(); err != nil {
+		return []Step{ErrorStep(fmt.Errorf("invalid localizations: %w", err), "write localizations", l.Codes()...)}
+	}
+	var steps []Step
+	for _, code := range l.Codes() {
+		loc := l.Languages[code]
+		dir := b.Resources(code + ".lproj")
+		steps = append(steps, MkdirAll(dir))
+		for _, f := range []struct {
+			name    string
+			entries map[string]string
+		}{
+			{InfoPlistStringsFile, loc.InfoPlist},
+			{LocalizableStringsFile, loc.Strings},
+		} {
+			if len(f.entries) == 0 {
+				continue
+			}
+			data, err := EncodeStrings(f.entries, l.Format)
+			if err != nil {
+				steps = append(steps, ErrorStep(err, "write "+f.name, dir))
+				continue
+			}
+			steps = append(steps, WriteFile(data, 0644, dir, f.name))
+		}
+	}
+	return steps
+}
+
+// EncodeStrings encodes the supplied entries as a .strings file in the
+// specified format, the entries are sorted by key.
+func EncodeStrings(entries map[string]string, format StringsFormat) ([]byte, error) {
+	switch format {
+	case "", StringsUTF16:
+		var out strings.Builder
+		for _, k := range sortedKeys(entries) {
+			fmt.Fprintf(&out, "%v = %v;\n", quoteString(k), quoteString(entries[k]))
+		}
+		return encodeUTF16(out.String()), nil
+	case StringsBinary:
+		return plist.Marshal(entries, plist.BinaryFormat)
+	}
+	return nil, fmt.Errorf("unsupported strings format: %q", format)
+}
+
+var stringsEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+func quoteString(s string) string {
+	return `"` + stringsEscaper.Replace(s) + `"`
+}
+
+// encodeUTF16 encodes s as little endian UTF-16 with a byte order mark.
+func encodeUTF16(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 0, 2+2*len(units))
+	out = append(out, 0xff, 0xfe)
+	for _, u := range units {
+		out = binary.LittleEndian.AppendUint16(out, u)
+	}
+	return out
+}
@@ -0,0 +1,201 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"cloudeng.io/macos/buildtools"
+	"gopkg.in/yaml.v3"
+	"howett.net/plist"
+)
+
+const localizationsYAML = `
+development-region: en
+languages:
+  en:
+    info.plist:
+      CFBundleDisplayName: Example
+      NSCameraUsageDescription: Used to scan "QR" codes.
+    strings:
+      greeting: Hello
+      farewell: "Goodbye\nfor now"
+  fr:
+    info.plist:
+      CFBundleDisplayName: Exemple
+      NSCameraUsageDescription: Utilisé pour scanner les codes QR.
+    strings:
+      greeting: Bonjour
+      farewell: Au revoir
+`
+
+func decodeUTF16(t *testing.T, data []byte) string {
+	t.Helper()
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xfe || len(data)%2 != 0 {
+		t.Fatalf("not little endian UTF-16 with a byte order mark: %x", data)
+	}
+	units := make([]uint16, 0, len(data)/2-1)
+	for i := 2; i < len(data); i += 2 {
+		units = append(units, binary.LittleEndian.Uint16(data[i:]))
+	}
+	return string(utf16.Decode(units))
+}
+
+func TestLocalizations(t *testing.T) {
+	ctx := context.Background()
+	var l buildtools.Localizations
+	if err := yaml.Unmarshal([]byte(localizationsYAML), &l); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	info := unmarshalInfoPlist(t, plistYAML+"NSCameraUsageDescription: Used to scan QR codes.\n")
+	bundle := buildtools.AppBundle{
+		Path: filepath.Join(t.TempDir(), "TestApp.app"),
+		Info: info,
+	}.WithLocalizations(l)
+	if got, want := bundle.Info.Raw["CFBundleDevelopmentRegion"], "en"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := bundle.Info.Raw["CFBundleLocalizations"], []any{"en", "fr"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, ok := info.Raw["CFBundleLocalizations"]; ok {
+		t.Errorf("original Info.plist was modified")
+	}
+
+	runner := buildtools.NewRunner()
+	runner.AddSteps(bundle.ValidateLocalizations(l))
+	runner.AddSteps(bundle.Create()...)
+	runner.AddSteps(bundle.WriteInfoPlist())
+	runner.AddSteps(bundle.WriteLocalizations(l)...)
+	if err := runner.Run(ctx, buildtools.NewCommandRunner()).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		file, want string
+	}{
+		{"en.lproj/InfoPlist.strings", `"CFBundleDisplayName" = "Example";
+"NSCameraUsageDescription" = "Used to scan \"QR\" codes.";
+`},
+		{"en.lproj/Localizable.strings", `"farewell" = "Goodbye\nfor now";
+"greeting" = "Hello";
+`},
+		{"fr.lproj/InfoPlist.strings", `"CFBundleDisplayName" = "Exemple";
+"NSCameraUsageDescription" = "Utilisé pour scanner les codes QR.";
+`},
+	} {
+		data, err := os.ReadFile(bundle.Resources(filepath.FromSlash(tc.file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := decodeUTF16(t, data), tc.want; got != want {
+			t.Errorf("%v: got %v, want %v", tc.file, got, want)
+		}
+	}
+	data, err := os.ReadFile(bundle.Contents("Info.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<key>CFBundleDevelopmentRegion</key>\n\t\t<string>en</string>",
+		"<key>CFBundleLocalizations</key>\n\t\t<array>\n\t\t\t<string>en</string>\n\t\t\t<string>fr</string>",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s does not contain %q", data, want)
+		}
+	}
+
+	l.Format = buildtools.StringsBinary
+	if err := buildtools.NewRunner().AddSteps(bundle.WriteLocalizations(l)...).Run(ctx, buildtools.NewCommandRunner()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(bundle.Resources("fr.lproj", "Localizable.strings"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "bplist00") {
+		t.Errorf("not a binary plist: %q", data)
+	}
+	var strs map[string]string
+	if _, err := plist.Unmarshal(data, &strs); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strs, l.Languages["fr"].Strings; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLocalizationValidation(t *testing.T) {
+	ctx := context.Background()
+	var l buildtools.Localizations
+	if err := yaml.Unmarshal([]byte(`
+development-region: de
+format: utf8
+languages:
+  en:
+    info.plist:
+      CFBundleDisplayName: Example
+      CFBundleIdentifier: io.cloudeng.Example
+    strings:
+      greeting: Hello
+      farewell: Goodbye
+  fr:
+    info.plist:
+      CFBundleDisplayName: ""
+    strings:
+      greeting: Bonjour
+`), &l); err != nil {
+		t.Fatal(err)
+	}
+	err := l.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		`development-region: "de" is not one of the localized languages`,
+		`format: "utf8" is not one of "utf16" or "binary"`,
+		"InfoPlist.strings: CFBundleIdentifier is not a localizable Info.plist key",
+		"fr: InfoPlist.strings: CFBundleDisplayName is empty",
+		"fr: InfoPlist.strings: CFBundleIdentifier is missing",
+		"fr: Localizable.strings: farewell is missing",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%v does not contain %v", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "en: ") {
+		t.Errorf("unexpected error for en: %v", err)
+	}
+
+	bundle := buildtools.AppBundle{
+		Path: filepath.Join(t.TempDir(), "TestApp.app"),
+		Info: unmarshalInfoPlist(t, plistYAML),
+	}
+	steps := bundle.WriteLocalizations(l)
+	if _, err := steps[0].Run(ctx, buildtools.NewCommandRunner()); err == nil || !strings.HasPrefix(err.Error(), "invalid localizations: ") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+
+	l = buildtools.Localizations{
+		DevelopmentRegion: "en",
+		Languages: map[string]buildtools.Localization{
+			"en": {InfoPlist: map[string]string{"NSCameraUsageDescription": "Camera"}},
+		},
+	}
+	_, err = bundle.ValidateLocalizations(l).Run(ctx, buildtools.NewCommandRunner())
+	if err == nil || err.Error() != "InfoPlist.strings: NSCameraUsageDescription is not set in Info.plist" {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"strings"
+)
+
+// NestedBundleKind identifies the kind of a bundle nested within an app
+// bundle, which determines its location, extension and package type.
+type NestedBundleKind int
+
+const (
+	XPCServiceBundle NestedBundleKind = iota // Contents/XPCServices/<name>.xpc
+	HelperAppBundle                          // Contents/Helpers/<name>.app
+	PlugInBundle                             // Contents/PlugIns/<name>.appex
+	LoginItemBundle                          // Contents/Library/LoginItems/<name>.app
+)
+
+func (k NestedBundleKind) String() string {
+	switch k {
+	case XPCServiceBundle:
+		return "xpc-service"
+	case HelperAppBundle:
+		return "helper"
+	case PlugInBundle:
+		return "plug-in"
+	case LoginItemBundle:
+		return "login-item"
+	}
+	return fmt.Sprintf("NestedBundleKind(%d)", int(k))
+}
+
+// Dir returns the directory, relative to the parent's Contents directory,
+// that bundles of this kind are placed in.
+func (k NestedBundleKind) Dir() string {
+	switch k {
+	case XPCServiceBundle:
+		return "XPCServices"
+	case HelperAppBundle:
+		return "Helpers"
+	case PlugInBundle:
+		return "PlugIns"
+	case LoginItemBundle:
+		return filepath.Join("Library", "LoginItems")
+	}
+	return ""
+}
+
+// Extension returns the file extension for bundles of this kind.
+func (k NestedBundleKind) Extension() string {
+	switch k {
+	case XPCServiceBundle:
+		return ".xpc"
+	case HelperAppBundle, LoginItemBundle:
+		return ".app"
+	case PlugInBundle:
+		return ".appex"
+	}
+	return ""
+}
+
+// PackageType returns the CFBundlePackageType required for bundles of
+// this kind, note that app extensions are XPC services.
+func (k NestedBundleKind) PackageType() string {
+	switch k {
+	case XPCServiceBundle, PlugInBundle:
+		return "XPC!"
+	case HelperAppBundle, LoginItemBundle:
+		return "APPL"
+	}
+	return ""
+}
+
+// NestedBundle represents an XPC service, helper app, app extension or
+// login item that is embedded within an app bundle. The embedded AppBundle's Path
+// is the absolute path of the nested bundle and its methods, such as
+// Create, WriteInfoPlist and CopyExecutable, are used to populate it.
+type NestedBundle struct {
+	AppBundle
+	Kind NestedBundleKind
+	// Entitlements, if set, are used to sign the nested bundle and its
+	// main executable, see WithNestedBundles.
+	Entitlements *Entitlements
+	parent       string
+	rel          string
+}
+
+// Nested returns a NestedBundle of the specified kind and name that is
+// located within the app bundle, eg. a name of "Service" for an
+// XPCServiceBundle refers to Contents/XPCServices/Service.xpc.
+func (b AppBundle) Nested(kind NestedBundleKind, name string, info InfoPlist, entitlements *Entitlements) NestedBundle {
+	rel := filepath.Join("Contents", kind.Dir(), name+kind.Extension())
+	return NestedBundle{
+		AppBundle:    AppBundle{Path: filepath.Join(b.Path, rel), Info: info},
+		Kind:         kind,
+		Entitlements: entitlements,
+		parent:       b.Path,
+		rel:          rel,
+	}
+}
+
+// RelPath returns the path of the nested bundle relative to its parent.
+func (n NestedBundle) RelPath() string {
+	return n.rel
+}
+
+// Validate returns an error if the nested bundle's Info.plist does not
+// have a CFBundleIdentifier that is prefixed by the parent's identifier,
+// a main executable and the package type required for its kind, or if
+// an app extension does not have an NSExtension dictionary that specifies
+// its extension point. All such errors are returned, joined together.
+func (n NestedBundle) Validate(parent InfoPlist) error {
+	var errs []error
+	id, _ := asString(n.Info.Raw, "CFBundleIdentifier")
+	parentID, _ := asString(parent.Raw, "CFBundleIdentifier")
+	switch {
+	case id == "":
+		errs = append(errs, fmt.Errorf("CFBundleIdentifier is not set"))
+	case parentID == "":
+		errs = append(errs, fmt.Errorf("the parent bundle's CFBundleIdentifier is not set"))
+	case !strings.HasPrefix(id, parentID+"."):
+		errs = append(errs, fmt.Errorf("CFBundleIdentifier: %q is not prefixed by the parent's identifier %q", id, parentID+"."))
+	}
+	if exe, _ := asString(n.Info.Raw, "CFBundleExecutable"); exe == "" {
+		errs = append(errs, fmt.Errorf("CFBundleExecutable is not set"))
+	}
+	if pt, _ := asString(n.Info.Raw, "CFBundlePackageType"); pt != n.Kind.PackageType() {
+		errs = append(errs, fmt.Errorf("CFBundlePackageType: %q must be %q for a %v", pt, n.Kind.PackageType(), n.Kind))
+	}
+	if n.Kind == PlugInBundle {
+		ext, ok := n.Info.Raw["NSExtension"].(map[string]any)
+		if !ok {
+			errs = append(errs, fmt.Errorf("NSExtension dictionary is not set"))
+		} else if pi, _ := asString(ext, "NSExtensionPointIdentifier"); pi == "" {
+			errs = append(errs, fmt.Errorf("NSExtension: NSExtensionPointIdentifier is not set"))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%v: %w", n.RelPath(), err)
+	}
+	return nil
+}
+
+// ValidateNested returns a Step that validates the specified nested
+// bundles against the app bundle's Info.plist, see NestedBundle.Validate.
+func (b AppBundle) ValidateNested(nested ...NestedBundle) Step {
+	return StepFunc(func(_ context.Context, _ *CommandRunner) (StepResult, error) {
+		var errs []error
+		args := make([]string, 0, len(nested))
+		for _, n := range nested {
+			args = append(args, n.RelPath())
+			if err := n.Validate(b.Info); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		err := errors.Join(errs...)
+		return NewStepResult("validate nested bundles", args, nil, err), err
+	})
+}
+
+// Sign returns a Step that signs the nested bundle, and hence its main
+// executable, using the entitlements for the bundle's path within its
+// parent or, if there are none, those for its main executable. Nested
+// bundles must be signed before their parent and after any code that
+// they contain, Signer.SignInsideOut determines this order automatically.
+func (n NestedBundle) Sign(signer Signer) Step {
+	rel := n.RelPath()
+	return signer.signPath(n.parent, rel, rel, n.executableRelPath())
+}
+
+func (n NestedBundle) executableRelPath() string {
+	return filepath.Join(n.rel, "Contents", "MacOS", n.Info.CFBundleExecutable)
+}
+
+// EmbedFramework returns a Step that copies the framework at src, eg.
+// Foo.framework, into the app bundle's Contents/Frameworks directory,
+// preserving the symbolic links within it. The framework's own
+// Info.plist and signature, if any, are retained.
+func (b AppBundle) EmbedFramework(src string) Step {
+	if filepath.Ext(src) != ".framework" {
+		return ErrorStep(fmt.Errorf("%q is not a framework", src), "rsync", src)
+	}
+	dir := b.Contents("Frameworks")
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		if res, err := MkdirAll(dir).Run(ctx, cmdRunner); err != nil {
+			return res, err
+		}
+		return RSync(filepath.Clean(src), dir).Run(ctx, cmdRunner)
+	})
+}
+
+// WithNestedBundles adds the entitlements for each of the specified
+// nested bundles, that has them, to the per-file entitlements used by
+// the Signer. They are keyed by both the nested bundle's path relative to
+// its parent, eg. Contents/XPCServices/Service.xpc, and that of its main
+// executable, so that either may be signed or verified.
+func WithNestedBundles(nested ...NestedBundle) SignerOption {
+	return func(s *Signer) {
+		raw := map[string]Entitlements{}
+		if s.perFileEntitlements != nil {
+			maps.Copy(raw, s.perFileEntitlements.raw)
+		}
+		for _, n := range nested {
+			if n.Entitlements != nil {
+				raw[filepath.ToSlash(n.RelPath())] = *n.Entitlements
+				raw[filepath.ToSlash(n.executableRelPath())] = *n.Entitlements
+			}
+		}
+		s.perFileEntitlements = &PerFileEntitlements{raw: raw}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloudeng.io/macos/buildtools"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	xpcServiceYAML = `
+CFBundleIdentifier: io.cloudeng.TestApp.Service
+CFBundleName: Service
+CFBundleVersion: 1.0.0
+CFBundleExecutable: Service
+CFBundlePackageType: XPC!
+LSMinimumSystemVersion: "15.0"
+CFBundleDisplayName: Service
+XPCService:
+  ServiceName: io.cloudeng.TestApp.Service
+  ServiceType: Application
+`
+	helperAppYAML = `
+CFBundleIdentifier: io.cloudeng.TestApp.Helper
+CFBundleName: Helper
+CFBundleVersion: 1.0.0
+CFBundleExecutable: Helper
+CFBundlePackageType: APPL
+LSMinimumSystemVersion: "15.0"
+CFBundleDisplayName: Helper
+LSUIElement: true
+`
+	plugInYAML = `
+CFBundleIdentifier: io.cloudeng.TestApp.Share
+CFBundleName: Share
+CFBundleVersion: 1.0.0
+CFBundleExecutable: Share
+CFBundlePackageType: XPC!
+LSMinimumSystemVersion: "15.0"
+CFBundleDisplayName: Share
+NSExtension:
+  NSExtensionPointIdentifier: com.apple.share-services
+  NSExtensionPrincipalClass: ShareViewController
+`
+	nestedEntitlementsYAML = `
+service:
+  com.apple.security.app-sandbox: true
+  com.apple.security.network.client: true
+plugin:
+  com.apple.security.app-sandbox: true
+  com.apple.security.files.user-selected.read-only: true
+`
+)
+
+func unmarshalInfoPlist(t *testing.T, spec string) buildtools.InfoPlist {
+	t.Helper()
+	var info buildtools.InfoPlist
+	if err := yaml.Unmarshal([]byte(spec), &info); err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestNestedBundles(t *testing.T) {
+	ctx := context.Background()
+	binary := buildDarwinBinary(t)
+	var ents map[string]*buildtools.Entitlements
+	if err := yaml.Unmarshal([]byte(nestedEntitlementsYAML), &ents); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := buildtools.AppBundle{
+		Path: filepath.Join(t.TempDir(), "TestApp.app"),
+		Info: unmarshalInfoPlist(t, plistYAML),
+	}
+	service := bundle.Nested(buildtools.XPCServiceBundle, "Service", unmarshalInfoPlist(t, xpcServiceYAML), ents["service"])
+	helper := bundle.Nested(buildtools.HelperAppBundle, "Helper", unmarshalInfoPlist(t, helperAppYAML), nil)
+	plugin := bundle.Nested(buildtools.PlugInBundle, "Share", unmarshalInfoPlist(t, plugInYAML), ents["plugin"])
+	nested := []buildtools.NestedBundle{service, helper, plugin}
+
+	for _, tc := range []struct {
+		nb   buildtools.NestedBundle
+		path string
+	}{
+		{service, "Contents/XPCServices/Service.xpc"},
+		{helper, "Contents/Helpers/Helper.app"},
+		{plugin, "Contents/PlugIns/Share.appex"},
+	} {
+		if got, want := tc.nb.RelPath(), filepath.FromSlash(tc.path); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if got, want := tc.nb.Path, filepath.Join(bundle.Path, filepath.FromSlash(tc.path)); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	if got, want := plugin.Info.NSExtension.PointIdentifier, "com.apple.share-services"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	runner := buildtools.NewRunner()
+	runner.AddSteps(bundle.ValidateNested(nested...))
+	runner.AddSteps(bundle.Create()...)
+	runner.AddSteps(bundle.WriteInfoPlist(), bundle.CopyExecutable(binary))
+	for _, nb := range nested {
+		runner.AddSteps(nb.Create()...)
+		runner.AddSteps(nb.WriteInfoPlist(), nb.CopyExecutable(binary))
+	}
+	if err := runner.Run(ctx, buildtools.NewCommandRunner()).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	signer := buildtools.NewSigner("-", nil, nil, nil,
+		buildtools.WithSigningBackend(buildtools.AdHocBackend{}),
+		buildtools.WithNestedBundles(nested...))
+
+	res, err := bundle.SignInsideOut(signer).Run(ctx, buildtools.NewCommandRunner(buildtools.WithDryRun(true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.Output(), fmt.Sprintf(`1: %[1]v/Contents/Helpers/Helper.app (app)
+2: %[1]v/Contents/PlugIns/Share.appex (xpc-service)
+3: %[1]v/Contents/XPCServices/Service.xpc (xpc-service)
+4: %[1]v (app)
+`, bundle.Path); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	runner = buildtools.NewRunner()
+	for _, nb := range nested {
+		runner.AddSteps(nb.Sign(signer))
+	}
+	runner.AddSteps(
+		bundle.Sign(signer),
+		signer.VerifyEntitlements(bundle.Path, filepath.Join(service.RelPath(), "Contents", "MacOS", "Service")),
+		signer.VerifyEntitlements(bundle.Path, filepath.Join(helper.RelPath(), "Contents", "MacOS", "Helper")),
+		signer.VerifyEntitlements(bundle.Path, filepath.Join(plugin.RelPath(), "Contents", "MacOS", "Share")),
+		buildtools.VerifyPathOffline(bundle.Path, ""),
+	)
+	results := runner.Run(ctx, buildtools.NewCommandRunner())
+	if err := results.Error(); err != nil {
+		for _, r := range results {
+			t.Log(r.String())
+		}
+		t.Fatal(err)
+	}
+}
+
+func TestNestedBundleValidation(t *testing.T) {
+	ctx := context.Background()
+	bundle := buildtools.AppBundle{
+		Path: filepath.Join(t.TempDir(), "TestApp.app"),
+		Info: unmarshalInfoPlist(t, plistYAML),
+	}
+	for _, tc := range []struct {
+		kind buildtools.NestedBundleKind
+		yaml string
+		err  string
+	}{
+		{buildtools.XPCServiceBundle,
+			strings.ReplaceAll(xpcServiceYAML, "io.cloudeng.TestApp.Service", "io.cloudeng.TestAppService"),
+			`Contents/XPCServices/Nested.xpc: CFBundleIdentifier: "io.cloudeng.TestAppService" is not prefixed by the parent's identifier "io.cloudeng.TestApp."`},
+		{buildtools.HelperAppBundle, xpcServiceYAML,
+			`Contents/Helpers/Nested.app: CFBundlePackageType: "XPC!" must be "APPL" for a helper`},
+		{buildtools.PlugInBundle, xpcServiceYAML,
+			"Contents/PlugIns/Nested.appex: NSExtension dictionary is not set"},
+	} {
+		nb := bundle.Nested(tc.kind, "Nested", unmarshalInfoPlist(t, tc.yaml), nil)
+		if err := nb.Validate(bundle.Info); err == nil || err.Error() != filepath.FromSlash(tc.err) {
+			t.Errorf("%v: unexpected or missing error: %v", tc.kind, err)
+		}
+		_, err := bundle.ValidateNested(nb).Run(ctx, buildtools.NewCommandRunner())
+		if err == nil || err.Error() != filepath.FromSlash(tc.err) {
+			t.Errorf("%v: unexpected or missing error: %v", tc.kind, err)
+		}
+	}
+
+	nb := bundle.Nested(buildtools.PlugInBundle, "Nested", buildtools.InfoPlist{
+		Raw: map[string]any{"NSExtension": map[string]any{}},
+	}, nil)
+	err := nb.Validate(bundle.Info)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		"CFBundleIdentifier is not set",
+		"CFBundleExecutable is not set",
+		`CFBundlePackageType: "" must be "XPC!" for a plug-in`,
+		"NSExtension: NSExtensionPointIdentifier is not set",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%v does not contain %v", err, want)
+		}
+	}
+}
+
+func TestEmbedFramework(t *testing.T) {
+	ctx := context.Background()
+	bundle := buildtools.AppBundle{Path: filepath.Join(t.TempDir(), "TestApp.app")}
+	if _, err := bundle.EmbedFramework("Foo.dylib").Run(ctx, buildtools.NewCommandRunner()); err == nil || err.Error() != `"Foo.dylib" is not a framework` {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	if _, err := exec.LookPath("rsync"); err != nil {
+		t.Skip("rsync not available")
+	}
+	fw := filepath.Join(t.TempDir(), "Foo.framework")
+	if err := os.MkdirAll(filepath.Join(fw, "Versions", "A", "Resources"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range [][2]string{
+		{"A", filepath.Join(fw, "Versions", "Current")},
+		{filepath.Join("Versions", "Current", "Resources"), filepath.Join(fw, "Resources")},
+	} {
+		if err := os.Symlink(link[0], link[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := bundle.EmbedFramework(fw).Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+	target, err := os.Readlink(bundle.Contents("Frameworks", "Foo.framework", "Versions", "Current"))
+	if err != nil || target != "A" {
+		t.Errorf("unexpected symlink: %v: %v", target, err)
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// NotaryAuth represents the credentials used by notarytool. Either a
+// keychain profile, as created by notarytool store-credentials, or an
+// App Store Connect API key must be specified.
+type NotaryAuth struct {
+	KeychainProfile string `yaml:"keychain-profile,omitempty"`
+	// Keychain optionally specifies the keychain that contains the
+	// keychain profile.
+	Keychain string `yaml:"keychain,omitempty"`
+	// APIKey is the path of an App Store Connect API key (.p8) file,
+	// APIKeyID its identifier and APIIssuer the issuer UUID, which is
+	// not required for individual API keys.
+	APIKey    string `yaml:"api-key,omitempty"`
+	APIKeyID  string `yaml:"api-key-id,omitempty"`
+	APIIssuer string `yaml:"api-issuer,omitempty"`
+}
+
+// Args returns the notarytool arguments for the credentials.
+func (a NotaryAuth) Args() ([]string, error) {
+	switch {
+	case a.KeychainProfile != "" && a.APIKey != "":
+		return nil, fmt.Errorf("only one of a keychain profile or an API key may be specified")
+	case a.KeychainProfile != "":
+		args := []string{"--keychain-profile", a.KeychainProfile}
+		if a.Keychain != "" {
+			args = append(args, "--keychain", a.Keychain)
+		}
+		return args, nil
+	case a.APIKey != "":
+		if a.APIKeyID == "" {
+			return nil, fmt.Errorf("an API key requires a key ID")
+		}
+		args := []string{"--key", a.APIKey, "--key-id", a.APIKeyID}
+		if a.APIIssuer != "" {
+			args = append(args, "--issuer", a.APIIssuer)
+		}
+		return args, nil
+	}
+	return nil, fmt.Errorf("either a keychain profile or an API key must be specified")
+}
+
+// Notarization status values as reported by notarytool.
+const (
+	NotaryInProgress = "In Progress"
+	NotaryAccepted   = "Accepted"
+	NotaryInvalid    = "Invalid"
+	NotaryRejected   = "Rejected"
+)
+
+// NotarySubmission represents a submission to the notary service as
+// reported by notarytool submit and notarytool info.
+type NotarySubmission struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+	CreatedDate string `json:"createdDate"`
+}
+
+// NotaryIssue represents an issue reported in a notarization log.
+type NotaryIssue struct {
+	Severity     string `json:"severity"`
+	Code         any    `json:"code"`
+	Path         string `json:"path"`
+	Message      string `json:"message"`
+	DocURL       string `json:"docUrl"`
+	Architecture string `json:"architecture"`
+}
+
+func (i NotaryIssue) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%v: %v", i.Severity, i.Path)
+	if i.Architecture != "" {
+		fmt.Fprintf(&out, " (%v)", i.Architecture)
+	}
+	fmt.Fprintf(&out, ": %v", i.Message)
+	if i.DocURL != "" {
+		fmt.Fprintf(&out, " see %v", i.DocURL)
+	}
+	return out.String()
+}
+
+// NotaryTicket represents an item of code included in a notarization
+// ticket.
+type NotaryTicket struct {
+	Path            string `json:"path"`
+	DigestAlgorithm string `json:"digestAlgorithm"`
+	CDHash          string `json:"cdhash"`
+	Architecture    string `json:"arch"`
+}
+
+// NotaryLog represents the JSON log for a notarization submission as
+// returned by notarytool log.
+type NotaryLog struct {
+	LogFormatVersion int            `json:"logFormatVersion"`
+	JobID            string         `json:"jobId"`
+	Status           string         `json:"status"`
+	StatusSummary    string         `json:"statusSummary"`
+	StatusCode       int            `json:"statusCode"`
+	ArchiveFilename  string         `json:"archiveFilename"`
+	UploadDate       string         `json:"uploadDate"`
+	SHA256           string         `json:"sha256"`
+	TicketContents   []NotaryTicket `json:"ticketContents"`
+	Issues           []NotaryIssue  `json:"issues"`
+}
+
+// Errors returns the issues with a severity of error.
+func (l NotaryLog) Errors() []NotaryIssue {
+	var errs []NotaryIssue
+	for _, i := range l.Issues {
+		if i.Severity == "error" {
+			errs = append(errs, i)
+		}
+	}
+	return errs
+}
+
+// decodeJSON decodes the first JSON object in data, ignoring any
+// preceding text such as warnings written to stderr.
+func decodeJSON(data []byte, v any) error {
+	idx := bytes.IndexByte(data, '{')
+	if idx < 0 {
+		return fmt.Errorf("no JSON object found in: %q", data)
+	}
+	return json.NewDecoder(bytes.NewReader(data[idx:])).Decode(v)
+}
+
+// ParseNotarySubmission parses the JSON output of notarytool submit or
+// notarytool info.
+func ParseNotarySubmission(data []byte) (NotarySubmission, error) {
+	var s NotarySubmission
+	if err := decodeJSON(data, &s); err != nil {
+		return s, fmt.Errorf("failed to parse notarytool output: %w", err)
+	}
+	if s.ID == "" {
+		return s, fmt.Errorf("no submission id found in notarytool output: %q", data)
+	}
+	return s, nil
+}
+
+// ParseNotaryLog parses the JSON log returned by notarytool log.
+func ParseNotaryLog(data []byte) (NotaryLog, error) {
+	var l NotaryLog
+	if err := decodeJSON(data, &l); err != nil {
+		return l, fmt.Errorf("failed to parse notarization log: %w", err)
+	}
+	return l, nil
+}
+
+// Notarizer provides steps to notarize and staple apps, packages and
+// disk images using notarytool and stapler. The steps share the state of
+// a single submission and hence a Notarizer must be used for only one
+// item at a time.
+type Notarizer struct {
+	Auth NotaryAuth
+	// Timeout is the maximum time to wait for the notary service to
+	// process a submission, it defaults to 30 minutes.
+	Timeout time.Duration
+	// PollInterval is the interval at which the status of a submission
+	// is checked, it defaults to 30 seconds.
+	PollInterval time.Duration
+
+	submission NotarySubmission
+	log        *NotaryLog
+}
+
+// Submission returns the most recently submitted, or waited for,
+// submission.
+func (n *Notarizer) Submission() NotarySubmission {
+	return n.submission
+}
+
+// Log returns the notarization log fetched by the step returned by
+// FetchLog, or nil if it has not been fetched.
+func (n *Notarizer) Log() *NotaryLog {
+	return n.log
+}
+
+// ZipForNotarization returns a Step that creates a zip archive of path,
+// typically an app bundle, using ditto in the manner recommended for
+// notarization, ie. preserving the bundle's top-level directory, extended
+// attributes and resource forks.
+func ZipForNotarization(path, zip string) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		return cmdRunner.Run(ctx, "ditto", "-c", "-k", "--sequesterRsrc", "--keepParent", path, zip)
+	})
+}
+
+func (n *Notarizer) notarytool(ctx context.Context, cmdRunner *CommandRunner, args ...string) (StepResult, error) {
+	auth, err := n.Auth.Args()
+	if err != nil {
+		return NewStepResult("xcrun", append([]string{"notarytool"}, args...), nil, err), err
+	}
+	args = append(append(append([]string{"notarytool"}, args...), auth...), "--output-format", "json")
+	return cmdRunner.Run(ctx, "xcrun", args...)
+}
+
+func withOutput(result StepResult, output string, err error) (StepResult, error) {
+	return NewStepResult(result.executable, result.args, []byte(output), err), err
+}
+
+// Submit returns a Step that submits the specified zip archive, installer
+// package or disk image to the notary service. The submission's id is
+// reported in the step's output.
+func (n *Notarizer) Submit(path string) Step {
+	switch filepath.Ext(path) {
+	case ".zip", ".pkg", ".dmg":
+	default:
+		return ErrorStep(fmt.Errorf("%v: only .zip, .pkg or .dmg files can be submitted for notarization", path), "xcrun", "notarytool", "submit", path)
+	}
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		n.submission, n.log = NotarySubmission{}, nil
+		result, err := n.notarytool(ctx, cmdRunner, "submit", path)
+		if err != nil || cmdRunner.DryRun() {
+			return result, err
+		}
+		s, err := ParseNotarySubmission(result.output)
+		if err != nil {
+			return withOutput(result, string(result.output), err)
+		}
+		n.submission = s
+		return withOutput(result, fmt.Sprintf("submission id: %v: %v\n", s.ID, s.Message), nil)
+	})
+}
+
+// Wait returns a Step that polls the status of the most recent submission
+// until it is no longer in progress or until the Notarizer's timeout is
+// reached. The final status is reported in the step's output, but the
+// step succeeds even if the submission was not accepted so that the log
+// can be fetched using FetchLog.
+func (n *Notarizer) Wait() Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		if cmdRunner.DryRun() {
+			return n.notarytool(ctx, cmdRunner, "info", "<submission-id>")
+		}
+		if n.submission.ID == "" {
+			err := fmt.Errorf("no notarization submission to wait for")
+			return NewStepResult("xcrun", []string{"notarytool", "info"}, nil, err), err
+		}
+		timeout, interval := n.Timeout, n.PollInterval
+		if timeout == 0 {
+			timeout = 30 * time.Minute
+		}
+		if interval == 0 {
+			interval = 30 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		start := time.Now()
+		for {
+			result, err := n.notarytool(ctx, cmdRunner, "info", n.submission.ID)
+			if err != nil {
+				if ctx.Err() != nil {
+					err = fmt.Errorf("timed out after %v waiting for submission %v: %w", timeout, n.submission.ID, err)
+				}
+				return withOutput(result, string(result.output), err)
+			}
+			s, err := ParseNotarySubmission(result.output)
+			if err != nil {
+				return withOutput(result, string(result.output), err)
+			}
+			n.submission = s
+			if s.Status != NotaryInProgress {
+				return withOutput(result, fmt.Sprintf("submission id: %v: %v after %v\n", s.ID, s.Status, time.Since(start).Round(time.Second)), nil)
+			}
+			select {
+			case <-ctx.Done():
+				err := fmt.Errorf("timed out after %v waiting for submission %v which is still %v", timeout, s.ID, s.Status)
+				return withOutput(result, "", err)
+			case <-time.After(interval):
+			}
+		}
+	})
+}
+
+// FetchLog returns a Step that fetches and parses the notarization log for
+// the most recent submission. The submission's status and every issue in
+// the log are reported in the step's output and the step fails if the
+// submission was not accepted.
+func (n *Notarizer) FetchLog() Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		if cmdRunner.DryRun() {
+			return n.notarytool(ctx, cmdRunner, "log", "<submission-id>")
+		}
+		if n.submission.ID == "" {
+			err := fmt.Errorf("no notarization submission to fetch the log for")
+			return NewStepResult("xcrun", []string{"notarytool", "log"}, nil, err), err
+		}
+		result, err := n.notarytool(ctx, cmdRunner, "log", n.submission.ID)
+		if err != nil {
+			return result, err
+		}
+		l, err := ParseNotaryLog(result.output)
+		if err != nil {
+			return withOutput(result, string(result.output), err)
+		}
+		n.log = &l
+		var out strings.Builder
+		fmt.Fprintf(&out, "submission id: %v: %v: %v\n", l.JobID, l.Status, l.StatusSummary)
+		for _, issue := range l.Issues {
+			fmt.Fprintf(&out, "%v\n", issue)
+		}
+		if l.Status != NotaryAccepted {
+			err = fmt.Errorf("notarization of %v failed: %v: %v issue(s), %v error(s)", l.ArchiveFilename, l.Status, len(l.Issues), len(l.Errors()))
+		}
+		return withOutput(result, out.String(), err)
+	})
+}
+
+// Staple returns a Step that staples the notarization ticket to the
+// specified app bundle, package or disk image.
+func Staple(path string) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		return cmdRunner.Run(ctx, "xcrun", "stapler", "staple", path)
+	})
+}
+
+// ValidateStaple returns a Step that validates the notarization ticket
+// stapled to the specified app bundle, package or disk image.
+func ValidateStaple(path string) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		return cmdRunner.Run(ctx, "xcrun", "stapler", "validate", path)
+	})
+}
+
+// Notarize returns the steps required to notarize and staple the
+// specified app bundle, installer package or disk image. App bundles are
+// first zipped, using ZipForNotarization, into a file of the same name,
+// but with a .zip extension, alongside the bundle; the ticket is stapled
+// to the bundle rather than the zip archive.
+func (n *Notarizer) Notarize(path string) []Step {
+	steps := []Step{}
+	submit := path
+	if filepath.Ext(path) == ".app" {
+		submit = strings.TrimSuffix(path, ".app") + ".zip"
+		steps = append(steps, ZipForNotarization(path, submit))
+	}
+	return append(steps,
+		n.Submit(submit),
+		n.Wait(),
+		n.FetchLog(),
+		Staple(path),
+		ValidateStaple(path),
+	)
+}
@@ -0,0 +1,202 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudeng.io/macos/buildtools"
+)
+
+func readNotaryFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "notarytool", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseNotaryOutput(t *testing.T) {
+	s, err := buildtools.ParseNotarySubmission(append([]byte("warning: something\n"), readNotaryFixture(t, "submit.json")...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.ID, "2efe2717-52ef-43a5-96dc-0797e4ca1041"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	s, err = buildtools.ParseNotarySubmission(readNotaryFixture(t, "info-invalid.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Status, buildtools.NotaryInvalid; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := buildtools.ParseNotarySubmission([]byte(`{"message":"no id"}`)); err == nil {
+		t.Errorf("expected an error")
+	}
+
+	l, err := buildtools.ParseNotaryLog(readNotaryFixture(t, "log-invalid.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := l.StatusCode, 4000; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(l.Issues), 3; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := len(l.Errors()), 2; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := l.Issues[1].String(), "error: TestApp.zip/TestApp.app/Contents/MacOS/TestApp (arm64): The executable does not have the hardened runtime enabled. see https://developer.apple.com/documentation/security/notarizing_macos_software_before_distribution/resolving_common_notarization_issues#3087724"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := l.Issues[2].String(), "warning: TestApp.zip/TestApp.app/Contents/MacOS/TestApp (x86_64): The binary uses an SDK older than the 10.9 SDK."; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	l, err = buildtools.ParseNotaryLog(readNotaryFixture(t, "log-accepted.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(l.TicketContents), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := l.TicketContents[0].Architecture, "arm64"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// fakeNotaryTools installs xcrun and ditto commands that log their
+// arguments and return the specified notarytool fixtures. The first
+// notarytool info request reports that the submission is in progress.
+func fakeNotaryTools(t *testing.T, info, log string) string {
+	t.Helper()
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "log")
+	fixtures, err := filepath.Abs(filepath.Join("testdata", "notarytool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	xcrun := fmt.Sprintf(`#!/bin/sh
+echo xcrun "$@" >> %[1]q
+case "$1 $2" in
+"notarytool submit") cat %[2]q/submit.json;;
+"notarytool info")
+	if [ -f %[1]q.polled ]; then cat %[2]q/%[3]v; else touch %[1]q.polled; cat %[2]q/info-in-progress.json; fi;;
+"notarytool log") cat %[2]q/%[4]v;;
+esac
+`, logFile, fixtures, info, log)
+	ditto := fmt.Sprintf(`#!/bin/sh
+echo ditto "$@" >> %[1]q
+`, logFile)
+	for name, script := range map[string]string{"xcrun": xcrun, "ditto": ditto} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0700); err != nil { //nolint:gosec // G306
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return logFile
+}
+
+func TestNotarize(t *testing.T) {
+	ctx := context.Background()
+	app := filepath.Join(t.TempDir(), "TestApp.app")
+	zip := strings.TrimSuffix(app, ".app") + ".zip"
+	auth := buildtools.NotaryAuth{KeychainProfile: "notary"}
+
+	logFile := fakeNotaryTools(t, "info-accepted.json", "log-accepted.json")
+	n := &buildtools.Notarizer{Auth: auth, PollInterval: time.Millisecond}
+	results := buildtools.NewRunner().AddSteps(n.Notarize(app)...).Run(ctx, buildtools.NewCommandRunner())
+	if err := results.Error(); err != nil {
+		t.Fatal(err)
+	}
+	var output strings.Builder
+	for _, r := range results {
+		output.WriteString(r.Output())
+	}
+	for _, want := range []string{
+		"submission id: 2efe2717-52ef-43a5-96dc-0797e4ca1041: Successfully uploaded file\n",
+		"submission id: 2efe2717-52ef-43a5-96dc-0797e4ca1041: Accepted after",
+		"submission id: 2efe2717-52ef-43a5-96dc-0797e4ca1041: Accepted: Ready for distribution\n",
+	} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("%q does not contain %q", output.String(), want)
+		}
+	}
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := "2efe2717-52ef-43a5-96dc-0797e4ca1041"
+	if got, want := strings.Split(strings.TrimSpace(string(data)), "\n"), []string{
+		"ditto -c -k --sequesterRsrc --keepParent " + app + " " + zip,
+		"xcrun notarytool submit " + zip + " --keychain-profile notary --output-format json",
+		"xcrun notarytool info " + id + " --keychain-profile notary --output-format json",
+		"xcrun notarytool info " + id + " --keychain-profile notary --output-format json",
+		"xcrun notarytool log " + id + " --keychain-profile notary --output-format json",
+		"xcrun stapler staple " + app,
+		"xcrun stapler validate " + app,
+	}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got, want := n.Log().Status, buildtools.NotaryAccepted; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// A rejected submission reports its issues and is not stapled.
+	fakeNotaryTools(t, "info-invalid.json", "log-invalid.json")
+	n = &buildtools.Notarizer{
+		Auth:         buildtools.NotaryAuth{APIKey: "key.p8", APIKeyID: "KEYID", APIIssuer: "issuer"},
+		PollInterval: time.Millisecond,
+	}
+	results = buildtools.NewRunner().AddSteps(n.Notarize(app)...).Run(ctx, buildtools.NewCommandRunner())
+	err = results.Error()
+	if err == nil || err.Error() != "notarization of TestApp.zip failed: Invalid: 3 issue(s), 2 error(s)" {
+		t.Fatalf("unexpected or missing error: %v", err)
+	}
+	last := results[len(results)-1]
+	if got, want := last.CommandLine(), "xcrun notarytool log 2efe2717-52ef-43a5-96dc-0797e4ca1041 --key key.p8 --key-id KEYID --issuer issuer --output-format json "; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := strings.Count(last.Output(), "error: "), 2; got != want {
+		t.Errorf("got %v, want %v: %v", got, want, last.Output())
+	}
+	if got, want := len(n.Log().Issues), 3; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Time out whilst the submission is in progress.
+	fakeNotaryTools(t, "info-in-progress.json", "log-invalid.json")
+	n = &buildtools.Notarizer{Auth: auth, PollInterval: time.Millisecond, Timeout: 50 * time.Millisecond}
+	results = buildtools.NewRunner().AddSteps(n.Submit(zip), n.Wait()).Run(ctx, buildtools.NewCommandRunner())
+	if err := results.Error(); err == nil || !strings.Contains(err.Error(), "timed out after 50ms waiting for submission") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		auth buildtools.NotaryAuth
+		path string
+		err  string
+	}{
+		{buildtools.NotaryAuth{}, zip, "either a keychain profile or an API key must be specified"},
+		{buildtools.NotaryAuth{KeychainProfile: "p", APIKey: "k"}, zip, "only one of a keychain profile or an API key may be specified"},
+		{buildtools.NotaryAuth{APIKey: "k"}, zip, "an API key requires a key ID"},
+		{auth, app, "only .zip, .pkg or .dmg files can be submitted for notarization"},
+	} {
+		n := &buildtools.Notarizer{Auth: tc.auth}
+		_, err := n.Submit(tc.path).Run(ctx, buildtools.NewCommandRunner(buildtools.WithDryRun(true)))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("unexpected or missing error: %v", err)
+		}
+	}
+}
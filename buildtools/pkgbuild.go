@@ -109,11 +109,21 @@ func (p PkgBuild) OutputsPath() string {
 
 // Build returns a Step that builds the package using pkgbuild.
 func (p PkgBuild) Build(outputPath string) Step {
+	args, err := p.buildArgs(outputPath)
+	if err != nil {
+		return ErrorStep(err, "pkgbuild")
+	}
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		return cmdRunner.Run(ctx, "pkgbuild", args...)
+	})
+}
+
+func (p PkgBuild) buildArgs(outputPath string) ([]string, error) {
 	if len(outputPath) == 0 || len(p.InstallLocation) == 0 || len(p.Identifier) == 0 || len(p.Version) == 0 {
-		return ErrorStep(fmt.Errorf("one of outputPath, InstallLocation, Identifier or Version is not set: %+v", p), "pkgbuild")
+		return nil, fmt.Errorf("one of outputPath, InstallLocation, Identifier or Version is not set: %+v", p)
 	}
 	pkgPath := filepath.Join(p.OutputsPath(), filepath.Base(outputPath))
-	args := []string{
+	return []string{
 		"--root", filepath.Join(p.BuildDir, "root"),
 		"--component-plist", filepath.Join(p.BuildDir, "component.plist"),
 		"--identifier", p.Identifier,
@@ -121,10 +131,7 @@ func (p PkgBuild) Build(outputPath string) Step {
 		"--install-location", p.InstallLocation,
 		"--scripts", p.ScriptsPath(),
 		pkgPath,
-	}
-	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
-		return cmdRunner.Run(ctx, "pkgbuild", args...)
-	})
+	}, nil
 }
 
 // Install returns a Step that installs the package using the system installer command
@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 	"howett.net/plist"
@@ -19,16 +21,136 @@ import (
 // and are extracted from the Raw map for convenience and use
 // within this package.
 type InfoPlist struct {
-	CFBundleIdentifier     string
-	CFBundleName           string
-	CFBundleExecutable     string
-	CFBundleIconFile       string
-	CFBundlePackageType    string
-	LSMinimumSystemVersion string
-	CFBundleDisplayName    string
-	CFBundleVersion        string
-	XPCService             *XPCServicePlist
-	Raw                    map[string]any
+	CFBundleIdentifier         string
+	CFBundleName               string
+	CFBundleExecutable         string
+	CFBundleIconFile           string
+	CFBundlePackageType        string
+	LSMinimumSystemVersion     string
+	CFBundleDisplayName        string
+	CFBundleVersion            string
+	CFBundleShortVersionString string
+	NSHumanReadableCopyright   string
+	LSApplicationCategoryType  string
+	LSUIElement                bool
+	LSBackgroundOnly           bool
+	CFBundleURLTypes           []URLType
+	CFBundleDocumentTypes      []DocumentType
+	UTExportedTypeDeclarations []TypeDeclaration
+	// UsageDescriptions contains the NS*UsageDescription privacy strings
+	// keyed by their Info.plist key, eg. NSCameraUsageDescription.
+	UsageDescriptions map[string]string
+	XPCService        *XPCServicePlist
+	NSExtension       *ExtensionPlist
+	Raw               map[string]any
+}
+
+// URLType represents an entry in the CFBundleURLTypes array, ie. a
+// URL scheme handled by the application.
+type URLType struct {
+	CFBundleURLName     string   `yaml:"CFBundleURLName"`
+	CFBundleURLSchemes  []string `yaml:"CFBundleURLSchemes"`
+	CFBundleTypeRole    string   `yaml:"CFBundleTypeRole,omitempty"`
+	CFBundleURLIconFile string   `yaml:"CFBundleURLIconFile,omitempty"`
+}
+
+// DocumentType represents an entry in the CFBundleDocumentTypes array,
+// ie. a document type that the application can open.
+type DocumentType struct {
+	CFBundleTypeName     string   `yaml:"CFBundleTypeName"`
+	CFBundleTypeRole     string   `yaml:"CFBundleTypeRole"`
+	LSHandlerRank        string   `yaml:"LSHandlerRank,omitempty"`
+	LSItemContentTypes   []string `yaml:"LSItemContentTypes"`
+	CFBundleTypeIconFile string   `yaml:"CFBundleTypeIconFile,omitempty"`
+	LSTypeIsPackage      bool     `yaml:"LSTypeIsPackage,omitempty"`
+}
+
+// TypeDeclaration represents an entry in the UTExportedTypeDeclarations
+// array, ie. a uniform type identifier defined by the application.
+type TypeDeclaration struct {
+	UTTypeIdentifier       string               `yaml:"UTTypeIdentifier"`
+	UTTypeDescription      string               `yaml:"UTTypeDescription,omitempty"`
+	UTTypeConformsTo       []string             `yaml:"UTTypeConformsTo"`
+	UTTypeIconFile         string               `yaml:"UTTypeIconFile,omitempty"`
+	UTTypeReferenceURL     string               `yaml:"UTTypeReferenceURL,omitempty"`
+	UTTypeTagSpecification TypeTagSpecification `yaml:"UTTypeTagSpecification,omitempty"`
+}
+
+// TypeTagSpecification represents the UTTypeTagSpecification dictionary
+// of a TypeDeclaration.
+type TypeTagSpecification struct {
+	FilenameExtensions []string `yaml:"public.filename-extension,omitempty"`
+	MIMETypes          []string `yaml:"public.mime-type,omitempty"`
+}
+
+// infoPlistTyped is used to decode the optional keys that are
+// represented as typed fields in InfoPlist.
+type infoPlistTyped struct {
+	CFBundleShortVersionString string            `yaml:"CFBundleShortVersionString"`
+	NSHumanReadableCopyright   string            `yaml:"NSHumanReadableCopyright"`
+	LSApplicationCategoryType  string            `yaml:"LSApplicationCategoryType"`
+	LSUIElement                plistBool         `yaml:"LSUIElement"`
+	LSBackgroundOnly           plistBool         `yaml:"LSBackgroundOnly"`
+	CFBundleURLTypes           []URLType         `yaml:"CFBundleURLTypes"`
+	CFBundleDocumentTypes      []DocumentType    `yaml:"CFBundleDocumentTypes"`
+	UTExportedTypeDeclarations []TypeDeclaration `yaml:"UTExportedTypeDeclarations"`
+}
+
+// plistBool is used to decode boolean keys that are commonly specified
+// as 0 or 1, or as YES or NO, as well as true or false.
+type plistBool bool
+
+func (b *plistBool) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if v, ok := parsePlistBool(node.Value); ok {
+			*b = plistBool(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("line %v: %q is not one of true, false, YES, NO, 1 or 0", node.Line, node.Value)
+}
+
+func parsePlistBool(v string) (bool, bool) {
+	switch strings.ToLower(v) {
+	case "1", "yes", "true":
+		return true, true
+	case "0", "no", "false":
+		return false, true
+	}
+	return false, false
+}
+
+// plistBoolKeys are the keys, at any level of the Info.plist, whose
+// values are booleans.
+var plistBoolKeys = map[string]bool{
+	"LSUIElement":      true,
+	"LSBackgroundOnly": true,
+	"LSTypeIsPackage":  true,
+}
+
+// normalizeBools rewrites the values of all plistBoolKeys within node
+// that are specified as 0 or 1, YES or NO or as quoted strings to YAML
+// booleans so that they are decoded, and hence written to the
+// Info.plist, as booleans rather than as strings or integers. Values
+// that are not recognised are left unchanged to be reported when the
+// typed keys are decoded.
+func normalizeBools(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, n := range node.Content {
+			normalizeBools(n)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			if plistBoolKeys[key.Value] && val.Kind == yaml.ScalarNode {
+				if v, ok := parsePlistBool(val.Value); ok {
+					val.Tag, val.Value, val.Style = "!!bool", strconv.FormatBool(v), 0
+				}
+			}
+			normalizeBools(val)
+		}
+	}
 }
 
 // XPCServicePlist represents the contents of an XPCService dictionary
@@ -39,6 +161,16 @@ type XPCServicePlist struct {
 	ServiceName string
 }
 
+// ExtensionPlist represents the contents of an NSExtension dictionary
+// within the Info.plist file of an app extension, ie. an .appex bundle.
+// The PointIdentifier and PrincipalClass fields are extracted from the
+// NSExtensionPointIdentifier and NSExtensionPrincipalClass keys for
+// convenience.
+type ExtensionPlist struct {
+	PointIdentifier string
+	PrincipalClass  string
+}
+
 func asString(dict map[string]any, key string) (string, error) {
 	if v, ok := dict[key]; ok {
 		if s, ok := v.(string); ok {
@@ -48,34 +180,56 @@ func asString(dict map[string]any, key string) (string, error) {
 	return "", fmt.Errorf("key %q not found or not a string", key)
 }
 
+// requiredString is like asString, but if the key is not found, the error
+// includes any key that is likely to be a misspelling of it.
+func requiredString(dict map[string]any, key string) (string, error) {
+	s, err := asString(dict, key)
+	if err == nil {
+		return s, nil
+	}
+	if _, ok := dict[key]; ok {
+		return "", err
+	}
+	for _, k := range sortedKeys(dict) {
+		if similarKey(k) == key {
+			return "", fmt.Errorf("%w, did you misspell it as %v?", err, k)
+		}
+	}
+	return "", err
+}
+
 func (ipl *InfoPlist) UnmarshalYAML(node *yaml.Node) error {
+	normalizeBools(node)
 	if err := node.Decode(&ipl.Raw); err != nil {
 		return err
 	}
 	var err error
-	if ipl.CFBundleIdentifier, err = asString(ipl.Raw, "CFBundleIdentifier"); err != nil {
+	if ipl.CFBundleIdentifier, err = requiredString(ipl.Raw, "CFBundleIdentifier"); err != nil {
 		return err
 	}
-	if ipl.CFBundleName, err = asString(ipl.Raw, "CFBundleName"); err != nil {
+	if ipl.CFBundleName, err = requiredString(ipl.Raw, "CFBundleName"); err != nil {
 		return err
 	}
-	if ipl.CFBundleExecutable, err = asString(ipl.Raw, "CFBundleExecutable"); err != nil {
+	if ipl.CFBundleExecutable, err = requiredString(ipl.Raw, "CFBundleExecutable"); err != nil {
 		return err
 	}
-	if ipl.CFBundlePackageType, err = asString(ipl.Raw, "CFBundlePackageType"); err != nil {
+	if ipl.CFBundlePackageType, err = requiredString(ipl.Raw, "CFBundlePackageType"); err != nil {
 		return err
 	}
-	if ipl.LSMinimumSystemVersion, err = asString(ipl.Raw, "LSMinimumSystemVersion"); err != nil {
+	if ipl.LSMinimumSystemVersion, err = requiredString(ipl.Raw, "LSMinimumSystemVersion"); err != nil {
 		return err
 	}
-	if ipl.CFBundleDisplayName, err = asString(ipl.Raw, "CFBundleDisplayName"); err != nil {
+	if ipl.CFBundleDisplayName, err = requiredString(ipl.Raw, "CFBundleDisplayName"); err != nil {
 		return err
 	}
-	if ipl.CFBundleVersion, err = asString(ipl.Raw, "CFBundleVersion"); err != nil {
+	if ipl.CFBundleVersion, err = requiredString(ipl.Raw, "CFBundleVersion"); err != nil {
 		return err
 	}
 	// optional
 	ipl.CFBundleIconFile, _ = asString(ipl.Raw, "CFBundleIconFile")
+	if err := ipl.decodeTyped(node); err != nil {
+		return err
+	}
 
 	if v, ok := ipl.Raw["XPCService"]; ok {
 		vm, ok := v.(map[string]any)
@@ -89,6 +243,61 @@ func (ipl *InfoPlist) UnmarshalYAML(node *yaml.Node) error {
 		}
 		ipl.XPCService = xpc
 	}
+	if v, ok := ipl.Raw["NSExtension"]; ok {
+		vm, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("NSExtension not a dictionary")
+		}
+		ext := &ExtensionPlist{}
+		ext.PointIdentifier, err = asString(vm, "NSExtensionPointIdentifier")
+		if err != nil {
+			return err
+		}
+		ext.PrincipalClass, _ = asString(vm, "NSExtensionPrincipalClass")
+		ipl.NSExtension = ext
+	}
+	return nil
+}
+
+// decodeTyped decodes the optional typed keys. Scalar string values are
+// written back to Raw so that, for example, a version of 1.0 is written
+// to the Info.plist as a string rather than as a real number. Boolean
+// values have already been normalized by normalizeBools.
+func (ipl *InfoPlist) decodeTyped(node *yaml.Node) error {
+	var typed infoPlistTyped
+	if err := node.Decode(&typed); err != nil {
+		return fmt.Errorf("invalid Info.plist: %w", err)
+	}
+	ipl.CFBundleShortVersionString = typed.CFBundleShortVersionString
+	ipl.NSHumanReadableCopyright = typed.NSHumanReadableCopyright
+	ipl.LSApplicationCategoryType = typed.LSApplicationCategoryType
+	ipl.LSUIElement = bool(typed.LSUIElement)
+	ipl.LSBackgroundOnly = bool(typed.LSBackgroundOnly)
+	ipl.CFBundleURLTypes = typed.CFBundleURLTypes
+	ipl.CFBundleDocumentTypes = typed.CFBundleDocumentTypes
+	ipl.UTExportedTypeDeclarations = typed.UTExportedTypeDeclarations
+	for key, val := range map[string]string{
+		"CFBundleShortVersionString": typed.CFBundleShortVersionString,
+		"NSHumanReadableCopyright":   typed.NSHumanReadableCopyright,
+		"LSApplicationCategoryType":  typed.LSApplicationCategoryType,
+	} {
+		if _, ok := ipl.Raw[key]; ok {
+			ipl.Raw[key] = val
+		}
+	}
+	for key, val := range ipl.Raw {
+		if !isUsageDescriptionKey(key) {
+			continue
+		}
+		s, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("key %q is not a string", key)
+		}
+		if ipl.UsageDescriptions == nil {
+			ipl.UsageDescriptions = map[string]string{}
+		}
+		ipl.UsageDescriptions[key] = s
+	}
 	return nil
 }
 
@@ -6,7 +6,9 @@ package buildtools_test
 
 import (
 	"context"
+	"maps"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 
@@ -86,6 +88,191 @@ func TestInfoPlist(t *testing.T) {
 	}
 }
 
+const plistTypedKeysYAML = `
+CFBundleIdentifier: io.cloudeng.TestApp
+CFBundleName: TestApp
+CFBundleVersion: 1.0.0
+CFBundleShortVersionString: 1.0
+CFBundleExecutable: TestExecutable
+CFBundlePackageType: APPL
+LSMinimumSystemVersion: "15.0"
+CFBundleDisplayName: TestApp
+CFBundleIdentifer: io.cloudeng.Typo
+LSUIElement: true
+NSHumanReadableCopyright: Copyright 2025 cloudeng llc
+LSApplicationCategoryType: public.app-category.developer-tools
+NSCameraUsageDescription: Used to scan QR codes.
+NSMicrophoneUsageDescripton: Typo.
+SomethingNew: SomeValue
+CFBundleURLTypes:
+  - CFBundleURLName: io.cloudeng.TestApp
+    CFBundleURLSchemes: [testapp]
+CFBundleDocumentTypes:
+  - CFBundleTypeName: Test Document
+    CFBundleTypeRole: Editor
+    LSHandlerRank: Owner
+    LSItemContentTypes: [io.cloudeng.testdoc]
+    LSTypeIsPackage: YES
+  - CFBundleTypeName: Other Document
+    CFBundleTypeRole: Viewer
+    LSItemContentTypes: [public.data]
+    LSTypeIsPackage: 0
+UTExportedTypeDeclarations:
+  - UTTypeIdentifier: io.cloudeng.testdoc
+    UTTypeDescription: Test Document
+    UTTypeConformsTo: [public.data]
+    UTTypeTagSpecification:
+      public.filename-extension: [testdoc]
+`
+
+func TestInfoPlistTypedKeys(t *testing.T) {
+	var info buildtools.InfoPlist
+	if err := yaml.Unmarshal([]byte(plistTypedKeysYAML), &info); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if err := info.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.CFBundleShortVersionString, "1.0"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !info.LSUIElement || info.LSBackgroundOnly {
+		t.Errorf("unexpected LSUIElement or LSBackgroundOnly: %v, %v", info.LSUIElement, info.LSBackgroundOnly)
+	}
+	if got, want := info.CFBundleURLTypes[0].CFBundleURLSchemes, []string{"testapp"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := info.CFBundleDocumentTypes[0].LSItemContentTypes, []string{"io.cloudeng.testdoc"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !info.CFBundleDocumentTypes[0].LSTypeIsPackage || info.CFBundleDocumentTypes[1].LSTypeIsPackage {
+		t.Errorf("unexpected LSTypeIsPackage: %+v", info.CFBundleDocumentTypes)
+	}
+	if got, want := info.UTExportedTypeDeclarations[0].UTTypeTagSpecification.FilenameExtensions, []string{"testdoc"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := info.UsageDescriptions, map[string]string{
+		"NSCameraUsageDescription": "Used to scan QR codes.",
+	}; !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := info.Warnings(), []string{
+		"CFBundleIdentifer: unknown key, did you mean CFBundleIdentifier?",
+		"NSMicrophoneUsageDescripton: unknown key, did you mean NSMicrophoneUsageDescription?",
+	}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Unknown keys round trip and the short version remains a string.
+	data, err := plist.MarshalIndent(info, plist.XMLFormat, "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]any
+	if _, err := plist.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := raw["CFBundleShortVersionString"], any("1.0"); got != want {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+	if got, want := raw["SomethingNew"], any("SomeValue"); got != want {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+	if got, want := raw["LSUIElement"], any(true); got != want {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+	// Nested booleans are written as booleans too.
+	docs, _ := raw["CFBundleDocumentTypes"].([]any)
+	if len(docs) != 2 {
+		t.Fatalf("unexpected CFBundleDocumentTypes: %#v", raw["CFBundleDocumentTypes"])
+	}
+	for i, want := range []any{true, false} {
+		if got := docs[i].(map[string]any)["LSTypeIsPackage"]; got != want {
+			t.Errorf("%v: got %#v, want %#v", i, got, want)
+		}
+	}
+
+	for _, tc := range []struct {
+		yaml string
+		err  string
+	}{
+		{"CFBundleShortVersionString: 1.0-beta", `CFBundleShortVersionString: "1.0-beta" is not of the form major[.minor[.patch]]`},
+		{"LSApplicationCategoryType: games", `LSApplicationCategoryType: unknown category "games"`},
+		{"CFBundleURLTypes: [{CFBundleURLName: x}]", "CFBundleURLTypes[0]: no CFBundleURLSchemes specified"},
+		{"CFBundleURLTypes: [{CFBundleURLSchemes: [test_app]}]", `CFBundleURLTypes[0]: invalid URL scheme "test_app"`},
+		{"CFBundleDocumentTypes: [{CFBundleTypeName: x, CFBundleTypeRole: Owner, LSItemContentTypes: [public.data]}]", `CFBundleDocumentTypes[0]: invalid CFBundleTypeRole "Owner"`},
+		{"CFBundleDocumentTypes: [{CFBundleTypeName: x, CFBundleTypeRole: Viewer}]", "CFBundleDocumentTypes[0]: no LSItemContentTypes specified"},
+		{"UTExportedTypeDeclarations: [{UTTypeIdentifier: testdoc, UTTypeConformsTo: [public.data]}]", `UTExportedTypeDeclarations[0]: invalid UTTypeIdentifier "testdoc"`},
+		{"NSCameraUsageDescription: ''", "NSCameraUsageDescription: usage description is empty"},
+	} {
+		var info buildtools.InfoPlist
+		if err := yaml.Unmarshal([]byte(minimalPlistYAML+tc.yaml), &info); err != nil {
+			t.Errorf("%v: %v", tc.yaml, err)
+			continue
+		}
+		if err := info.Validate(); err == nil || err.Error() != tc.err {
+			t.Errorf("%v: unexpected or missing error: %v", tc.yaml, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		yaml       string
+		ui, bgOnly bool
+	}{
+		{"LSUIElement: 1\nLSBackgroundOnly: 0", true, false},
+		{"LSUIElement: NO\nLSBackgroundOnly: YES", false, true},
+		{"LSUIElement: \"true\"\nLSBackgroundOnly: false", true, false},
+	} {
+		var info buildtools.InfoPlist
+		if err := yaml.Unmarshal([]byte(minimalPlistYAML+tc.yaml), &info); err != nil {
+			t.Errorf("%v: %v", tc.yaml, err)
+			continue
+		}
+		if info.LSUIElement != tc.ui || info.LSBackgroundOnly != tc.bgOnly {
+			t.Errorf("%v: unexpected LSUIElement or LSBackgroundOnly: %v, %v", tc.yaml, info.LSUIElement, info.LSBackgroundOnly)
+		}
+		if got, want := info.Raw["LSUIElement"], any(tc.ui); got != want {
+			t.Errorf("%v: got %#v, want %#v", tc.yaml, got, want)
+		}
+	}
+
+	for _, tc := range []string{
+		"LSUIElement: maybe",
+		"LSUIElement: 2",
+		"CFBundleDocumentTypes: [{CFBundleTypeName: x, CFBundleTypeRole: Viewer, LSItemContentTypes: [public.data], LSTypeIsPackage: maybe}]",
+		"CFBundleURLTypes: testapp",
+		"NSCameraUsageDescription: [a]",
+	} {
+		var info buildtools.InfoPlist
+		if err := yaml.Unmarshal([]byte(minimalPlistYAML+tc), &info); err == nil {
+			t.Errorf("%v: expected an error", tc)
+		}
+	}
+}
+
+func TestInfoPlistMisspeltRequiredKey(t *testing.T) {
+	var info buildtools.InfoPlist
+	err := yaml.Unmarshal([]byte(strings.Replace(minimalPlistYAML, "CFBundleIdentifier:", "CFBundleIdentifer:", 1)), &info)
+	if err == nil || err.Error() != `key "CFBundleIdentifier" not found or not a string, did you misspell it as CFBundleIdentifer?` {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	var other buildtools.InfoPlist
+	err = yaml.Unmarshal([]byte(strings.Replace(minimalPlistYAML, "CFBundleIdentifier:", "Unrelated:", 1)), &other)
+	if err == nil || err.Error() != `key "CFBundleIdentifier" not found or not a string` {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+}
+
+const minimalPlistYAML = `
+CFBundleIdentifier: io.cloudeng.TestApp
+CFBundleName: TestApp
+CFBundleVersion: 1.0.0
+CFBundleExecutable: TestExecutable
+CFBundlePackageType: APPL
+LSMinimumSystemVersion: "15.0"
+CFBundleDisplayName: TestApp
+`
+
 func TestStepExecution(t *testing.T) {
 	// Create a test context
 	ctx := context.Background()
@@ -0,0 +1,265 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// KnownInfoPlistKeys lists the Info.plist keys that are recognised when
+// checking for misspelt keys, see InfoPlist.Warnings.
+var KnownInfoPlistKeys = []string{
+	"CFBundleDevelopmentRegion",
+	"CFBundleDisplayName",
+	"CFBundleDocumentTypes",
+	"CFBundleExecutable",
+	"CFBundleIconFile",
+	"CFBundleIconName",
+	"CFBundleIdentifier",
+	"CFBundleInfoDictionaryVersion",
+	"CFBundleLocalizations",
+	"CFBundleName",
+	"CFBundlePackageType",
+	"CFBundleShortVersionString",
+	"CFBundleSignature",
+	"CFBundleSupportedPlatforms",
+	"CFBundleURLTypes",
+	"CFBundleVersion",
+	"LSApplicationCategoryType",
+	"LSBackgroundOnly",
+	"LSEnvironment",
+	"LSMinimumSystemVersion",
+	"LSMultipleInstancesProhibited",
+	"LSRequiresNativeExecution",
+	"LSUIElement",
+	"NSAppTransportSecurity",
+	"NSExtension",
+	"NSHighResolutionCapable",
+	"NSHumanReadableCopyright",
+	"NSMainNibFile",
+	"NSMainStoryboardFile",
+	"NSPrincipalClass",
+	"NSSupportsAutomaticGraphicsSwitching",
+	"NSSupportsSuddenTermination",
+	"UTExportedTypeDeclarations",
+	"UTImportedTypeDeclarations",
+	"XPCService",
+}
+
+// UsageDescriptionKeys lists the NS*UsageDescription privacy keys
+// supported by macOS.
+var UsageDescriptionKeys = []string{
+	"NSAppleEventsUsageDescription",
+	"NSAppleMusicUsageDescription",
+	"NSBluetoothAlwaysUsageDescription",
+	"NSCalendarsFullAccessUsageDescription",
+	"NSCalendarsUsageDescription",
+	"NSCalendarsWriteOnlyAccessUsageDescription",
+	"NSCameraUsageDescription",
+	"NSContactsUsageDescription",
+	"NSDesktopFolderUsageDescription",
+	"NSDocumentsFolderUsageDescription",
+	"NSDownloadsFolderUsageDescription",
+	"NSFaceIDUsageDescription",
+	"NSFileProviderDomainUsageDescription",
+	"NSHomeKitUsageDescription",
+	"NSIdentityUsageDescription",
+	"NSLocalNetworkUsageDescription",
+	"NSLocationUsageDescription",
+	"NSLocationWhenInUseUsageDescription",
+	"NSMicrophoneUsageDescription",
+	"NSMotionUsageDescription",
+	"NSNetworkVolumesUsageDescription",
+	"NSPhotoLibraryAddUsageDescription",
+	"NSPhotoLibraryUsageDescription",
+	"NSRemindersFullAccessUsageDescription",
+	"NSRemindersUsageDescription",
+	"NSRemovableVolumesUsageDescription",
+	"NSSiriUsageDescription",
+	"NSSpeechRecognitionUsageDescription",
+	"NSSystemAdministrationUsageDescription",
+	"NSSystemExtensionUsageDescription",
+	"NSUserTrackingUsageDescription",
+}
+
+// ApplicationCategories lists the valid values for LSApplicationCategoryType.
+var ApplicationCategories = []string{
+	"public.app-category.business",
+	"public.app-category.developer-tools",
+	"public.app-category.education",
+	"public.app-category.entertainment",
+	"public.app-category.finance",
+	"public.app-category.games",
+	"public.app-category.action-games",
+	"public.app-category.adventure-games",
+	"public.app-category.arcade-games",
+	"public.app-category.board-games",
+	"public.app-category.card-games",
+	"public.app-category.casino-games",
+	"public.app-category.dice-games",
+	"public.app-category.educational-games",
+	"public.app-category.family-games",
+	"public.app-category.kids-games",
+	"public.app-category.music-games",
+	"public.app-category.puzzle-games",
+	"public.app-category.racing-games",
+	"public.app-category.role-playing-games",
+	"public.app-category.simulation-games",
+	"public.app-category.sports-games",
+	"public.app-category.strategy-games",
+	"public.app-category.trivia-games",
+	"public.app-category.word-games",
+	"public.app-category.graphics-design",
+	"public.app-category.healthcare-fitness",
+	"public.app-category.lifestyle",
+	"public.app-category.medical",
+	"public.app-category.music",
+	"public.app-category.news",
+	"public.app-category.photography",
+	"public.app-category.productivity",
+	"public.app-category.reference",
+	"public.app-category.social-networking",
+	"public.app-category.sports",
+	"public.app-category.travel",
+	"public.app-category.utilities",
+	"public.app-category.video",
+	"public.app-category.weather",
+}
+
+var (
+	shortVersionRE = regexp.MustCompile(`^[0-9]+(\.[0-9]+){0,2}$`)
+	urlSchemeRE    = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*$`)
+	bundleRoles    = []string{"Editor", "Viewer", "Shell", "QLGenerator", "None"}
+	handlerRanks   = []string{"Owner", "Default", "Alternate", "None"}
+)
+
+func isUsageDescriptionKey(key string) bool {
+	return strings.HasPrefix(key, "NS") && strings.HasSuffix(key, "UsageDescription")
+}
+
+// Validate returns an error if any of the typed, optional, keys have
+// invalid values. All such errors are returned, joined together.
+func (ipl InfoPlist) Validate() error {
+	var errs []error
+	if v := ipl.CFBundleShortVersionString; v != "" && !shortVersionRE.MatchString(v) {
+		errs = append(errs, fmt.Errorf("CFBundleShortVersionString: %q is not of the form major[.minor[.patch]]", v))
+	}
+	if c := ipl.LSApplicationCategoryType; c != "" && !slices.Contains(ApplicationCategories, c) {
+		errs = append(errs, fmt.Errorf("LSApplicationCategoryType: unknown category %q", c))
+	}
+	for i, u := range ipl.CFBundleURLTypes {
+		prefix := fmt.Sprintf("CFBundleURLTypes[%v]", i)
+		if len(u.CFBundleURLSchemes) == 0 {
+			errs = append(errs, fmt.Errorf("%v: no CFBundleURLSchemes specified", prefix))
+		}
+		for _, s := range u.CFBundleURLSchemes {
+			if !urlSchemeRE.MatchString(s) {
+				errs = append(errs, fmt.Errorf("%v: invalid URL scheme %q", prefix, s))
+			}
+		}
+		if r := u.CFBundleTypeRole; r != "" && !slices.Contains(bundleRoles, r) {
+			errs = append(errs, fmt.Errorf("%v: invalid CFBundleTypeRole %q", prefix, r))
+		}
+	}
+	for i, d := range ipl.CFBundleDocumentTypes {
+		prefix := fmt.Sprintf("CFBundleDocumentTypes[%v]", i)
+		if d.CFBundleTypeName == "" {
+			errs = append(errs, fmt.Errorf("%v: CFBundleTypeName not specified", prefix))
+		}
+		if !slices.Contains(bundleRoles, d.CFBundleTypeRole) {
+			errs = append(errs, fmt.Errorf("%v: invalid CFBundleTypeRole %q", prefix, d.CFBundleTypeRole))
+		}
+		if r := d.LSHandlerRank; r != "" && !slices.Contains(handlerRanks, r) {
+			errs = append(errs, fmt.Errorf("%v: invalid LSHandlerRank %q", prefix, r))
+		}
+		if len(d.LSItemContentTypes) == 0 {
+			errs = append(errs, fmt.Errorf("%v: no LSItemContentTypes specified", prefix))
+		}
+	}
+	for i, t := range ipl.UTExportedTypeDeclarations {
+		prefix := fmt.Sprintf("UTExportedTypeDeclarations[%v]", i)
+		if !strings.Contains(t.UTTypeIdentifier, ".") || strings.ContainsAny(t.UTTypeIdentifier, " /") {
+			errs = append(errs, fmt.Errorf("%v: invalid UTTypeIdentifier %q", prefix, t.UTTypeIdentifier))
+		}
+		if len(t.UTTypeConformsTo) == 0 {
+			errs = append(errs, fmt.Errorf("%v: no UTTypeConformsTo specified", prefix))
+		}
+	}
+	keys := make([]string, 0, len(ipl.UsageDescriptions))
+	for k := range ipl.UsageDescriptions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.TrimSpace(ipl.UsageDescriptions[k]) == "" {
+			errs = append(errs, fmt.Errorf("%v: usage description is empty", k))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Warnings returns warnings for keys that are likely to be misspelt,
+// ie. unknown keys that are similar to a known key, and for
+// combinations of keys that are likely to be mistakes.
+func (ipl InfoPlist) Warnings() []string {
+	var warnings []string
+	keys := make([]string, 0, len(ipl.Raw))
+	for k := range ipl.Raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if slices.Contains(KnownInfoPlistKeys, k) || slices.Contains(UsageDescriptionKeys, k) {
+			continue
+		}
+		if suggestion := similarKey(k); suggestion != "" {
+			warnings = append(warnings, fmt.Sprintf("%v: unknown key, did you mean %v?", k, suggestion))
+		}
+	}
+	if ipl.LSUIElement && ipl.LSBackgroundOnly {
+		warnings = append(warnings, "LSUIElement and LSBackgroundOnly are both set, LSBackgroundOnly takes precedence")
+	}
+	return warnings
+}
+
+// similarKey returns the known key that is most similar to key, if any.
+func similarKey(key string) string {
+	best, bestDist := "", 3
+	for _, known := range slices.Concat(KnownInfoPlistKeys, UsageDescriptionKeys) {
+		if strings.EqualFold(key, known) {
+			return known
+		}
+		if d := editDistance(key, known); d < bestDist {
+			best, bestDist = known, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
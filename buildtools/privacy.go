@@ -0,0 +1,300 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"bytes"
+	"context"
+	"debug/macho"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"cloudeng.io/macos/buildtools/codesign"
+)
+
+var (
+	cameraUsage     = []string{"NSCameraUsageDescription"}
+	microphoneUsage = []string{"NSMicrophoneUsageDescription"}
+	bluetoothUsage  = []string{"NSBluetoothAlwaysUsageDescription"}
+	locationUsage   = []string{"NSLocationUsageDescription", "NSLocationWhenInUseUsageDescription"}
+	contactsUsage   = []string{"NSContactsUsageDescription"}
+	calendarsUsage  = []string{"NSCalendarsUsageDescription", "NSCalendarsFullAccessUsageDescription", "NSCalendarsWriteOnlyAccessUsageDescription", "NSRemindersUsageDescription", "NSRemindersFullAccessUsageDescription"}
+	photosUsage     = []string{"NSPhotoLibraryUsageDescription", "NSPhotoLibraryAddUsageDescription"}
+	trackingUsage   = []string{"NSUserTrackingUsageDescription"}
+)
+
+// EntitlementUsageDescriptions maps entitlements to the Info.plist usage
+// description keys, any one of which must be present when the
+// entitlement is enabled.
+var EntitlementUsageDescriptions = map[string][]string{
+	"com.apple.security.device.camera":                       cameraUsage,
+	"com.apple.security.device.audio-input":                  microphoneUsage,
+	"com.apple.security.device.bluetooth":                    bluetoothUsage,
+	"com.apple.security.personal-information.location":       locationUsage,
+	"com.apple.security.personal-information.addressbook":    contactsUsage,
+	"com.apple.security.personal-information.calendars":      calendarsUsage,
+	"com.apple.security.personal-information.photos-library": photosUsage,
+	"com.apple.security.automation.apple-events":             {"NSAppleEventsUsageDescription"},
+	"com.apple.developer.homekit":                            {"NSHomeKitUsageDescription"},
+	"com.apple.developer.siri":                               {"NSSiriUsageDescription"},
+}
+
+// FrameworkUsageDescriptions maps system frameworks, by name, to the
+// Info.plist usage description keys, any one of which must be present
+// when an executable links against the framework.
+var FrameworkUsageDescriptions = map[string][]string{
+	"AddressBook":             contactsUsage,
+	"AppTrackingTransparency": trackingUsage,
+	"Contacts":                contactsUsage,
+	"CoreBluetooth":           bluetoothUsage,
+	"CoreLocation":            locationUsage,
+	"CoreMotion":              {"NSMotionUsageDescription"},
+	"EventKit":                calendarsUsage,
+	"HomeKit":                 {"NSHomeKitUsageDescription"},
+	"Photos":                  photosUsage,
+	"Speech":                  {"NSSpeechRecognitionUsageDescription"},
+}
+
+// PrivacyManifestFile is the name of the privacy manifest within an
+// app bundle's Resources directory.
+const PrivacyManifestFile = "PrivacyInfo.xcprivacy"
+
+// UsageRequirement represents a requirement for an Info.plist usage
+// description, any one of Keys satisfies the requirement.
+type UsageRequirement struct {
+	Keys   []string
+	Source string // what requires the usage description.
+}
+
+func (r UsageRequirement) String() string {
+	if len(r.Keys) == 1 {
+		return fmt.Sprintf("%v: required by %v", r.Keys[0], r.Source)
+	}
+	return fmt.Sprintf("one of %v: required by %v", strings.Join(r.Keys, ", "), r.Source)
+}
+
+// EntitlementUsageRequirements returns the usage descriptions required
+// by the enabled entitlements in ent, name identifies the entitlements
+// in the returned requirements.
+func EntitlementUsageRequirements(name string, ent Entitlements) []UsageRequirement {
+	var reqs []UsageRequirement
+	for _, k := range sortedKeys(ent.raw) {
+		keys, ok := EntitlementUsageDescriptions[k]
+		if !ok {
+			continue
+		}
+		if enabled, ok := ent.raw[k].(bool); ok && enabled {
+			reqs = append(reqs, UsageRequirement{Keys: keys, Source: fmt.Sprintf("entitlement %v in %v", k, name)})
+		}
+	}
+	return reqs
+}
+
+// FrameworkUsageRequirements returns the usage descriptions required by
+// the frameworks linked by the Mach-O executable at path.
+func FrameworkUsageRequirements(path string) ([]UsageRequirement, error) {
+	frameworks, err := LinkedFrameworks(path)
+	if err != nil {
+		return nil, err
+	}
+	var reqs []UsageRequirement
+	for _, fw := range frameworks {
+		if keys, ok := FrameworkUsageDescriptions[fw]; ok {
+			reqs = append(reqs, UsageRequirement{Keys: keys, Source: fmt.Sprintf("framework %v linked by %v", fw, filepath.Base(path))})
+		}
+	}
+	return reqs, nil
+}
+
+// PrivacyManifestUsageRequirements returns the usage descriptions
+// required by the privacy manifest at path, currently a manifest that
+// declares tracking requires NSUserTrackingUsageDescription.
+func PrivacyManifestUsageRequirements(path string) ([]UsageRequirement, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pm, err := ParsePrivacyManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse privacy manifest %v: %w", path, err)
+	}
+	if pm.Tracking {
+		return []UsageRequirement{{Keys: trackingUsage, Source: "NSPrivacyTracking in " + filepath.Base(path)}}, nil
+	}
+	return nil, nil
+}
+
+// MissingUsageDescriptions returns the requirements that are not
+// satisfied by the Info.plist.
+func (ipl InfoPlist) MissingUsageDescriptions(reqs []UsageRequirement) []UsageRequirement {
+	var missing []UsageRequirement
+	for _, r := range reqs {
+		if !slices.ContainsFunc(r.Keys, func(k string) bool {
+			_, ok := ipl.Raw[k]
+			return ok
+		}) {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// Mach-O load commands that are not represented by debug/macho.
+const (
+	lcLoadWeakDylib = 0x80000018
+	lcReexportDylib = 0x8000001f
+)
+
+// LinkedFrameworks returns the names of the frameworks, eg. CoreLocation,
+// that are linked, including weakly, by the Mach-O file at path. All of
+// the architectures in a universal binary are examined.
+func LinkedFrameworks(path string) ([]string, error) {
+	var files []*macho.File
+	if fat, err := macho.OpenFat(path); err == nil {
+		defer fat.Close()
+		for _, arch := range fat.Arches {
+			files = append(files, arch.File)
+		}
+	} else {
+		f, err := macho.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	var frameworks []string
+	for _, f := range files {
+		for _, lib := range linkedLibraries(f) {
+			if fw := frameworkName(lib); fw != "" && !slices.Contains(frameworks, fw) {
+				frameworks = append(frameworks, fw)
+			}
+		}
+	}
+	sort.Strings(frameworks)
+	return frameworks, nil
+}
+
+func linkedLibraries(f *macho.File) []string {
+	var libs []string
+	for _, l := range f.Loads {
+		switch l := l.(type) {
+		case *macho.Dylib:
+			libs = append(libs, l.Name)
+		case macho.LoadBytes:
+			if len(l) < 12 {
+				continue
+			}
+			if cmd := f.ByteOrder.Uint32(l[0:4]); cmd != lcLoadWeakDylib && cmd != lcReexportDylib {
+				continue
+			}
+			if off := f.ByteOrder.Uint32(l[8:12]); int(off) < len(l) {
+				name := l[off:]
+				if i := bytes.IndexByte(name, 0); i >= 0 {
+					name = name[:i]
+				}
+				libs = append(libs, string(name))
+			}
+		}
+	}
+	return libs
+}
+
+// frameworkName returns the name of the framework for the specified
+// install name, eg. CoreLocation for
+// /System/Library/Frameworks/CoreLocation.framework/Versions/A/CoreLocation.
+func frameworkName(installName string) string {
+	for _, dir := range strings.Split(installName, "/") {
+		if name, ok := strings.CutSuffix(dir, ".framework"); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CheckPrivacy returns a Step that cross-references the signer's
+// entitlements, the frameworks linked by all of the code in the bundle,
+// including nested frameworks, helpers, XPC services and plug-ins, and
+// the bundle's privacy manifest, if any, against the usage descriptions
+// in the bundle's Info.plist. Apps that access protected resources
+// without the appropriate usage description are terminated at runtime,
+// this step reports every missing usage description, in its output, and
+// fails if there are any. In dry-run mode only the entitlements are
+// checked since the bundle's contents may not yet exist.
+func (s Signer) CheckPrivacy(bundle AppBundle) Step {
+	return StepFunc(func(_ context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		args := []string{bundle.Path}
+		var reqs []UsageRequirement
+		if s.entitlements != nil {
+			reqs = append(reqs, EntitlementUsageRequirements("entitlements", *s.entitlements)...)
+		}
+		if s.perFileEntitlements != nil {
+			for _, path := range sortedKeys(s.perFileEntitlements.raw) {
+				reqs = append(reqs, EntitlementUsageRequirements(path, s.perFileEntitlements.raw[path])...)
+			}
+		}
+		if !cmdRunner.DryRun() {
+			more, err := bundlePrivacyRequirements(bundle)
+			if err != nil {
+				return NewStepResult("check privacy", args, nil, err), err
+			}
+			reqs = append(reqs, more...)
+		}
+		var out strings.Builder
+		missing := bundle.Info.MissingUsageDescriptions(reqs)
+		for _, m := range missing {
+			fmt.Fprintf(&out, "%v\n", m)
+		}
+		var err error
+		if len(missing) > 0 {
+			err = fmt.Errorf("%v usage description(s) are missing from Info.plist", len(missing))
+		}
+		return NewStepResult("check privacy", args, []byte(out.String()), err), err
+	})
+}
+
+// bundlePrivacyRequirements returns the usage descriptions required by
+// all of the Mach-O files in the bundle, including those nested within
+// frameworks, helpers, XPC services and plug-ins as listed by
+// codesign.PlanSigning, and by its privacy manifest.
+func bundlePrivacyRequirements(bundle AppBundle) ([]UsageRequirement, error) {
+	plan, err := codesign.PlanSigning(bundle.Path)
+	if err != nil {
+		return nil, err
+	}
+	var reqs []UsageRequirement
+	for _, c := range plan.Code {
+		file := c.Path
+		if c.Kind != codesign.CodeMachO {
+			file = c.Executable
+		}
+		if file == "" {
+			continue
+		}
+		r, err := FrameworkUsageRequirements(filepath.Join(bundle.Path, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, r...)
+	}
+	r, err := PrivacyManifestUsageRequirements(bundle.Resources(PrivacyManifestFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return append(reqs, r...), nil
+}
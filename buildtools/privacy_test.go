@@ -0,0 +1,159 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"cloudeng.io/macos/buildtools"
+	"gopkg.in/yaml.v3"
+)
+
+// writeMachO writes a minimal 64-bit Mach-O executable that links the
+// specified libraries, those prefixed with "weak:" are weakly linked.
+func writeMachO(t *testing.T, path string, libs ...string) {
+	t.Helper()
+	le := binary.LittleEndian
+	var cmds []byte
+	for _, lib := range libs {
+		cmd := uint32(0xc) // LC_LOAD_DYLIB
+		if name, ok := strings.CutPrefix(lib, "weak:"); ok {
+			cmd, lib = 0x80000018, name
+		}
+		name := append([]byte(lib), 0)
+		size := (24 + len(name) + 7) &^ 7
+		lc := make([]byte, size)
+		le.PutUint32(lc[0:], cmd)
+		le.PutUint32(lc[4:], uint32(size))
+		le.PutUint32(lc[8:], 24)
+		copy(lc[24:], name)
+		cmds = append(cmds, lc...)
+	}
+	hdr := make([]byte, 32)
+	le.PutUint32(hdr[0:], 0xfeedfacf)
+	le.PutUint32(hdr[4:], 0x01000007) // x86_64
+	le.PutUint32(hdr[8:], 3)
+	le.PutUint32(hdr[12:], 2) // MH_EXECUTE
+	le.PutUint32(hdr[16:], uint32(len(libs)))
+	le.PutUint32(hdr[20:], uint32(len(cmds)))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(hdr, cmds...), 0755); err != nil { //nolint:gosec // G306
+		t.Fatal(err)
+	}
+}
+
+const privacySigningConfig = `
+entitlements:
+  com.apple.security.app-sandbox: true
+  com.apple.security.device.camera: true
+  com.apple.security.device.bluetooth: false
+perfile_entitlements:
+  helper:
+    com.apple.security.device.audio-input: true
+`
+
+const privacyManifestTracking = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>NSPrivacyTracking</key>
+	<true/>
+</dict>
+</plist>
+`
+
+func TestLinkedFrameworks(t *testing.T) {
+	exe := filepath.Join(t.TempDir(), "exe")
+	writeMachO(t, exe,
+		"/usr/lib/libSystem.B.dylib",
+		"/System/Library/Frameworks/Foundation.framework/Versions/C/Foundation",
+		"weak:/System/Library/Frameworks/CoreLocation.framework/Versions/A/CoreLocation")
+	frameworks, err := buildtools.LinkedFrameworks(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := frameworks, []string{"CoreLocation", "Foundation"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := buildtools.LinkedFrameworks(filepath.Join("testdata", "hello.go")); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestCheckPrivacy(t *testing.T) {
+	ctx := context.Background()
+	var cfg buildtools.SigningConfig
+	if err := yaml.Unmarshal([]byte(privacySigningConfig), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	var info buildtools.InfoPlist
+	if err := yaml.Unmarshal([]byte(minimalPlistYAML+"NSCameraUsageDescription: Scans QR codes.\n"), &info); err != nil {
+		t.Fatal(err)
+	}
+	bundle := buildtools.AppBundle{Path: filepath.Join(t.TempDir(), "TestApp.app"), Info: info}
+	writeMachO(t, bundle.Contents("MacOS", "TestExecutable"),
+		"/System/Library/Frameworks/CoreLocation.framework/Versions/A/CoreLocation")
+	if err := os.WriteFile(bundle.Contents("MacOS", "script.sh"), []byte("#!/bin/sh\n"), 0755); err != nil { //nolint:gosec // G306
+		t.Fatal(err)
+	}
+	if _, err := bundle.WriteInfoPlist().Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+	// Nested code is checked too.
+	writeMachO(t, bundle.Contents("Frameworks", "libcontacts.dylib"),
+		"/System/Library/Frameworks/Contacts.framework/Versions/A/Contacts")
+	xpc := buildtools.AppBundle{Path: bundle.Contents("XPCServices", "Service.xpc"), Info: info}
+	writeMachO(t, xpc.Contents("MacOS", "TestExecutable"),
+		"/System/Library/Frameworks/CoreBluetooth.framework/Versions/A/CoreBluetooth")
+	if _, err := xpc.WriteInfoPlist().Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the entitlements are checked in dry-run mode.
+	dryRun := buildtools.NewCommandRunner(buildtools.WithDryRun(true))
+	res, err := cfg.Signer().CheckPrivacy(bundle).Run(ctx, dryRun)
+	if err == nil || err.Error() != "1 usage description(s) are missing from Info.plist" {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	if got, want := res.Output(), "NSMicrophoneUsageDescription: required by entitlement com.apple.security.device.audio-input in helper\n"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if err := os.MkdirAll(bundle.Resources(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bundle.Resources(buildtools.PrivacyManifestFile), []byte(privacyManifestTracking), 0600); err != nil {
+		t.Fatal(err)
+	}
+	res, err = cfg.Signer().CheckPrivacy(bundle).Run(ctx, buildtools.NewCommandRunner())
+	if err == nil || err.Error() != "5 usage description(s) are missing from Info.plist" {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	if got, want := res.Output(), `NSMicrophoneUsageDescription: required by entitlement com.apple.security.device.audio-input in helper
+NSContactsUsageDescription: required by framework Contacts linked by libcontacts.dylib
+NSBluetoothAlwaysUsageDescription: required by framework CoreBluetooth linked by TestExecutable
+one of NSLocationUsageDescription, NSLocationWhenInUseUsageDescription: required by framework CoreLocation linked by TestExecutable
+NSUserTrackingUsageDescription: required by NSPrivacyTracking in PrivacyInfo.xcprivacy
+`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	bundle.Info.Raw["NSMicrophoneUsageDescription"] = "Records audio."
+	bundle.Info.Raw["NSLocationWhenInUseUsageDescription"] = "Finds nearby things."
+	bundle.Info.Raw["NSUserTrackingUsageDescription"] = "Tracks you."
+	bundle.Info.Raw["NSContactsUsageDescription"] = "Finds friends."
+	bundle.Info.Raw["NSBluetoothAlwaysUsageDescription"] = "Talks to devices."
+	if _, err := cfg.Signer().CheckPrivacy(bundle).Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+}
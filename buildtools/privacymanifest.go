@@ -0,0 +1,208 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"howett.net/plist"
+)
+
+// PrivacyManifest represents an Apple privacy manifest, ie. a
+// PrivacyInfo.xcprivacy file. It is configured using YAML and written
+// as a plist using the keys defined by Apple.
+// See https://developer.apple.com/documentation/bundleresources/privacy-manifest-files
+type PrivacyManifest struct {
+	// Tracking is true if the app uses data for tracking as defined
+	// by the App Tracking Transparency framework.
+	Tracking bool `yaml:"tracking" plist:"NSPrivacyTracking"`
+	// TrackingDomains are the internet domains that the app connects to
+	// that engage in tracking, Tracking must be true if any are listed.
+	TrackingDomains []string `yaml:"tracking-domains,omitempty" plist:"NSPrivacyTrackingDomains"`
+	// CollectedData describes the types of data collected by the app.
+	CollectedData []CollectedDataType `yaml:"collected-data,omitempty" plist:"NSPrivacyCollectedDataTypes"`
+	// AccessedAPIs describes the app's use of required reason APIs.
+	AccessedAPIs []AccessedAPIType `yaml:"accessed-apis,omitempty" plist:"NSPrivacyAccessedAPITypes"`
+}
+
+// CollectedDataType represents an entry in a privacy manifest's
+// NSPrivacyCollectedDataTypes array.
+type CollectedDataType struct {
+	// Type is one of PrivacyCollectedDataTypes, eg.
+	// NSPrivacyCollectedDataTypeCrashData.
+	Type     string `yaml:"type" plist:"NSPrivacyCollectedDataType"`
+	Linked   bool   `yaml:"linked" plist:"NSPrivacyCollectedDataTypeLinked"`
+	Tracking bool   `yaml:"tracking" plist:"NSPrivacyCollectedDataTypeTracking"`
+	// Purposes are any of PrivacyCollectedDataPurposes.
+	Purposes []string `yaml:"purposes" plist:"NSPrivacyCollectedDataTypePurposes"`
+}
+
+// AccessedAPIType represents an entry in a privacy manifest's
+// NSPrivacyAccessedAPITypes array.
+type AccessedAPIType struct {
+	// Type is one of the categories in RequiredReasonAPIs, eg.
+	// NSPrivacyAccessedAPICategoryUserDefaults.
+	Type string `yaml:"type" plist:"NSPrivacyAccessedAPIType"`
+	// Reasons are the reason codes for the use of the API, eg. CA92.1,
+	// and must be valid for the category.
+	Reasons []string `yaml:"reasons" plist:"NSPrivacyAccessedAPITypeReasons"`
+}
+
+// RequiredReasonAPIs maps each category of required reason API to its
+// valid reason codes.
+// See https://developer.apple.com/documentation/bundleresources/describing-use-of-required-reason-api
+var RequiredReasonAPIs = map[string][]string{
+	"NSPrivacyAccessedAPICategoryFileTimestamp":   {"DDA9.1", "C617.1", "3B52.1", "0A2A.1"},
+	"NSPrivacyAccessedAPICategorySystemBootTime":  {"35F9.1", "8FFB.1", "3D61.1"},
+	"NSPrivacyAccessedAPICategoryDiskSpace":       {"85F4.1", "E174.1", "7D9E.1", "B728.1"},
+	"NSPrivacyAccessedAPICategoryActiveKeyboards": {"3EC4.1", "54BD.1"},
+	"NSPrivacyAccessedAPICategoryUserDefaults":    {"CA92.1", "1C8F.1", "C56D.1", "AC6B.1"},
+}
+
+// PrivacyCollectedDataTypes lists the valid collected data types.
+var PrivacyCollectedDataTypes = []string{
+	"NSPrivacyCollectedDataTypeName",
+	"NSPrivacyCollectedDataTypeEmailAddress",
+	"NSPrivacyCollectedDataTypePhoneNumber",
+	"NSPrivacyCollectedDataTypePhysicalAddress",
+	"NSPrivacyCollectedDataTypeOtherUserContactInfo",
+	"NSPrivacyCollectedDataTypeHealth",
+	"NSPrivacyCollectedDataTypeFitness",
+	"NSPrivacyCollectedDataTypePaymentInfo",
+	"NSPrivacyCollectedDataTypeCreditInfo",
+	"NSPrivacyCollectedDataTypeOtherFinancialInfo",
+	"NSPrivacyCollectedDataTypePreciseLocation",
+	"NSPrivacyCollectedDataTypeCoarseLocation",
+	"NSPrivacyCollectedDataTypeSensitiveInfo",
+	"NSPrivacyCollectedDataTypeContacts",
+	"NSPrivacyCollectedDataTypeEmailsOrTextMessages",
+	"NSPrivacyCollectedDataTypePhotosorVideos",
+	"NSPrivacyCollectedDataTypeAudioData",
+	"NSPrivacyCollectedDataTypeGameplayContent",
+	"NSPrivacyCollectedDataTypeCustomerSupport",
+	"NSPrivacyCollectedDataTypeOtherUserContent",
+	"NSPrivacyCollectedDataTypeBrowsingHistory",
+	"NSPrivacyCollectedDataTypeSearchHistory",
+	"NSPrivacyCollectedDataTypeUserID",
+	"NSPrivacyCollectedDataTypeDeviceID",
+	"NSPrivacyCollectedDataTypePurchaseHistory",
+	"NSPrivacyCollectedDataTypeProductInteraction",
+	"NSPrivacyCollectedDataTypeAdvertisingData",
+	"NSPrivacyCollectedDataTypeOtherUsageData",
+	"NSPrivacyCollectedDataTypeCrashData",
+	"NSPrivacyCollectedDataTypePerformanceData",
+	"NSPrivacyCollectedDataTypeOtherDiagnosticData",
+	"NSPrivacyCollectedDataTypeEnvironmentScanning",
+	"NSPrivacyCollectedDataTypeHands",
+	"NSPrivacyCollectedDataTypeHead",
+	"NSPrivacyCollectedDataTypeOtherDataTypes",
+}
+
+// PrivacyCollectedDataPurposes lists the valid purposes for collected data.
+var PrivacyCollectedDataPurposes = []string{
+	"NSPrivacyCollectedDataTypePurposeThirdPartyAdvertising",
+	"NSPrivacyCollectedDataTypePurposeDeveloperAdvertising",
+	"NSPrivacyCollectedDataTypePurposeAnalytics",
+	"NSPrivacyCollectedDataTypePurposeProductPersonalization",
+	"NSPrivacyCollectedDataTypePurposeAppFunctionality",
+	"NSPrivacyCollectedDataTypePurposeOther",
+}
+
+// ParsePrivacyManifest parses the plist representation of a privacy
+// manifest.
+func ParsePrivacyManifest(data []byte) (PrivacyManifest, error) {
+	var pm PrivacyManifest
+	if _, err := plist.Unmarshal(data, &pm); err != nil {
+		return PrivacyManifest{}, err
+	}
+	return pm, nil
+}
+
+// Validate returns an error if the manifest refers to unknown data types,
+// purposes, API categories or reason codes, or if tracking domains are
+// listed without tracking being enabled. All such errors are returned,
+// joined together.
+func (pm PrivacyManifest) Validate() error {
+	var errs []error
+	if len(pm.TrackingDomains) > 0 && !pm.Tracking {
+		errs = append(errs, fmt.Errorf("tracking-domains: tracking must be enabled when tracking domains are listed"))
+	}
+	for _, d := range pm.TrackingDomains {
+		if d == "" || strings.ContainsAny(d, ":/ ") {
+			errs = append(errs, fmt.Errorf("tracking-domains: invalid domain %q", d))
+		}
+	}
+	for i, c := range pm.CollectedData {
+		prefix := fmt.Sprintf("collected-data[%v]", i)
+		if !slices.Contains(PrivacyCollectedDataTypes, c.Type) {
+			errs = append(errs, fmt.Errorf("%v: unknown data type %q", prefix, c.Type))
+		}
+		if len(c.Purposes) == 0 {
+			errs = append(errs, fmt.Errorf("%v: no purposes specified", prefix))
+		}
+		for _, p := range c.Purposes {
+			if !slices.Contains(PrivacyCollectedDataPurposes, p) {
+				errs = append(errs, fmt.Errorf("%v: unknown purpose %q", prefix, p))
+			}
+		}
+		if c.Tracking && !pm.Tracking {
+			errs = append(errs, fmt.Errorf("%v: tracking must be enabled when data is used for tracking", prefix))
+		}
+	}
+	for i, a := range pm.AccessedAPIs {
+		prefix := fmt.Sprintf("accessed-apis[%v]", i)
+		reasons, ok := RequiredReasonAPIs[a.Type]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%v: unknown API category %q", prefix, a.Type))
+			continue
+		}
+		if len(a.Reasons) == 0 {
+			errs = append(errs, fmt.Errorf("%v: no reasons specified for %v", prefix, a.Type))
+		}
+		for _, r := range a.Reasons {
+			if !slices.Contains(reasons, r) {
+				errs = append(errs, fmt.Errorf("%v: invalid reason %q for %v, must be one of %v", prefix, r, a.Type, strings.Join(reasons, ", ")))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MarshalPlist implements plist.Marshaler. All of the top level keys
+// are always written, as is the case for manifests created by Xcode.
+func (pm PrivacyManifest) MarshalPlist() (any, error) {
+	collected := make([]any, 0, len(pm.CollectedData))
+	for _, c := range pm.CollectedData {
+		collected = append(collected, map[string]any{
+			"NSPrivacyCollectedDataType":         c.Type,
+			"NSPrivacyCollectedDataTypeLinked":   c.Linked,
+			"NSPrivacyCollectedDataTypeTracking": c.Tracking,
+			"NSPrivacyCollectedDataTypePurposes": nonNil(c.Purposes),
+		})
+	}
+	accessed := make([]any, 0, len(pm.AccessedAPIs))
+	for _, a := range pm.AccessedAPIs {
+		accessed = append(accessed, map[string]any{
+			"NSPrivacyAccessedAPIType":        a.Type,
+			"NSPrivacyAccessedAPITypeReasons": nonNil(a.Reasons),
+		})
+	}
+	return map[string]any{
+		"NSPrivacyTracking":           pm.Tracking,
+		"NSPrivacyTrackingDomains":    nonNil(pm.TrackingDomains),
+		"NSPrivacyCollectedDataTypes": collected,
+		"NSPrivacyAccessedAPITypes":   accessed,
+	}, nil
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
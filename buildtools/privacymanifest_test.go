@@ -0,0 +1,116 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloudeng.io/macos/buildtools"
+	"gopkg.in/yaml.v3"
+)
+
+const privacyManifestYAML = `
+tracking: true
+tracking-domains: [tracker.example.com]
+collected-data:
+  - type: NSPrivacyCollectedDataTypeCrashData
+    purposes: [NSPrivacyCollectedDataTypePurposeAppFunctionality]
+  - type: NSPrivacyCollectedDataTypeDeviceID
+    linked: true
+    tracking: true
+    purposes:
+      - NSPrivacyCollectedDataTypePurposeAnalytics
+      - NSPrivacyCollectedDataTypePurposeThirdPartyAdvertising
+accessed-apis:
+  - type: NSPrivacyAccessedAPICategoryUserDefaults
+    reasons: [CA92.1]
+  - type: NSPrivacyAccessedAPICategoryFileTimestamp
+    reasons: [C617.1, 3B52.1]
+`
+
+func TestPrivacyManifest(t *testing.T) {
+	ctx := context.Background()
+	var pm buildtools.PrivacyManifest
+	if err := yaml.Unmarshal([]byte(privacyManifestYAML), &pm); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := buildtools.AppBundle{Path: filepath.Join(t.TempDir(), "TestApp.app")}
+	if err := os.MkdirAll(bundle.Resources(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bundle.WritePrivacyManifest(pm).Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(bundle.Resources("PrivacyInfo.xcprivacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<key>NSPrivacyTracking</key>\n\t\t<true/>",
+		"<key>NSPrivacyCollectedDataTypeLinked</key>\n\t\t\t\t<false/>",
+		"<key>NSPrivacyAccessedAPIType</key>\n\t\t\t\t<string>NSPrivacyAccessedAPICategoryUserDefaults</string>",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s does not contain %v", data, want)
+		}
+	}
+	parsed, err := buildtools.ParsePrivacyManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, pm) {
+		t.Errorf("got %+v, want %+v", parsed, pm)
+	}
+
+	// An empty manifest still contains all of the top level keys.
+	if _, err := bundle.WritePrivacyManifest(buildtools.PrivacyManifest{}).Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(bundle.Resources("PrivacyInfo.xcprivacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"NSPrivacyTracking", "NSPrivacyTrackingDomains", "NSPrivacyCollectedDataTypes", "NSPrivacyAccessedAPITypes"} {
+		if !strings.Contains(string(data), "<key>"+want+"</key>") {
+			t.Errorf("%s does not contain %v", data, want)
+		}
+	}
+
+	for _, tc := range []struct {
+		yaml string
+		err  string
+	}{
+		{"tracking-domains: [tracker.example.com]", "tracking-domains: tracking must be enabled when tracking domains are listed"},
+		{"{tracking: true, tracking-domains: ['https://tracker.example.com']}", `tracking-domains: invalid domain "https://tracker.example.com"`},
+		{"collected-data: [{type: NSPrivacyCollectedDataTypeShoeSize, purposes: [NSPrivacyCollectedDataTypePurposeOther]}]", `collected-data[0]: unknown data type "NSPrivacyCollectedDataTypeShoeSize"`},
+		{"collected-data: [{type: NSPrivacyCollectedDataTypeCrashData}]", "collected-data[0]: no purposes specified"},
+		{"collected-data: [{type: NSPrivacyCollectedDataTypeCrashData, tracking: true, purposes: [NSPrivacyCollectedDataTypePurposeOther]}]", "collected-data[0]: tracking must be enabled when data is used for tracking"},
+		{"accessed-apis: [{type: NSPrivacyAccessedAPICategoryClipboard, reasons: [CA92.1]}]", `accessed-apis[0]: unknown API category "NSPrivacyAccessedAPICategoryClipboard"`},
+		{"accessed-apis: [{type: NSPrivacyAccessedAPICategoryDiskSpace}]", "accessed-apis[0]: no reasons specified for NSPrivacyAccessedAPICategoryDiskSpace"},
+		{"accessed-apis: [{type: NSPrivacyAccessedAPICategoryDiskSpace, reasons: [CA92.1]}]", `accessed-apis[0]: invalid reason "CA92.1" for NSPrivacyAccessedAPICategoryDiskSpace, must be one of 85F4.1, E174.1, 7D9E.1, B728.1`},
+	} {
+		var pm buildtools.PrivacyManifest
+		if err := yaml.Unmarshal([]byte(tc.yaml), &pm); err != nil {
+			t.Errorf("%v: %v", tc.yaml, err)
+			continue
+		}
+		if err := pm.Validate(); err == nil || err.Error() != tc.err {
+			t.Errorf("%v: unexpected or missing error: %v", tc.yaml, err)
+		}
+		_, err := bundle.WritePrivacyManifest(pm).Run(ctx, buildtools.NewCommandRunner())
+		if err == nil || !strings.Contains(err.Error(), "invalid privacy manifest: "+tc.err) {
+			t.Errorf("%v: unexpected or missing error: %v", tc.yaml, err)
+		}
+	}
+}
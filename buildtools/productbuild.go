@@ -17,6 +17,9 @@ type ProductBuild struct {
 	PkgBuild
 	InstallLocation string // target location for the install, e.g. /
 	GUIXML          string // path to the distribution XML file relative to the resources directory
+	// ReleaseNotes, if set, are generated and written to the resources
+	// directory as ReleaseNotesHTMLFile by CopyResources.
+	ReleaseNotes *ReleaseNotes
 }
 
 // Create returns steps that create the product build directory structure
@@ -31,15 +34,19 @@ func (p ProductBuild) Create() []Step {
 }
 
 // CopyResources returns a Step that copies the specified resource to the
-// resources directory within the product build root.
+// resources directory within the product build root, followed by a Step
+// that writes the release notes if ReleaseNotes is set.
 func (p ProductBuild) CopyResources(src ...string) []Step {
-	if len(src) == 0 {
+	if len(src) == 0 && p.ReleaseNotes == nil {
 		return []Step{NoopStep("no resource specified")}
 	}
-	steps := make([]Step, 0, len(src))
+	steps := make([]Step, 0, len(src)+1)
 	for _, s := range src {
 		steps = append(steps, Copy(s, filepath.Join(p.BuildDir, "resources")))
 	}
+	if p.ReleaseNotes != nil {
+		steps = append(steps, p.ReleaseNotes.Write(ChangelogHTML, p.ResourcesPath(), ReleaseNotesHTMLFile))
+	}
 	return steps
 }
 
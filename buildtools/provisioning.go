@@ -0,0 +1,88 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloudeng.io/macos/buildtools/provisioning"
+)
+
+// ValidateProvisioningProfile returns a Step that parses the specified
+// provisioning profile and fails if it has expired or if its application
+// identifier does not match bundleID. The profile is read even in dry-run
+// mode so that such problems are detected as early as possible.
+func ValidateProvisioningProfile(profile, bundleID string) Step {
+	return StepFunc(func(_ context.Context, _ *CommandRunner) (StepResult, error) {
+		args := []string{profile, bundleID}
+		p, err := provisioning.ParseFile(profile)
+		if err != nil {
+			return NewStepResult("validate provisioning profile", args, nil, err), err
+		}
+		err = p.Validate(bundleID, time.Now())
+		return NewStepResult("validate provisioning profile", args, []byte(p.String()+"\n"), err), err
+	})
+}
+
+// CheckEntitlements returns a Step that compares the signer's global and
+// per-file entitlements with those granted by the specified provisioning
+// profile. Every restricted entitlement that will be rejected at launch
+// is reported in the step's output and causes the step to fail.
+func (s Signer) CheckEntitlements(profile string) Step {
+	return StepFunc(func(_ context.Context, _ *CommandRunner) (StepResult, error) {
+		args := []string{profile}
+		p, err := provisioning.ParseFile(profile)
+		if err != nil {
+			return NewStepResult("check entitlements", args, nil, err), err
+		}
+		var out strings.Builder
+		n := 0
+		check := func(name string, ent Entitlements) {
+			for _, issue := range p.CheckEntitlements(ent.raw) {
+				fmt.Fprintf(&out, "%v: %v\n", name, issue)
+				n++
+			}
+		}
+		if s.entitlements != nil {
+			check("entitlements", *s.entitlements)
+		}
+		if s.perFileEntitlements != nil {
+			paths := make([]string, 0, len(s.perFileEntitlements.raw))
+			for path := range s.perFileEntitlements.raw {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			for _, path := range paths {
+				check(path, s.perFileEntitlements.raw[path])
+			}
+		}
+		if n > 0 {
+			err = fmt.Errorf("%v entitlement(s) are not granted by provisioning profile %q (%v)", n, p.Name, p.UUID)
+		}
+		return NewStepResult("check entitlements", args, []byte(out.String()), err), err
+	})
+}
+
+// DeriveEntitlements returns the minimal entitlements required to use the
+// specified provisioning profile with bundleID, see
+// provisioning.Profile.MinimalEntitlements, merged with ent. Entitlements
+// already present in ent take precedence.
+func DeriveEntitlements(profile, bundleID string, ent *Entitlements) (*Entitlements, error) {
+	p, err := provisioning.ParseFile(profile)
+	if err != nil {
+		return nil, err
+	}
+	derived := &Entitlements{raw: p.MinimalEntitlements(bundleID)}
+	if ent != nil {
+		for k, v := range ent.raw {
+			derived.raw[k] = v
+		}
+	}
+	return derived, nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package provisioning
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"fmt"
+)
+
+// berValue represents a single BER encoded value. Provisioning profiles
+// are CMS (PKCS#7) SignedData structures that may use BER features, such
+// as indefinite lengths and constructed octet strings, that are not
+// supported by encoding/asn1.
+type berValue struct {
+	class       int
+	tag         int
+	constructed bool
+	content     []byte     // contents of primitive values.
+	children    []berValue // contents of constructed values.
+	raw         []byte     // the complete encoding, including the header.
+}
+
+const maxBERDepth = 32
+
+func parseBER(data []byte, depth int) (berValue, []byte, error) {
+	if depth > maxBERDepth {
+		return berValue{}, nil, fmt.Errorf("asn.1 value is too deeply nested")
+	}
+	if len(data) < 2 {
+		return berValue{}, nil, fmt.Errorf("truncated asn.1 header")
+	}
+	v := berValue{
+		class:       int(data[0] >> 6),
+		constructed: data[0]&0x20 != 0,
+		tag:         int(data[0] & 0x1f),
+	}
+	off := 1
+	if v.tag == 0x1f {
+		v.tag = 0
+		for {
+			if off >= len(data) || off > 4 {
+				return berValue{}, nil, fmt.Errorf("invalid asn.1 tag")
+			}
+			b := data[off]
+			off++
+			v.tag = v.tag<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+	}
+	if off >= len(data) {
+		return berValue{}, nil, fmt.Errorf("truncated asn.1 header")
+	}
+	lb := data[off]
+	off++
+	if lb == 0x80 {
+		// Indefinite length, only valid for constructed values.
+		if !v.constructed {
+			return berValue{}, nil, fmt.Errorf("indefinite length for a primitive asn.1 value")
+		}
+		rest := data[off:]
+		for {
+			if len(rest) >= 2 && rest[0] == 0 && rest[1] == 0 {
+				rest = rest[2:]
+				break
+			}
+			child, r, err := parseBER(rest, depth+1)
+			if err != nil {
+				return berValue{}, nil, err
+			}
+			v.children = append(v.children, child)
+			rest = r
+		}
+		v.raw = data[:len(data)-len(rest)]
+		return v, rest, nil
+	}
+	length := int(lb)
+	if lb&0x80 != 0 {
+		n := int(lb & 0x7f)
+		if n > 4 || off+n > len(data) {
+			return berValue{}, nil, fmt.Errorf("invalid asn.1 length")
+		}
+		length = 0
+		for _, b := range data[off : off+n] {
+			length = length<<8 | int(b)
+		}
+		off += n
+	}
+	if length < 0 || off+length > len(data) {
+		return berValue{}, nil, fmt.Errorf("asn.1 length %v exceeds the available data", length)
+	}
+	content := data[off : off+length]
+	v.raw = data[:off+length]
+	if !v.constructed {
+		v.content = content
+		return v, data[off+length:], nil
+	}
+	for len(content) > 0 {
+		child, r, err := parseBER(content, depth+1)
+		if err != nil {
+			return berValue{}, nil, err
+		}
+		v.children = append(v.children, child)
+		content = r
+	}
+	return v, data[off+length:], nil
+}
+
+const (
+	classUniversal       = 0
+	classContextSpecific = 2
+	tagOctetString       = 4
+	tagOID               = 6
+	tagSequence          = 16
+)
+
+func (v berValue) is(class, tag int) bool {
+	return v.class == class && v.tag == tag
+}
+
+// octets returns the contents of an octet string which may be
+// either primitive or constructed.
+func (v berValue) octets() []byte {
+	if !v.constructed {
+		return v.content
+	}
+	var buf bytes.Buffer
+	for _, c := range v.children {
+		buf.Write(c.octets())
+	}
+	return buf.Bytes()
+}
+
+func (v berValue) oid() (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	if !v.is(classUniversal, tagOID) {
+		return nil, fmt.Errorf("expected an object identifier")
+	}
+	_, err := asn1.Unmarshal(v.raw, &oid)
+	return oid, err
+}
+
+var (
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+)
+
+// signedData represents the parts of a CMS SignedData structure
+// that are of interest for provisioning profiles.
+type signedData struct {
+	content      []byte
+	certificates [][]byte
+}
+
+// parseSignedData parses a CMS ContentInfo that contains a SignedData
+// structure and returns its encapsulated content and certificates. The
+// signature itself is not verified.
+func parseSignedData(data []byte) (signedData, error) {
+	ci, _, err := parseBER(data, 0)
+	if err != nil {
+		return signedData{}, err
+	}
+	if !ci.is(classUniversal, tagSequence) || len(ci.children) < 2 {
+		return signedData{}, fmt.Errorf("not a CMS ContentInfo")
+	}
+	if oid, err := ci.children[0].oid(); err != nil || !oid.Equal(oidSignedData) {
+		return signedData{}, fmt.Errorf("CMS content type is not SignedData")
+	}
+	explicit := ci.children[1]
+	if !explicit.is(classContextSpecific, 0) || len(explicit.children) != 1 {
+		return signedData{}, fmt.Errorf("malformed CMS ContentInfo")
+	}
+	sd := explicit.children[0]
+	if !sd.is(classUniversal, tagSequence) || len(sd.children) < 3 {
+		return signedData{}, fmt.Errorf("malformed CMS SignedData")
+	}
+	// version, digestAlgorithms, encapContentInfo, [0] certificates, [1] crls, signerInfos.
+	eci := sd.children[2]
+	if !eci.is(classUniversal, tagSequence) || len(eci.children) != 2 {
+		return signedData{}, fmt.Errorf("CMS SignedData has no encapsulated content")
+	}
+	if oid, err := eci.children[0].oid(); err != nil || !oid.Equal(oidData) {
+		return signedData{}, fmt.Errorf("CMS encapsulated content type is not data")
+	}
+	econtent := eci.children[1]
+	if !econtent.is(classContextSpecific, 0) || len(econtent.children) != 1 ||
+		!econtent.children[0].is(classUniversal, tagOctetString) {
+		return signedData{}, fmt.Errorf("malformed CMS encapsulated content")
+	}
+	result := signedData{content: econtent.children[0].octets()}
+	for _, c := range sd.children[3:] {
+		if c.is(classContextSpecific, 0) {
+			for _, cert := range c.children {
+				result.certificates = append(result.certificates, cert.raw)
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package provisioning
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// IsRestricted returns true if the specified entitlement must be granted
+// by a provisioning profile, ie. it is not one of the sandbox or hardened
+// runtime entitlements (com.apple.security.*) that any signed code may
+// claim.
+func IsRestricted(key string) bool {
+	return !strings.HasPrefix(key, "com.apple.security.")
+}
+
+// EntitlementIssue represents an entitlement that will be rejected
+// at launch because it is not granted by a provisioning profile.
+type EntitlementIssue struct {
+	Key    string
+	Value  any
+	Reason string
+}
+
+func (i EntitlementIssue) String() string {
+	return fmt.Sprintf("%v: %v", i.Key, i.Reason)
+}
+
+// CheckEntitlements compares the requested entitlements with those
+// granted by the profile and returns an issue for every restricted
+// entitlement that is not granted. Wildcards in the profile's values,
+// such as TEAMID.* or *, match any value with the same prefix. Boolean
+// entitlements granted as true may be requested as true or false and
+// those granted as false may only be requested as false. The issues are
+// ordered by entitlement key.
+func (p *Profile) CheckEntitlements(requested map[string]any) []EntitlementIssue {
+	keys := make([]string, 0, len(requested))
+	for k := range requested {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var issues []EntitlementIssue
+	for _, key := range keys {
+		if !IsRestricted(key) {
+			continue
+		}
+		value := requested[key]
+		allowed, ok := p.Entitlements[key]
+		if !ok {
+			issues = append(issues, EntitlementIssue{Key: key, Value: value,
+				Reason: "not granted by the provisioning profile"})
+			continue
+		}
+		if !entitlementAllowed(value, allowed) {
+			issues = append(issues, EntitlementIssue{Key: key, Value: value,
+				Reason: fmt.Sprintf("value %v is not granted by the provisioning profile, which allows %v", value, allowed)})
+		}
+	}
+	return issues
+}
+
+func wildcardMatch(pattern, value string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(value, prefix)
+	}
+	return pattern == value
+}
+
+func stringAllowed(value string, allowed any) bool {
+	switch a := allowed.(type) {
+	case string:
+		return wildcardMatch(a, value)
+	case []any:
+		for _, v := range a {
+			if s, ok := v.(string); ok && wildcardMatch(s, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func entitlementAllowed(value, allowed any) bool {
+	switch v := value.(type) {
+	case string:
+		return stringAllowed(v, allowed)
+	case []any:
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return reflect.DeepEqual(value, allowed)
+			}
+			if !stringAllowed(s, allowed) {
+				return false
+			}
+		}
+		return true
+	case []string:
+		for _, s := range v {
+			if !stringAllowed(s, allowed) {
+				return false
+			}
+		}
+		return true
+	case bool:
+		a, ok := allowed.(bool)
+		return ok && (a || !v)
+	}
+	return reflect.DeepEqual(value, allowed)
+}
+
+// MinimalEntitlements returns the minimal set of entitlements required
+// for code with the specified bundle identifier to be launched with this
+// profile, that is, the application identifier, with any wildcard replaced
+// by the bundle identifier, and the team identifier.
+func (p *Profile) MinimalEntitlements(bundleID string) map[string]any {
+	ent := map[string]any{}
+	key := "com.apple.application-identifier"
+	if _, ok := p.Entitlements[key]; !ok {
+		if _, ok := p.Entitlements["application-identifier"]; ok {
+			key = "application-identifier"
+		}
+	}
+	ent[key] = p.AppIDPrefix() + "." + bundleID
+	if team := p.TeamID(); team != "" {
+		ent["com.apple.developer.team-identifier"] = team
+	}
+	return ent
+}
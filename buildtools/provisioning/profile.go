@@ -0,0 +1,197 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+// Package provisioning provides pure Go support for parsing and validating
+// Apple provisioning profiles, that is, the CMS (PKCS#7) signed property
+// lists stored in .provisionprofile and .mobileprovision files.
+// See https://developer.apple.com/documentation/technotes/tn3125-inside-code-signing-provisioning-profiles
+package provisioning
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"howett.net/plist"
+)
+
+// Profile represents a provisioning profile.
+type Profile struct {
+	Name                          string
+	UUID                          string
+	AppIDName                     string
+	TeamName                      string
+	TeamIdentifiers               []string
+	ApplicationIdentifierPrefixes []string
+	Platforms                     []string
+	CreationDate                  time.Time
+	ExpirationDate                time.Time
+	Entitlements                  map[string]any
+	DeveloperCertificates         []*x509.Certificate
+	ProvisionedDevices            []string
+	ProvisionsAllDevices          bool
+	// Certificates contains the certificates included in the CMS wrapper,
+	// ie. those used to sign the profile.
+	Certificates []*x509.Certificate
+	// Raw contains the complete, decoded, property list.
+	Raw map[string]any
+}
+
+type profilePlist struct {
+	Name                          string         `plist:"Name"`
+	UUID                          string         `plist:"UUID"`
+	AppIDName                     string         `plist:"AppIDName"`
+	TeamName                      string         `plist:"TeamName"`
+	TeamIdentifiers               []string       `plist:"TeamIdentifier"`
+	ApplicationIdentifierPrefixes []string       `plist:"ApplicationIdentifierPrefix"`
+	Platforms                     []string       `plist:"Platform"`
+	CreationDate                  time.Time      `plist:"CreationDate"`
+	ExpirationDate                time.Time      `plist:"ExpirationDate"`
+	Entitlements                  map[string]any `plist:"Entitlements"`
+	DeveloperCertificates         [][]byte       `plist:"DeveloperCertificates"`
+	ProvisionedDevices            []string       `plist:"ProvisionedDevices"`
+	ProvisionsAllDevices          bool           `plist:"ProvisionsAllDevices"`
+}
+
+// ParseFile parses the provisioning profile stored in the named file.
+func ParseFile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse parses a CMS wrapped provisioning profile. The CMS signature
+// is not verified.
+func Parse(data []byte) (*Profile, error) {
+	sd, err := parseSignedData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse provisioning profile: %w", err)
+	}
+	return parseContent(sd)
+}
+
+func parseContent(sd signedData) (*Profile, error) {
+	var pl profilePlist
+	if _, err := plist.Unmarshal(sd.content, &pl); err != nil {
+		return nil, fmt.Errorf("failed to parse provisioning profile property list: %w", err)
+	}
+	p := &Profile{
+		Name:                          pl.Name,
+		UUID:                          pl.UUID,
+		AppIDName:                     pl.AppIDName,
+		TeamName:                      pl.TeamName,
+		TeamIdentifiers:               pl.TeamIdentifiers,
+		ApplicationIdentifierPrefixes: pl.ApplicationIdentifierPrefixes,
+		Platforms:                     pl.Platforms,
+		CreationDate:                  pl.CreationDate,
+		ExpirationDate:                pl.ExpirationDate,
+		Entitlements:                  pl.Entitlements,
+		ProvisionedDevices:            pl.ProvisionedDevices,
+		ProvisionsAllDevices:          pl.ProvisionsAllDevices,
+	}
+	if _, err := plist.Unmarshal(sd.content, &p.Raw); err != nil {
+		return nil, err
+	}
+	for i, der := range pl.DeveloperCertificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse developer certificate %v: %w", i, err)
+		}
+		p.DeveloperCertificates = append(p.DeveloperCertificates, cert)
+	}
+	for i, der := range sd.certificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CMS certificate %v: %w", i, err)
+		}
+		p.Certificates = append(p.Certificates, cert)
+	}
+	return p, nil
+}
+
+// TeamID returns the profile's team identifier.
+func (p *Profile) TeamID() string {
+	if len(p.TeamIdentifiers) > 0 {
+		return p.TeamIdentifiers[0]
+	}
+	id, _ := p.Entitlements["com.apple.developer.team-identifier"].(string)
+	return id
+}
+
+// AppIDPrefix returns the profile's application identifier prefix,
+// which is generally the same as the team identifier.
+func (p *Profile) AppIDPrefix() string {
+	if len(p.ApplicationIdentifierPrefixes) > 0 {
+		return p.ApplicationIdentifierPrefixes[0]
+	}
+	return p.TeamID()
+}
+
+// ApplicationIdentifier returns the application identifier granted by the
+// profile, eg. ABCDE12345.com.example.app or ABCDE12345.* for a wildcard
+// profile. macOS profiles use the com.apple.application-identifier
+// entitlement and iOS profiles use application-identifier.
+func (p *Profile) ApplicationIdentifier() string {
+	for _, key := range []string{"com.apple.application-identifier", "application-identifier"} {
+		if id, ok := p.Entitlements[key].(string); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// BundleIDPattern returns the bundle identifier pattern granted by the
+// profile, ie. the application identifier without its prefix,
+// eg. com.example.app or *.
+func (p *Profile) BundleIDPattern() string {
+	id := p.ApplicationIdentifier()
+	if prefix := p.AppIDPrefix(); prefix != "" {
+		if pattern, ok := strings.CutPrefix(id, prefix+"."); ok {
+			return pattern
+		}
+	}
+	_, pattern, _ := strings.Cut(id, ".")
+	return pattern
+}
+
+// MatchesBundleID returns true if the profile may be used for the
+// specified bundle identifier. A trailing * in the profile's bundle
+// identifier pattern matches any suffix.
+func (p *Profile) MatchesBundleID(bundleID string) bool {
+	pattern := p.BundleIDPattern()
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(bundleID, prefix)
+	}
+	return pattern == bundleID
+}
+
+// Expired returns true if the profile has expired at the specified time.
+func (p *Profile) Expired(when time.Time) bool {
+	return !p.ExpirationDate.IsZero() && !when.Before(p.ExpirationDate)
+}
+
+// Validate returns an error if the profile has expired at the specified
+// time or if its application identifier does not match bundleID.
+func (p *Profile) Validate(bundleID string, when time.Time) error {
+	if p.Expired(when) {
+		return fmt.Errorf("provisioning profile %q (%v) expired on %v", p.Name, p.UUID, p.ExpirationDate.Format(time.RFC3339))
+	}
+	if !p.MatchesBundleID(bundleID) {
+		return fmt.Errorf("provisioning profile %q (%v) application identifier %q does not match bundle identifier %q", p.Name, p.UUID, p.ApplicationIdentifier(), bundleID)
+	}
+	return nil
+}
+
+// String returns a one line summary of the profile.
+func (p *Profile) String() string {
+	return fmt.Sprintf("%v: %q team %v app id %v expires %v", p.UUID, p.Name, p.TeamID(), p.ApplicationIdentifier(), p.ExpirationDate.Format(time.RFC3339))
+}
@@ -0,0 +1,162 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package provisioning_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"cloudeng.io/macos/buildtools/internal/profiletest"
+	"cloudeng.io/macos/buildtools/provisioning"
+)
+
+func TestParse(t *testing.T) {
+	expires := time.Now().Add(30 * 24 * time.Hour).UTC().Truncate(time.Second)
+	data := profiletest.Create(t, profiletest.Spec{
+		Name:       "Test Profile",
+		UUID:       "0B5C4E5A-1111-2222-3333-444455556666",
+		TeamID:     "ABCDE12345",
+		BundleID:   "io.cloudeng.app",
+		Expiration: expires,
+		Devices:    []string{"00008103-000A1B2C3D4E5F60"},
+	})
+	p, err := provisioning.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.Name, "Test Profile"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := p.UUID, "0B5C4E5A-1111-2222-3333-444455556666"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := p.TeamID(), "ABCDE12345"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := p.AppIDPrefix(), "ABCDE12345"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := p.ApplicationIdentifier(), "ABCDE12345.io.cloudeng.app"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := p.BundleIDPattern(), "io.cloudeng.app"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := p.ExpirationDate, expires; !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := strings.Join(p.ProvisionedDevices, ","), "00008103-000A1B2C3D4E5F60"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if p.ProvisionsAllDevices {
+		t.Errorf("unexpected ProvisionsAllDevices")
+	}
+	if got, want := len(p.DeveloperCertificates), 1; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := p.DeveloperCertificates[0].Subject.CommonName, "Apple Development: Test (ABCDE12345)"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := len(p.Certificates), 1; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := p.Entitlements["keychain-access-groups"], []any{"ABCDE12345.*"}; len(got.([]any)) != 1 || got.([]any)[0] != want[0] {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	now := time.Now()
+	if err := p.Validate("io.cloudeng.app", now); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := p.Validate("io.cloudeng.other", now); err == nil || !strings.Contains(err.Error(), `application identifier "ABCDE12345.io.cloudeng.app" does not match bundle identifier "io.cloudeng.other"`) {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	if err := p.Validate("io.cloudeng.app", expires.Add(time.Second)); err == nil || !strings.Contains(err.Error(), "expired on") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	if _, err := provisioning.Parse(data[:len(data)/2]); err == nil {
+		t.Errorf("expected an error for a truncated profile")
+	}
+}
+
+func TestWildcard(t *testing.T) {
+	p, err := provisioning.Parse(profiletest.Create(t, profiletest.Spec{
+		Name:       "Wildcard",
+		UUID:       "WILDCARD",
+		TeamID:     "ABCDE12345",
+		BundleID:   "io.cloudeng.*",
+		Expiration: time.Now().Add(time.Hour),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.ProvisionsAllDevices {
+		t.Errorf("expected ProvisionsAllDevices")
+	}
+	for _, tc := range []struct {
+		id    string
+		match bool
+	}{
+		{"io.cloudeng.app", true},
+		{"io.cloudeng.app.helper", true},
+		{"io.other.app", false},
+	} {
+		if got, want := p.MatchesBundleID(tc.id), tc.match; got != want {
+			t.Errorf("%v: got %v, want %v", tc.id, got, want)
+		}
+	}
+}
+
+func TestCheckEntitlements(t *testing.T) {
+	p, err := provisioning.Parse(profiletest.Create(t, profiletest.Spec{
+		Name:       "Test",
+		UUID:       "UUID",
+		TeamID:     "ABCDE12345",
+		BundleID:   "io.cloudeng.*",
+		Expiration: time.Now().Add(time.Hour),
+		Entitlements: map[string]any{
+			"get-task-allow":                      false,
+			"com.apple.developer.icloud-services": []any{"CloudKit"},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := p.CheckEntitlements(map[string]any{
+		"com.apple.security.app-sandbox":      true,
+		"com.apple.application-identifier":    "ABCDE12345.io.cloudeng.app",
+		"keychain-access-groups":              []any{"ABCDE12345.io.cloudeng.shared", "OTHER.group"},
+		"get-task-allow":                      true,
+		"com.apple.developer.icloud-services": []any{"CloudKit"},
+		"com.apple.developer.networking.vpn":  true,
+	})
+	var got []string
+	for _, i := range issues {
+		got = append(got, i.String())
+	}
+	want := []string{
+		"com.apple.developer.networking.vpn: not granted by the provisioning profile",
+		"get-task-allow: value true is not granted by the provisioning profile, which allows false",
+		"keychain-access-groups: value [ABCDE12345.io.cloudeng.shared OTHER.group] is not granted by the provisioning profile, which allows [ABCDE12345.*]",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if issues := p.CheckEntitlements(map[string]any{"com.apple.application-identifier": "ABCDE12345.io.other.app"}); len(issues) != 1 {
+		t.Errorf("expected an issue: %v", issues)
+	}
+
+	minimal := p.MinimalEntitlements("io.cloudeng.app")
+	if got, want := minimal["com.apple.application-identifier"], "ABCDE12345.io.cloudeng.app"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := minimal["com.apple.developer.team-identifier"], "ABCDE12345"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if issues := p.CheckEntitlements(minimal); len(issues) != 0 {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+}
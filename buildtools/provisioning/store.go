@@ -0,0 +1,271 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package provisioning
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultStoreDir returns the directory in which Xcode, and hence
+// the system, looks for the user's installed provisioning profiles,
+// ie. ~/Library/Developer/Xcode/UserData/Provisioning Profiles.
+func DefaultStoreDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "Developer", "Xcode", "UserData", "Provisioning Profiles"), nil
+}
+
+// Store represents a directory of installed provisioning profiles, each
+// of which is stored in a file named after its UUID.
+type Store struct {
+	dir string
+}
+
+// NewStore returns a Store for the specified directory, if dir is empty
+// DefaultStoreDir is used.
+func NewStore(dir string) (*Store, error) {
+	if dir == "" {
+		d, err := DefaultStoreDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = d
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the store's directory.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Installed represents a provisioning profile installed in a Store.
+type Installed struct {
+	*Profile
+	Path string
+}
+
+// Filter is used to select installed profiles, zero valued fields
+// match all profiles.
+type Filter struct {
+	Name   string // The profile's name.
+	UUID   string // The profile's UUID, case insensitive.
+	TeamID string // The profile's team identifier.
+	// AppID matches either the profile's application identifier,
+	// eg. ABCDE12345.com.example.app, or its bundle identifier pattern,
+	// eg. com.example.app or *.
+	AppID string
+	// ExpiresBefore matches profiles that expire before the specified time.
+	ExpiresBefore time.Time
+	// ExpiresAfter matches profiles that expire after the specified time.
+	ExpiresAfter time.Time
+}
+
+// Match returns true if the profile matches the filter.
+func (f Filter) Match(p *Profile) bool {
+	if f.Name != "" && f.Name != p.Name {
+		return false
+	}
+	if f.UUID != "" && !strings.EqualFold(f.UUID, p.UUID) {
+		return false
+	}
+	if f.TeamID != "" && f.TeamID != p.TeamID() {
+		return false
+	}
+	if f.AppID != "" && f.AppID != p.ApplicationIdentifier() && f.AppID != p.BundleIDPattern() {
+		return false
+	}
+	if !f.ExpiresBefore.IsZero() && !p.ExpirationDate.Before(f.ExpiresBefore) {
+		return false
+	}
+	if !f.ExpiresAfter.IsZero() && !p.ExpirationDate.After(f.ExpiresAfter) {
+		return false
+	}
+	return true
+}
+
+func isProfileFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".provisionprofile" || ext == ".mobileprovision"
+}
+
+// List returns the installed profiles that match the filter ordered by
+// name and then by expiration date. Files that cannot be parsed are
+// skipped and reported via the returned error along with the profiles
+// that could be parsed. A store directory that does not exist contains
+// no profiles.
+func (s *Store) List(f Filter) ([]Installed, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var installed []Installed
+	var errs []error
+	for _, e := range entries {
+		if e.IsDir() || !isProfileFile(e.Name()) {
+			continue
+		}
+		path := filepath.Join(s.dir, e.Name())
+		p, err := ParseFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if f.Match(p) {
+			installed = append(installed, Installed{Profile: p, Path: path})
+		}
+	}
+	sort.SliceStable(installed, func(i, j int) bool {
+		if installed[i].Name != installed[j].Name {
+			return installed[i].Name < installed[j].Name
+		}
+		return installed[i].ExpirationDate.Before(installed[j].ExpirationDate)
+	})
+	return installed, errors.Join(errs...)
+}
+
+// Filename returns the name of the file used to store the profile,
+// ie. <UUID>.provisionprofile for macOS profiles and
+// <UUID>.mobileprovision for all others.
+func Filename(p *Profile) string {
+	if len(p.Platforms) == 0 || slices.Contains(p.Platforms, "OSX") {
+		return p.UUID + ".provisionprofile"
+	}
+	return p.UUID + ".mobileprovision"
+}
+
+// Install copies the provisioning profile at path into the store, naming
+// it after its UUID and replacing any existing copy. The store directory
+// is created if necessary.
+func (s *Store) Install(path string) (Installed, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Installed{}, err
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return Installed{}, fmt.Errorf("%v: %w", path, err)
+	}
+	if p.UUID == "" || strings.ContainsAny(p.UUID, `/\`) || p.UUID == "." || p.UUID == ".." {
+		return Installed{}, fmt.Errorf("%v: invalid or missing UUID: %q", path, p.UUID)
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return Installed{}, err
+	}
+	dst := filepath.Join(s.dir, Filename(p))
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		return Installed{}, err
+	}
+	return Installed{Profile: p, Path: dst}, nil
+}
+
+// Remove removes the installed profile.
+func (s *Store) Remove(p Installed) error {
+	return os.Remove(p.Path)
+}
+
+// RemoveExpired removes all of the profiles that have expired at the
+// specified time and returns the profiles that were removed. Profiles
+// that cannot be parsed, or removed, are skipped and reported in the
+// returned error, which is joined from all such errors.
+func (s *Store) RemoveExpired(when time.Time) ([]Installed, error) {
+	installed, err := s.List(Filter{})
+	errs := []error{err}
+	var removed []Installed
+	for _, p := range installed {
+		if !p.Expired(when) {
+			continue
+		}
+		if err := s.Remove(p); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, p)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// better returns true if a is a better choice than b for the same bundle
+// identifier: explicit application identifiers are preferred to wildcard
+// ones, longer patterns to shorter ones and then profiles that expire
+// later to those that expire sooner.
+func better(a, b Installed) bool {
+	pa, pb := a.BundleIDPattern(), b.BundleIDPattern()
+	wa, wb := strings.HasSuffix(pa, "*"), strings.HasSuffix(pb, "*")
+	if wa != wb {
+		return !wa
+	}
+	if len(pa) != len(pb) {
+		return len(pa) > len(pb)
+	}
+	if !a.ExpirationDate.Equal(b.ExpirationDate) {
+		return a.ExpirationDate.After(b.ExpirationDate)
+	}
+	return a.UUID < b.UUID
+}
+
+// Select returns the best installed profile for the specified bundle
+// identifier and team at the specified time. Expired profiles are ignored,
+// as is the team if teamID is empty. Profiles with an explicit application
+// identifier are preferred to wildcard profiles and, of otherwise equal
+// profiles, the one that expires last is selected.
+func (s *Store) Select(bundleID, teamID string, when time.Time) (Installed, error) {
+	installed, err := s.List(Filter{TeamID: teamID, ExpiresAfter: when})
+	if err != nil && len(installed) == 0 {
+		return Installed{}, err
+	}
+	var best Installed
+	for _, p := range installed {
+		if !p.MatchesBundleID(bundleID) {
+			continue
+		}
+		if best.Profile == nil || better(p, best) {
+			best = p
+		}
+	}
+	if best.Profile == nil {
+		if teamID != "" {
+			return Installed{}, fmt.Errorf("no valid provisioning profile in %v for bundle identifier %q and team %q", s.dir, bundleID, teamID)
+		}
+		return Installed{}, fmt.Errorf("no valid provisioning profile in %v for bundle identifier %q", s.dir, bundleID)
+	}
+	return best, nil
+}
+
+// Lookup returns the installed profile with the specified UUID or name
+// that has not expired at the specified time. Profiles are generally
+// renewed with the same name and hence if several match the one that
+// expires last is returned.
+func (s *Store) Lookup(nameOrUUID string, when time.Time) (Installed, error) {
+	installed, err := s.List(Filter{ExpiresAfter: when})
+	if err != nil && len(installed) == 0 {
+		return Installed{}, err
+	}
+	var found Installed
+	for _, p := range installed {
+		if p.Name != nameOrUUID && !strings.EqualFold(p.UUID, nameOrUUID) {
+			continue
+		}
+		if found.Profile == nil || p.ExpirationDate.After(found.ExpirationDate) {
+			found = p
+		}
+	}
+	if found.Profile == nil {
+		return Installed{}, fmt.Errorf("no valid provisioning profile named %q in %v", nameOrUUID, s.dir)
+	}
+	return found, nil
+}
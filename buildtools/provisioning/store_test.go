@@ -0,0 +1,138 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package provisioning_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudeng.io/macos/buildtools/internal/profiletest"
+	"cloudeng.io/macos/buildtools/provisioning"
+)
+
+func names(installed []provisioning.Installed) []string {
+	var n []string
+	for _, p := range installed {
+		n = append(n, p.Name+"/"+p.UUID)
+	}
+	return n
+}
+
+func TestStore(t *testing.T) {
+	now := time.Now()
+	downloads := t.TempDir()
+	store, err := provisioning.NewStore(filepath.Join(t.TempDir(), "Provisioning Profiles"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if installed, err := store.List(provisioning.Filter{}); err != nil || len(installed) != 0 {
+		t.Fatalf("unexpected result for missing store: %v, %v", installed, err)
+	}
+
+	month := 30 * 24 * time.Hour
+	for i, spec := range []profiletest.Spec{
+		{Name: "Explicit", UUID: "UUID-1", TeamID: "ABCDE12345", BundleID: "io.cloudeng.app", Expiration: now.Add(month)},
+		{Name: "Explicit", UUID: "UUID-2", TeamID: "ABCDE12345", BundleID: "io.cloudeng.app", Expiration: now.Add(2 * month)},
+		{Name: "Wildcard", UUID: "UUID-3", TeamID: "ABCDE12345", BundleID: "io.cloudeng.*", Expiration: now.Add(3 * month)},
+		{Name: "Any", UUID: "UUID-4", TeamID: "ABCDE12345", BundleID: "*", Expiration: now.Add(3 * month)},
+		{Name: "Other Team", UUID: "UUID-5", TeamID: "ZZZZZ99999", BundleID: "io.cloudeng.app", Expiration: now.Add(3 * month)},
+		{Name: "Expired", UUID: "UUID-6", TeamID: "ABCDE12345", BundleID: "io.cloudeng.app", Expiration: now.Add(-month)},
+	} {
+		path := profiletest.Write(t, spec, downloads, "profile"+string(rune('a'+i))+".provisionprofile")
+		p, err := store.Install(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := p.Path, filepath.Join(store.Dir(), spec.UUID+".provisionprofile"); got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	// Re-installing a profile replaces it.
+	if _, err := store.Install(filepath.Join(downloads, "profilea.provisionprofile")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		filter provisioning.Filter
+		want   []string
+	}{
+		{provisioning.Filter{}, []string{"Any/UUID-4", "Expired/UUID-6", "Explicit/UUID-1", "Explicit/UUID-2", "Other Team/UUID-5", "Wildcard/UUID-3"}},
+		{provisioning.Filter{Name: "Explicit"}, []string{"Explicit/UUID-1", "Explicit/UUID-2"}},
+		{provisioning.Filter{UUID: "uuid-3"}, []string{"Wildcard/UUID-3"}},
+		{provisioning.Filter{TeamID: "ZZZZZ99999"}, []string{"Other Team/UUID-5"}},
+		{provisioning.Filter{AppID: "ABCDE12345.io.cloudeng.*"}, []string{"Wildcard/UUID-3"}},
+		{provisioning.Filter{AppID: "io.cloudeng.app", TeamID: "ABCDE12345"}, []string{"Expired/UUID-6", "Explicit/UUID-1", "Explicit/UUID-2"}},
+		{provisioning.Filter{ExpiresBefore: now}, []string{"Expired/UUID-6"}},
+		{provisioning.Filter{ExpiresAfter: now.Add(2 * month)}, []string{"Any/UUID-4", "Other Team/UUID-5", "Wildcard/UUID-3"}},
+	} {
+		installed, err := store.List(tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(installed); !slices.Equal(got, tc.want) {
+			t.Errorf("%+v: got %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		bundleID, teamID, want string
+	}{
+		{"io.cloudeng.app", "ABCDE12345", "UUID-2"},
+		{"io.cloudeng.app", "ZZZZZ99999", "UUID-5"},
+		{"io.cloudeng.other", "ABCDE12345", "UUID-3"},
+		{"com.example.app", "", "UUID-4"},
+	} {
+		p, err := store.Select(tc.bundleID, tc.teamID, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.UUID; got != tc.want {
+			t.Errorf("%v %v: got %v, want %v", tc.bundleID, tc.teamID, got, tc.want)
+		}
+	}
+	if _, err := store.Select("com.example.app", "ZZZZZ99999", now); err == nil || !strings.Contains(err.Error(), `no valid provisioning profile`) {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+
+	p, err := store.Lookup("Explicit", now)
+	if err != nil || p.UUID != "UUID-2" {
+		t.Errorf("unexpected result: %v, %v", p.Profile, err)
+	}
+	if p, err := store.Lookup("uuid-1", now); err != nil || p.UUID != "UUID-1" {
+		t.Errorf("unexpected result: %v, %v", p.Profile, err)
+	}
+	if _, err := store.Lookup("Expired", now); err == nil {
+		t.Errorf("expected an error for an expired profile")
+	}
+
+	// Unparseable files are reported but do not prevent listing.
+	if err := os.WriteFile(filepath.Join(store.Dir(), "bad.provisionprofile"), []byte("bad"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	installed, err := store.List(provisioning.Filter{Name: "Any"})
+	if err == nil || !strings.Contains(err.Error(), "bad.provisionprofile") || len(installed) != 1 {
+		t.Errorf("unexpected result: %v, %v", names(installed), err)
+	}
+
+	// Nor do they prevent expired profiles from being removed.
+	removed, err := store.RemoveExpired(now)
+	if err == nil || !strings.Contains(err.Error(), "bad.provisionprofile") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	if got, want := names(removed), []string{"Expired/UUID-6"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := os.Remove(filepath.Join(store.Dir(), "bad.provisionprofile")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir(), "UUID-6.provisionprofile")); !os.IsNotExist(err) {
+		t.Errorf("expired profile was not removed: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudeng.io/macos/buildtools"
+	"cloudeng.io/macos/buildtools/internal/profiletest"
+	"gopkg.in/yaml.v3"
+)
+
+func TestInstallProvisioningProfile(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	var info buildtools.InfoPlist
+	if err := yaml.Unmarshal([]byte(plistYAML), &info); err != nil {
+		t.Fatal(err)
+	}
+	bundle := buildtools.AppBundle{
+		Path: filepath.Join(tmpDir, "TestApp.app"),
+		Info: info,
+	}
+	if err := buildtools.NewRunner().AddSteps(bundle.Create()...).Run(ctx, buildtools.NewCommandRunner()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	spec := profiletest.Spec{
+		Name:       "Test",
+		UUID:       "UUID-1",
+		TeamID:     "ABCDE12345",
+		BundleID:   info.CFBundleIdentifier,
+		Expiration: time.Now().Add(time.Hour),
+	}
+	valid := profiletest.Write(t, spec, tmpDir, "valid.provisionprofile")
+	spec.BundleID = "io.cloudeng.other"
+	mismatch := profiletest.Write(t, spec, tmpDir, "mismatch.provisionprofile")
+	spec.BundleID = "io.cloudeng.*"
+	wildcard := profiletest.Write(t, spec, tmpDir, "wildcard.provisionprofile")
+	spec.Expiration = time.Now().Add(-time.Hour)
+	expired := profiletest.Write(t, spec, tmpDir, "expired.provisionprofile")
+
+	embedded := bundle.Contents("embedded.provisionprofile")
+	for _, tc := range []struct {
+		profile string
+		err     string
+	}{
+		{valid, ""},
+		{wildcard, ""},
+		{mismatch, `does not match bundle identifier "io.cloudeng.TestApp"`},
+		{expired, "expired on"},
+	} {
+		os.Remove(embedded) //nolint:errcheck
+		_, err := bundle.InstallProvisioningProfile(tc.profile).Run(ctx, buildtools.NewCommandRunner())
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%v: %v", tc.profile, err)
+			}
+			if _, err := os.Stat(embedded); err != nil {
+				t.Errorf("%v: %v", tc.profile, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%v: unexpected or missing error: %v", tc.profile, err)
+		}
+		if _, err := os.Stat(embedded); !os.IsNotExist(err) {
+			t.Errorf("%v: profile should not have been installed: %v", tc.profile, err)
+		}
+	}
+}
+
+const profileEntitlementsConfig = `
+entitlements:
+  com.apple.security.app-sandbox: true
+  keychain-access-groups:
+    - ABCDE12345.io.cloudeng.shared
+perfile_entitlements:
+  helper:
+    keychain-access-groups:
+      - OTHERTEAM.shared
+    com.apple.developer.networking.vpn: true
+`
+
+func TestCheckEntitlements(t *testing.T) {
+	ctx := context.Background()
+	profile := profiletest.Write(t, profiletest.Spec{
+		Name:       "Test",
+		UUID:       "UUID-1",
+		TeamID:     "ABCDE12345",
+		BundleID:   "io.cloudeng.*",
+		Expiration: time.Now().Add(time.Hour),
+	}, t.TempDir(), "test.provisionprofile")
+
+	var cfg buildtools.SigningConfig
+	if err := yaml.Unmarshal([]byte(profileEntitlementsConfig), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	res, err := cfg.Signer().CheckEntitlements(profile).Run(ctx, buildtools.NewCommandRunner())
+	if err == nil || !strings.Contains(err.Error(), `2 entitlement(s) are not granted by provisioning profile "Test" (UUID-1)`) {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	if got, want := res.Output(), `helper: com.apple.developer.networking.vpn: not granted by the provisioning profile
+helper: keychain-access-groups: value [OTHERTEAM.shared] is not granted by the provisioning profile, which allows [ABCDE12345.*]
+`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	cfg.PerFileEntitlements = nil
+	cfg.Entitlements, err = buildtools.DeriveEntitlements(profile, "io.cloudeng.app", cfg.Entitlements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.Signer().CheckEntitlements(profile).Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := cfg.Entitlements.MarshalIndent("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<key>com.apple.application-identifier</key><string>ABCDE12345.io.cloudeng.app</string>",
+		"<key>com.apple.developer.team-identifier</key><string>ABCDE12345</string>",
+		"<key>keychain-access-groups</key><array><string>ABCDE12345.io.cloudeng.shared</string>",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s does not contain %v", data, want)
+		}
+	}
+}
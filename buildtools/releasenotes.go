@@ -0,0 +1,344 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChangelogEntry represents a single change, ie. a commit, in a Changelog.
+type ChangelogEntry struct {
+	Commit      string // abbreviated commit hash.
+	Type        string // conventional commit type, eg. feat, empty if not a conventional commit.
+	Scope       string // conventional commit scope, if any.
+	Subject     string
+	Breaking    bool // marked with ! or a BREAKING CHANGE footer.
+	Merge       bool // a merge commit.
+	PullRequest int  // the pull request number, if one could be determined.
+}
+
+// ChangelogSection is a titled group of entries in a Changelog.
+type ChangelogSection struct {
+	Title   string
+	Entries []ChangelogEntry
+}
+
+// Changelog represents the changes made between two revisions, grouped
+// into sections by conventional commit type.
+type Changelog struct {
+	Version  string    // the revision that the changelog was generated for, eg. v1.2.0.
+	Previous string    // the revision that it was generated from, empty for all history.
+	Date     time.Time // the commit time of Version.
+	Sections []ChangelogSection
+}
+
+// ConventionalCommitTypes lists the conventional commit types and the
+// titles of the changelog sections they are grouped into, in the order
+// that the sections appear. Breaking changes, regardless of type, appear
+// first in a section of their own and commits that do not follow the
+// conventional commit format appear last in "Other Changes".
+// See https://www.conventionalcommits.org.
+var ConventionalCommitTypes = []struct {
+	Type, Title string
+}{
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"perf", "Performance Improvements"},
+	{"revert", "Reverts"},
+	{"docs", "Documentation"},
+	{"refactor", "Code Refactoring"},
+	{"style", "Styles"},
+	{"test", "Tests"},
+	{"build", "Build System"},
+	{"ci", "Continuous Integration"},
+	{"chore", "Chores"},
+}
+
+const (
+	breakingChangesTitle = "Breaking Changes"
+	otherChangesTitle    = "Other Changes"
+)
+
+var (
+	conventionalRE = regexp.MustCompile(`^([a-zA-Z]+)(?:\(([^)]*)\))?(!)?:\s*(.+)$`)
+	mergePRRE      = regexp.MustCompile(`^Merge pull request #([0-9]+) from \S+`)
+	squashPRRE     = regexp.MustCompile(`\s+\(#([0-9]+)\)$`)
+	breakingRE     = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE:`)
+)
+
+// ParseChangelogEntry parses a commit's subject and body into a
+// ChangelogEntry. The subject of a GitHub style merge commit, ie.
+// "Merge pull request #N from ...", is replaced by the first line of the
+// body which contains the pull request's title, and a squash merged
+// pull request number, eg. "subject (#N)", is removed from the subject.
+func ParseChangelogEntry(commit, subject, body string, merge bool) ChangelogEntry {
+	e := ChangelogEntry{Commit: commit, Merge: merge}
+	if m := mergePRRE.FindStringSubmatch(subject); m != nil {
+		e.PullRequest, _ = strconv.Atoi(m[1])
+		if title, _, _ := strings.Cut(strings.TrimSpace(body), "\n"); title != "" {
+			subject = title
+		}
+	}
+	if m := squashPRRE.FindStringSubmatchIndex(subject); m != nil {
+		e.PullRequest, _ = strconv.Atoi(subject[m[2]:m[3]])
+		subject = subject[:m[0]]
+	}
+	subject = strings.TrimSpace(subject)
+	e.Subject = subject
+	if m := conventionalRE.FindStringSubmatch(subject); m != nil && conventionalTitle(strings.ToLower(m[1])) != "" {
+		e.Type = strings.ToLower(m[1])
+		e.Scope = m[2]
+		e.Breaking = m[3] == "!"
+		e.Subject = m[4]
+	}
+	if breakingRE.MatchString(body) {
+		e.Breaking = true
+	}
+	return e
+}
+
+func conventionalTitle(typ string) string {
+	for _, ct := range ConventionalCommitTypes {
+		if ct.Type == typ {
+			return ct.Title
+		}
+	}
+	return ""
+}
+
+// NewChangelog groups the specified entries into sections, retaining
+// their order within each section.
+func NewChangelog(version, previous string, date time.Time, entries []ChangelogEntry) Changelog {
+	cl := Changelog{Version: version, Previous: previous, Date: date}
+	titles := []string{breakingChangesTitle}
+	for _, ct := range ConventionalCommitTypes {
+		titles = append(titles, ct.Title)
+	}
+	titles = append(titles, otherChangesTitle)
+	grouped := map[string][]ChangelogEntry{}
+	for _, e := range entries {
+		title := conventionalTitle(e.Type)
+		switch {
+		case e.Breaking:
+			title = breakingChangesTitle
+		case title == "":
+			title = otherChangesTitle
+		}
+		grouped[title] = append(grouped[title], e)
+	}
+	for _, title := range titles {
+		if len(grouped[title]) > 0 {
+			cl.Sections = append(cl.Sections, ChangelogSection{Title: title, Entries: grouped[title]})
+		}
+	}
+	return cl
+}
+
+// ReleaseNotes generates a Changelog from the commit history of a git
+// repository.
+type ReleaseNotes struct {
+	Git Git
+	// To is the revision to generate release notes for, it defaults to HEAD.
+	To string
+	// From is the revision to generate release notes from, it defaults
+	// to the nearest tag that precedes To. If there is no such tag, the
+	// entire history leading to To is used.
+	From string
+	// FirstParent restricts the history to the first parent of each
+	// merge commit so that merged pull requests appear as a single
+	// entry. Otherwise, merge commits are omitted since the commits
+	// they merge are included.
+	FirstParent bool
+}
+
+const (
+	logFieldSep  = "\x1f"
+	logRecordSep = "\x1e"
+)
+
+// Changelog returns the Changelog for the configured revisions. In
+// dry-run mode the commands are displayed and an empty Changelog is
+// returned.
+func (r ReleaseNotes) Changelog(ctx context.Context, cmdRunner *CommandRunner) (Changelog, error) {
+	to := r.To
+	if to == "" {
+		to = "HEAD"
+	}
+	from := r.From
+	if from == "" {
+		// An error indicates that there is no preceding tag, or that
+		// To is the root commit.
+		from, _ = r.Git.run(ctx, cmdRunner, "describe", "--tags", "--abbrev=0", to+"^")
+	}
+	version := to
+	if tag, err := r.Git.run(ctx, cmdRunner, "describe", "--tags", "--exact-match", to); err == nil && tag != "" {
+		version = tag
+	}
+	when, err := r.Git.run(ctx, cmdRunner, "show", "-s", "--format=%cI", to)
+	if err != nil {
+		return Changelog{}, err
+	}
+	args := []string{"log", "--format=%h%x1f%p%x1f%s%x1f%b%x1e"}
+	if r.FirstParent {
+		args = append(args, "--first-parent")
+	}
+	if from != "" {
+		args = append(args, from+".."+to)
+	} else {
+		args = append(args, to)
+	}
+	out, err := r.Git.run(ctx, cmdRunner, args...)
+	if err != nil || cmdRunner.DryRun() {
+		return Changelog{}, err
+	}
+	date, err := time.Parse(time.RFC3339, when)
+	if err != nil {
+		return Changelog{}, fmt.Errorf("failed to parse commit time %q: %w", when, err)
+	}
+	return NewChangelog(version, from, date, parseGitLog(out, r.FirstParent)), nil
+}
+
+// parseGitLog parses the output of git log using the format created
+// by ReleaseNotes.Changelog.
+func parseGitLog(out string, includeMerges bool) []ChangelogEntry {
+	var entries []ChangelogEntry
+	for record := range strings.SplitSeq(out, logRecordSep) {
+		fields := strings.SplitN(strings.TrimLeft(record, "\n"), logFieldSep, 4)
+		if len(fields) != 4 {
+			continue
+		}
+		merge := len(strings.Fields(fields[1])) > 1
+		if merge && !includeMerges {
+			continue
+		}
+		entries = append(entries, ParseChangelogEntry(fields[0], fields[2], fields[3], merge))
+	}
+	return entries
+}
+
+func (e ChangelogEntry) suffix() string {
+	var parts []string
+	if e.PullRequest != 0 {
+		parts = append(parts, fmt.Sprintf("#%d", e.PullRequest))
+	}
+	if e.Commit != "" {
+		parts = append(parts, e.Commit)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+func (cl Changelog) heading() string {
+	if cl.Date.IsZero() {
+		return cl.Version
+	}
+	return cl.Version + " (" + cl.Date.UTC().Format(time.DateOnly) + ")"
+}
+
+// Markdown renders the changelog as Markdown.
+func (cl Changelog) Markdown() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "## %v\n", cl.heading())
+	for _, s := range cl.Sections {
+		fmt.Fprintf(&out, "\n### %v\n\n", s.Title)
+		for _, e := range s.Entries {
+			out.WriteString("- ")
+			if e.Scope != "" {
+				fmt.Fprintf(&out, "**%v:** ", e.Scope)
+			}
+			out.WriteString(e.Subject + e.suffix() + "\n")
+		}
+	}
+	return out.String()
+}
+
+// htmlFragment renders the changelog as an HTML fragment.
+func (cl Changelog) htmlFragment() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "<h2>%v</h2>\n", html.EscapeString(cl.heading()))
+	for _, s := range cl.Sections {
+		fmt.Fprintf(&out, "<h3>%v</h3>\n<ul>\n", html.EscapeString(s.Title))
+		for _, e := range s.Entries {
+			out.WriteString("<li>")
+			if e.Scope != "" {
+				fmt.Fprintf(&out, "<b>%v:</b> ", html.EscapeString(e.Scope))
+			}
+			out.WriteString(html.EscapeString(e.Subject+e.suffix()) + "</li>\n")
+		}
+		out.WriteString("</ul>\n")
+	}
+	return out.String()
+}
+
+// HTML renders the changelog as a complete HTML document suitable for
+// use as an Installer welcome or conclusion resource.
+func (cl Changelog) HTML() string {
+	return `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>` + html.EscapeString(cl.Version) + `</title>
+</head>
+<body>
+` + cl.htmlFragment() + `</body>
+</html>
+`
+}
+
+// FeedDescription renders the changelog as the contents of the
+// description element of an update feed item, eg. a Sparkle appcast,
+// ie. as an HTML fragment within a CDATA section.
+func (cl Changelog) FeedDescription() string {
+	return "<![CDATA[\n" + cl.htmlFragment() + "]]>"
+}
+
+// ChangelogFormat specifies the format that a changelog is written in.
+type ChangelogFormat int
+
+const (
+	ChangelogMarkdown ChangelogFormat = iota
+	ChangelogHTML
+	ChangelogFeedDescription
+)
+
+// Render renders the changelog in the specified format.
+func (cl Changelog) Render(format ChangelogFormat) string {
+	switch format {
+	case ChangelogHTML:
+		return cl.HTML()
+	case ChangelogFeedDescription:
+		return cl.FeedDescription()
+	default:
+		return cl.Markdown()
+	}
+}
+
+// ReleaseNotesHTMLFile is the name of the HTML release notes written
+// to a product build's resources directory, it can be referred to
+// by the distribution XML's conclusion element, ie.
+//
+//	<conclusion file="ReleaseNotes.html" mime-type="text/html"/>
+const ReleaseNotesHTMLFile = "ReleaseNotes.html"
+
+// Write returns a Step that generates the changelog and writes it to
+// the specified file in the specified format.
+func (r ReleaseNotes) Write(format ChangelogFormat, elems ...string) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		cl, err := r.Changelog(ctx, cmdRunner)
+		if err != nil {
+			return NewStepResult("release notes", []string{filepath.Join(elems...)}, nil, err), err
+		}
+		return WriteFile([]byte(cl.Render(format)), 0644, elems...).Run(ctx, cmdRunner)
+	})
+}
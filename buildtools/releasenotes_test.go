@@ -0,0 +1,155 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudeng.io/macos/buildtools"
+)
+
+func TestParseChangelogEntry(t *testing.T) {
+	for _, tc := range []struct {
+		subject, body string
+		want          buildtools.ChangelogEntry
+	}{
+		{"feat(ui): add dark mode", "", buildtools.ChangelogEntry{Type: "feat", Scope: "ui", Subject: "add dark mode"}},
+		{"Fix: crash on launch (#12)", "", buildtools.ChangelogEntry{Type: "fix", Subject: "crash on launch", PullRequest: 12}},
+		{"refactor!: drop legacy API", "", buildtools.ChangelogEntry{Type: "refactor", Subject: "drop legacy API", Breaking: true}},
+		{"feat: new config format", "Details.\n\nBREAKING CHANGE: old files are ignored", buildtools.ChangelogEntry{Type: "feat", Subject: "new config format", Breaking: true}},
+		{"wip: not a known type", "", buildtools.ChangelogEntry{Subject: "wip: not a known type"}},
+		{"Merge pull request #7 from org/sync", "feat: add sync\n\nmore", buildtools.ChangelogEntry{Type: "feat", Subject: "add sync", PullRequest: 7}},
+	} {
+		if got := buildtools.ParseChangelogEntry("", tc.subject, tc.body, false); got != tc.want {
+			t.Errorf("%v: got %+v, want %+v", tc.subject, got, tc.want)
+		}
+	}
+}
+
+func TestReleaseNotes(t *testing.T) {
+	dir := t.TempDir()
+	runner := buildtools.NewCommandRunner()
+	ctx := buildtools.ContextWithCWD(t.Context(), dir)
+	initGitRepo(ctx, t, runner, dir)
+	git := func(args ...string) {
+		t.Helper()
+		if res, err := runner.Run(ctx, "git", args...); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, res.Output())
+		}
+	}
+
+	gitCommit(ctx, t, runner, dir, "initial", "v1.0.0")
+	gitCommit(ctx, t, runner, dir, "feat(ui): add dark mode")
+	gitCommit(ctx, t, runner, dir, "fix: handle <nil> values (#12)")
+	gitCommit(ctx, t, runner, dir, "refactor!: drop legacy API")
+	git("checkout", "-q", "-b", "sync")
+	if err := os.WriteFile(filepath.Join(dir, "sync.txt"), []byte("sync"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "sync.txt")
+	git("commit", "-q", "-m", "feat: sync with the cloud")
+	git("checkout", "-q", "-")
+	gitCommit(ctx, t, runner, dir, "update readme")
+	git("merge", "-q", "--no-ff", "-m", "Merge pull request #7 from org/sync", "-m", "feat: add sync", "sync")
+	git("tag", "v1.1.0")
+	gitCommit(ctx, t, runner, dir, "chore: after the release")
+
+	rn := buildtools.ReleaseNotes{Git: buildtools.NewGit(dir), To: "v1.1.0", FirstParent: true}
+	cl, err := rn.Changelog(ctx, runner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.Version != "v1.1.0" || cl.Previous != "v1.0.0" || time.Since(cl.Date) > time.Hour {
+		t.Errorf("unexpected changelog: %+v", cl)
+	}
+	for _, s := range cl.Sections {
+		for i := range s.Entries {
+			if len(s.Entries[i].Commit) == 0 {
+				t.Errorf("missing commit: %+v", s.Entries[i])
+			}
+			s.Entries[i].Commit = ""
+		}
+	}
+	cl.Date = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	if got, want := cl.Markdown(), `## v1.1.0 (2025-06-01)
+
+### Breaking Changes
+
+- drop legacy API
+
+### Features
+
+- add sync (#7)
+- **ui:** add dark mode
+
+### Bug Fixes
+
+- handle <nil> values (#12)
+
+### Other Changes
+
+- update readme
+`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	html := cl.HTML()
+	for _, want := range []string{
+		"<title>v1.1.0</title>",
+		"<h3>Bug Fixes</h3>\n<ul>\n<li>handle &lt;nil&gt; values (#12)</li>\n</ul>\n",
+		"<li><b>ui:</b> add dark mode</li>\n",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("%v does not contain %v", html, want)
+		}
+	}
+	if got := cl.FeedDescription(); !strings.HasPrefix(got, "<![CDATA[\n<h2>v1.1.0 (2025-06-01)</h2>\n") || !strings.HasSuffix(got, "</ul>\n]]>") {
+		t.Errorf("unexpected feed description: %v", got)
+	}
+
+	// Without FirstParent, the merged commits appear instead of the merge.
+	rn.FirstParent = false
+	cl, err = rn.Changelog(ctx, runner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := cl.Markdown()
+	if !strings.Contains(md, "- sync with the cloud (") || strings.Contains(md, "add sync") {
+		t.Errorf("unexpected changelog: %v", md)
+	}
+
+	// The default is HEAD since the most recent tag.
+	cl, err = buildtools.ReleaseNotes{Git: buildtools.NewGit(dir)}.Changelog(ctx, runner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.Version != "HEAD" || cl.Previous != "v1.1.0" || len(cl.Sections) != 1 || cl.Sections[0].Title != "Chores" {
+		t.Errorf("unexpected changelog: %+v", cl)
+	}
+
+	cl, err = rn.Changelog(ctx, buildtools.NewCommandRunner(buildtools.WithDryRun(true)))
+	if err != nil || len(cl.Sections) != 0 {
+		t.Errorf("unexpected dry-run changelog: %+v: %v", cl, err)
+	}
+
+	pb := buildtools.ProductBuild{
+		PkgBuild:     buildtools.PkgBuild{BuildDir: filepath.Join(t.TempDir(), "build")},
+		ReleaseNotes: &rn,
+	}
+	results := buildtools.NewRunner().AddSteps(pb.Create()...).AddSteps(pb.CopyResources()...).Run(ctx, runner)
+	if err := results.Error(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(pb.ResourcesPath(), buildtools.ReleaseNotesHTMLFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "sync with the cloud") {
+		t.Errorf("unexpected release notes: %s", data)
+	}
+}
@@ -0,0 +1,454 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The remote signing protocol allows for files and bundles to be signed
+// by a SigningServer running on a different machine, typically a Mac
+// that holds the signing identities, on behalf of a build machine that
+// may be running any operating system.
+//
+// A client POSTs a tar archive to RemoteSignPath with an
+// "Authorization: Bearer <token>" header. The first entry in the archive
+// is a JSON encoded RemoteSigningRequest named RemoteSignRequestEntry, it
+// is followed by the file or bundle to be signed, stored under
+// RemoteSignArtifactDir. The response to a successful request is a tar
+// archive whose first entry is a JSON encoded RemoteSigningResponse named
+// RemoteSignResponseEntry, followed by the signed artifact stored under
+// RemoteSignArtifactDir. Failed requests are reported using a non-200
+// status code and a JSON encoded RemoteSigningResponse.
+const (
+	RemoteSignPath          = "/v1/sign"
+	RemoteSignRequestEntry  = "request.json"
+	RemoteSignResponseEntry = "response.json"
+	RemoteSignArtifactDir   = "artifact"
+	// DefaultRemoteSignMaxSize is the default limit on the size of the
+	// archives exchanged between client and server.
+	DefaultRemoteSignMaxSize = 1 << 30
+)
+
+// RemoteSigningRequest represents the signing options sent to a
+// SigningServer.
+type RemoteSigningRequest struct {
+	Identity        string         `json:"identity"`
+	Entitlements    string         `json:"entitlements,omitempty"`
+	HardenedRuntime bool           `json:"hardened_runtime"`
+	Options         SigningOptions `json:"options"`
+}
+
+// RemoteSigningResponse represents the outcome of a remote signing
+// operation.
+type RemoteSigningResponse struct {
+	Backend string `json:"backend,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RemoteSigningConfig represents the configuration for the remote
+// signing backend that can be read from a yaml config file. URL is
+// either an http(s) URL or a unix:///path/to/socket URL. The
+// authentication token is read from TokenFile if Token is not set.
+// CAFile, if set, is a file of PEM encoded certificates that are used,
+// instead of the system's root certificates, to verify the certificate
+// presented by an https server, eg. one that uses a self-signed
+// certificate.
+type RemoteSigningConfig struct {
+	URL       string `yaml:"url"`
+	Token     string `yaml:"token,omitempty"`
+	TokenFile string `yaml:"token-file,omitempty"`
+	CAFile    string `yaml:"ca-file,omitempty"`
+	MaxSize   int64  `yaml:"max-size,omitempty"`
+}
+
+// RemoteBackend is a SigningBackend that uploads the file or bundle
+// to be signed, along with its entitlements, to a SigningServer and
+// replaces it with the signed artifact returned by that server. The
+// identity and hardened runtime settings are passed through to the
+// server whereas any arguments are ignored since they are specific to
+// the backend used by the server.
+type RemoteBackend struct {
+	cfg      RemoteSigningConfig
+	endpoint string
+	client   *http.Client
+}
+
+// NewRemoteBackend creates a new RemoteBackend.
+func NewRemoteBackend(cfg RemoteSigningConfig) (*RemoteBackend, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote signing url %q: %w", cfg.URL, err)
+	}
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = DefaultRemoteSignMaxSize
+	}
+	rb := &RemoteBackend{cfg: cfg}
+	switch u.Scheme {
+	case "http", "https":
+		rb.endpoint = strings.TrimSuffix(cfg.URL, "/") + RemoteSignPath
+		rb.client = &http.Client{}
+		if cfg.CAFile != "" {
+			pool, err := readCertPool(os.ExpandEnv(cfg.CAFile))
+			if err != nil {
+				return nil, err
+			}
+			rb.client.Transport = &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+			}
+		}
+	case "unix":
+		socket := u.Path
+		rb.endpoint = "http://unix" + RemoteSignPath
+		rb.client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}}
+	default:
+		return nil, fmt.Errorf("unsupported remote signing url %q: scheme must be http, https or unix", cfg.URL)
+	}
+	return rb, nil
+}
+
+func readCertPool(filename string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%v: no PEM encoded certificates found", filename)
+	}
+	return pool, nil
+}
+
+// Name implements SigningBackend.
+func (rb *RemoteBackend) Name() string {
+	return SigningBackendRemote
+}
+
+func (rb *RemoteBackend) token() (string, error) {
+	if rb.cfg.Token != "" {
+		return rb.cfg.Token, nil
+	}
+	if rb.cfg.TokenFile == "" {
+		return "", fmt.Errorf("no token or token file specified")
+	}
+	data, err := os.ReadFile(os.ExpandEnv(rb.cfg.TokenFile))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Sign implements SigningBackend.
+func (rb *RemoteBackend) Sign(ctx context.Context, cmdRunner *CommandRunner, req SigningRequest) (StepResult, error) {
+	args := []string{rb.cfg.URL, "--sign", req.Identity, req.Path}
+	if cmdRunner.DryRun() {
+		return NewStepResult(rb.Name(), args, nil, nil), nil
+	}
+	resp, err := rb.sign(ctx, req)
+	var output []byte
+	if resp != nil {
+		output = []byte(resp.Output)
+	}
+	return NewStepResult(rb.Name(), args, output, err), err
+}
+
+func (rb *RemoteBackend) sign(ctx context.Context, req SigningRequest) (*RemoteSigningResponse, error) {
+	token, err := rb.token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain remote signing token: %w", err)
+	}
+	opts, err := req.Options.remoteOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read requirements: %w", err)
+	}
+	rreq := RemoteSigningRequest{
+		Identity:        req.Identity,
+		HardenedRuntime: req.HardenedRuntime,
+		Options:         opts,
+	}
+	if req.Entitlements != nil {
+		data, err := req.Entitlements.MarshalIndent("\t")
+		if err != nil {
+			return nil, err
+		}
+		rreq.Entitlements = string(data)
+	}
+	body, size, err := rb.archive(rreq, req.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(body.Name()) //nolint:errcheck
+	defer body.Close()
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, rb.endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	hreq.ContentLength = size
+	hreq.Header.Set("Authorization", "Bearer "+token)
+	hreq.Header.Set("Content-Type", "application/x-tar")
+	hresp, err := rb.client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer hresp.Body.Close()
+	rd := io.LimitReader(hresp.Body, rb.cfg.MaxSize+1)
+	if hresp.StatusCode != http.StatusOK {
+		var resp RemoteSigningResponse
+		if err := json.NewDecoder(rd).Decode(&resp); err != nil || resp.Error == "" {
+			return nil, fmt.Errorf("remote signing failed: %v", hresp.Status)
+		}
+		return &resp, fmt.Errorf("remote signing failed: %v: %v", hresp.Status, resp.Error)
+	}
+	return rb.replace(rd, req.Path)
+}
+
+// archive spools the request archive to a temporary file, rather than
+// holding it in memory, and returns that file positioned at its start
+// along with its size. The caller must close and remove the file.
+func (rb *RemoteBackend) archive(rreq RemoteSigningRequest, filename string) (*os.File, int64, error) {
+	f, err := os.CreateTemp("", "signing-request-")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := rb.writeArchive(f, rreq, filename)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name()) //nolint:errcheck
+		return nil, 0, err
+	}
+	return f, size, nil
+}
+
+func (rb *RemoteBackend) writeArchive(f *os.File, rreq RemoteSigningRequest, filename string) (int64, error) {
+	tw := tar.NewWriter(f)
+	if err := writeTarJSON(tw, RemoteSignRequestEntry, rreq); err != nil {
+		return 0, err
+	}
+	if err := writeTarArtifact(tw, filename); err != nil {
+		return 0, err
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if size > rb.cfg.MaxSize {
+		return 0, fmt.Errorf("%v: archive of %v bytes exceeds the limit of %v bytes", filename, size, rb.cfg.MaxSize)
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return size, err
+}
+
+// replace extracts the signed artifact from the response and uses it
+// to replace the original file or bundle.
+func (rb *RemoteBackend) replace(rd io.Reader, filename string) (*RemoteSigningResponse, error) {
+	tmpDir, err := os.MkdirTemp(filepath.Dir(filename), ".remotesign-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir) //nolint:errcheck
+	var resp RemoteSigningResponse
+	name, err := readTarArchive(tar.NewReader(rd), RemoteSignResponseEntry, &resp, tmpDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response from remote signing server: %w", err)
+	}
+	if name != filepath.Base(filename) {
+		return nil, fmt.Errorf("invalid response from remote signing server: unexpected artifact %q", name)
+	}
+	// Move the original aside, within tmpDir, before moving the signed
+	// copy into its place so that the original is restored, rather than
+	// lost, if the signed copy cannot be moved. tmpDir is in the same
+	// directory as filename so both renames are within a filesystem.
+	original := filepath.Join(tmpDir, name+".original")
+	if err := os.Rename(filename, original); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(filepath.Join(tmpDir, name), filename); err != nil {
+		if rerr := os.Rename(original, filename); rerr != nil {
+			return nil, fmt.Errorf("%w, and failed to restore the original: %v", err, rerr)
+		}
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func writeTarJSON(tw *tar.Writer, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// writeTarArtifact writes the specified file or directory to the archive
+// under RemoteSignArtifactDir, preserving file modes and symlinks.
+func writeTarArtifact(tw *tar.Writer, filename string) error {
+	root := filepath.Dir(filename)
+	return filepath.WalkDir(filename, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(RemoteSignArtifactDir, filepath.ToSlash(rel))
+		hdr.Uname, hdr.Gname, hdr.Uid, hdr.Gid = "", "", 0, 0
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// readTarArchive reads an archive written by writeTarJSON and
+// writeTarArtifact, decoding the JSON entry into v and extracting the
+// artifact into dir. It returns the name of the artifact. All files are
+// created via an os.Root for dir so that no entry, including one that
+// refers to a previously extracted symlink, can be written outside of dir.
+func readTarArchive(tr *tar.Reader, jsonEntry string, v any, dir string) (string, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return "", err
+	}
+	defer root.Close()
+	hdr, err := tr.Next()
+	if err != nil {
+		return "", err
+	}
+	if hdr.Name != jsonEntry {
+		return "", fmt.Errorf("first entry is %q, not %q", hdr.Name, jsonEntry)
+	}
+	if err := json.NewDecoder(tr).Decode(v); err != nil {
+		return "", fmt.Errorf("failed to decode %v: %w", jsonEntry, err)
+	}
+	var artifact string
+	symlinks := map[string]bool{}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		name, err := artifactPath(hdr.Name)
+		if err != nil {
+			return "", err
+		}
+		top, _, _ := strings.Cut(name, "/")
+		if artifact == "" {
+			artifact = top
+		} else if top != artifact {
+			return "", fmt.Errorf("%q: archive contains more than one artifact", hdr.Name)
+		}
+		if err := extractTarEntry(tr, hdr, name, root, symlinks); err != nil {
+			return "", err
+		}
+	}
+	if artifact == "" {
+		return "", fmt.Errorf("archive does not contain an artifact")
+	}
+	return artifact, nil
+}
+
+// artifactPath validates the name of an archive entry, returning it
+// relative to RemoteSignArtifactDir.
+func artifactPath(name string) (string, error) {
+	rel, ok := strings.CutPrefix(name, RemoteSignArtifactDir+"/")
+	if !ok || rel == "" || !fs.ValidPath(rel) {
+		return "", fmt.Errorf("%q: invalid archive entry", name)
+	}
+	return rel, nil
+}
+
+// extractTarEntry extracts the entry for name, which is relative to
+// RemoteSignArtifactDir, into root. Symlinks must refer to files within
+// the artifact and, since writeTarArtifact never follows symlinks, no
+// entry may be located beneath a previously extracted symlink; such
+// symlinks are recorded in symlinks.
+func extractTarEntry(tr *tar.Reader, hdr *tar.Header, name string, root *os.Root, symlinks map[string]bool) error {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if symlinks[dir] {
+			return fmt.Errorf("%q: path refers to the symlink %q", hdr.Name, path.Join(RemoteSignArtifactDir, dir))
+		}
+	}
+	filename := filepath.FromSlash(name)
+	perm := fs.FileMode(hdr.Mode).Perm() //nolint:gosec // G115
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return root.MkdirAll(filename, perm|0700)
+	case tar.TypeSymlink:
+		top, _, _ := strings.Cut(name, "/")
+		target := path.Join(path.Dir(name), hdr.Linkname)
+		if path.IsAbs(hdr.Linkname) || !strings.HasPrefix(target, top+"/") {
+			return fmt.Errorf("%q: symlink target %q is outside of the artifact", hdr.Name, hdr.Linkname)
+		}
+		symlinks[name] = true
+		return root.Symlink(hdr.Linkname, filename)
+	case tar.TypeReg:
+		f, err := root.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return fmt.Errorf("%q: unsupported archive entry type %q", hdr.Name, hdr.Typeflag)
+}
@@ -0,0 +1,390 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/fs"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudeng.io/macos/buildtools"
+	"gopkg.in/yaml.v3"
+)
+
+func newRemoteBundle(t *testing.T, binary string) buildtools.AppBundle {
+	t.Helper()
+	var info buildtools.InfoPlist
+	if err := yaml.Unmarshal([]byte(plistYAML), &info); err != nil {
+		t.Fatal(err)
+	}
+	bundle := buildtools.AppBundle{
+		Path: filepath.Join(t.TempDir(), "TestApp.app"),
+		Info: info,
+	}
+	runner := buildtools.NewRunner()
+	runner.AddSteps(bundle.Create()...)
+	runner.AddSteps(bundle.WriteInfoPlist(), bundle.CopyExecutable(binary))
+	if err := runner.Run(context.Background(), buildtools.NewCommandRunner()).Error(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "Info.plist"), bundle.Resources("Info.plist")); err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func auditRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	buf.Reset()
+	return records
+}
+
+func TestRemoteSigning(t *testing.T) {
+	ctx := context.Background()
+	binary := buildDarwinBinary(t)
+	var audit bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&audit, nil))
+
+	srv, err := buildtools.NewStandInSigningServer(
+		map[string]string{"secret-token": "linux-builder"}, logger,
+		buildtools.WithAllowedIdentities("-"),
+		buildtools.WithMaxRequestSize(16<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var cfg buildtools.SigningConfig
+	if err := yaml.Unmarshal([]byte(adhocSigningConfig), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Backend = buildtools.SigningBackendRemote
+	cfg.Identity = "-"
+	cfg.Remote = &buildtools.RemoteSigningConfig{URL: srv.URL, TokenFile: tokenFile}
+	signer := cfg.Signer()
+
+	bundle := newRemoteBundle(t, binary)
+	exe := filepath.Join("Contents", "MacOS", bundle.Info.CFBundleExecutable)
+	runner := buildtools.NewRunner()
+	runner.AddSteps(
+		bundle.SignExecutable(signer),
+		bundle.Sign(signer),
+		signer.VerifyEntitlements(bundle.Path, exe),
+		buildtools.VerifyPathOffline(bundle.Path, ""),
+	)
+	results := runner.Run(ctx, buildtools.NewCommandRunner())
+	if err := results.Error(); err != nil {
+		for _, r := range results {
+			t.Log(r.String())
+		}
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(bundle.Resources("Info.plist")); err != nil || target != filepath.Join("..", "Info.plist") {
+		t.Errorf("symlink not preserved: %v %v", target, err)
+	}
+
+	records := auditRecords(t, &audit)
+	if got, want := len(records), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, artifact := range []string{bundle.Info.CFBundleExecutable, "TestApp.app"} {
+		rec := records[i]
+		if rec["client"] != "linux-builder" || rec["artifact"] != artifact || rec["status"] != float64(200) || rec["identity"] != "-" {
+			t.Errorf("unexpected audit record: %v", rec)
+		}
+		if len(rec["sha256"].(string)) != 64 {
+			t.Errorf("unexpected audit record: %v", rec)
+		}
+	}
+
+	signWith := func(rcfg buildtools.RemoteSigningConfig, identity string) error {
+		backend, err := buildtools.NewRemoteBackend(rcfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer := buildtools.NewSigner(identity, nil, nil, nil, buildtools.WithSigningBackend(backend))
+		_, err = bundle.Sign(signer).Run(ctx, buildtools.NewCommandRunner())
+		return err
+	}
+
+	for _, tc := range []struct {
+		rcfg     buildtools.RemoteSigningConfig
+		identity string
+		status   float64
+		err      string
+	}{
+		{buildtools.RemoteSigningConfig{URL: srv.URL, Token: "wrong"}, "-", 401, "401 Unauthorized: missing or invalid authentication token"},
+		{buildtools.RemoteSigningConfig{URL: srv.URL, Token: "secret-token"}, "other", 403, `403 Forbidden: identity "other" is not allowed`},
+	} {
+		err := signWith(tc.rcfg, tc.identity)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("unexpected or missing error: %v", err)
+		}
+		records := auditRecords(t, &audit)
+		if len(records) != 1 || records[0]["status"] != tc.status {
+			t.Errorf("unexpected audit records: %v", records)
+		}
+	}
+
+	// Exceed the server's size limit.
+	if err := os.WriteFile(bundle.Resources("large"), make([]byte, 17<<20), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = signWith(buildtools.RemoteSigningConfig{URL: srv.URL, Token: "secret-token"}, "-")
+	if err == nil || !strings.Contains(err.Error(), "413 Request Entity Too Large") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	// And the client's.
+	err = signWith(buildtools.RemoteSigningConfig{URL: srv.URL, Token: "secret-token", MaxSize: 1 << 20}, "-")
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit of 1048576 bytes") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+}
+
+func TestRemoteSigningUnixSocket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	binary := buildDarwinBinary(t)
+	socket := filepath.Join(t.TempDir(), "sign.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := buildtools.NewSigningServer(buildtools.AdHocBackend{}, map[string]string{"token": "client"}, nil,
+		buildtools.WithAllowedIdentities("-"))
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx, ln)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	backend, err := buildtools.NewRemoteBackend(buildtools.RemoteSigningConfig{URL: "unix://" + socket, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := buildtools.NewSigner("-", nil, nil, nil, buildtools.WithSigningBackend(backend))
+	if _, err := signer.SignPath(filepath.Dir(binary), filepath.Base(binary)).Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildtools.VerifyPathOffline(filepath.Dir(binary), filepath.Base(binary)).Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// selfSignedCertificate creates a self-signed certificate for 127.0.0.1
+// and returns the PEM encoded certificate and key.
+func selfSignedCertificate(t *testing.T) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "signing-server"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestRemoteSigningTLS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	binary := buildDarwinBinary(t)
+
+	// Plain HTTP is only allowed for loopback addresses and unix sockets.
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := buildtools.NewSigningServer(buildtools.AdHocBackend{}, map[string]string{"token": "client"}, nil,
+		buildtools.WithAllowedIdentities("-"))
+	if err := srv.Serve(ctx, ln); err == nil || !strings.Contains(err.Error(), "TLS must be configured") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	ln.Close()
+
+	certPEM, keyPEM := selfSignedCertificate(t)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv = buildtools.NewSigningServer(buildtools.AdHocBackend{}, map[string]string{"token": "client"}, nil,
+		buildtools.WithAllowedIdentities("-"),
+		buildtools.WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}))
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx, ln)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	sign := func(caFile string) error {
+		backend, err := buildtools.NewRemoteBackend(buildtools.RemoteSigningConfig{
+			URL: "https://" + ln.Addr().String(), Token: "token", CAFile: caFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer := buildtools.NewSigner("-", nil, nil, nil, buildtools.WithSigningBackend(backend))
+		_, err = signer.SignPath(filepath.Dir(binary), filepath.Base(binary)).Run(ctx, buildtools.NewCommandRunner())
+		return err
+	}
+	if err := sign(""); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	if err := sign(caFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildtools.VerifyPathOffline(filepath.Dir(binary), filepath.Base(binary)).Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// postArchive posts a request archive containing the supplied entries,
+// after the request itself, to srv and returns the response's status
+// code and error.
+func postArchive(t *testing.T, url, identity string, entries ...*tar.Header) (int, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	data, _ := json.Marshal(buildtools.RemoteSigningRequest{Identity: identity})
+	tw.WriteHeader(&tar.Header{Name: buildtools.RemoteSignRequestEntry, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(data))}) //nolint:errcheck
+	tw.Write(data)                                                                                                                  //nolint:errcheck
+	for _, hdr := range entries {
+		tw.WriteHeader(hdr) //nolint:errcheck
+	}
+	tw.Close() //nolint:errcheck
+
+	req, _ := http.NewRequest(http.MethodPost, url+buildtools.RemoteSignPath, &buf)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var rresp buildtools.RemoteSigningResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rresp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, rresp.Error
+}
+
+func TestRemoteSigningInvalidArchives(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+	srv, err := buildtools.NewStandInSigningServer(map[string]string{"token": "client"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		entries []*tar.Header
+		err     string
+	}{
+		{[]*tar.Header{{Name: "artifact/../evil", Typeflag: tar.TypeReg, Mode: 0600}}, `"artifact/../evil": invalid archive entry`},
+		{[]*tar.Header{{Name: "evil", Typeflag: tar.TypeReg, Mode: 0600}}, `"evil": invalid archive entry`},
+		{[]*tar.Header{{Name: "artifact/a.app/link", Typeflag: tar.TypeSymlink, Linkname: "../../x"}}, `symlink target "../../x" is outside of the artifact`},
+		{[]*tar.Header{{Name: "artifact/a.app/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}}, `symlink target "/etc/passwd" is outside of the artifact`},
+		// Each symlink target is within the artifact when considered on
+		// its own, but the second is created via the first.
+		{[]*tar.Header{
+			{Name: "artifact/top/a", Typeflag: tar.TypeDir, Mode: 0700},
+			{Name: "artifact/top/a/b", Typeflag: tar.TypeDir, Mode: 0700},
+			{Name: "artifact/top/a/b/s", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "artifact/top/a/b/s/x", Typeflag: tar.TypeSymlink, Linkname: "../../../top/z"},
+			{Name: "artifact/top/a/b/s/x/owned", Typeflag: tar.TypeReg, Mode: 0600},
+		}, `"artifact/top/a/b/s/x": path refers to the symlink "artifact/top/a/b/s"`},
+	} {
+		status, msg := postArchive(t, srv.URL, "-", tc.entries...)
+		if got, want := status, http.StatusBadRequest; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if !strings.Contains(msg, tc.err) {
+			t.Errorf("%q does not contain %q", msg, tc.err)
+		}
+	}
+	err = filepath.WalkDir(tmpDir, func(path string, _ fs.DirEntry, err error) error {
+		if err == nil && filepath.Base(path) == "owned" {
+			t.Errorf("%v: file was written", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoteSigningIdentities(t *testing.T) {
+	srv := httptest.NewServer(buildtools.NewSigningServer(buildtools.AdHocBackend{}, map[string]string{"token": "client"}, nil))
+	defer srv.Close()
+	status, msg := postArchive(t, srv.URL, "-", &tar.Header{Name: "artifact/a.app", Typeflag: tar.TypeDir, Mode: 0700})
+	if got, want := status, http.StatusForbidden; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := msg, `identity "-" is not allowed`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
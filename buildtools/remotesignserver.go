@@ -0,0 +1,354 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"howett.net/plist"
+)
+
+// SigningServerOption represents an option to NewSigningServer.
+type SigningServerOption func(o *signingServerOptions)
+
+type signingServerOptions struct {
+	maxSize    int64
+	identities []string
+	cmdOpts    []CommandRunnerOption
+	tlsConfig  *tls.Config
+}
+
+// WithMaxRequestSize sets the maximum size of the archive that
+// a client may upload, the default is DefaultRemoteSignMaxSize.
+func WithMaxRequestSize(size int64) SigningServerOption {
+	return func(o *signingServerOptions) {
+		o.maxSize = size
+	}
+}
+
+// WithAllowedIdentities specifies the identities that clients may request,
+// by default no identities are allowed and hence all requests are rejected.
+func WithAllowedIdentities(identities ...string) SigningServerOption {
+	return func(o *signingServerOptions) {
+		o.identities = identities
+	}
+}
+
+// WithTLSConfig specifies the TLS configuration used by Serve, which
+// must include the server's certificate.
+func WithTLSConfig(cfg *tls.Config) SigningServerOption {
+	return func(o *signingServerOptions) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithServerCommandRunnerOptions sets the options used for the
+// CommandRunner that is passed to the server's SigningBackend.
+func WithServerCommandRunnerOptions(opts ...CommandRunnerOption) SigningServerOption {
+	return func(o *signingServerOptions) {
+		o.cmdOpts = opts
+	}
+}
+
+// SigningServer implements the server side of the remote signing protocol
+// (see RemoteSignPath) as an http.Handler. Each request must carry one of
+// the server's authentication tokens and every request, successful or not,
+// is recorded in the audit log. Requests are signed one at a time using
+// the server's SigningBackend.
+type SigningServer struct {
+	backend SigningBackend
+	tokens  map[string]string
+	logger  *slog.Logger
+	opts    signingServerOptions
+	mu      sync.Mutex
+}
+
+// NewSigningServer creates a new SigningServer that uses backend to sign
+// artifacts. Tokens maps authentication tokens to the names of the clients
+// that use them, the client names are recorded in the audit log. Requests
+// are rejected if no tokens are supplied and requests for identities that
+// are not allowed by WithAllowedIdentities are rejected. If logger is nil, a default
+// logger that discards all logs will be used.
+func NewSigningServer(backend SigningBackend, tokens map[string]string, logger *slog.Logger, opts ...SigningServerOption) *SigningServer {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	s := &SigningServer{
+		backend: backend,
+		tokens:  tokens,
+		logger:  logger,
+	}
+	s.opts.maxSize = DefaultRemoteSignMaxSize
+	for _, fn := range opts {
+		fn(&s.opts)
+	}
+	return s
+}
+
+// Serve serves the signing protocol on the supplied listener until
+// the context is canceled. TLS is used if configured via WithTLSConfig,
+// otherwise the listener must be a unix domain socket or be bound to a
+// loopback address so that authentication tokens are never sent over
+// the network in the clear.
+func (s *SigningServer) Serve(ctx context.Context, ln net.Listener) error {
+	if s.opts.tlsConfig != nil {
+		ln = tls.NewListener(ln, s.opts.tlsConfig)
+	} else if !isLocalAddr(ln.Addr()) {
+		return fmt.Errorf("%v: TLS must be configured for addresses that are not loopback addresses or unix domain sockets", ln.Addr())
+	}
+	mux := http.NewServeMux()
+	mux.Handle(RemoteSignPath, s)
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: time.Minute,
+		ErrorLog:          slog.NewLogLogger(s.logger.Handler(), slog.LevelWarn),
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close() //nolint:errcheck
+	}()
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// isLocalAddr returns true if addr is a unix domain socket or a
+// loopback address.
+func isLocalAddr(addr net.Addr) bool {
+	switch a := addr.(type) {
+	case *net.UnixAddr:
+		return true
+	case *net.TCPAddr:
+		return a.IP.IsLoopback()
+	}
+	return false
+}
+
+func (s *SigningServer) authenticate(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	for t, client := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return client, true
+		}
+	}
+	return "", false
+}
+
+type signingAudit struct {
+	client, identity, artifact, sha256 string
+	size                               int64
+}
+
+// ServeHTTP implements http.Handler.
+func (s *SigningServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var audit signingAudit
+	status, resp, body := s.handle(w, r, &audit)
+	if body != nil {
+		defer body.Close()
+	}
+	s.logger.Info("signing request",
+		"client", audit.client,
+		"remote", r.RemoteAddr,
+		"identity", audit.identity,
+		"artifact", audit.artifact,
+		"sha256", audit.sha256,
+		"size", audit.size,
+		"status", status,
+		"error", resp.Error,
+		"duration", time.Since(start))
+	if status != http.StatusOK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp) //nolint:errcheck
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	io.Copy(w, body) //nolint:errcheck
+}
+
+// unlinkedTempFile creates a temporary file that is removed as soon as
+// it is created and hence once it is closed.
+func unlinkedTempFile(pattern string) (*os.File, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// handle processes a signing request, the request and response archives
+// are spooled to temporary files rather than being held in memory. The
+// returned file, if any, contains the response archive.
+func (s *SigningServer) handle(w http.ResponseWriter, r *http.Request, audit *signingAudit) (int, RemoteSigningResponse, *os.File) {
+	resp := RemoteSigningResponse{Backend: s.backend.Name()}
+	fail := func(status int, format string, args ...any) (int, RemoteSigningResponse, *os.File) {
+		resp.Error = fmt.Sprintf(format, args...)
+		return status, resp, nil
+	}
+	if r.Method != http.MethodPost {
+		return fail(http.StatusMethodNotAllowed, "method %v not allowed", r.Method)
+	}
+	client, ok := s.authenticate(r)
+	if !ok {
+		return fail(http.StatusUnauthorized, "missing or invalid authentication token")
+	}
+	audit.client = client
+	if r.ContentLength > s.opts.maxSize {
+		return fail(http.StatusRequestEntityTooLarge, "request of %v bytes exceeds the limit of %v bytes", r.ContentLength, s.opts.maxSize)
+	}
+	archive, err := unlinkedTempFile("signing-request-")
+	if err != nil {
+		return fail(http.StatusInternalServerError, "%v", err)
+	}
+	defer archive.Close()
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(archive, sum), http.MaxBytesReader(w, r.Body, s.opts.maxSize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return fail(http.StatusRequestEntityTooLarge, "request exceeds the limit of %v bytes", s.opts.maxSize)
+		}
+		return fail(http.StatusBadRequest, "failed to read request: %v", err)
+	}
+	audit.sha256 = hex.EncodeToString(sum.Sum(nil))
+	audit.size = size
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return fail(http.StatusInternalServerError, "%v", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "signing-server-")
+	if err != nil {
+		return fail(http.StatusInternalServerError, "%v", err)
+	}
+	defer os.RemoveAll(tmpDir) //nolint:errcheck
+
+	var req RemoteSigningRequest
+	name, err := readTarArchive(tar.NewReader(archive), RemoteSignRequestEntry, &req, tmpDir)
+	if err != nil {
+		return fail(http.StatusBadRequest, "invalid request: %v", err)
+	}
+	audit.identity, audit.artifact = req.Identity, name
+	if !slices.Contains(s.opts.identities, req.Identity) {
+		return fail(http.StatusForbidden, "identity %q is not allowed", req.Identity)
+	}
+	if err := req.Options.Validate(); err != nil {
+		return fail(http.StatusBadRequest, "invalid options: %v", err)
+	}
+	if req.Options.RequirementsFile != "" {
+		return fail(http.StatusBadRequest, "invalid options: requirements files are not supported, send the requirements instead")
+	}
+	sreq := SigningRequest{
+		Path:            filepath.Join(tmpDir, name),
+		Identity:        req.Identity,
+		HardenedRuntime: req.HardenedRuntime,
+		Options:         req.Options,
+	}
+	if req.Entitlements != "" {
+		var raw map[string]any
+		if _, err := plist.Unmarshal([]byte(req.Entitlements), &raw); err != nil {
+			return fail(http.StatusBadRequest, "invalid entitlements: %v", err)
+		}
+		sreq.Entitlements = &Entitlements{raw: raw}
+	}
+
+	s.mu.Lock()
+	result, err := s.backend.Sign(r.Context(), NewCommandRunner(s.opts.cmdOpts...), sreq)
+	s.mu.Unlock()
+	resp.Output = result.Output()
+	if err != nil {
+		return fail(http.StatusUnprocessableEntity, "failed to sign %q: %v", name, err)
+	}
+
+	out, err := unlinkedTempFile("signing-response-")
+	if err != nil {
+		return fail(http.StatusInternalServerError, "%v", err)
+	}
+	if err := writeResponseArchive(out, resp, sreq.Path); err != nil {
+		out.Close()
+		return fail(http.StatusInternalServerError, "%v", err)
+	}
+	return http.StatusOK, resp, out
+}
+
+func writeResponseArchive(out *os.File, resp RemoteSigningResponse, filename string) error {
+	tw := tar.NewWriter(out)
+	if err := writeTarJSON(tw, RemoteSignResponseEntry, resp); err != nil {
+		return err
+	}
+	if err := writeTarArtifact(tw, filename); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	_, err := out.Seek(0, io.SeekStart)
+	return err
+}
+
+// StandInSigningServer is an in-process SigningServer intended for
+// testing, it uses the AdHocBackend and listens on a loopback address.
+type StandInSigningServer struct {
+	// URL is the URL to be used in a RemoteSigningConfig.
+	URL string
+	// Server is the underlying SigningServer.
+	Server *SigningServer
+	cancel context.CancelFunc
+	done   chan error
+}
+
+// NewStandInSigningServer starts a StandInSigningServer that accepts
+// the supplied tokens, see NewSigningServer. The ad-hoc identity, "-",
+// is allowed unless overridden by WithAllowedIdentities.
+func NewStandInSigningServer(tokens map[string]string, logger *slog.Logger, opts ...SigningServerOption) (*StandInSigningServer, error) {
+	opts = append([]SigningServerOption{WithAllowedIdentities("-")}, opts...)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ss := &StandInSigningServer{
+		URL:    "http://" + ln.Addr().String(),
+		Server: NewSigningServer(AdHocBackend{}, tokens, logger, opts...),
+		cancel: cancel,
+		done:   make(chan error, 1),
+	}
+	go func() {
+		ss.done <- ss.Server.Serve(ctx, ln)
+	}()
+	return ss, nil
+}
+
+// Close stops the server.
+func (ss *StandInSigningServer) Close() error {
+	ss.cancel()
+	return <-ss.done
+}
@@ -50,6 +50,7 @@ func (f File) RewriteHOME() File {
 type BashScript struct {
 	out           *strings.Builder
 	installerOnce sync.Once
+	launchctlOnce sync.Once
 }
 
 // BashInstallPreamble is the standard preamble for install scripts
@@ -102,6 +103,45 @@ function installer_copy {
 
 `
 
+// launchctlFunctions are standard functions used to stop and start
+// launchd jobs in install scripts used in pkgbuild packages. Jobs are
+// either in the system domain or in the GUI domain of the console user,
+// the latter are skipped if no user is logged in.
+const launchctlFunctions = `
+function launchctl_domain {
+  if [ "$1" = "true" ]; then
+	echo "system"
+  elif [ "${TARGET_USER}" != "root" ]; then
+	echo "gui/$(id -u "${TARGET_USER}")"
+  fi
+}
+
+function launchctl_bootout {
+  domain=$(launchctl_domain "$1")
+  label="$2"
+  if [ -z "${domain}" ]; then
+	echo "No console user, not stopping ${label}"
+	return
+  fi
+  if launchctl print "${domain}/${label}" > /dev/null 2>&1; then
+	echo "Stopping ${domain}/${label}"
+	launchctl bootout "${domain}/${label}" || true
+  fi
+}
+
+function launchctl_bootstrap {
+  domain=$(launchctl_domain "$1")
+  plist="$2"
+  if [ -z "${domain}" ]; then
+	echo "No console user, not starting ${plist}"
+	return
+  fi
+  echo "Starting ${plist} in ${domain}"
+  launchctl bootstrap "${domain}" "${plist}"
+}
+
+`
+
 // NewBashScript creates a new BashScript instance with the specified
 // preamble.
 func NewBashScript(preamble string) *BashScript {
@@ -141,6 +181,34 @@ func (b *BashScript) CreateInstallManifest(systemWide bool, manifest File) {
 	b.InstallFile(systemWide, manifest, "")
 }
 
+// LaunchctlBootout appends the commands to stop and unload the launchd
+// job with the specified label, if it is loaded, to the script, typically
+// a preinstall script. If systemWide is true the job is a daemon in the
+// system domain, otherwise it is an agent in the console user's GUI
+// domain. The script must start with BashInstallPreamble.
+func (b *BashScript) LaunchctlBootout(systemWide bool, label string) {
+	b.launchctlOnce.Do(func() {
+		b.out.WriteString(launchctlFunctions)
+	})
+	fmt.Fprintf(b.out, `
+launchctl_bootout %t "%s"
+`, systemWide, label)
+}
+
+// LaunchctlBootstrap appends the commands to load and start the launchd
+// job defined by the specified plist to the script, typically a
+// postinstall script. The domain is determined as for LaunchctlBootout.
+// The plist path may refer to ${TARGET_HOME} for per-user agents, see
+// File.RewriteHOME.
+func (b *BashScript) LaunchctlBootstrap(systemWide bool, plist string) {
+	b.launchctlOnce.Do(func() {
+		b.out.WriteString(launchctlFunctions)
+	})
+	fmt.Fprintf(b.out, `
+launchctl_bootstrap %t "%s"
+`, systemWide, plist)
+}
+
 // Bytes returns the script as a byte slice.
 func (b *BashScript) Bytes() []byte {
 	return []byte(b.out.String())
@@ -9,34 +9,100 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+
+	"cloudeng.io/macos/buildtools/codesign"
+	"howett.net/plist"
 )
 
+// Signer signs files and bundles using a SigningBackend, the same
+// identity, entitlements and hardened runtime settings are provided
+// to every backend so that the backend can be changed without
+// changing the steps that use the Signer.
 type Signer struct {
+	backend             SigningBackend
 	identity            string
 	entitlements        *Entitlements
 	perFileEntitlements *PerFileEntitlements
 	arguments           []string
+	hardenedRuntime     bool
+	options             *SigningOptions
+	perFileOptions      *PerFileSigningOptions
+	err                 error
+}
+
+// SignerOption represents an option to NewSigner.
+type SignerOption func(s *Signer)
+
+// WithSigningBackend specifies the backend to be used for signing,
+// the default is CodesignBackend.
+func WithSigningBackend(backend SigningBackend) SignerOption {
+	return func(s *Signer) {
+		s.backend = backend
+	}
+}
+
+// WithHardenedRuntime specifies whether the hardened runtime is to be
+// enabled. The default is true unless arguments are supplied to NewSigner,
+// since they replace the default arguments, which enable it.
+func WithHardenedRuntime(enabled bool) SignerOption {
+	return func(s *Signer) {
+		s.hardenedRuntime = enabled
+	}
+}
+
+// WithSigningOptions specifies the typed signing options to be used
+// for all files and those to be used for specific files. As for
+// entitlements, the options for the most specific path are used.
+func WithSigningOptions(options *SigningOptions, perFileOptions *PerFileSigningOptions) SignerOption {
+	return func(s *Signer) {
+		s.options = options
+		s.perFileOptions = perFileOptions
+	}
 }
 
 // NewSigner creates a new signer.
 // The most specific entitlements for a given path will be used.
 // If no file specific entitlement exists, the global one (if any)
-// is used.
-func NewSigner(identity string, entitlements *Entitlements, perFileEntitlements *PerFileEntitlements, arguments []string) Signer {
+// is used. The arguments, if any, replace the backend's default
+// arguments and the hardened runtime is then only enabled if requested
+// via WithHardenedRuntime.
+func NewSigner(identity string, entitlements *Entitlements, perFileEntitlements *PerFileEntitlements, arguments []string, opts ...SignerOption) Signer {
 	signer := Signer{
+		backend:             CodesignBackend{},
 		identity:            identity,
 		entitlements:        entitlements,
 		perFileEntitlements: perFileEntitlements,
 		arguments:           arguments,
+		hardenedRuntime:     len(arguments) == 0,
+	}
+	for _, fn := range opts {
+		fn(&signer)
 	}
 	return signer
 }
 
-func (s Signer) entitlementsFor(path string) (Entitlements, bool) {
-	if len(path) > 0 && s.perFileEntitlements != nil {
-		pf, ok := s.perFileEntitlements.For(path)
-		if ok {
-			return pf, true
+// NewAdHocSigner creates a new signer that uses the AdHocBackend.
+// Entitlements are handled in the same manner as for NewSigner.
+func NewAdHocSigner(entitlements *Entitlements, perFileEntitlements *PerFileEntitlements) Signer {
+	return NewSigner("-", entitlements, perFileEntitlements, nil, WithSigningBackend(AdHocBackend{}))
+}
+
+// Backend returns the signer's backend.
+func (s Signer) Backend() SigningBackend {
+	return s.backend
+}
+
+// entitlementsFor returns the entitlements for the first of paths that
+// has file specific entitlements, or the global ones.
+func (s Signer) entitlementsFor(paths ...string) (Entitlements, bool) {
+	for _, path := range paths {
+		if len(path) > 0 && s.perFileEntitlements != nil {
+			pf, ok := s.perFileEntitlements.For(path)
+			if ok {
+				return pf, true
+			}
 		}
 	}
 	if s.entitlements != nil {
@@ -45,69 +111,103 @@ func (s Signer) entitlementsFor(path string) (Entitlements, bool) {
 	return Entitlements{}, false
 }
 
-func (s Signer) entitlementsFileFor(path string) (string, bool, error) {
-	ent, ok := s.entitlementsFor(path)
-	if !ok {
-		return "", false, nil
-	}
-	data, err := ent.MarshalIndent("  ")
-	if err != nil {
-		return "", false, err
-	}
-	tmpFile, err := os.CreateTemp("", filepath.Base(path)+"entitlements.plist-")
-	if err != nil {
-		return "", false, err
-	}
-	if _, err := tmpFile.Write(data); err != nil {
-		os.Remove(tmpFile.Name()) //nolint:errcheck
-		return "", false, err
+// optionsFor returns the signing options for the first of paths that
+// has file specific options, or the global ones.
+func (s Signer) optionsFor(paths ...string) SigningOptions {
+	for _, path := range paths {
+		if len(path) > 0 && s.perFileOptions != nil {
+			if opts, ok := s.perFileOptions.For(path); ok {
+				return opts
+			}
+		}
 	}
-	name := tmpFile.Name()
-	if err := tmpFile.Close(); err != nil {
-		os.Remove(name) //nolint:errcheck
-		return "", false, err
+	if s.options != nil {
+		return *s.options
 	}
-	return tmpFile.Name(), true, nil
+	return SigningOptions{}
 }
 
 // SignPath returns a Step that signs the specified path within the
 // specified bundle. If path is empty, the bundle itself is signed.
 func (s Signer) SignPath(bundle, path string) Step {
-	if s.identity == "" {
-		return ErrorStep(fmt.Errorf("cannot sign path %q: no identity specified", path), "codesign")
+	return s.signPath(bundle, path, path)
+}
+
+// signPath signs path using the entitlements for the first of
+// entitlementsPaths that has file specific entitlements.
+func (s Signer) signPath(bundle, path string, entitlementsPaths ...string) Step {
+	if s.err != nil {
+		return ErrorStep(fmt.Errorf("cannot sign path %q: %w", path, s.err), "sign")
 	}
-	args := []string{"--sign", s.identity}
-	if len(s.arguments) == 0 {
-		args = append(args, "--options", "runtime", "--force", "--timestamp")
-	} else {
-		args = append(args, s.arguments...)
+	req := SigningRequest{
+		Path:            filepath.Join(bundle, path),
+		Identity:        s.identity,
+		HardenedRuntime: s.hardenedRuntime,
+		Arguments:       s.arguments,
+		Options:         s.optionsFor(entitlementsPaths...),
 	}
-	entitlementsFile, ok, err := s.entitlementsFileFor(path)
-	if err != nil {
-		return ErrorStep(fmt.Errorf("failed to create entitlements file for %q: %w", path, err), "codesign")
+	if ent, ok := s.entitlementsFor(entitlementsPaths...); ok {
+		req.Entitlements = &ent
 	}
-	if ok {
-		args = append(args, "--entitlements", entitlementsFile)
-	}
-	args = append(args, filepath.Join(bundle, path))
 	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
-		if entitlementsFile != "" {
-			defer os.Remove(entitlementsFile) //nolint:errcheck
-		}
-		result, err := cmdRunner.Run(ctx, "codesign", args...)
+		result, err := s.backend.Sign(ctx, cmdRunner, req)
 		if err != nil {
-			if entitlementsFile != "" {
-				ent, nerr := os.ReadFile(entitlementsFile)
-				if nerr == nil {
-					err = fmt.Errorf("%w; entitlements: %s", err, string(ent))
-				}
-			}
 			return result, fmt.Errorf("failed to sign %q: %w", path, err)
 		}
 		return result, nil
 	})
 }
 
+// SignInsideOut returns a Step that signs all of the code within the
+// specified bundle, and then the bundle itself, in inside-out order as
+// determined by codesign.PlanSigning. Each Mach-O file is signed with the
+// entitlements for its path, and each bundle with the entitlements for its
+// own path or, if there are none, those for its main executable. Files that
+// appear to be code but cannot be signed are reported in the step's output
+// and cause the step to fail before anything is signed. In dry-run mode the
+// computed signing order and any unsignable files are reported without
+// signing anything.
+func (s Signer) SignInsideOut(bundle string) Step {
+	args := []string{"--inside-out", bundle}
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		if _, err := os.Stat(bundle); err != nil && cmdRunner.DryRun() {
+			out := fmt.Sprintf("%v does not exist yet, the signing order cannot be determined\n", bundle)
+			return NewStepResult("sign", args, []byte(out), nil), nil
+		}
+		plan, err := codesign.PlanSigning(bundle)
+		if err != nil {
+			return NewStepResult("sign", args, nil, err), err
+		}
+		var out strings.Builder
+		for _, u := range plan.Unsignable {
+			fmt.Fprintf(&out, "unsignable: %v\n", u)
+		}
+		if cmdRunner.DryRun() {
+			for i, code := range plan.Code {
+				fmt.Fprintf(&out, "%v: %v (%v)\n", i+1, filepath.Join(bundle, filepath.FromSlash(code.Path)), code.Kind)
+			}
+			return NewStepResult("sign", args, []byte(out.String()), nil), nil
+		}
+		if len(plan.Unsignable) > 0 {
+			err := fmt.Errorf("%v: %v file(s) cannot be signed", bundle, len(plan.Unsignable))
+			return NewStepResult("sign", args, []byte(out.String()), err), err
+		}
+		for _, code := range plan.Code {
+			path := filepath.FromSlash(code.Path)
+			step := s.signPath(bundle, path, path)
+			if code.Kind != codesign.CodeMachO {
+				step = s.signPath(bundle, path, path, filepath.FromSlash(code.Executable))
+			}
+			res, err := step.Run(ctx, cmdRunner)
+			out.WriteString(res.String())
+			if err != nil {
+				return NewStepResult("sign", args, []byte(out.String()), err), err
+			}
+		}
+		return NewStepResult("sign", args, []byte(out.String()), nil), nil
+	})
+}
+
 // VerifyPath returns a Step that verifies the signature of the specified path within the
 // specified bundle. If path is empty, the bundle itself is verified.
 func (s Signer) VerifyPath(bundle, path string) Step {
@@ -115,3 +215,84 @@ func (s Signer) VerifyPath(bundle, path string) Step {
 		return cmdRunner.Run(ctx, "codesign", "--verify", "--strict", filepath.Join(bundle, path))
 	})
 }
+
+// VerifyPathOffline returns a Step that verifies the signature of the specified
+// path within the specified bundle without using codesign. If path is empty,
+// or refers to a nested bundle, the bundle is verified, that is, the page
+// hashes of the main executable and all nested code are recomputed and all
+// of the resources sealed in _CodeSignature/CodeResources are compared
+// with the files on disk. Otherwise, path is assumed to be a Mach-O file
+// and only its page and special slot hashes are verified. Every divergence
+// found is included in the StepResult's output.
+func VerifyPathOffline(bundle, path string) Step {
+	filename := filepath.Join(bundle, path)
+	return StepFunc(func(_ context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		if cmdRunner.DryRun() {
+			return NewStepResult("verify signature", []string{filename}, nil, nil), nil
+		}
+		var issues codesign.Issues
+		var err error
+		if fi, serr := os.Stat(filename); serr == nil && fi.IsDir() {
+			issues, err = codesign.VerifyBundle(filename)
+		} else {
+			issues, err = codesign.VerifyFile(filename)
+		}
+		if err == nil {
+			err = issues.Err()
+		}
+		var out []byte
+		for _, issue := range issues {
+			out = append(out, issue.String()...)
+			out = append(out, '\n')
+		}
+		return NewStepResult("verify signature", []string{filename}, out, err), err
+	})
+}
+
+// VerifyEntitlements returns a Step that reads the embedded code signature
+// of the specified path within the specified bundle and verifies that every
+// slice carries the entitlements that the signer is configured to use for
+// that path. It does not use codesign and can be run on any platform.
+func (s Signer) VerifyEntitlements(bundle, path string) Step {
+	filename := filepath.Join(bundle, path)
+	return StepFunc(func(_ context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		if cmdRunner.DryRun() {
+			return NewStepResult("verify entitlements", []string{filename}, nil, nil), nil
+		}
+		err := s.verifyEntitlements(filename, path)
+		return NewStepResult("verify entitlements", []string{filename}, nil, err), err
+	})
+}
+
+func (s Signer) verifyEntitlements(filename, path string) error {
+	want := map[string]any{}
+	if ent, ok := s.entitlementsFor(path); ok {
+		data, err := ent.MarshalIndent("")
+		if err != nil {
+			return err
+		}
+		if _, err := plist.Unmarshal(data, &want); err != nil {
+			return err
+		}
+	}
+	slices, err := codesign.ParseFile(filename)
+	if err != nil {
+		return err
+	}
+	for _, slice := range slices {
+		if !slice.Signed() {
+			return fmt.Errorf("%v: %v: not signed", filename, slice.Arch())
+		}
+		got, err := slice.Signature.EntitlementsMap()
+		if err != nil {
+			return fmt.Errorf("%v: %v: %w", filename, slice.Arch(), err)
+		}
+		if got == nil {
+			got = map[string]any{}
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("%v: %v: entitlements mismatch: got %v, want %v", filename, slice.Arch(), got, want)
+		}
+	}
+	return nil
+}
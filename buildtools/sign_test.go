@@ -0,0 +1,427 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"cloudeng.io/macos/buildtools"
+	"cloudeng.io/macos/buildtools/codesign"
+	"gopkg.in/yaml.v3"
+)
+
+func buildDarwinBinary(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "hello")
+	cmd := exec.Command("go", "build", "-ldflags=-s -w", "-o", bin, filepath.Join("testdata", "hello.go"))
+	cmd.Env = append(os.Environ(), "GOOS=darwin", "GOARCH=amd64", "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build darwin binary: %v: %s", err, out)
+	}
+	return bin
+}
+
+const adhocSigningConfig = `
+entitlements:
+  com.apple.security.app-sandbox: true
+  keychain-access-groups:
+    - ABCDE12345.*
+perfile_entitlements:
+  helper:
+    com.apple.security.inherit: true
+`
+
+func TestAdHocSigner(t *testing.T) {
+	ctx := context.Background()
+	binary := buildDarwinBinary(t)
+
+	var cfg buildtools.SigningConfig
+	if err := yaml.Unmarshal([]byte(adhocSigningConfig), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	var info buildtools.InfoPlist
+	if err := yaml.Unmarshal([]byte(plistYAML), &info); err != nil {
+		t.Fatal(err)
+	}
+	bundle := buildtools.AppBundle{
+		Path: filepath.Join(t.TempDir(), "TestApp.app"),
+		Info: info,
+	}
+	signer := buildtools.NewAdHocSigner(cfg.Entitlements, cfg.PerFileEntitlements)
+	exe := filepath.Join("Contents", "MacOS", info.CFBundleExecutable)
+	helper := filepath.Join("Contents", "MacOS", "helper")
+
+	runner := buildtools.NewRunner()
+	runner.AddSteps(bundle.Create()...)
+	runner.AddSteps(
+		bundle.WriteInfoPlist(),
+		bundle.CopyExecutable(binary),
+		bundle.CopyContents(binary, "MacOS", "helper"),
+		bundle.SignContents(signer, "MacOS", "helper"),
+		bundle.Sign(signer),
+		signer.VerifyEntitlements(bundle.Path, exe),
+		signer.VerifyEntitlements(bundle.Path, helper),
+	)
+	runner.AddSteps(bundle.VerifySignaturesOffline()...)
+	results := runner.Run(ctx, buildtools.NewCommandRunner())
+	if err := results.Error(); err != nil {
+		for _, r := range results {
+			t.Log(r.String())
+		}
+		t.Fatal(err)
+	}
+
+	slices, err := codesign.ParseFile(bundle.ExecutablePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := slices[0].Signature.CodeDirectory
+	if got, want := cd.Identifier, info.CFBundleIdentifier; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !cd.AdHoc() || !cd.HardenedRuntime() {
+		t.Errorf("unexpected flags: %v", cd.Flags)
+	}
+
+	// The helper's entitlements must not match those of the executable.
+	_, err = signer.VerifyEntitlements(bundle.Path, exe).Run(ctx, buildtools.NewCommandRunner())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := buildtools.NewAdHocSigner(cfg.Entitlements, nil)
+	if _, err := other.VerifyEntitlements(bundle.Path, helper).Run(ctx, buildtools.NewCommandRunner()); err == nil {
+		t.Errorf("expected an entitlements mismatch")
+	}
+
+	// Modifying the bundle must be detected.
+	if err := os.WriteFile(bundle.Resources("extra.txt"), []byte("extra"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	res, err := buildtools.VerifyPathOffline(bundle.Path, "").Run(ctx, buildtools.NewCommandRunner())
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if got, want := res.Output(), "TestApp.app/Contents/Resources/extra.txt: resource added\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSigningBackends(t *testing.T) {
+	ctx := context.Background()
+	dryRun := buildtools.NewCommandRunner(buildtools.WithDryRun(true))
+	ent := buildtools.Entitlements{}
+
+	for _, tc := range []struct {
+		backend, identity string
+		hardened          bool
+		args              []string
+		executable        string
+		prefix            []string
+	}{
+		{"", "id", true, nil, "codesign",
+			[]string{"--sign", "id", "--force", "--timestamp", "--options", "runtime", "--entitlements"}},
+		{"codesign", "id", false, []string{"--deep"}, "codesign",
+			[]string{"--sign", "id", "--deep", "--entitlements"}},
+		{"codesign", "id", true, []string{"--options", "runtime,library"}, "codesign",
+			[]string{"--sign", "id", "--options", "runtime,library", "--entitlements"}},
+		{"rcodesign", "-", true, nil, "rcodesign",
+			[]string{"sign", "--code-signature-flags", "runtime", "--entitlements-xml-file"}},
+		{"rcodesign", strings.Repeat("0a", 20), false, nil, "rcodesign",
+			[]string{"sign", "--keychain-fingerprint", strings.Repeat("0a", 20), "--entitlements-xml-file"}},
+		{"rcodesign", "cert.p12", false, []string{"--p12-password-file", "pw"}, "rcodesign",
+			[]string{"sign", "--p12-file", "cert.p12", "--p12-password-file", "pw", "--entitlements-xml-file"}},
+		{"adhoc", "", true, nil, "codesign.Sign",
+			[]string{"--sign", "-", filepath.Join("a.app", "Contents", "MacOS", "a")}},
+		{"noop", "", true, nil, "noop: sign",
+			[]string{filepath.Join("a.app", "Contents", "MacOS", "a")}},
+	} {
+		cfg := buildtools.SigningConfig{
+			Backend:           tc.backend,
+			Identity:          tc.identity,
+			CodesignArguments: tc.args,
+			HardenedRuntime:   &tc.hardened,
+			Entitlements:      &ent,
+		}
+		signer := cfg.Signer()
+		res, err := signer.SignPath("a.app", filepath.Join("Contents", "MacOS", "a")).Run(ctx, dryRun)
+		if err != nil {
+			t.Errorf("%v: %v", tc.backend, err)
+			continue
+		}
+		if got, want := res.Executable(), tc.executable; got != want {
+			t.Errorf("%v: got %v, want %v", tc.backend, got, want)
+		}
+		args := res.Args()
+		if len(args) < len(tc.prefix) || !slices.Equal(args[:len(tc.prefix)], tc.prefix) {
+			t.Errorf("%v: got %v, want prefix %v", tc.backend, args, tc.prefix)
+		}
+		if got, want := args[len(args)-1], filepath.Join("a.app", "Contents", "MacOS", "a"); got != want {
+			t.Errorf("%v: got %v, want %v", tc.backend, got, want)
+		}
+	}
+
+	for _, cfg := range []buildtools.SigningConfig{
+		{Backend: "unknown", Identity: "id"},
+		{Backend: "codesign"},
+		{Backend: "rcodesign", Identity: "Developer ID Application: x"},
+	} {
+		_, err := cfg.Signer().SignPath("a.app", "").Run(ctx, dryRun)
+		if err == nil {
+			t.Errorf("%v: expected an error", cfg.Backend)
+		}
+	}
+}
+
+func TestCodesignArguments(t *testing.T) {
+	ctx := context.Background()
+	dryRun := buildtools.NewCommandRunner(buildtools.WithDryRun(true))
+	ent := buildtools.Entitlements{}
+	enabled := true
+
+	for _, tc := range []struct {
+		args     []string
+		hardened *bool
+		want     []string
+	}{
+		// Custom arguments replace the defaults, including --options runtime.
+		{[]string{"--deep"}, nil, []string{"--sign", "id", "--deep"}},
+		{[]string{"--deep"}, &enabled, []string{"--sign", "id", "--deep", "--options", "runtime"}},
+		{[]string{"--options=runtime,library"}, &enabled, []string{"--sign", "id", "--options=runtime,library"}},
+		{[]string{"-o=runtime"}, &enabled, []string{"--sign", "id", "-o=runtime"}},
+		{[]string{"-o", "runtime"}, &enabled, []string{"--sign", "id", "-o", "runtime"}},
+	} {
+		cfg := buildtools.SigningConfig{
+			Identity:          "id",
+			CodesignArguments: tc.args,
+			HardenedRuntime:   tc.hardened,
+			Entitlements:      &ent,
+		}
+		res, err := cfg.Signer().SignPath("a.app", "").Run(ctx, dryRun)
+		if err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+			continue
+		}
+		args := res.Args()
+		if i := slices.Index(args, "--entitlements"); i >= 0 {
+			args = args[:i]
+		}
+		if got, want := args, tc.want; !slices.Equal(got, want) {
+			t.Errorf("%v: got %v, want %v", tc.args, got, want)
+		}
+	}
+}
+
+const signingOptionsConfig = `
+identity: id
+options:
+  flags: [library, kill]
+  requirements: identifier "io.cloudeng.a" and anchor apple generic
+  timestamp: none
+  identifier: io.cloudeng.a
+  preserve-metadata: [entitlements]
+perfile_options:
+  helper:
+    flags: [hard]
+    requirements-file: helper.rqset
+    timestamp: http://timestamp.example.com
+`
+
+func TestSigningOptions(t *testing.T) {
+	ctx := context.Background()
+	dryRun := buildtools.NewCommandRunner(buildtools.WithDryRun(true))
+
+	var cfg buildtools.SigningConfig
+	if err := yaml.Unmarshal([]byte(signingOptionsConfig), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	argsFor := func(cfg buildtools.SigningConfig, path string) []string {
+		res, err := cfg.Signer().SignPath("a.app", path).Run(ctx, dryRun)
+		if err != nil {
+			t.Fatalf("%v: %v: %v", cfg.Backend, path, err)
+		}
+		args := res.Args()
+		// Strip the temporary entitlements file and the path.
+		if i := slices.Index(args, "--entitlements"); i >= 0 {
+			return args[:i]
+		}
+		if i := slices.Index(args, "--entitlements-xml-file"); i >= 0 {
+			return args[:i]
+		}
+		return args[:len(args)-1]
+	}
+
+	main := filepath.Join("Contents", "MacOS", "a")
+	helper := filepath.Join("Contents", "MacOS", "helper")
+	if got, want := argsFor(cfg, main), []string{"--sign", "id", "--force",
+		"--timestamp=none", "--options", "runtime,library,kill",
+		"--requirements", `=designated => identifier "io.cloudeng.a" and anchor apple generic`,
+		"--identifier", "io.cloudeng.a", "--preserve-metadata=entitlements"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := argsFor(cfg, helper), []string{"--sign", "id", "--force",
+		"--timestamp=http://timestamp.example.com", "--options", "runtime,hard",
+		"--requirements", "helper.rqset"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	cfg.Backend, cfg.Identity = "rcodesign", "-"
+	if got, want := argsFor(cfg, helper), []string{"sign",
+		"--code-signature-flags", "runtime", "--code-signature-flags", "hard",
+		"--code-requirements-path", "helper.rqset",
+		"--timestamp-url", "http://timestamp.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Requirement expressions are not supported by rcodesign or ad-hoc
+	// signing.
+	for _, backend := range []string{"rcodesign", "adhoc"} {
+		cfg.Backend = backend
+		_, err := cfg.Signer().SignPath("a.app", main).Run(ctx, dryRun)
+		if err == nil || !strings.Contains(err.Error(), "not support") {
+			t.Errorf("%v: unexpected or missing error: %v", backend, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		opts buildtools.SigningOptions
+		err  string
+	}{
+		{buildtools.SigningOptions{Flags: []string{"runtime"}}, "the runtime flag is controlled by the hardened runtime setting"},
+		{buildtools.SigningOptions{Flags: []string{"restrict"}}, `unsupported code signature flag "restrict"`},
+		{buildtools.SigningOptions{Requirements: "anchor apple", RequirementsFile: "r"}, "only one of requirements or requirements-file may be specified"},
+		{buildtools.SigningOptions{Timestamp: "timestamp.apple.com"}, "timestamp must be none or an http(s) URL"},
+		{buildtools.SigningOptions{Identifier: "io.cloudeng/a"}, "invalid identifier"},
+		{buildtools.SigningOptions{PreserveMetadata: []string{"resources"}}, `unsupported preserve-metadata value "resources"`},
+	} {
+		cfg := buildtools.SigningConfig{Identity: "id", Options: &tc.opts}
+		_, err := cfg.Signer().SignPath("a.app", main).Run(ctx, dryRun)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("unexpected or missing error: %v", err)
+		}
+	}
+
+	// Ad-hoc signing sets the flags and identifier in the CodeDirectory.
+	binary := buildDarwinBinary(t)
+	cfg = buildtools.SigningConfig{
+		Backend: "adhoc",
+		Options: &buildtools.SigningOptions{Flags: []string{"library", "kill"}, Identifier: "io.cloudeng.hello"},
+	}
+	if _, err := cfg.Signer().SignPath(binary, "").Run(ctx, buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := codesign.ParseFile(binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd := parsed[0].Signature.CodeDirectory
+	if got, want := cd.Identifier, "io.cloudeng.hello"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := cd.Flags, codesign.FlagAdhoc|codesign.FlagRuntime|codesign.FlagRequireLibraryValidation|codesign.FlagKill; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+const insideOutSigningConfig = `
+entitlements:
+  com.apple.security.app-sandbox: true
+perfile_entitlements:
+  helper:
+    com.apple.security.inherit: true
+  Service:
+    com.apple.security.network.client: true
+`
+
+func TestSignInsideOut(t *testing.T) {
+	ctx := context.Background()
+	binary := buildDarwinBinary(t)
+
+	var cfg buildtools.SigningConfig
+	if err := yaml.Unmarshal([]byte(insideOutSigningConfig), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	var info buildtools.InfoPlist
+	if err := yaml.Unmarshal([]byte(plistYAML), &info); err != nil {
+		t.Fatal(err)
+	}
+	bundle := buildtools.AppBundle{
+		Path: filepath.Join(t.TempDir(), "TestApp.app"),
+		Info: info,
+	}
+	service := buildtools.AppBundle{
+		Path: bundle.Contents("XPCServices", "Service.xpc"),
+		Info: buildtools.InfoPlist{
+			CFBundleExecutable: "Service",
+			Raw: map[string]any{
+				"CFBundleIdentifier":  info.CFBundleIdentifier + ".Service",
+				"CFBundleExecutable":  "Service",
+				"CFBundlePackageType": "XPC!",
+			},
+		},
+	}
+	runner := buildtools.NewRunner()
+	runner.AddSteps(bundle.Create()...)
+	runner.AddSteps(service.Create()...)
+	runner.AddSteps(
+		bundle.WriteInfoPlist(),
+		bundle.CopyExecutable(binary),
+		bundle.CopyContents(binary, "MacOS", "helper"),
+		service.WriteInfoPlist(),
+		service.CopyExecutable(binary),
+	)
+	if err := runner.Run(ctx, buildtools.NewCommandRunner()).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	signer := buildtools.NewSigner("-", cfg.Entitlements, cfg.PerFileEntitlements, nil,
+		buildtools.WithSigningBackend(buildtools.AdHocBackend{}))
+
+	res, err := bundle.SignInsideOut(signer).Run(ctx, buildtools.NewCommandRunner(buildtools.WithDryRun(true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.Output(), fmt.Sprintf(`1: %[1]v/Contents/MacOS/helper (mach-o)
+2: %[1]v/Contents/XPCServices/Service.xpc (xpc-service)
+3: %[1]v (app)
+`, bundle.Path); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	runner = buildtools.NewRunner()
+	runner.AddSteps(
+		bundle.SignInsideOut(signer),
+		signer.VerifyEntitlements(bundle.Path, filepath.Join("Contents", "MacOS", "helper")),
+		signer.VerifyEntitlements(bundle.Path, filepath.Join("Contents", "XPCServices", "Service.xpc", "Contents", "MacOS", "Service")),
+		signer.VerifyEntitlements(bundle.Path, filepath.Join("Contents", "MacOS", info.CFBundleExecutable)),
+		buildtools.VerifyPathOffline(bundle.Path, ""),
+	)
+	results := runner.Run(ctx, buildtools.NewCommandRunner())
+	if err := results.Error(); err != nil {
+		for _, r := range results {
+			t.Log(r.String())
+		}
+		t.Fatal(err)
+	}
+
+	// Unsignable files are reported and nothing is signed.
+	script := bundle.Contents("MacOS", "script.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0700); err != nil { //nolint:gosec // G306
+		t.Fatal(err)
+	}
+	res, err = bundle.SignInsideOut(signer).Run(ctx, buildtools.NewCommandRunner())
+	if err == nil || !strings.Contains(err.Error(), "1 file(s) cannot be signed") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+	if got, want := res.Output(), "unsignable: Contents/MacOS/script.sh: executable file in a code directory is not a Mach-O file\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
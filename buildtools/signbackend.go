@@ -0,0 +1,249 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloudeng.io/macos/buildtools/codesign"
+)
+
+// Names of the supported signing backends, as used in a SigningConfig.
+const (
+	SigningBackendCodesign  = "codesign"
+	SigningBackendRcodesign = "rcodesign"
+	SigningBackendAdHoc     = "adhoc"
+	SigningBackendNoop      = "noop"
+	SigningBackendRemote    = "remote"
+)
+
+// SigningRequest represents a single signing operation to be performed by
+// a SigningBackend.
+type SigningRequest struct {
+	// Path is the file or bundle to be signed.
+	Path string
+	// Identity is the signing identity, "-" requests an ad-hoc signature.
+	Identity string
+	// Entitlements, if non-nil, are the entitlements to be embedded.
+	Entitlements *Entitlements
+	// HardenedRuntime requests that the hardened runtime be enabled.
+	HardenedRuntime bool
+	// Arguments, if set, replace the backend's default arguments.
+	Arguments []string
+	// Options are typed signing options that each backend translates
+	// into its own arguments or settings.
+	Options SigningOptions
+}
+
+// SigningBackend represents a means of signing files and bundles.
+type SigningBackend interface {
+	// Name returns the name of the backend.
+	Name() string
+	// Sign performs the requested signing operation.
+	Sign(ctx context.Context, cmdRunner *CommandRunner, req SigningRequest) (StepResult, error)
+}
+
+// NewSigningBackend returns the SigningBackend with the specified name.
+// An empty name selects the codesign backend. The remote backend requires
+// configuration and must be created using NewRemoteBackend.
+func NewSigningBackend(name string) (SigningBackend, error) {
+	switch name {
+	case "", SigningBackendCodesign:
+		return CodesignBackend{}, nil
+	case SigningBackendRcodesign:
+		return RcodesignBackend{}, nil
+	case SigningBackendAdHoc:
+		return AdHocBackend{}, nil
+	case SigningBackendNoop:
+		return NoopBackend{}, nil
+	case SigningBackendRemote:
+		return nil, fmt.Errorf("the %v signing backend must be created using NewRemoteBackend", name)
+	}
+	return nil, fmt.Errorf("unsupported signing backend: %q", name)
+}
+
+// writeEntitlementsFile writes the specified entitlements to a temporary
+// file, it returns an empty filename if there are no entitlements.
+func writeEntitlementsFile(ent *Entitlements, path string) (string, error) {
+	if ent == nil {
+		return "", nil
+	}
+	data, err := ent.MarshalIndent("  ")
+	if err != nil {
+		return "", err
+	}
+	tmpFile, err := os.CreateTemp("", filepath.Base(path)+"entitlements.plist-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmpFile.Write(data); err != nil {
+		os.Remove(tmpFile.Name()) //nolint:errcheck
+		return "", err
+	}
+	name := tmpFile.Name()
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(name) //nolint:errcheck
+		return "", err
+	}
+	return name, nil
+}
+
+// runWithEntitlements runs the specified command, removing the entitlements
+// file once it has completed and including its contents in any error.
+func runWithEntitlements(ctx context.Context, cmdRunner *CommandRunner, entitlementsFile, name string, args ...string) (StepResult, error) {
+	if entitlementsFile != "" {
+		defer os.Remove(entitlementsFile) //nolint:errcheck
+	}
+	result, err := cmdRunner.Run(ctx, name, args...)
+	if err != nil && entitlementsFile != "" {
+		if ent, nerr := os.ReadFile(entitlementsFile); nerr == nil {
+			err = fmt.Errorf("%w; entitlements: %s", err, string(ent))
+		}
+	}
+	return result, err
+}
+
+// CodesignBackend signs using Apple's codesign command. Its default
+// arguments are --force and --timestamp, the timestamp server may be
+// changed, or disabled, using SigningOptions.
+type CodesignBackend struct{}
+
+// Name implements SigningBackend.
+func (CodesignBackend) Name() string {
+	return SigningBackendCodesign
+}
+
+// Sign implements SigningBackend.
+func (b CodesignBackend) Sign(ctx context.Context, cmdRunner *CommandRunner, req SigningRequest) (StepResult, error) {
+	if req.Identity == "" {
+		err := fmt.Errorf("no identity specified")
+		return NewStepResult(b.Name(), nil, nil, err), err
+	}
+	args := []string{"--sign", req.Identity}
+	if len(req.Arguments) == 0 {
+		args = append(args, "--force")
+	} else {
+		args = append(args, req.Arguments...)
+	}
+	args = append(args, req.Options.codesignArgs(req.HardenedRuntime, len(req.Arguments) == 0, req.Arguments)...)
+	entitlementsFile, err := writeEntitlementsFile(req.Entitlements, req.Path)
+	if err != nil {
+		err = fmt.Errorf("failed to create entitlements file: %w", err)
+		return NewStepResult(b.Name(), args, nil, err), err
+	}
+	if entitlementsFile != "" {
+		args = append(args, "--entitlements", entitlementsFile)
+	}
+	args = append(args, req.Path)
+	return runWithEntitlements(ctx, cmdRunner, entitlementsFile, "codesign", args...)
+}
+
+// RcodesignBackend signs using the open source rcodesign command
+// (https://github.com/indygreg/apple-platform-rs). The identity is
+// interpreted as follows: "-" requests an ad-hoc signature, a SHA-1
+// fingerprint selects a certificate from the macOS keychain and
+// a path ending in .p12 selects a PKCS#12 file, the password for
+// which must be supplied via the backend's arguments, for example,
+// --p12-password-file. It has no default arguments.
+type RcodesignBackend struct{}
+
+// Name implements SigningBackend.
+func (RcodesignBackend) Name() string {
+	return SigningBackendRcodesign
+}
+
+func isSHA1Fingerprint(id string) bool {
+	if len(id) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// Sign implements SigningBackend.
+func (b RcodesignBackend) Sign(ctx context.Context, cmdRunner *CommandRunner, req SigningRequest) (StepResult, error) {
+	args := []string{"sign"}
+	switch {
+	case req.Identity == "-":
+	case isSHA1Fingerprint(req.Identity):
+		args = append(args, "--keychain-fingerprint", req.Identity)
+	case strings.HasSuffix(req.Identity, ".p12"):
+		args = append(args, "--p12-file", req.Identity)
+	default:
+		err := fmt.Errorf("identity %q must be -, a SHA-1 fingerprint or a .p12 file", req.Identity)
+		return NewStepResult(b.Name(), args, nil, err), err
+	}
+	args = append(args, req.Arguments...)
+	opts, err := req.Options.rcodesignArgs(req.HardenedRuntime)
+	if err != nil {
+		return NewStepResult(b.Name(), args, nil, err), err
+	}
+	args = append(args, opts...)
+	entitlementsFile, err := writeEntitlementsFile(req.Entitlements, req.Path)
+	if err != nil {
+		err = fmt.Errorf("failed to create entitlements file: %w", err)
+		return NewStepResult(b.Name(), args, nil, err), err
+	}
+	if entitlementsFile != "" {
+		args = append(args, "--entitlements-xml-file", entitlementsFile)
+	}
+	args = append(args, req.Path)
+	return runWithEntitlements(ctx, cmdRunner, entitlementsFile, "rcodesign", args...)
+}
+
+// AdHocBackend creates ad-hoc signatures, ie. those created by codesign's
+// "-" identity, in pure Go without using any external commands. This allows
+// for bundles to be built and signed on platforms other than macOS.
+// The identity and arguments are ignored.
+type AdHocBackend struct{}
+
+// Name implements SigningBackend.
+func (AdHocBackend) Name() string {
+	return SigningBackendAdHoc
+}
+
+// Sign implements SigningBackend.
+func (AdHocBackend) Sign(_ context.Context, cmdRunner *CommandRunner, req SigningRequest) (StepResult, error) {
+	args := []string{"--sign", "-", req.Path}
+	opts, err := req.Options.adhocOptions(req.HardenedRuntime)
+	if err != nil {
+		return NewStepResult("codesign.Sign", args, nil, err), err
+	}
+	if cmdRunner.DryRun() {
+		return NewStepResult("codesign.Sign", args, nil, nil), nil
+	}
+	if req.Entitlements != nil {
+		data, err := req.Entitlements.MarshalIndent("\t")
+		if err != nil {
+			return NewStepResult("codesign.Sign", args, nil, err), err
+		}
+		opts.Entitlements = data
+	}
+	if fi, serr := os.Stat(req.Path); serr == nil && fi.IsDir() {
+		err = codesign.SignBundle(req.Path, opts)
+	} else {
+		err = codesign.SignFile(req.Path, opts)
+	}
+	return NewStepResult("codesign.Sign", args, nil, err), err
+}
+
+// NoopBackend does not sign anything, it is intended for development
+// and testing where signing is not required.
+type NoopBackend struct{}
+
+// Name implements SigningBackend.
+func (NoopBackend) Name() string {
+	return SigningBackendNoop
+}
+
+// Sign implements SigningBackend.
+func (NoopBackend) Sign(_ context.Context, _ *CommandRunner, req SigningRequest) (StepResult, error) {
+	return NewStepResult("noop: sign", []string{req.Path}, nil, nil), nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"cloudeng.io/macos/buildtools/codesign"
+	"gopkg.in/yaml.v3"
+)
+
+// Code signature flags, in addition to runtime which is controlled by
+// the hardened runtime setting, that may be specified in SigningOptions.
+const (
+	SignatureFlagLibrary = "library" // require library validation.
+	SignatureFlagKill    = "kill"    // kill the process if it becomes invalid.
+	SignatureFlagHard    = "hard"    // refuse to load invalid pages.
+)
+
+// TimestampNone disables the use of a timestamp server.
+const TimestampNone = "none"
+
+var (
+	signatureFlags   = []string{SignatureFlagLibrary, SignatureFlagKill, SignatureFlagHard}
+	preserveMetadata = []string{"identifier", "entitlements", "requirements", "flags", "runtime", "launch-constraints", "library-constraints"}
+)
+
+// SigningOptions represents typed signing options that are translated
+// into the equivalent arguments, or settings, for each signing backend.
+type SigningOptions struct {
+	// Flags are code signature flags to be set in addition to runtime,
+	// ie. any of library, kill or hard.
+	Flags []string `yaml:"flags,omitempty" json:"flags,omitempty"`
+	// Requirements is a designated requirement expression, eg.
+	// 'identifier "com.example.app" and anchor apple generic', or a
+	// complete requirement set that starts with 'designated =>'.
+	Requirements string `yaml:"requirements,omitempty" json:"requirements,omitempty"`
+	// RequirementsFile is the path of a file containing requirements,
+	// it may not be used with Requirements.
+	RequirementsFile string `yaml:"requirements-file,omitempty" json:"requirements_file,omitempty"`
+	// Timestamp is the URL of the timestamp server to use, or none to
+	// disable timestamps. The default is Apple's timestamp server.
+	Timestamp string `yaml:"timestamp,omitempty" json:"timestamp,omitempty"`
+	// Identifier overrides the signing identifier, which defaults to
+	// the bundle identifier or the file name.
+	Identifier string `yaml:"identifier,omitempty" json:"identifier,omitempty"`
+	// PreserveMetadata lists the existing signature metadata to be
+	// retained when re-signing, ie. any of identifier, entitlements,
+	// requirements, flags, runtime, launch-constraints or
+	// library-constraints.
+	PreserveMetadata []string `yaml:"preserve-metadata,omitempty" json:"preserve_metadata,omitempty"`
+}
+
+// Validate returns an error if any of the options are invalid.
+func (o SigningOptions) Validate() error {
+	for _, f := range o.Flags {
+		if f == "runtime" {
+			return fmt.Errorf("the runtime flag is controlled by the hardened runtime setting")
+		}
+		if !slices.Contains(signatureFlags, f) {
+			return fmt.Errorf("unsupported code signature flag %q, must be one of %v", f, strings.Join(signatureFlags, ", "))
+		}
+	}
+	if o.Requirements != "" && o.RequirementsFile != "" {
+		return fmt.Errorf("only one of requirements or requirements-file may be specified")
+	}
+	if ts := o.Timestamp; ts != "" && ts != TimestampNone {
+		u, err := url.Parse(ts)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("timestamp must be %v or an http(s) URL: %q", TimestampNone, ts)
+		}
+	}
+	if strings.ContainsAny(o.Identifier, " \t\n/") {
+		return fmt.Errorf("invalid identifier: %q", o.Identifier)
+	}
+	for _, p := range o.PreserveMetadata {
+		if !slices.Contains(preserveMetadata, p) {
+			return fmt.Errorf("unsupported preserve-metadata value %q, must be one of %v", p, strings.Join(preserveMetadata, ", "))
+		}
+	}
+	return nil
+}
+
+// designatedRequirement returns the requirement set text for the
+// Requirements option.
+func (o SigningOptions) designatedRequirement() string {
+	if strings.HasPrefix(strings.TrimSpace(o.Requirements), "designated") {
+		return o.Requirements
+	}
+	return "designated => " + o.Requirements
+}
+
+// codesignArgs returns the codesign arguments for the options. The
+// timestamp argument is only included if the default arguments are in
+// use or a timestamp option was specified.
+func (o SigningOptions) codesignArgs(hardenedRuntime, defaults bool, arguments []string) []string {
+	var args []string
+	switch o.Timestamp {
+	case "":
+		if defaults {
+			args = append(args, "--timestamp")
+		}
+	default:
+		args = append(args, "--timestamp="+o.Timestamp)
+	}
+	var flags []string
+	if hardenedRuntime {
+		flags = append(flags, "runtime")
+	}
+	flags = append(flags, o.Flags...)
+	if len(flags) > 0 && !slices.ContainsFunc(arguments, isOptionsArg) {
+		args = append(args, "--options", strings.Join(flags, ","))
+	}
+	switch {
+	case o.Requirements != "":
+		args = append(args, "--requirements", "="+o.designatedRequirement())
+	case o.RequirementsFile != "":
+		args = append(args, "--requirements", o.RequirementsFile)
+	}
+	if o.Identifier != "" {
+		args = append(args, "--identifier", o.Identifier)
+	}
+	if len(o.PreserveMetadata) > 0 {
+		args = append(args, "--preserve-metadata="+strings.Join(o.PreserveMetadata, ","))
+	}
+	return args
+}
+
+// isOptionsArg returns true if arg is codesign's --options (or -o) flag
+// in either its --options <flags> or --options=<flags> form.
+func isOptionsArg(arg string) bool {
+	name, _, _ := strings.Cut(arg, "=")
+	return name == "--options" || name == "-o"
+}
+
+// rcodesignArgs returns the rcodesign arguments for the options.
+func (o SigningOptions) rcodesignArgs(hardenedRuntime bool) ([]string, error) {
+	if o.Requirements != "" {
+		return nil, fmt.Errorf("rcodesign does not support requirement expressions, use a compiled requirements-file instead")
+	}
+	if len(o.PreserveMetadata) > 0 {
+		return nil, fmt.Errorf("rcodesign does not support preserve-metadata")
+	}
+	var args []string
+	if hardenedRuntime {
+		args = append(args, "--code-signature-flags", "runtime")
+	}
+	for _, f := range o.Flags {
+		if f == SignatureFlagLibrary {
+			f = "library-validation"
+		}
+		args = append(args, "--code-signature-flags", f)
+	}
+	if o.RequirementsFile != "" {
+		args = append(args, "--code-requirements-path", o.RequirementsFile)
+	}
+	if o.Timestamp != "" {
+		args = append(args, "--timestamp-url", o.Timestamp)
+	}
+	if o.Identifier != "" {
+		args = append(args, "--binary-identifier", o.Identifier)
+	}
+	return args, nil
+}
+
+// adhocOptions returns the codesign.SignOptions for the options, ad-hoc
+// signatures are never timestamped and hence the timestamp is ignored.
+func (o SigningOptions) adhocOptions(hardenedRuntime bool) (codesign.SignOptions, error) {
+	var opts codesign.SignOptions
+	if o.Requirements != "" || o.RequirementsFile != "" {
+		return opts, fmt.Errorf("ad-hoc signatures do not support requirements")
+	}
+	if len(o.PreserveMetadata) > 0 {
+		return opts, fmt.Errorf("ad-hoc signatures do not support preserve-metadata")
+	}
+	if hardenedRuntime {
+		opts.Flags |= codesign.FlagRuntime
+	}
+	for _, f := range o.Flags {
+		switch f {
+		case SignatureFlagLibrary:
+			opts.Flags |= codesign.FlagRequireLibraryValidation
+		case SignatureFlagKill:
+			opts.Flags |= codesign.FlagKill
+		case SignatureFlagHard:
+			opts.Flags |= codesign.FlagHard
+		}
+	}
+	opts.Identifier = o.Identifier
+	return opts, nil
+}
+
+// remoteOptions returns the options to be sent to a signing server, the
+// contents of any requirements file are sent rather than its path.
+func (o SigningOptions) remoteOptions() (SigningOptions, error) {
+	if o.RequirementsFile == "" {
+		return o, nil
+	}
+	data, err := os.ReadFile(o.RequirementsFile)
+	if err != nil {
+		return o, err
+	}
+	o.Requirements, o.RequirementsFile = string(data), ""
+	return o, nil
+}
+
+// PerFileSigningOptions represents signing options that are specific to
+// individual files within an app bundle. These are specified as YAML in
+// the same manner as PerFileEntitlements, the key is either the base name
+// of a file or its full path within the bundle and the options for the
+// most specific path replace, rather than being merged with, any global
+// options.
+type PerFileSigningOptions struct {
+	raw map[string]SigningOptions `yaml:",inline"`
+}
+
+func (o *PerFileSigningOptions) UnmarshalYAML(node *yaml.Node) error {
+	return node.Decode(&o.raw)
+}
+
+func (o PerFileSigningOptions) MarshalYAML() (any, error) {
+	return o.raw, nil
+}
+
+// For returns the options for the specified path, if any. It will first
+// look for the base name of the path and then the full path.
+func (o PerFileSigningOptions) For(path string) (SigningOptions, bool) {
+	if opts, ok := o.raw[filepath.Base(path)]; ok {
+		return opts, true
+	}
+	opts, ok := o.raw[path]
+	return opts, ok
+}
+
+// Validate returns an error if any of the per-file options are invalid.
+func (o PerFileSigningOptions) Validate() error {
+	paths := make([]string, 0, len(o.raw))
+	for path := range o.raw {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := o.raw[path].Validate(); err != nil {
+			return fmt.Errorf("%v: %w", path, err)
+		}
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -25,19 +26,32 @@ func WithStepTiming(timing bool) StepRunnerOption {
 	}
 }
 
+// WithCleanupTimeout sets the time allowed for the cleanup steps to run,
+// the default is DefaultCleanupTimeout.
+func WithCleanupTimeout(timeout time.Duration) StepRunnerOption {
+	return func(o *stepRunnerOptions) {
+		o.cleanupTimeout = timeout
+	}
+}
+
+// DefaultCleanupTimeout is the default time allowed for cleanup steps.
+const DefaultCleanupTimeout = time.Minute
+
 type stepRunnerOptions struct {
-	timing bool
+	timing         bool
+	cleanupTimeout time.Duration
 }
 
 // StepRunner manages and executes a series of Steps.
 type StepRunner struct {
 	options stepRunnerOptions
 	steps   []Step
+	cleanup []Step
 }
 
 // NewRunner creates a new StepRunner with the provided options.
 func NewRunner(opts ...StepRunnerOption) *StepRunner {
-	var options stepRunnerOptions
+	options := stepRunnerOptions{cleanupTimeout: DefaultCleanupTimeout}
 	for _, opt := range opts {
 		opt(&options)
 	}
@@ -101,15 +115,35 @@ func (le *StepResult) Duration() time.Duration {
 	return le.duration
 }
 
+// AddCleanupSteps adds one or more steps that are run after all of the
+// other steps have been run, even if one of those steps fails. All of the
+// cleanup steps are run, even if one of them fails. Cleanup steps are run
+// with a context that is not canceled when the context passed to Run is,
+// but which is subject to the timeout set by WithCleanupTimeout, so that
+// they run even when the build fails because it was canceled or timed out.
+func (r *StepRunner) AddCleanupSteps(steps ...Step) *StepRunner {
+	r.cleanup = append(r.cleanup, steps...)
+	return r
+}
+
 // RunResult captures the outcome of running the steps.
 type RunResult []StepResult
 
-// Error returns the last error encountered, if any.
+// Error returns the errors encountered, if any, in the order in which
+// they occurred. A single error is returned as is, multiple errors, such
+// as a failing step followed by a failing cleanup step, are joined with
+// the first failure first.
 func (r RunResult) Error() error {
-	if len(r) == 0 {
-		return nil
+	var errs []error
+	for i := range r {
+		if err := r[i].Error(); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	return r[len(r)-1].Error()
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
 }
 
 // Run executes all added steps in sequence and returns a RunResult.
@@ -118,6 +152,9 @@ func (r *StepRunner) Run(ctx context.Context, cmdRunner *CommandRunner) RunResul
 	start := time.Now()
 	for i, step := range r.steps {
 		result, err := step.Run(ctx, cmdRunner)
+		if err != nil && result.err == nil {
+			result.err = err
+		}
 		log = append(log, result)
 		if err != nil {
 			break
@@ -126,6 +163,15 @@ func (r *StepRunner) Run(ctx context.Context, cmdRunner *CommandRunner) RunResul
 			fmt.Fprintf(os.Stderr, "  step: %d: %v: %v\n", i, result.Duration(), result.CommandLine())
 		}
 	}
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.options.cleanupTimeout)
+	defer cancel()
+	for _, step := range r.cleanup {
+		result, err := step.Run(cleanupCtx, cmdRunner)
+		if err != nil && result.err == nil {
+			result.err = err
+		}
+		log = append(log, result)
+	}
 	if r.options.timing {
 		fmt.Fprintf(os.Stderr, "total: %v\n", time.Since(start))
 	}
@@ -12,9 +12,10 @@ import (
 
 // SwiftApp represents the swift build tool.
 type SwiftApp struct {
-	root    string
-	release bool
-	bindir  string
+	root      string
+	release   bool
+	bindir    string
+	buildArgs []string
 }
 
 // binDir returns the directory containing the swift build products.
@@ -49,6 +50,7 @@ func (s SwiftApp) Build() Step {
 	if s.release {
 		args = append(args, "--configuration", "release")
 	}
+	args = append(args, s.buildArgs...)
 	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
 		ctx = ContextWithCWD(ctx, s.root)
 		return cmdRunner.Run(ctx, "swift", args...)
@@ -0,0 +1,304 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BuildVersion represents the version of a bundle as derived from a git
+// repository by a Versioner.
+type BuildVersion struct {
+	// Short is the semantic version, eg. 1.2.3, derived from the latest
+	// semver tag and used for CFBundleShortVersionString.
+	Short string
+	// Build is the monotonically increasing build number used for
+	// CFBundleVersion.
+	Build string
+	// Tag is the tag that Short was derived from, if any.
+	Tag string
+	// Commit is the abbreviated hash of the HEAD commit.
+	Commit string
+	// Dirty is true if the working tree has uncommitted changes.
+	Dirty bool
+}
+
+// Semver returns the full semantic version, including the build number,
+// commit and dirty state as build metadata, eg. 1.2.3+42.1a2b3c4d.dirty.
+func (v BuildVersion) Semver() string {
+	meta := []string{v.Build}
+	if v.Commit != "" {
+		meta = append(meta, v.Commit)
+	}
+	if v.Dirty {
+		meta = append(meta, "dirty")
+	}
+	return v.Short + "+" + strings.Join(meta, ".")
+}
+
+func (v BuildVersion) String() string {
+	return v.Semver()
+}
+
+// ApplyToInfoPlist sets CFBundleShortVersionString and CFBundleVersion.
+// Neither may include a dirty marker since macOS requires both to consist
+// of period separated integers.
+func (v BuildVersion) ApplyToInfoPlist(info *InfoPlist) {
+	if info.Raw == nil {
+		info.Raw = map[string]any{}
+	}
+	info.CFBundleShortVersionString = v.Short
+	info.CFBundleVersion = v.Build
+	info.Raw["CFBundleShortVersionString"] = v.Short
+	info.Raw["CFBundleVersion"] = v.Build
+}
+
+// ApplyToPkgBuild sets the package version to the short version.
+func (v BuildVersion) ApplyToPkgBuild(p *PkgBuild) {
+	p.Version = v.Short
+}
+
+// LDFlags returns the linker flags required to set the string variables
+// Version, BuildNumber and Commit in the specified package (eg. main) to
+// Semver(), Build and Commit respectively, for use as:
+//
+//	go build -ldflags "$(LDFlags)"
+func (v BuildVersion) LDFlags(pkg string) string {
+	return fmt.Sprintf("-X %[1]v.Version=%[2]v -X %[1]v.BuildNumber=%[3]v -X %[1]v.Commit=%[4]v",
+		pkg, v.Semver(), v.Build, v.Commit)
+}
+
+// Versioner derives a BuildVersion from a git repository. The short
+// version is taken from the highest release semver tag, eg. v1.2.3,
+// that is reachable from HEAD, or 0.0.0 if there is none. The build
+// number is the number of commits reachable from HEAD unless a
+// CounterFile is specified.
+type Versioner struct {
+	Git Git
+	// TagPrefix is the prefix for semver tags, it defaults to "v". Tags
+	// without the prefix are also accepted.
+	TagPrefix string
+	// CounterFile, if set, is the name of a file that contains the
+	// previous build number, the build number is then that value plus
+	// one. The file is only updated by RecordBuildNumber, which should
+	// be run once the build has succeeded so that failed builds do not
+	// use up a number. This is useful when builds are made from multiple
+	// branches or from shallow clones where the commit count is not
+	// monotonic.
+	CounterFile string
+}
+
+var semverTagRE = regexp.MustCompile(`^([0-9]+)\.([0-9]+)\.([0-9]+)$`)
+
+// parseSemverTag returns the major, minor and patch numbers for a
+// release semver tag.
+func parseSemverTag(tag, prefix string) ([3]int, bool) {
+	var v [3]int
+	m := semverTagRE.FindStringSubmatch(strings.TrimPrefix(tag, prefix))
+	if m == nil {
+		return v, false
+	}
+	for i := range v {
+		v[i], _ = strconv.Atoi(m[i+1])
+	}
+	return v, true
+}
+
+// latestSemverTag returns the highest release semver tag in the output
+// of git tag.
+func latestSemverTag(output, prefix string) (string, string) {
+	var best [3]int
+	bestTag := ""
+	sc := bufio.NewScanner(strings.NewReader(output))
+	for sc.Scan() {
+		tag := strings.TrimSpace(sc.Text())
+		v, ok := parseSemverTag(tag, prefix)
+		if !ok {
+			continue
+		}
+		if bestTag == "" || v[0] > best[0] ||
+			(v[0] == best[0] && (v[1] > best[1] || (v[1] == best[1] && v[2] > best[2]))) {
+			best, bestTag = v, tag
+		}
+	}
+	if bestTag == "" {
+		return "", "0.0.0"
+	}
+	return bestTag, fmt.Sprintf("%d.%d.%d", best[0], best[1], best[2])
+}
+
+func (g Git) run(ctx context.Context, cmdRunner *CommandRunner, args ...string) (string, error) {
+	res, err := cmdRunner.Run(ContextWithCWD(ctx, g.dir), "git", args...)
+	if err != nil {
+		return "", fmt.Errorf("git %v: %w: %s", strings.Join(args, " "), err, res.Output())
+	}
+	return strings.TrimSpace(res.Output()), nil
+}
+
+// CommitCount returns the number of commits reachable from HEAD.
+func (g Git) CommitCount(ctx context.Context, cmdRunner *CommandRunner) (int, error) {
+	out, err := g.run(ctx, cmdRunner, "rev-list", "--count", "HEAD")
+	if err != nil || cmdRunner.DryRun() {
+		return 0, err
+	}
+	return strconv.Atoi(out)
+}
+
+// IsDirty returns true if the working tree has uncommitted changes to
+// tracked files.
+func (g Git) IsDirty(ctx context.Context, cmdRunner *CommandRunner) (bool, error) {
+	out, err := g.run(ctx, cmdRunner, "status", "--porcelain", "--untracked-files=no")
+	return len(out) > 0, err
+}
+
+// Version returns the version for the repository's current state.
+func (v Versioner) Version(ctx context.Context, cmdRunner *CommandRunner) (BuildVersion, error) {
+	prefix := v.TagPrefix
+	if prefix == "" {
+		prefix = "v"
+	}
+	var bv BuildVersion
+	tags, err := v.Git.run(ctx, cmdRunner, "tag", "--list", "--merged", "HEAD")
+	if err != nil {
+		return bv, err
+	}
+	bv.Tag, bv.Short = latestSemverTag(tags, prefix)
+	res, err := v.Git.Hash(ctx, cmdRunner, "HEAD", 8)
+	if err != nil {
+		return bv, err
+	}
+	bv.Commit = strings.TrimSpace(res.Output())
+	if bv.Dirty, err = v.Git.IsDirty(ctx, cmdRunner); err != nil {
+		return bv, err
+	}
+	var build int
+	if v.CounterFile != "" {
+		build, err = nextBuildNumber(v.CounterFile)
+	} else {
+		build, err = v.Git.CommitCount(ctx, cmdRunner)
+	}
+	if err != nil {
+		return bv, err
+	}
+	bv.Build = strconv.Itoa(build)
+	return bv, nil
+}
+
+// nextBuildNumber reads the previous build number from file, which need
+// not exist, and returns the incremented value.
+func nextBuildNumber(file string) (int, error) {
+	prev := 0
+	data, err := os.ReadFile(file)
+	switch {
+	case err == nil:
+		if prev, err = strconv.Atoi(strings.TrimSpace(string(data))); err != nil {
+			return 0, fmt.Errorf("invalid build number in %v: %w", file, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return 0, err
+	}
+	return prev + 1, nil
+}
+
+// RecordBuildNumber returns a Step that writes the build number in bv to
+// CounterFile. It should be the last step of a build so that the counter
+// is only advanced by successful builds. It does nothing if CounterFile
+// is not set.
+func (v Versioner) RecordBuildNumber(bv *BuildVersion) Step {
+	if v.CounterFile == "" {
+		return NoopStep("no build number counter file")
+	}
+	return StepFunc(func(_ context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		args := []string{v.CounterFile}
+		if cmdRunner.DryRun() {
+			return NewStepResult("record build number", args, nil, nil), nil
+		}
+		err := os.WriteFile(v.CounterFile, []byte(bv.Build+"\n"), 0644) //nolint:gosec // G306
+		return NewStepResult("record build number", args, nil, err), err
+	})
+}
+
+// Apply returns a Step that derives the version and applies it to the
+// specified InfoPlist and PkgBuild, either of which may be nil. Note that
+// steps such as AppBundle.WriteInfoPlist and PkgBuild.Build use the
+// values in effect when they are created rather than when they are run,
+// use VersionStep with AppBundle.WriteInfoPlistVersion,
+// Executable.WriteInfoPlistVersion or PkgBuild.BuildVersion to derive
+// and use the version in the same set of steps.
+func (v Versioner) Apply(info *InfoPlist, pkg *PkgBuild) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		bv, err := v.Version(ctx, cmdRunner)
+		if err != nil {
+			return NewStepResult("version", nil, nil, err), err
+		}
+		if info != nil {
+			bv.ApplyToInfoPlist(info)
+		}
+		if pkg != nil {
+			bv.ApplyToPkgBuild(pkg)
+		}
+		return NewStepResult("version", nil, []byte(bv.Semver()+"\n"), nil), nil
+	})
+}
+
+// VersionStep returns a Step that derives the version and stores it in bv
+// for use by subsequent steps, see AppBundle.WriteInfoPlistVersion and
+// Versioner.RecordBuildNumber.
+func (v Versioner) VersionStep(bv *BuildVersion) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		version, err := v.Version(ctx, cmdRunner)
+		if err != nil {
+			return NewStepResult("version", nil, nil, err), err
+		}
+		*bv = version
+		return NewStepResult("version", nil, []byte(bv.Semver()+"\n"), nil), nil
+	})
+}
+
+// WriteInfoPlistVersion returns a Step that writes the bundle's Info.plist
+// with the version obtained by a preceding Versioner.VersionStep.
+func (b AppBundle) WriteInfoPlistVersion(bv *BuildVersion) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		return writeInfoPlist(filepath.Join(b.Path, "Contents", "Info.plist"), withVersion(b.Info, bv)).Run(ctx, cmdRunner)
+	})
+}
+
+// WriteInfoPlistVersion is like AppBundle.WriteInfoPlistVersion but writes
+// the executable's Info.plist to the specified file, see
+// Executable.WriteInfoPlist.
+func (e Executable) WriteInfoPlistVersion(path string, bv *BuildVersion) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		return writeInfoPlist(path, withVersion(e.Info, bv)).Run(ctx, cmdRunner)
+	})
+}
+
+// BuildVersion is like Build but uses the version obtained by a
+// preceding Versioner.VersionStep.
+func (p PkgBuild) BuildVersion(outputPath string, bv *BuildVersion) Step {
+	return StepFunc(func(ctx context.Context, cmdRunner *CommandRunner) (StepResult, error) {
+		bv.ApplyToPkgBuild(&p)
+		args, err := p.buildArgs(outputPath)
+		if err != nil {
+			return NewStepResult("pkgbuild", nil, nil, err), err
+		}
+		return cmdRunner.Run(ctx, "pkgbuild", args...)
+	})
+}
+
+// withVersion returns a copy of info with the version applied to it.
+func withVersion(info InfoPlist, bv *BuildVersion) InfoPlist {
+	info.Raw = maps.Clone(info.Raw)
+	bv.ApplyToInfoPlist(&info)
+	return info
+}
@@ -0,0 +1,215 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package buildtools_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloudeng.io/macos/buildtools"
+)
+
+func gitCommit(ctx context.Context, t *testing.T, runner *buildtools.CommandRunner, dir, content string, tags ...string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"add", "file.txt"},
+		{"commit", "-m", content},
+	} {
+		if res, err := runner.Run(ctx, "git", args...); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, res.Output())
+		}
+	}
+	for _, tag := range tags {
+		if res, err := runner.Run(ctx, "git", "tag", tag); err != nil {
+			t.Fatalf("git tag %v: %v: %s", tag, err, res.Output())
+		}
+	}
+}
+
+func TestVersioner(t *testing.T) {
+	dir := t.TempDir()
+	runner := buildtools.NewCommandRunner()
+	ctx := buildtools.ContextWithCWD(t.Context(), dir)
+	initGitRepo(ctx, t, runner, dir)
+
+	v := buildtools.Versioner{Git: buildtools.NewGit(dir)}
+	version := func() buildtools.BuildVersion {
+		t.Helper()
+		bv, err := v.Version(ctx, runner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bv
+	}
+
+	gitCommit(ctx, t, runner, dir, "one")
+	bv := version()
+	if got, want := bv.Short+" "+bv.Build, "0.0.0 1"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(bv.Commit) != 8 || bv.Dirty || bv.Tag != "" {
+		t.Errorf("unexpected version: %+v", bv)
+	}
+
+	gitCommit(ctx, t, runner, dir, "two", "v1.2.0", "v1.10.0", "1.9.0", "v2.0.0-rc1", "release")
+	gitCommit(ctx, t, runner, dir, "three")
+	bv = version()
+	if got, want := bv.Short+" "+bv.Build+" "+bv.Tag, "1.10.0 3 v1.10.0"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := bv.Semver(), "1.10.0+3."+bv.Commit; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("modified"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bv = version()
+	if !bv.Dirty || !strings.HasSuffix(bv.Semver(), ".dirty") {
+		t.Errorf("expected a dirty version: %v", bv)
+	}
+
+	// A persisted counter is only advanced when the build number is
+	// recorded, and not in dry-run mode.
+	v.CounterFile = filepath.Join(t.TempDir(), "build-number")
+	for _, want := range []string{"1", "1"} {
+		if got := version().Build; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	var recorded buildtools.BuildVersion
+	steps := buildtools.NewRunner().AddSteps(v.VersionStep(&recorded), v.RecordBuildNumber(&recorded))
+	if err := steps.Run(ctx, runner).Error(); err != nil {
+		t.Fatal(err)
+	}
+	info := buildtools.InfoPlist{}
+	pkg := buildtools.PkgBuild{}
+	if _, err := v.Apply(&info, &pkg).Run(ctx, runner); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.CFBundleShortVersionString+" "+info.CFBundleVersion+" "+pkg.Version, "1.10.0 2 1.10.0"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := info.Raw["CFBundleVersion"], any("2"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := info.Validate(); err != nil {
+		t.Error(err)
+	}
+	recorded.Build = "7"
+	if _, err := v.RecordBuildNumber(&recorded).Run(ctx, buildtools.NewCommandRunner(buildtools.WithDryRun(true))); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(v.CounterFile); err != nil || string(data) != "1\n" {
+		t.Errorf("unexpected counter file contents: %q: %v", data, err)
+	}
+	if err := os.WriteFile(v.CounterFile, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Version(ctx, runner); err == nil || !strings.Contains(err.Error(), "invalid build number") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+
+	// The linker flags set the version variables in a Go binary.
+	src := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(src, []byte(`package main
+
+import "fmt"
+
+var Version, BuildNumber, Commit string
+
+func main() {
+	fmt.Print(Version, " ", BuildNumber, " ", Commit)
+}
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(t.TempDir(), "version")
+	cmd := exec.Command("go", "build", "-ldflags", bv.LDFlags("main"), "-o", bin, src)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v: %s", err, out)
+	}
+	out, err := exec.Command(bin).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(out), bv.Semver()+" "+bv.Build+" "+bv.Commit; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestVersionSteps(t *testing.T) {
+	dir := t.TempDir()
+	runner := buildtools.NewCommandRunner()
+	ctx := buildtools.ContextWithCWD(t.Context(), dir)
+	initGitRepo(ctx, t, runner, dir)
+	gitCommit(ctx, t, runner, dir, "one", "v1.2.3")
+	gitCommit(ctx, t, runner, dir, "two")
+
+	// Use a fake pkgbuild that records its arguments.
+	bin := t.TempDir()
+	log := filepath.Join(dir, "pkgbuild.log")
+	if err := os.WriteFile(filepath.Join(bin, "pkgbuild"), []byte("#!/bin/sh\necho \"$@\" > "+log+"\n"), 0755); err != nil { //nolint:gosec // G306
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	bundle := buildtools.AppBundle{
+		Path: filepath.Join(t.TempDir(), "TestApp.app"),
+		Info: unmarshalInfoPlist(t, plistYAML),
+	}
+	pkg := buildtools.PkgBuild{
+		BuildDir:        t.TempDir(),
+		Identifier:      "io.cloudeng.TestApp",
+		InstallLocation: "/Applications",
+	}
+	var bv buildtools.BuildVersion
+	v := buildtools.Versioner{Git: buildtools.NewGit(dir)}
+	steps := buildtools.NewRunner()
+	steps.AddSteps(v.VersionStep(&bv))
+	steps.AddSteps(bundle.Create()...)
+	steps.AddSteps(bundle.WriteInfoPlistVersion(&bv), pkg.BuildVersion("TestApp.pkg", &bv))
+	if err := steps.Run(ctx, runner).Error(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bv.Short+" "+bv.Build, "1.2.3 2"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	data, err := os.ReadFile(bundle.Contents("Info.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<key>CFBundleShortVersionString</key>\n\t\t<string>1.2.3</string>",
+		"<key>CFBundleVersion</key>\n\t\t<string>2</string>",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s does not contain %q", data, want)
+		}
+	}
+	if bundle.Info.Raw["CFBundleVersion"] == "2" {
+		t.Errorf("original Info.plist was modified")
+	}
+	data, err = os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "--version 1.2.3 ") {
+		t.Errorf("%s does not contain the version", data)
+	}
+
+	// Without a version, the package cannot be built.
+	_, err = pkg.BuildVersion("TestApp.pkg", &buildtools.BuildVersion{}).Run(ctx, runner)
+	if err == nil || !strings.Contains(err.Error(), "Version is not set") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"cloudeng.io/macos/buildtools"
+	"cloudeng.io/macos/buildtools/provisioning"
 	"gopkg.in/yaml.v3"
 )
 
@@ -30,25 +32,97 @@ func newBundle(cfg config) bundle {
 	}
 }
 
+// provisioningProfile returns the path of the configured provisioning
+// profile. The profile may be specified as a path or as the name or UUID
+// of a profile installed in the user's provisioning profile directory.
+func (b bundle) provisioningProfile() (string, error) {
+	profile := os.ExpandEnv(b.cfg.ProvisioningProfile)
+	if profile == "" {
+		return "", nil
+	}
+	if _, err := os.Stat(profile); err == nil || !os.IsNotExist(err) {
+		return profile, err
+	}
+	store, err := provisioning.NewStore("")
+	if err != nil {
+		return "", err
+	}
+	installed, err := store.Lookup(profile, time.Now())
+	if err != nil {
+		return "", err
+	}
+	printf("using provisioning profile: %v\n", installed.Path)
+	return installed.Path, nil
+}
+
+// writeConfig returns a Step that writes the configuration, including
+// any git metadata obtained by a preceding step, to Resources/gobundle.yml.
+func (b bundle) writeConfig(md *buildtools.GitMetadata) buildtools.Step {
+	return buildtools.StepFunc(func(ctx context.Context, cmdRunner *buildtools.CommandRunner) (buildtools.StepResult, error) {
+		cfg := b.cfg
+		if md.Commit != "" {
+			cfg.Git = md
+		}
+		configData, err := yaml.Marshal(cfg)
+		if err != nil {
+			err = fmt.Errorf("error marshaling config: %v", err)
+			return buildtools.NewStepResult("write gobundle.yml", nil, nil, err), err
+		}
+		return buildtools.WriteFile(configData, 0644, b.ap.Resources("gobundle.yml")).Run(ctx, cmdRunner)
+	})
+}
+
 func (b bundle) createAndSign(ctx context.Context, binary string) error {
-	configData, err := yaml.Marshal(b.cfg)
+	profile, err := b.provisioningProfile()
 	if err != nil {
-		return fmt.Errorf("error marshaling config: %v", err)
+		return fmt.Errorf("error locating provisioning profile: %v", err)
+	}
+	if b.cfg.Localizations != nil {
+		b.ap = b.ap.WithLocalizations(*b.cfg.Localizations)
+	}
+	var md buildtools.GitMetadata
+	if b.cfg.GitMetadata {
+		b.stepRunner.AddSteps(buildtools.NewGit(".").MetadataStep(&md))
+	}
+	b.stepRunner.AddSteps(b.ap.ValidateInfoPlist())
+	if b.cfg.Localizations != nil {
+		b.stepRunner.AddSteps(b.ap.ValidateLocalizations(*b.cfg.Localizations))
 	}
 	b.stepRunner.AddSteps(b.ap.Clean())
 	b.stepRunner.AddSteps(b.ap.Create()...)
-	if b.cfg.ProvisioningProfile != "" {
-		profile := os.ExpandEnv(b.cfg.ProvisioningProfile)
-		b.stepRunner.AddSteps(b.ap.CopyContents(profile, "embedded.provisionprofile"))
-	}
-	b.stepRunner.AddSteps(
-		buildtools.WriteFile(configData, 0644,
-			b.ap.Resources("gobundle.yml")))
-	b.stepRunner.AddSteps(b.ap.WriteInfoPlist(),
-		b.ap.CopyExecutable(binary))
-
-	if b.cfg.Identity != "" {
-		signer := b.cfg.Signer()
+	if profile != "" {
+		// The profile is validated before it is installed.
+		b.stepRunner.AddSteps(b.ap.InstallProvisioningProfile(profile))
+	}
+	b.stepRunner.AddSteps(b.writeConfig(&md))
+	if b.cfg.GitMetadata {
+		b.stepRunner.AddSteps(b.ap.WriteInfoPlistGitMetadata(&md))
+	} else {
+		b.stepRunner.AddSteps(b.ap.WriteInfoPlist())
+	}
+	b.stepRunner.AddSteps(b.ap.CopyExecutable(binary))
+	if b.cfg.PrivacyManifest != nil {
+		b.stepRunner.AddSteps(b.ap.WritePrivacyManifest(*b.cfg.PrivacyManifest))
+	}
+	if b.cfg.Localizations != nil {
+		b.stepRunner.AddSteps(b.ap.WriteLocalizations(*b.cfg.Localizations)...)
+	}
+
+	if b.cfg.Identity != "" || b.cfg.Backend != "" {
+		signingConfig := b.cfg.SigningConfig
+		if profile != "" && b.cfg.DeriveEntitlements {
+			ent, err := buildtools.DeriveEntitlements(profile, b.ap.Info.CFBundleIdentifier, signingConfig.Entitlements)
+			if err != nil {
+				return fmt.Errorf("error deriving entitlements from %v: %v", profile, err)
+			}
+			signingConfig.Entitlements = ent
+		}
+		signer := signingConfig.Signer()
+		b.stepRunner.AddSteps(signer.CheckIdentity())
+		if profile != "" {
+			b.stepRunner.AddSteps(signer.CheckEntitlements(profile))
+		}
+		b.stepRunner.AddSteps(signer.CheckPrivacy(b.ap))
 		b.stepRunner.AddSteps(
 			b.ap.SignExecutable(signer),
 			b.ap.Sign(signer),
@@ -23,12 +23,48 @@
 //	The config file format is as follows:
 //
 //	    identity:       - signing identity
-//	    codesign-args:  - array of additional arguments to codesign
+//	    backend:        - signing backend: codesign (default), rcodesign, adhoc, noop or remote
+//	    remote:         - url, token or token-file and ca-file for the remote signing backend,
+//	                      served by cmd/signing-server
+//	    codesign-args:  - array of arguments that replace the signing backend's
+//	                      default arguments
+//	    hardened-runtime: - enable the hardened runtime, defaults to true unless
+//	                      codesign-args is set
+//	    options:        - typed signing options: flags (library, kill, hard), requirements,
+//	                      requirements-file, timestamp (a URL or none), identifier and
+//	                      preserve-metadata
+//	    perfile_options: - signing options for specific files, keyed by file name or path
 //	    bundle:         - path to the app bundle to create, if empty <binary>.app is used
 //	    profile:        - path to the provisioning profile to embed in the app bundle,
-//	                      it can include environment variables
+//	                      it can include environment variables. If no such file exists
+//	                      it is treated as the name or UUID of a profile installed in
+//	                      ~/Library/Developer/Xcode/UserData/Provisioning Profiles
+//	    derive-entitlements: - if true, the minimal entitlements required by the profile are
+//	                          added to the configured entitlements
+//	    git-metadata:   - if true, the commit, branch, nearest tag, dirty state, commit time
+//	                      and remote URL of the git repository in the current directory
+//	                      are added to the Info.plist (as Git* keys) and to
+//	                      Resources/gobundle.yml
+//	    embed-info-plist: - if true, build and install embed the Info.plist in the
+//	                      executable's __TEXT,__info_plist section (using cgo and
+//	                      external linking) and sign the executable itself rather
+//	                      than creating an app bundle. A profile cannot be used.
+//	    version:        - if set, the version is derived from the semver tags of the git
+//	                      repository in the current directory and used for CFBundleShortVersionString
+//	                      and CFBundleVersion and to set the Version, BuildNumber and Commit
+//	                      variables, via -ldflags, in package (default main). tag-prefix (default v)
+//	                      and counter-file (for a persistent build number) may also be set.
 //	    entitlements:   - a dictionary of entitlements to embed in the app
-//	    info.plist:     - a dictionary of fields that correspond to info.Plist entries.
+//	    info.plist:     - a dictionary of fields that correspond to info.Plist entries,
+//	                      common keys are validated and likely misspellings reported.
+//	    privacy-manifest: - the privacy manifest to write to Resources/PrivacyInfo.xcprivacy:
+//	                      tracking, tracking-domains, collected-data (type, linked,
+//	                      tracking, purposes) and accessed-apis (type, reasons)
+//	    localizations:  - the localization table used to create Resources/<language>.lproj:
+//	                      development-region, format (utf16 or binary) and languages, each
+//	                      with info.plist (eg. CFBundleDisplayName and usage descriptions)
+//	                      and strings, written to InfoPlist.strings and Localizable.strings.
+//	                      Keys missing from any language are reported.
 //
 //	For example:
 //	    identity: "Apple Development: You (Your Team ID)"
@@ -24,9 +24,16 @@ const (
 
 type config struct {
 	buildtools.SigningConfig `yaml:",inline"`
-	Path                     string               `yaml:"bundle"`
-	Info                     buildtools.InfoPlist `yaml:"info.plist"`
-	ProvisioningProfile      string               `yaml:"profile"`
+	Path                     string                      `yaml:"bundle"`
+	Info                     buildtools.InfoPlist        `yaml:"info.plist"`
+	PrivacyManifest          *buildtools.PrivacyManifest `yaml:"privacy-manifest,omitempty"`
+	Localizations            *buildtools.Localizations   `yaml:"localizations,omitempty"`
+	ProvisioningProfile      string                      `yaml:"profile"`
+	DeriveEntitlements       bool                        `yaml:"derive-entitlements,omitempty"`
+	GitMetadata              bool                        `yaml:"git-metadata,omitempty"`
+	EmbedInfoPlist           bool                        `yaml:"embed-info-plist,omitempty"`
+	Version                  *versionConfig              `yaml:"version,omitempty"`
+	Git                      *buildtools.GitMetadata     `yaml:"git,omitempty"`
 }
 
 func readconfig(file string) (map[string]any, error) {
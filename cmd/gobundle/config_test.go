@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"cloudeng.io/macos/buildtools"
 	"gopkg.in/yaml.v3"
 )
 
@@ -148,3 +149,33 @@ func parseConfig(t *testing.T, merged []byte) config {
 	}
 	return cfg
 }
+
+func TestLocalizationsConfig(t *testing.T) {
+	cfg := parseConfig(t, []byte(`
+info.plist:
+  CFBundleIdentifier: io.cloudeng.Example
+localizations:
+  development-region: en
+  format: binary
+  languages:
+    en:
+      info.plist:
+        CFBundleDisplayName: Example
+    de:
+      info.plist:
+        CFBundleDisplayName: Beispiel
+`))
+	l := cfg.Localizations
+	if l == nil {
+		t.Fatal("localizations were not set")
+	}
+	if got, want := l.Format, buildtools.StringsBinary; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := l.Languages["de"].InfoPlist["CFBundleDisplayName"], "Beispiel"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := l.Validate(); err != nil {
+		t.Error(err)
+	}
+}
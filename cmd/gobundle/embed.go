@@ -0,0 +1,95 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"cloudeng.io/macos/buildtools"
+)
+
+// buildWithEmbeddedInfoPlist runs go build or go install, as specified by
+// verb, with the configured Info.plist embedded in the executable's
+// __TEXT,__info_plist section rather than creating an app bundle. The
+// executable is verified to contain the Info.plist and is then signed.
+func buildWithEmbeddedInfoPlist(ctx context.Context, cfg config, verb, binary string, args []string) error {
+	if cfg.ProvisioningProfile != "" {
+		return fmt.Errorf("a provisioning profile cannot be used with embed-info-plist")
+	}
+	tmpDir, err := os.MkdirTemp("", "gobundle-info-plist")
+	if err != nil {
+		return fmt.Errorf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	infoPlist := filepath.Join(tmpDir, "Info.plist")
+
+	exe := buildtools.Executable{Path: binary, Info: cfg.Info}
+	runner := buildtools.NewRunner()
+	var md buildtools.GitMetadata
+	if cfg.GitMetadata {
+		runner.AddSteps(buildtools.NewGit(".").MetadataStep(&md))
+	}
+	runner.AddSteps(exe.ValidateInfoPlist(), exe.WriteInfoPlistGitMetadata(infoPlist, &md))
+	if err := runSteps(ctx, runner); err != nil {
+		return err
+	}
+
+	args = withLDFlags(args, buildtools.EmbeddedInfoPlistLDFlags(infoPlist))
+	if err := rungo(ctx, append([]string{verb}, args...)); err != nil {
+		return err
+	}
+	if _, err := os.Stat(binary); err != nil {
+		return fmt.Errorf("error finding expected binary: %v: %v", binary, err)
+	}
+
+	runner = buildtools.NewRunner()
+	runner.AddSteps(exe.VerifyInfoPlist())
+	if cfg.Identity != "" || cfg.Backend != "" {
+		signer := cfg.SigningConfig.Signer()
+		runner.AddSteps(signer.CheckIdentity(), exe.Sign(signer))
+	}
+	return runSteps(ctx, runner)
+}
+
+func runSteps(ctx context.Context, runner *buildtools.StepRunner) error {
+	results := runner.Run(ctx, buildtools.NewCommandRunner())
+	for _, r := range results {
+		printf("%s\n%s", r.CommandLine(), r.Output())
+	}
+	return results.Error()
+}
+
+// withLDFlags returns a copy of args with ldflags appended to the value of
+// any existing -ldflags option, or with a new -ldflags option otherwise.
+func withLDFlags(args []string, ldflags string) []string {
+	args = slices.Clone(args)
+	for i := 0; i < len(args); i++ {
+		arg, val, hasVal := strings.Cut(args[i], "=")
+		name := "-" + strings.TrimLeft(arg, "-")
+		if name == "-ldflags" {
+			if hasVal {
+				args[i] = arg + "=" + val + " " + ldflags
+				return args
+			}
+			if i+1 < len(args) {
+				args[i+1] += " " + ldflags
+				return args
+			}
+		}
+		n, ok := buildArgs[name]
+		if !ok {
+			break
+		}
+		if !hasVal && n != 0 {
+			i++ // skip the flag's value.
+		}
+	}
+	return append([]string{"-ldflags", ldflags}, args...)
+}
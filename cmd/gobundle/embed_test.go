@@ -0,0 +1,51 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithLDFlags(t *testing.T) {
+	const flags = "-linkmode=external"
+	for _, tc := range []struct {
+		args, want []string
+	}{
+		{nil, []string{"-ldflags", flags}},
+		{[]string{"./cmd/tool"}, []string{"-ldflags", flags, "./cmd/tool"}},
+		{[]string{"-o", "bin/tool", "-ldflags", "-s -w", "."},
+			[]string{"-o", "bin/tool", "-ldflags", "-s -w " + flags, "."}},
+		{[]string{"-trimpath", "-ldflags=-s -w", "."},
+			[]string{"-trimpath", "-ldflags=-s -w " + flags, "."}},
+		{[]string{"--ldflags=-X main.v=1"}, []string{"--ldflags=-X main.v=1 " + flags}},
+		// -ldflags after the packages is not an option.
+		{[]string{".", "-ldflags", "-s"}, []string{"-ldflags", flags, ".", "-ldflags", "-s"}},
+		// The value of -tags is not mistaken for -ldflags.
+		{[]string{"-tags", "-ldflags", "."}, []string{"-ldflags", flags, "-tags", "-ldflags", "."}},
+	} {
+		if got, want := withLDFlags(tc.args, flags), tc.want; !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %q, want %q", tc.args, got, want)
+		}
+	}
+}
+
+func TestEmbedInfoPlistConfig(t *testing.T) {
+	cfg := parseConfig(t, []byte(`
+embed-info-plist: true
+profile: example.provisionprofile
+info.plist:
+  CFBundleIdentifier: io.cloudeng.tool
+`))
+	if !cfg.EmbedInfoPlist {
+		t.Errorf("embed-info-plist was not set")
+	}
+	err := buildWithEmbeddedInfoPlist(context.Background(), cfg, "build", "binary", nil)
+	if err == nil || !strings.Contains(err.Error(), "a provisioning profile cannot be used") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+}
@@ -10,21 +10,37 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"cloudeng.io/macos/buildtools"
 )
 
 func handleGoBuild(ctx context.Context, merged []byte, args []string) error {
 	dashO, rest := consumeBuildArgs(args)
 	binary := determineBuildBinary(dashO, rest)
+	cfg, err := configForGoBuild(binary, dashO, merged)
+	if err != nil {
+		return fmt.Errorf("error processing config for go build: %v", err)
+	}
+	args, record, err := applyVersion(ctx, &cfg, args)
+	if err != nil {
+		return err
+	}
+	if err := goBuild(ctx, cfg, binary, args); err != nil || record == nil {
+		return err
+	}
+	return runSteps(ctx, buildtools.NewRunner().AddSteps(record))
+}
+
+func goBuild(ctx context.Context, cfg config, binary string, args []string) error {
+	if cfg.EmbedInfoPlist {
+		return buildWithEmbeddedInfoPlist(ctx, cfg, "build", binary, args)
+	}
 	if err := rungo(ctx, append([]string{"build"}, args...)); err != nil {
 		return err
 	}
 	if _, err := os.Stat(binary); err != nil {
 		return fmt.Errorf("error finding expected binary: %v: %v", binary, err)
 	}
-	cfg, err := configForGoBuild(binary, dashO, merged)
-	if err != nil {
-		return fmt.Errorf("error processing config for go build: %v", err)
-	}
 	b := newBundle(cfg)
 	if err := b.createAndSign(ctx, binary); err != nil {
 		return err
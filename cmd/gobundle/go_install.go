@@ -9,24 +9,40 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"cloudeng.io/macos/buildtools"
 )
 
 func handleGoInstall(ctx context.Context, merged []byte, args []string) error {
 	_, rest := consumeBuildArgs(args)
 	installDir, binary := deterimineInstallBinary(rest)
+	cfg, err := configForGoInstall(installDir, binary, merged)
+	if err != nil {
+		return fmt.Errorf("error processing config for go install: %v", err)
+	}
 	if err := os.Remove(binary); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("error removing original binary: %v", err)
 	}
+	args, record, err := applyVersion(ctx, &cfg, args)
+	if err != nil {
+		return err
+	}
+	if err := goInstall(ctx, cfg, binary, args); err != nil || record == nil {
+		return err
+	}
+	return runSteps(ctx, buildtools.NewRunner().AddSteps(record))
+}
+
+func goInstall(ctx context.Context, cfg config, binary string, args []string) error {
+	if cfg.EmbedInfoPlist {
+		return buildWithEmbeddedInfoPlist(ctx, cfg, "install", binary, args)
+	}
 	if err := rungo(ctx, append([]string{"install"}, args...)); err != nil {
 		return err
 	}
 	if _, err := os.Stat(binary); err != nil {
 		return fmt.Errorf("error finding expected binary: %v: %v", binary, err)
 	}
-	cfg, err := configForGoInstall(installDir, binary, merged)
-	if err != nil {
-		return fmt.Errorf("error processing config for go install: %v", err)
-	}
 	b := newBundle(cfg)
 	if err := b.createAndSign(ctx, binary); err != nil {
 		return err
@@ -0,0 +1,53 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"cloudeng.io/macos/buildtools"
+)
+
+// versionConfig specifies how the version is derived from the git
+// repository in the current directory, see buildtools.Versioner.
+type versionConfig struct {
+	TagPrefix   string `yaml:"tag-prefix,omitempty"`
+	CounterFile string `yaml:"counter-file,omitempty"`
+	// Package is the package whose Version, BuildNumber and Commit
+	// variables are set via -ldflags, it defaults to main.
+	Package string `yaml:"package,omitempty"`
+}
+
+// applyVersion derives the version, if one is configured, and applies it
+// to the configured Info.plist. It returns args with the linker flags
+// required to set the version variables in the Go binary added to them
+// and, if a counter file is configured, a step that records the build
+// number in it, which is to be run once the build has succeeded.
+func applyVersion(ctx context.Context, cfg *config, args []string) ([]string, buildtools.Step, error) {
+	if cfg.Version == nil {
+		return args, nil, nil
+	}
+	v := buildtools.Versioner{
+		Git:         buildtools.NewGit("."),
+		TagPrefix:   cfg.Version.TagPrefix,
+		CounterFile: cfg.Version.CounterFile,
+	}
+	bv, err := v.Version(ctx, buildtools.NewCommandRunner())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error determining version: %v", err)
+	}
+	printf("Version: %v\n", bv)
+	bv.ApplyToInfoPlist(&cfg.Info)
+	pkg := cfg.Version.Package
+	if pkg == "" {
+		pkg = "main"
+	}
+	args = withLDFlags(args, bv.LDFlags(pkg))
+	if v.CounterFile == "" {
+		return args, nil, nil
+	}
+	return args, v.RecordBuildNumber(&bv), nil
+}
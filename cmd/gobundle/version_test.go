@@ -0,0 +1,80 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloudeng.io/macos/buildtools"
+)
+
+func TestVersionConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for _, args := range [][]string{
+		{"init"},
+		{"config", "user.name", "Test User"},
+		{"config", "user.email", "test@example.com"},
+		{"commit", "--allow-empty", "-m", "one"},
+		{"tag", "v1.2.3"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Skipf("git %v: %v: %s", args, err, out)
+		}
+	}
+	cfg := parseConfig(t, []byte(`
+version:
+  package: example.com/tool/version
+info.plist:
+  CFBundleIdentifier: io.cloudeng.tool
+`))
+	args, record, err := applyVersion(context.Background(), &cfg, []string{"-o", "tool", "."})
+	if err != nil || record != nil {
+		t.Fatalf("unexpected record step or error: %v: %v", record, err)
+	}
+	if got, want := cfg.Info.CFBundleShortVersionString+" "+cfg.Info.CFBundleVersion, "1.2.3 1"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := cfg.Info.Raw["CFBundleVersion"], any("1"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(args) != 5 || args[0] != "-ldflags" || !reflect.DeepEqual(args[2:], []string{"-o", "tool", "."}) {
+		t.Fatalf("unexpected args: %q", args)
+	}
+	if !strings.HasPrefix(args[1], "-X example.com/tool/version.Version=1.2.3+1.") {
+		t.Errorf("unexpected ldflags: %v", args[1])
+	}
+
+	// The counter file is only written by the record step.
+	cfg = parseConfig(t, []byte(`
+version:
+  counter-file: build-number
+info.plist:
+  CFBundleIdentifier: io.cloudeng.tool
+`))
+	_, record, err = applyVersion(context.Background(), &cfg, []string{"."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("build-number"); !os.IsNotExist(err) {
+		t.Errorf("counter file written before the build: %v", err)
+	}
+	if _, err := record.Run(context.Background(), buildtools.NewCommandRunner()); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile("build-number"); err != nil || string(data) != "1\n" {
+		t.Errorf("unexpected counter file contents: %q: %v", data, err)
+	}
+
+	cfg = parseConfig(t, []byte("info.plist:\n  CFBundleIdentifier: io.cloudeng.tool\n"))
+	if args, record, err := applyVersion(context.Background(), &cfg, []string{"."}); err != nil || record != nil || !reflect.DeepEqual(args, []string{"."}) {
+		t.Errorf("unexpected args, record step or error: %v: %v: %v", args, record, err)
+	}
+}
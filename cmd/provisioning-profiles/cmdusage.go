@@ -0,0 +1,9 @@
+// Usage of provisioning-profiles
+//
+//	manage locally installed provisioning profiles
+//
+//	          list - list installed provisioning profiles
+//	       install - install provisioning profiles under their UUIDs
+//	remove-expired - remove expired provisioning profiles
+//	        select - print the path of the best provisioning profile for a bundle identifier
+package main
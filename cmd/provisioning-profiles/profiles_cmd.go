@@ -0,0 +1,158 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloudeng.io/cmdutil/subcmd"
+	"cloudeng.io/macos/buildtools/provisioning"
+)
+
+const cmdSpec = `name: provisioning-profiles
+summary: manage locally installed provisioning profiles
+commands:
+  - name: list
+    summary: list installed provisioning profiles
+    arguments:
+  - name: install
+    summary: install provisioning profiles under their UUIDs
+    arguments:
+      - <filename>...
+  - name: remove-expired
+    summary: remove expired provisioning profiles
+    arguments:
+  - name: select
+    summary: print the path of the best provisioning profile for a bundle identifier
+    arguments:
+      - <bundle-id>
+`
+
+func cli() *subcmd.CommandSetYAML {
+	cmd := subcmd.MustFromYAML(cmdSpec)
+	var profilesCmd profilesCmd
+	cmd.Set("list").MustRunner(profilesCmd.List, &ListFlags{})
+	cmd.Set("install").MustRunner(profilesCmd.Install, &StoreFlags{})
+	cmd.Set("remove-expired").MustRunner(profilesCmd.RemoveExpired, &RemoveFlags{})
+	cmd.Set("select").MustRunner(profilesCmd.Select, &SelectFlags{})
+	return cmd
+}
+
+func main() {
+	ctx := context.Background()
+	subcmd.Dispatch(ctx, cli())
+}
+
+type profilesCmd struct{}
+
+type StoreFlags struct {
+	Dir string `subcmd:"dir,,'directory containing installed profiles, defaults to ~/Library/Developer/Xcode/UserData/Provisioning Profiles'"`
+}
+
+type ListFlags struct {
+	StoreFlags
+	Name          string        `subcmd:"name,,list profiles with this name"`
+	UUID          string        `subcmd:"uuid,,list the profile with this UUID"`
+	TeamID        string        `subcmd:"team,,list profiles for this team identifier"`
+	AppID         string        `subcmd:"app-id,,'list profiles with this application identifier or bundle identifier pattern, eg. com.example.app or *'"`
+	Expired       bool          `subcmd:"expired,false,list only expired profiles"`
+	ExpiresWithin time.Duration `subcmd:"expires-within,0s,list only profiles that expire within this duration"`
+}
+
+type RemoveFlags struct {
+	StoreFlags
+	DryRun bool `subcmd:"dry-run,false,list the expired profiles without removing them"`
+}
+
+type SelectFlags struct {
+	StoreFlags
+	TeamID string `subcmd:"team,,team identifier that the profile must belong to"`
+}
+
+func (pc profilesCmd) print(installed []provisioning.Installed, now time.Time) {
+	for _, p := range installed {
+		state := "valid"
+		if p.Expired(now) {
+			state = "expired"
+		}
+		fmt.Printf("%v (%v)\n", p.Profile, state)
+	}
+}
+
+func (pc profilesCmd) List(_ context.Context, f any, _ []string) error {
+	fl := f.(*ListFlags)
+	store, err := provisioning.NewStore(fl.Dir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	filter := provisioning.Filter{
+		Name:   fl.Name,
+		UUID:   fl.UUID,
+		TeamID: fl.TeamID,
+		AppID:  fl.AppID,
+	}
+	if fl.Expired {
+		filter.ExpiresBefore = now
+	}
+	if fl.ExpiresWithin > 0 {
+		filter.ExpiresAfter = now
+		filter.ExpiresBefore = now.Add(fl.ExpiresWithin)
+	}
+	installed, err := store.List(filter)
+	pc.print(installed, now)
+	return err
+}
+
+func (pc profilesCmd) Install(_ context.Context, f any, args []string) error {
+	fl := f.(*StoreFlags)
+	store, err := provisioning.NewStore(fl.Dir)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		p, err := store.Install(arg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("installed %q as %v\n", p.Name, p.Path)
+	}
+	return nil
+}
+
+func (pc profilesCmd) RemoveExpired(_ context.Context, f any, _ []string) error {
+	fl := f.(*RemoveFlags)
+	store, err := provisioning.NewStore(fl.Dir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if fl.DryRun {
+		installed, err := store.List(provisioning.Filter{ExpiresBefore: now})
+		pc.print(installed, now)
+		return err
+	}
+	removed, err := store.RemoveExpired(now)
+	for _, p := range removed {
+		fmt.Printf("removed %v\n", p.Profile)
+	}
+	return err
+}
+
+func (pc profilesCmd) Select(_ context.Context, f any, args []string) error {
+	fl := f.(*SelectFlags)
+	store, err := provisioning.NewStore(fl.Dir)
+	if err != nil {
+		return err
+	}
+	p, err := store.Select(args[0], fl.TeamID, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Println(p.Path)
+	return nil
+}
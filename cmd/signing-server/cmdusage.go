@@ -0,0 +1,8 @@
+// Usage of signing-server
+//
+//	run a remote signing server on the Mac that holds the signing identities so that
+//	build machines, running any operating system, can sign files and bundles using
+//	the remote signing backend.
+//
+//	serve - serve signing requests until interrupted, TLS is required unless listening on a loopback address or unix socket
+package main
@@ -0,0 +1,137 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+
+	"cloudeng.io/cmdutil/subcmd"
+	"cloudeng.io/macos/buildtools"
+	"gopkg.in/yaml.v3"
+)
+
+const cmdSpec = `name: signing-server
+summary: run a remote signing server on the Mac that holds the signing
+  identities so that build machines, running any operating system, can
+  sign files and bundles using the remote signing backend.
+commands:
+  - name: serve
+    summary: serve signing requests until interrupted, TLS is required unless listening on a loopback address or unix socket
+    arguments:
+`
+
+func cli() *subcmd.CommandSetYAML {
+	cmd := subcmd.MustFromYAML(cmdSpec)
+	var serverCmd serverCmd
+	cmd.Set("serve").MustRunner(serverCmd.Serve, &ServeFlags{})
+	return cmd
+}
+
+func main() {
+	ctx := context.Background()
+	subcmd.Dispatch(ctx, cli())
+}
+
+type serverCmd struct{}
+
+type ServeFlags struct {
+	Address    string `subcmd:"address,127.0.0.1:8443,'address to listen on, either host:port or unix:///path/to/socket'"`
+	Tokens     string `subcmd:"tokens,,'yaml file that maps the names of clients to their authentication tokens'"`
+	Identities string `subcmd:"identities,,'comma separated list of the signing identities that clients may request'"`
+	Backend    string `subcmd:"backend,codesign,'signing backend to use, one of codesign, rcodesign or adhoc'"`
+	TLSCert    string `subcmd:"tls-cert,,file containing the PEM encoded certificate for the server"`
+	TLSKey     string `subcmd:"tls-key,,file containing the PEM encoded private key for the certificate"`
+	MaxSize    int64  `subcmd:"max-size,1073741824,maximum size in bytes of the archives that clients may upload"`
+	AuditLog   string `subcmd:"audit-log,,'file that the JSON audit log is appended to, defaults to stderr'"`
+}
+
+// readTokens reads a yaml file that maps client names to tokens and
+// returns the tokens mapped to client names as required by
+// buildtools.NewSigningServer.
+func readTokens(filename string) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var clients map[string]string
+	if err := yaml.Unmarshal(data, &clients); err != nil {
+		return nil, fmt.Errorf("%v: %w", filename, err)
+	}
+	tokens := map[string]string{}
+	for client, token := range clients {
+		if token == "" {
+			return nil, fmt.Errorf("%v: no token specified for client %q", filename, client)
+		}
+		if other, ok := tokens[token]; ok {
+			return nil, fmt.Errorf("%v: clients %q and %q use the same token", filename, other, client)
+		}
+		tokens[token] = client
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%v: no tokens specified", filename)
+	}
+	return tokens, nil
+}
+
+func listen(address string) (net.Listener, error) {
+	if socket, ok := strings.CutPrefix(address, "unix://"); ok {
+		return net.Listen("unix", socket)
+	}
+	return net.Listen("tcp", address)
+}
+
+func (sc serverCmd) Serve(ctx context.Context, f any, _ []string) error {
+	fl := f.(*ServeFlags)
+	if fl.Tokens == "" {
+		return fmt.Errorf("--tokens must be specified")
+	}
+	tokens, err := readTokens(fl.Tokens)
+	if err != nil {
+		return err
+	}
+	backend, err := buildtools.NewSigningBackend(fl.Backend)
+	if err != nil {
+		return err
+	}
+	opts := []buildtools.SigningServerOption{buildtools.WithMaxRequestSize(fl.MaxSize)}
+	if fl.Identities != "" {
+		opts = append(opts, buildtools.WithAllowedIdentities(strings.Split(fl.Identities, ",")...))
+	}
+	if fl.TLSCert != "" || fl.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(fl.TLSCert, fl.TLSKey)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, buildtools.WithTLSConfig(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}))
+	}
+	var audit io.Writer = os.Stderr
+	if fl.AuditLog != "" {
+		f, err := os.OpenFile(fl.AuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		audit = f
+	}
+	logger := slog.New(slog.NewJSONHandler(audit, nil))
+	srv := buildtools.NewSigningServer(backend, tokens, logger, opts...)
+	ln, err := listen(fl.Address)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	fmt.Fprintf(os.Stderr, "serving signing requests using the %v backend on %v\n", backend.Name(), ln.Addr())
+	return srv.Serve(ctx, ln)
+}
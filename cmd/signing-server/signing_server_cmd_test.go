@@ -0,0 +1,63 @@
+// Copyright 2025 cloudeng llc. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadTokens(t *testing.T) {
+	dir := t.TempDir()
+	write := func(contents string) string {
+		filename := filepath.Join(dir, "tokens.yml")
+		if err := os.WriteFile(filename, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	tokens, err := readTokens(write("linux-builder: token-a\nwindows-builder: token-b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(tokens), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := tokens["token-a"], "linux-builder"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, tc := range []struct {
+		contents, err string
+	}{
+		{"a: token\nb: token\n", "use the same token"},
+		{"a: ''\n", `no token specified for client "a"`},
+		{"{}\n", "no tokens specified"},
+	} {
+		if _, err := readTokens(write(tc.contents)); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: unexpected or missing error: %v", tc.contents, err)
+		}
+	}
+}
+
+func TestServeRequiresTLS(t *testing.T) {
+	tokens := filepath.Join(t.TempDir(), "tokens.yml")
+	if err := os.WriteFile(tokens, []byte("client: token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var sc serverCmd
+	err := sc.Serve(context.Background(), &ServeFlags{
+		Address: ":0",
+		Tokens:  tokens,
+		Backend: "adhoc",
+		MaxSize: 1 << 20,
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), "TLS must be configured") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+}
@@ -5,6 +5,7 @@ go 1.25.5
 require (
 	cloudeng.io/aws v0.0.0-20251210231338-d661eee74313
 	cloudeng.io/cmdutil v0.0.0-20251210231338-d661eee74313
+	cloudeng.io/file v0.0.0-20251210231338-d661eee74313
 	cloudeng.io/linux v0.0.0-20251206055912-df09039c8e99
 	cloudeng.io/logging v0.0.0-20251210231338-d661eee74313
 	cloudeng.io/os v0.0.0-20251210231338-d661eee74313
@@ -18,7 +19,6 @@ require (
 )
 
 require (
-	cloudeng.io/file v0.0.0-20251210231338-d661eee74313 // indirect
 	github.com/aws/aws-sdk-go-v2/config v1.32.5 // indirect
 	github.com/aws/aws-sdk-go-v2/credentials v1.19.5 // indirect
 	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.18.16 // indirect